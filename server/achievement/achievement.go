@@ -0,0 +1,209 @@
+// Package achievement decides which achievements a finished game unlocks.
+// Achievements are declared as data: each rule lists conditions on the
+// facts of a game and of the player's running totals, and is unlocked by a
+// game that meets all of them. The rules shipped with the server are in
+// rules.json.
+package achievement
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+)
+
+// Facts that conditions can refer to. A condition on a fact that is missing
+// from a game's facts is never met.
+const (
+	FactGameType      = "game_type"
+	FactWon           = "won"
+	FactScore         = "score"
+	FactTimeInSeconds = "time_in_seconds"
+	FactCellsRevealed = "cells_revealed"
+	FactFlagsUsed     = "flags_used"
+	FactGamesPlayed   = "games_played"
+	FactGamesWon      = "games_won"
+	FactWinStreak     = "win_streak"
+)
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindBool
+	kindNumber
+)
+
+var factKinds = map[string]kind{
+	FactGameType:      kindString,
+	FactWon:           kindBool,
+	FactScore:         kindNumber,
+	FactTimeInSeconds: kindNumber,
+	FactCellsRevealed: kindNumber,
+	FactFlagsUsed:     kindNumber,
+	FactGamesPlayed:   kindNumber,
+	FactGamesWon:      kindNumber,
+	FactWinStreak:     kindNumber,
+}
+
+// Comparison operators. Strings and booleans only support eq and ne.
+const (
+	OpEq  = "eq"
+	OpNe  = "ne"
+	OpLt  = "lt"
+	OpLte = "lte"
+	OpGt  = "gt"
+	OpGte = "gte"
+)
+
+type Rule struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Conditions  []Condition `json:"conditions"`
+}
+
+type Condition struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value any    `json:"value"`
+}
+
+// Facts describes a finished game. Numbers are ints, as in the game
+// records, and are compared with the float64 values decoded from the rules.
+type Facts map[string]any
+
+//go:embed rules.json
+var rulesJSON []byte
+
+var defaultRules = mustParse(rulesJSON)
+
+// Rules returns the achievements shipped with the server.
+func Rules() []Rule {
+	return defaultRules
+}
+
+func mustParse(data []byte) []Rule {
+	rules, err := Parse(data)
+	if err != nil {
+		panic(fmt.Sprintf("achievement: invalid rules.json: %v", err))
+	}
+	return rules
+}
+
+// Parse decodes a JSON array of rules, rejecting duplicate IDs, unknown
+// facts and conditions whose operator or value does not suit their fact.
+func Parse(data []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if rule.ID == "" || rule.Name == "" {
+			return nil, fmt.Errorf("rule %q needs an id and a name", rule.ID)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("duplicate rule %q", rule.ID)
+		}
+		seen[rule.ID] = true
+		if len(rule.Conditions) == 0 {
+			return nil, fmt.Errorf("rule %q has no conditions", rule.ID)
+		}
+		for _, cond := range rule.Conditions {
+			if err := cond.validate(); err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rule.ID, err)
+			}
+		}
+	}
+	return rules, nil
+}
+
+func (c Condition) validate() error {
+	k, ok := factKinds[c.Field]
+	if !ok {
+		return fmt.Errorf("unknown field %q", c.Field)
+	}
+
+	switch c.Op {
+	case OpEq, OpNe:
+	case OpLt, OpLte, OpGt, OpGte:
+		if k != kindNumber {
+			return fmt.Errorf("field %q cannot be compared with %s", c.Field, c.Op)
+		}
+	default:
+		return fmt.Errorf("unknown operator %q", c.Op)
+	}
+
+	var valid bool
+	switch k {
+	case kindString:
+		_, valid = c.Value.(string)
+	case kindBool:
+		_, valid = c.Value.(bool)
+	case kindNumber:
+		_, valid = c.Value.(float64)
+	}
+	if !valid {
+		return fmt.Errorf("field %q cannot be compared with %v", c.Field, c.Value)
+	}
+	return nil
+}
+
+// Evaluate returns the rules whose conditions facts all meet.
+func Evaluate(rules []Rule, facts Facts) []Rule {
+	var met []Rule
+	for _, rule := range rules {
+		if rule.met(facts) {
+			met = append(met, rule)
+		}
+	}
+	return met
+}
+
+func (r Rule) met(facts Facts) bool {
+	for _, cond := range r.Conditions {
+		if !cond.met(facts) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) met(facts Facts) bool {
+	fact, ok := facts[c.Field]
+	if !ok {
+		return false
+	}
+
+	if n, ok := fact.(int); ok {
+		want, ok := c.Value.(float64)
+		if !ok {
+			return false
+		}
+		v := float64(n)
+		switch c.Op {
+		case OpEq:
+			return v == want
+		case OpNe:
+			return v != want
+		case OpLt:
+			return v < want
+		case OpLte:
+			return v <= want
+		case OpGt:
+			return v > want
+		case OpGte:
+			return v >= want
+		}
+		return false
+	}
+
+	switch c.Op {
+	case OpEq:
+		return fact == c.Value
+	case OpNe:
+		return fact != c.Value
+	}
+	return false
+}
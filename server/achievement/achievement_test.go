@@ -0,0 +1,94 @@
+package achievement
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRules(t *testing.T) {
+	rules := Rules()
+	require.NotEmpty(t, rules)
+	for _, rule := range rules {
+		assert.NotEmpty(t, rule.Description, rule.ID)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		expectedErr string
+	}{
+		{name: "Valid", data: `[{"id": "a", "name": "A", "conditions": [{"field": "score", "op": "gte", "value": 10}]}]`},
+		{name: "Malformed", data: `{`, expectedErr: "unexpected end of JSON input"},
+		{name: "Missing Name", data: `[{"id": "a", "conditions": [{"field": "won", "op": "eq", "value": true}]}]`, expectedErr: `rule "a" needs an id and a name`},
+		{name: "Duplicate", data: `[{"id": "a", "name": "A", "conditions": [{"field": "won", "op": "eq", "value": true}]}, {"id": "a", "name": "B", "conditions": [{"field": "won", "op": "eq", "value": true}]}]`, expectedErr: `duplicate rule "a"`},
+		{name: "No Conditions", data: `[{"id": "a", "name": "A", "conditions": []}]`, expectedErr: `rule "a" has no conditions`},
+		{name: "Unknown Field", data: `[{"id": "a", "name": "A", "conditions": [{"field": "lives", "op": "eq", "value": 1}]}]`, expectedErr: `rule "a": unknown field "lives"`},
+		{name: "Unknown Operator", data: `[{"id": "a", "name": "A", "conditions": [{"field": "score", "op": "between", "value": 1}]}]`, expectedErr: `rule "a": unknown operator "between"`},
+		{name: "Ordered Bool", data: `[{"id": "a", "name": "A", "conditions": [{"field": "won", "op": "gt", "value": true}]}]`, expectedErr: `rule "a": field "won" cannot be compared with gt`},
+		{name: "Wrong Value Type", data: `[{"id": "a", "name": "A", "conditions": [{"field": "score", "op": "eq", "value": "high"}]}]`, expectedErr: `rule "a": field "score" cannot be compared with high`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := Parse([]byte(tt.data))
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, rules, 1)
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	ids := func(rules []Rule) []string {
+		var ids []string
+		for _, rule := range rules {
+			ids = append(ids, rule.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name     string
+		facts    Facts
+		expected []string
+	}{
+		{
+			name:     "Fast Win Without Flags",
+			facts:    Facts{FactGameType: "normal", FactWon: true, FactTimeInSeconds: 85, FactFlagsUsed: 0, FactGamesPlayed: 1, FactWinStreak: 1},
+			expected: []string{"first_win", "normal_under_100s", "no_flags"},
+		},
+		{
+			name:     "Slow Win Without Flag Count",
+			facts:    Facts{FactGameType: "normal", FactWon: true, FactTimeInSeconds: 100, FactGamesPlayed: 2, FactWinStreak: 2},
+			expected: []string{"first_win"},
+		},
+		{
+			name:     "Loss",
+			facts:    Facts{FactGameType: "normal", FactWon: false, FactTimeInSeconds: 20, FactFlagsUsed: 0, FactGamesPlayed: 3, FactWinStreak: 0},
+			expected: nil,
+		},
+		{
+			name:     "Long Infinite Run",
+			facts:    Facts{FactGameType: "infinite", FactWon: false, FactCellsRevealed: 10000, FactGamesPlayed: 4},
+			expected: []string{"infinite_10000_cells"},
+		},
+		{
+			name:     "Streak And Milestone",
+			facts:    Facts{FactGameType: "normal", FactWon: true, FactTimeInSeconds: 300, FactGamesPlayed: 100, FactWinStreak: 10},
+			expected: []string{"first_win", "win_streak_10", "games_played_100"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ids(Evaluate(Rules(), tt.facts)))
+		})
+	}
+}
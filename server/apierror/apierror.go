@@ -0,0 +1,119 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Code is a stable, machine-readable error identifier. Clients should switch
+// on the code rather than parse the message, which may change.
+type Code string
+
+const (
+	CodeInvalidRequest     Code = "invalid_request"
+	CodeValidationFailed   Code = "validation_failed"
+	CodeMissingToken       Code = "missing_token"
+	CodeInvalidToken       Code = "invalid_token"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeForbidden          Code = "forbidden"
+	CodeAccountBanned      Code = "account_banned"
+	CodeNotFound           Code = "not_found"
+	CodeUsernameTaken      Code = "username_taken"
+	CodeTournamentClosed   Code = "tournament_closed"
+	CodeTournamentFull     Code = "tournament_full"
+	CodeAlreadyRegistered  Code = "already_registered"
+	CodeAlreadyFriends     Code = "already_friends"
+	CodeRequestPending     Code = "friend_request_pending"
+	CodeUserBlocked        Code = "user_blocked"
+	CodeChallengeClosed    Code = "challenge_closed"
+	CodeUnavailable        Code = "service_unavailable"
+	CodeInternal           Code = "internal_error"
+)
+
+// FieldError describes a problem with a single request field.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// Error is an error that knows how it should be presented to API clients.
+// The wrapped cause is logged but never sent in the response.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Details []FieldError
+	Cause   error
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Response is the JSON body written for every error. "error" keeps the
+// human-readable message for backwards compatibility with older clients.
+type Response struct {
+	Error   string       `json:"error"`
+	Code    Code         `json:"code"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+func (e *Error) Response() Response {
+	return Response{Error: e.Message, Code: e.Code, Details: e.Details}
+}
+
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeInvalidRequest, message)
+}
+
+func Validation(message string, details ...FieldError) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeValidationFailed, Message: message, Details: details}
+}
+
+func Unauthorized(code Code, message string) *Error {
+	return New(http.StatusUnauthorized, code, message)
+}
+
+func Forbidden(code Code, message string) *Error {
+	return New(http.StatusForbidden, code, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(code Code, message string) *Error {
+	return New(http.StatusConflict, code, message)
+}
+
+func Unavailable(message string) *Error {
+	return New(http.StatusServiceUnavailable, CodeUnavailable, message)
+}
+
+// Internal wraps an unexpected failure. The message is shown to the client
+// and the cause is only logged.
+func Internal(message string, cause error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: message, Cause: cause}
+}
+
+// From converts any error into an *Error, treating errors that are not
+// already API errors as internal failures.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return Internal("Internal server error", err)
+}
@@ -0,0 +1,53 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report validation failures using the JSON field names clients send
+	// rather than Go struct field names.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// FromBinding converts an error returned by gin's ShouldBind* methods into a
+// client-facing error without exposing raw decoder or validator text.
+func FromBinding(err error) *Error {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		details := make([]FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			details = append(details, FieldError{Field: fieldErr.Field(), Reason: fieldErr.Tag()})
+		}
+		return Validation("Request validation failed", details...)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return Validation("Request validation failed", FieldError{Field: typeErr.Field, Reason: "type"})
+	}
+
+	if errors.Is(err, io.EOF) {
+		return BadRequest("Request body is required")
+	}
+
+	return BadRequest("Request body is not valid JSON")
+}
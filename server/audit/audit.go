@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type EventType string
+
+const (
+	EventUserRegistered      EventType = "user.registered"
+	EventLoginSucceeded      EventType = "auth.login"
+	EventLoginFailed         EventType = "auth.login_failed"
+	EventGuestSessionCreated EventType = "auth.guest_session"
+	EventGameRecordSaved     EventType = "game.record_saved"
+
+	EventAdminUserBanned          EventType = "admin.user_banned"
+	EventAdminUserUnbanned        EventType = "admin.user_unbanned"
+	EventAdminUserRenamed         EventType = "admin.user_renamed"
+	EventAdminUserRecordsReset    EventType = "admin.user_records_reset"
+	EventAdminLeaderboardDeleted  EventType = "admin.leaderboard_deleted"
+	EventAdminLeaderboardHidden   EventType = "admin.leaderboard_hidden"
+	EventAdminLeaderboardUnhidden EventType = "admin.leaderboard_unhidden"
+	EventAdminTournamentCreated   EventType = "admin.tournament_created"
+	EventAdminTournamentCancelled EventType = "admin.tournament_cancelled"
+)
+
+const (
+	CollectionName = "audit_log"
+
+	// collectionMaxBytes bounds the capped collection; once full, Mongo
+	// discards the oldest events first.
+	collectionMaxBytes = 64 * 1024 * 1024
+	queueSize          = 256
+)
+
+var (
+	mu     sync.RWMutex
+	events chan models.AuditEvent
+	wg     sync.WaitGroup
+	logger = slog.Default()
+)
+
+// Start creates the capped audit collection if needed and starts the
+// background writer. Events recorded before Start are dropped.
+func Start(l *slog.Logger) {
+	if err := ensureCollection(config.DB); err != nil {
+		l.Warn("could not create audit log collection", slog.Any("error", err))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	logger = l
+	events = make(chan models.AuditEvent, queueSize)
+	wg.Add(1)
+	go writer(events)
+}
+
+// Stop flushes queued events and waits for the writer to exit, giving up
+// when ctx is done.
+func Stop(ctx context.Context) error {
+	mu.Lock()
+	if events != nil {
+		close(events)
+		events = nil
+	}
+	mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Healthy reports whether the background writer is running and keeping up
+// with recorded events.
+func Healthy(ctx context.Context) error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if events == nil {
+		return errors.New("audit writer is not running")
+	}
+	if len(events) >= cap(events)*9/10 {
+		return errors.New("audit queue is backed up")
+	}
+	return nil
+}
+
+func ensureCollection(db *mongo.Database) error {
+	opts := options.CreateCollection().SetCapped(true).SetSizeInBytes(collectionMaxBytes)
+	err := db.CreateCollection(context.Background(), CollectionName, opts)
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceExists" {
+		return nil
+	}
+	return err
+}
+
+func writer(queue <-chan models.AuditEvent) {
+	defer wg.Done()
+
+	collection := config.GetCollection(CollectionName)
+	for event := range queue {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if _, err := collection.InsertOne(ctx, event); err != nil {
+			logger.Error("failed to write audit event", slog.String("type", event.Type), slog.Any("error", err))
+		}
+		cancel()
+	}
+}
+
+// Record queues an event for the request in c. actorID identifies who
+// performed the action and may be empty, e.g. for a failed login.
+func Record(c *gin.Context, eventType EventType, actorID string, targetID string, payload map[string]any) {
+	enqueue(newEvent(c, eventType, actorID, targetID, payload))
+}
+
+func newEvent(c *gin.Context, eventType EventType, actorID string, targetID string, payload map[string]any) models.AuditEvent {
+	return models.AuditEvent{
+		ID:        primitive.NewObjectID(),
+		Type:      string(eventType),
+		ActorID:   actorID,
+		TargetID:  targetID,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	}
+}
+
+func enqueue(event models.AuditEvent) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if events == nil {
+		return
+	}
+
+	select {
+	case events <- event:
+	default:
+		logger.Warn("audit queue full, dropping event", slog.String("type", event.Type))
+	}
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	resp := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(resp)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+	c.Request.RemoteAddr = "203.0.113.7:5000"
+	c.Request.Header.Set("User-Agent", "test-agent")
+
+	event := newEvent(c, EventLoginFailed, "", "user123", map[string]any{"reason": "wrong_password"})
+
+	assert.False(t, event.ID.IsZero())
+	assert.Equal(t, "auth.login_failed", event.Type)
+	assert.Empty(t, event.ActorID)
+	assert.Equal(t, "user123", event.TargetID)
+	assert.Equal(t, "203.0.113.7", event.IP)
+	assert.Equal(t, "test-agent", event.UserAgent)
+	assert.Equal(t, "wrong_password", event.Payload["reason"])
+	assert.False(t, event.CreatedAt.IsZero())
+}
+
+func TestNewEventForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		proxies    []string
+		expectedIP string
+	}{
+		{name: "No Trusted Proxies", proxies: nil, expectedIP: "203.0.113.7"},
+		{name: "Untrusted Proxy", proxies: []string{"10.0.0.0/8"}, expectedIP: "203.0.113.7"},
+		{name: "Trusted Proxy", proxies: []string{"203.0.113.0/24"}, expectedIP: "198.51.100.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, router := gin.CreateTestContext(httptest.NewRecorder())
+			require.NoError(t, router.SetTrustedProxies(tt.proxies))
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+			c.Request.RemoteAddr = "203.0.113.7:5000"
+			c.Request.Header.Set("X-Forwarded-For", "198.51.100.4")
+
+			event := newEvent(c, EventLoginFailed, "", "", nil)
+
+			assert.Equal(t, tt.expectedIP, event.IP)
+		})
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	t.Run("Dropped Before Start", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			enqueue(models.AuditEvent{Type: string(EventLoginSucceeded)})
+		})
+	})
+
+	t.Run("Dropped When Queue Full", func(t *testing.T) {
+		mu.Lock()
+		events = make(chan models.AuditEvent, 1)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			events = nil
+			mu.Unlock()
+		}()
+
+		enqueue(models.AuditEvent{Type: string(EventLoginSucceeded)})
+		enqueue(models.AuditEvent{Type: string(EventLoginFailed)})
+
+		assert.Len(t, events, 1)
+		assert.Equal(t, string(EventLoginSucceeded), (<-events).Type)
+	})
+}
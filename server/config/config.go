@@ -0,0 +1,326 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// minSecretLength is the shortest JWT secret accepted at startup. HS256 keys
+// shorter than the 256-bit hash output make brute-forcing tokens easier.
+const minSecretLength = 32
+
+// minDistinctSecretChars rejects low-entropy secrets such as "aaaa..." that
+// satisfy the length check.
+const minDistinctSecretChars = 8
+
+var placeholderSecrets = []string{"secret", "changeme", "change-me", "password", "example"}
+
+type Config struct {
+	Port                 string        `json:"port"`
+	MongoURI             string        `json:"mongodb_uri"`
+	DBName               string        `json:"db_name"`
+	JWTSecret            string        `json:"jwt_secret"`
+	DailySeedKey         string        `json:"daily_seed_key"`
+	CORSAllowedOrigins   []string      `json:"cors_allowed_origins"`
+	CORSAllowedMethods   []string      `json:"cors_allowed_methods"`
+	CORSAllowedHeaders   []string      `json:"cors_allowed_headers"`
+	CORSAllowCredentials bool          `json:"cors_allow_credentials"`
+	CORSMaxAge           time.Duration `json:"cors_max_age"`
+
+	// TrustedProxies lists the addresses or CIDR ranges of the reverse
+	// proxies whose X-Forwarded-For header is believed. With none, client
+	// addresses come from the connection alone.
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	HTTPReadTimeout  time.Duration `json:"http_read_timeout"`
+	HTTPWriteTimeout time.Duration `json:"http_write_timeout"`
+	HTTPIdleTimeout  time.Duration `json:"http_idle_timeout"`
+	ShutdownTimeout  time.Duration `json:"shutdown_timeout"`
+	// ShutdownDrainDelay is how long the server keeps serving after a
+	// shutdown signal while /readyz reports it as shutting down, so load
+	// balancers stop routing to it before the listener closes.
+	ShutdownDrainDelay time.Duration `json:"shutdown_drain_delay"`
+
+	LogLevel  string `json:"log_level"`
+	LogFormat string `json:"log_format"`
+
+	LiveMaxConnections int           `json:"live_max_connections"`
+	LivePingInterval   time.Duration `json:"live_ping_interval"`
+	LiveSessionTTL     time.Duration `json:"live_session_ttl"`
+	// LiveRaceReconnectGrace is how long a racer who lost their connection
+	// can come back before they forfeit.
+	LiveRaceReconnectGrace time.Duration `json:"live_race_reconnect_grace"`
+
+	// ChallengeTTL is how long a head-to-head challenge stays open.
+	ChallengeTTL time.Duration `json:"challenge_ttl"`
+
+	// NotificationLimit and NotificationRetention bound each player's
+	// notification inbox.
+	NotificationLimit     int           `json:"notification_limit"`
+	NotificationRetention time.Duration `json:"notification_retention"`
+
+	EnvFile     string `json:"env_file"`
+	PrintConfig bool   `json:"-"`
+}
+
+// Load builds the configuration from, in increasing order of precedence, the
+// env file, the process environment and command line flags.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+
+	envFile := fs.String("env-file", ".env", "path to an env file to load before reading the environment")
+	port := fs.String("port", "", "port to listen on (env PORT)")
+	mongoURI := fs.String("mongodb-uri", "", "MongoDB connection string (env MONGODB_URI)")
+	dbName := fs.String("db-name", "", "MongoDB database name (env DB_NAME)")
+	logLevel := fs.String("log-level", "", "minimum log level: debug, info, warn or error (env LOG_LEVEL)")
+	logFormat := fs.String("log-format", "", "log output format: json or text (env LOG_FORMAT)")
+	corsOrigins := fs.String("cors-origins", "", "comma separated list of allowed CORS origins (env CORS_ALLOWED_ORIGINS)")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := godotenv.Load(*envFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("loading env file %s: %w", *envFile, err)
+	}
+
+	cfg := &Config{
+		Port:               envOrDefault("PORT", "8080"),
+		MongoURI:           os.Getenv("MONGODB_URI"),
+		DBName:             os.Getenv("DB_NAME"),
+		JWTSecret:          os.Getenv("JWT_SECRET"),
+		DailySeedKey:       os.Getenv("DAILY_SEED_KEY"),
+		CORSAllowedOrigins: splitList(envOrDefault("CORS_ALLOWED_ORIGINS", "https://infinite-minesweeper.onrender.com")),
+		CORSAllowedMethods: splitList(envOrDefault("CORS_ALLOWED_METHODS", "GET, POST, PUT, DELETE, OPTIONS")),
+		CORSAllowedHeaders: splitList(envOrDefault("CORS_ALLOWED_HEADERS", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Accept, Origin, Cache-Control, X-Requested-With")),
+		TrustedProxies:     splitList(os.Getenv("TRUSTED_PROXIES")),
+		LogLevel:           envOrDefault("LOG_LEVEL", "info"),
+		LogFormat:          envOrDefault("LOG_FORMAT", "json"),
+		EnvFile:            *envFile,
+		PrintConfig:        *printConfig,
+	}
+
+	var err error
+	if cfg.CORSAllowCredentials, err = strconv.ParseBool(envOrDefault("CORS_ALLOW_CREDENTIALS", "true")); err != nil {
+		return nil, fmt.Errorf("CORS_ALLOW_CREDENTIALS: %w", err)
+	}
+	if cfg.LiveMaxConnections, err = strconv.Atoi(envOrDefault("LIVE_MAX_CONNECTIONS", "1000")); err != nil {
+		return nil, fmt.Errorf("LIVE_MAX_CONNECTIONS: %w", err)
+	}
+	if cfg.NotificationLimit, err = strconv.Atoi(envOrDefault("NOTIFICATION_LIMIT", "200")); err != nil {
+		return nil, fmt.Errorf("NOTIFICATION_LIMIT: %w", err)
+	}
+
+	durations := []struct {
+		key      string
+		fallback string
+		target   *time.Duration
+	}{
+		{"CORS_MAX_AGE", "12h", &cfg.CORSMaxAge},
+		{"HTTP_READ_TIMEOUT", "15s", &cfg.HTTPReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", "30s", &cfg.HTTPWriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", "2m", &cfg.HTTPIdleTimeout},
+		{"SHUTDOWN_TIMEOUT", "20s", &cfg.ShutdownTimeout},
+		{"SHUTDOWN_DRAIN_DELAY", "5s", &cfg.ShutdownDrainDelay},
+		{"LIVE_PING_INTERVAL", "25s", &cfg.LivePingInterval},
+		{"LIVE_SESSION_TTL", "10m", &cfg.LiveSessionTTL},
+		{"LIVE_RACE_RECONNECT_GRACE", "30s", &cfg.LiveRaceReconnectGrace},
+		{"CHALLENGE_TTL", "72h", &cfg.ChallengeTTL},
+		{"NOTIFICATION_RETENTION", "720h", &cfg.NotificationRetention},
+	}
+	for _, d := range durations {
+		if *d.target, err = time.ParseDuration(envOrDefault(d.key, d.fallback)); err != nil {
+			return nil, fmt.Errorf("%s: %w", d.key, err)
+		}
+	}
+
+	if *port != "" {
+		cfg.Port = *port
+	}
+	if *mongoURI != "" {
+		cfg.MongoURI = *mongoURI
+	}
+	if *dbName != "" {
+		cfg.DBName = *dbName
+	}
+	if *corsOrigins != "" {
+		cfg.CORSAllowedOrigins = splitList(*corsOrigins)
+	}
+	if *logLevel != "" {
+		cfg.LogLevel = *logLevel
+	}
+	if *logFormat != "" {
+		cfg.LogFormat = *logFormat
+	}
+
+	return cfg, nil
+}
+
+// Validate reports every problem with the configuration at once so that a
+// misconfigured deployment can be fixed in a single pass.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Port == "" {
+		errs = append(errs, errors.New("PORT must not be empty"))
+	}
+	if c.MongoURI == "" {
+		errs = append(errs, errors.New("MONGODB_URI is required"))
+	}
+	if c.DBName == "" {
+		errs = append(errs, errors.New("DB_NAME is required"))
+	}
+
+	for _, secret := range []struct{ name, value string }{
+		{"JWT_SECRET", c.JWTSecret},
+		{"DAILY_SEED_KEY", c.DailySeedKey},
+	} {
+		switch {
+		case secret.value == "":
+			errs = append(errs, fmt.Errorf("%s is required", secret.name))
+		case len(secret.value) < minSecretLength:
+			errs = append(errs, fmt.Errorf("%s must be at least %d characters", secret.name, minSecretLength))
+		case isWeakSecret(secret.value):
+			errs = append(errs, fmt.Errorf("%s looks like a placeholder or low-entropy value", secret.name))
+		}
+	}
+	if c.DailySeedKey != "" && c.DailySeedKey == c.JWTSecret {
+		errs = append(errs, errors.New("DAILY_SEED_KEY must differ from JWT_SECRET"))
+	}
+
+	if len(c.CORSAllowedOrigins) == 0 {
+		errs = append(errs, errors.New("CORS_ALLOWED_ORIGINS must list at least one origin"))
+	}
+	for _, origin := range c.CORSAllowedOrigins {
+		if !validOriginPattern(origin) {
+			errs = append(errs, fmt.Errorf("CORS_ALLOWED_ORIGINS: %q is not an origin such as https://example.com or https://*.example.com", origin))
+		}
+	}
+	if c.CORSAllowCredentials && slices.Contains(c.CORSAllowedOrigins, "*") {
+		// Any site could then make requests with the user's credentials.
+		errs = append(errs, errors.New(`CORS_ALLOWED_ORIGINS cannot contain "*" while CORS_ALLOW_CREDENTIALS is true`))
+	}
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %q is not an IP address or CIDR range", proxy))
+			}
+		}
+	}
+	if c.CORSMaxAge < 0 {
+		errs = append(errs, errors.New("CORS_MAX_AGE must not be negative"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT must be positive"))
+	}
+	if c.ShutdownDrainDelay < 0 {
+		errs = append(errs, errors.New("SHUTDOWN_DRAIN_DELAY must not be negative"))
+	}
+	if c.LiveMaxConnections <= 0 {
+		errs = append(errs, errors.New("LIVE_MAX_CONNECTIONS must be positive"))
+	}
+	if c.LivePingInterval <= 0 {
+		errs = append(errs, errors.New("LIVE_PING_INTERVAL must be positive"))
+	}
+	if c.LiveSessionTTL <= 0 {
+		errs = append(errs, errors.New("LIVE_SESSION_TTL must be positive"))
+	}
+	if c.LiveRaceReconnectGrace <= 0 {
+		errs = append(errs, errors.New("LIVE_RACE_RECONNECT_GRACE must be positive"))
+	}
+	if c.ChallengeTTL <= 0 {
+		errs = append(errs, errors.New("CHALLENGE_TTL must be positive"))
+	}
+	if c.NotificationLimit <= 0 {
+		errs = append(errs, errors.New("NOTIFICATION_LIMIT must be positive"))
+	}
+	if c.NotificationRetention <= 0 {
+		errs = append(errs, errors.New("NOTIFICATION_RETENTION must be positive"))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL %q must be debug, info, warn or error", c.LogLevel))
+	}
+	if format := strings.ToLower(c.LogFormat); format != "json" && format != "text" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT %q must be json or text", c.LogFormat))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the configuration that is safe to print.
+func (c *Config) Redacted() Config {
+	redacted := *c
+	for _, secret := range []*string{&redacted.JWTSecret, &redacted.DailySeedKey} {
+		if *secret != "" {
+			*secret = "[REDACTED]"
+		}
+	}
+	redacted.MongoURI = redactURI(c.MongoURI)
+	return redacted
+}
+
+func redactURI(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+	}
+	return u.String()
+}
+
+func validOriginPattern(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	return err == nil && u.Scheme != "" && u.Host != "" && u.Path == "" && u.RawQuery == "" && u.User == nil
+}
+
+func isWeakSecret(secret string) bool {
+	lower := strings.ToLower(secret)
+	for _, placeholder := range placeholderSecrets {
+		if strings.Contains(lower, placeholder) {
+			return true
+		}
+	}
+
+	distinct := make(map[rune]struct{})
+	for _, r := range secret {
+		distinct[r] = struct{}{}
+	}
+	return len(distinct) < minDistinctSecretChars
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -2,40 +2,56 @@ package config
 
 import (
 	"context"
-	"log"
-	"os"
-	"time"
+	"errors"
+	"fmt"
+	"log/slog"
 
-	"github.com/joho/godotenv"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var DB *mongo.Database
-
-func ConnectDB() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning, no .env file")
-	}
-
-	clientOptions := options.Client().ApplyURI(os.Getenv("MONGODB_URI"))
+var (
+	DB     *mongo.Database
+	client *mongo.Client
+)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// ConnectDB connects to MongoDB and verifies the connection with a ping. The
+// context bounds how long the initial connection may take.
+func ConnectDB(ctx context.Context, cfg *Config) error {
+	clientOptions := options.Client().ApplyURI(cfg.MongoURI).SetMonitor(metrics.MongoMonitor())
 
-	client, err := mongo.Connect(ctx, clientOptions)
+	c, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("connecting to MongoDB: %w", err)
 	}
 
-	err = client.Ping(ctx, nil)
-	if err != nil {
-		log.Fatal(err)
+	if err := c.Ping(ctx, nil); err != nil {
+		_ = c.Disconnect(context.Background())
+		return fmt.Errorf("pinging MongoDB: %w", err)
 	}
 
-	log.Println("Connected to MongoDB")
+	slog.Info("connected to MongoDB", slog.String("database", cfg.DBName))
 
-	DB = client.Database(os.Getenv("DB_NAME"))
+	client = c
+	DB = c.Database(cfg.DBName)
+	return nil
+}
+
+// DisconnectDB closes the MongoDB client opened by ConnectDB.
+func DisconnectDB(ctx context.Context) error {
+	if client == nil {
+		return nil
+	}
+	return client.Disconnect(ctx)
+}
+
+// PingDB checks that the MongoDB deployment is reachable.
+func PingDB(ctx context.Context) error {
+	if client == nil {
+		return errors.New("not connected")
+	}
+	return client.Ping(ctx, nil)
 }
 
 func GetCollection(collectionName string) *mongo.Collection {
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/achievement"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/markbakos/infinite-minesweeper/server/notification"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// achievementUnlocksCollection holds one counter per achievement of the
+// players who unlocked it, so that listing achievements does not scan every
+// player.
+const achievementUnlocksCollection = "achievement_unlocks"
+
+// ListAchievements returns every achievement with the share of registered
+// players who have unlocked it. Signed in viewers also see when they
+// unlocked each one.
+func (h *Handler) ListAchievements(c *gin.Context) {
+	ctx := c.Request.Context()
+	users := getUserCollection()
+
+	players, err := users.EstimatedDocumentCount(ctx)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count players", err))
+		return
+	}
+
+	var counts []struct {
+		ID    string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	if err := findAll(ctx, config.GetCollection(achievementUnlocksCollection), bson.M{}, options.Find(), &counts); err != nil {
+		c.Error(apierror.Internal("Failed to count achievements", err))
+		return
+	}
+	unlocked := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		unlocked[count.ID] = count.Count
+	}
+
+	viewer := map[string]time.Time{}
+	if userID := c.GetString("user_id"); userID != "" && !c.GetBool("is_guest") {
+		if objectID, err := primitive.ObjectIDFromHex(userID); err == nil {
+			var user models.User
+			findOptions := options.FindOne().SetProjection(bson.M{"achievements": 1})
+			if err := users.FindOne(ctx, bson.M{"_id": objectID}, findOptions).Decode(&user); err == nil {
+				for _, a := range user.Achievements {
+					viewer[a.ID] = a.UnlockedAt
+				}
+			}
+		}
+	}
+
+	rules := achievement.Rules()
+	achievements := make([]models.Achievement, 0, len(rules))
+	for _, rule := range rules {
+		a := models.Achievement{
+			ID:          rule.ID,
+			Name:        rule.Name,
+			Description: rule.Description,
+			Unlocked:    unlocked[rule.ID],
+		}
+		if players > 0 {
+			a.Percentage = float64(a.Unlocked) * 100 / float64(players)
+		}
+		if at, ok := viewer[rule.ID]; ok {
+			a.UnlockedAt = &at
+		}
+		achievements = append(achievements, a)
+	}
+
+	c.JSON(http.StatusOK, models.AchievementListResponse{Achievements: achievements, Players: players})
+}
+
+// RecordFinishedGame counts a game a registered player finished in a live
+// session towards their stats and awards every achievement it newly earned
+// them.
+func RecordFinishedGame(ctx context.Context, g models.FinishedGame) error {
+	userID, err := primitive.ObjectIDFromHex(g.PlayerID)
+	if err != nil {
+		return fmt.Errorf("invalid player ID %q: %w", g.PlayerID, err)
+	}
+	user, err := updatePlayerStats(ctx, userID, g)
+	if err != nil {
+		return fmt.Errorf("updating stats: %w", err)
+	}
+
+	earned := make(map[string]bool, len(user.Achievements))
+	for _, a := range user.Achievements {
+		earned[a.ID] = true
+	}
+
+	users := getUserCollection()
+	var errs []error
+	for _, rule := range achievement.Evaluate(achievement.Rules(), achievementFacts(g, user.Stats)) {
+		if earned[rule.ID] {
+			continue
+		}
+		// The filter keeps concurrent games from awarding the same
+		// achievement twice, and only the update that awarded it counts it.
+		result, err := users.UpdateOne(ctx,
+			bson.M{"_id": userID, "achievements.id": bson.M{"$ne": rule.ID}},
+			bson.M{"$push": bson.M{"achievements": models.UnlockedAchievement{ID: rule.ID, UnlockedAt: g.FinishedAt}}},
+		)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("awarding %s: %w", rule.ID, err))
+			continue
+		}
+		if result.ModifiedCount == 0 {
+			continue
+		}
+		if err := countAchievementUnlocks(ctx, rule.ID, 1); err != nil {
+			errs = append(errs, fmt.Errorf("counting %s: %w", rule.ID, err))
+		}
+		notification.Send(g.PlayerID, notification.TypeAchievementUnlocked,
+			fmt.Sprintf("You unlocked %s", rule.Name),
+			map[string]string{"achievement_id": rule.ID},
+		)
+	}
+	return errors.Join(errs...)
+}
+
+// countAchievementUnlocks adds delta to the number of players who unlocked
+// the achievement id.
+func countAchievementUnlocks(ctx context.Context, id string, delta int) error {
+	_, err := config.GetCollection(achievementUnlocksCollection).UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$inc": bson.M{"count": delta}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// updatePlayerStats counts g towards the player's stats and returns the
+// player as updated.
+func updatePlayerStats(ctx context.Context, userID primitive.ObjectID, g models.FinishedGame) (models.User, error) {
+	inc := bson.M{"stats.games_played": 1}
+	update := bson.M{"$inc": inc}
+	if g.GameType == game.TypeNormal {
+		if g.Won {
+			inc["stats.games_won"] = 1
+			inc["stats.win_streak"] = 1
+		} else {
+			update["$set"] = bson.M{"stats.win_streak": 0}
+		}
+	}
+
+	var user models.User
+	err := getUserCollection().FindOneAndUpdate(ctx, bson.M{"_id": userID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	return user, err
+}
+
+// achievementFacts describes a finished game and the stats it left behind.
+func achievementFacts(g models.FinishedGame, stats models.PlayerStats) achievement.Facts {
+	return achievement.Facts{
+		achievement.FactGameType:      g.GameType,
+		achievement.FactWon:           g.Won,
+		achievement.FactScore:         g.Score,
+		achievement.FactTimeInSeconds: g.TimeInSeconds,
+		achievement.FactCellsRevealed: g.CellsRevealed,
+		achievement.FactFlagsUsed:     g.FlagsPlaced,
+		achievement.FactGamesPlayed:   stats.GamesPlayed,
+		achievement.FactGamesWon:      stats.GamesWon,
+		achievement.FactWinStreak:     stats.WinStreak,
+	}
+}
@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/audit"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (h *Handler) ListUsers(c *gin.Context) {
+	limit := 20
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if val, err := strconv.ParseInt(limitParam, 10, 64); err == nil && val > 0 {
+			limit = int(val)
+		}
+	}
+
+	skip := 0
+	if skipParam := c.Query("skip"); skipParam != "" {
+		if val, err := strconv.ParseInt(skipParam, 10, 64); err == nil && val >= 0 {
+			skip = int(val)
+		}
+	}
+
+	filter := bson.M{}
+	if query := c.Query("q"); query != "" {
+		filter["username"] = bson.M{"$regex": regexp.QuoteMeta(query), "$options": "i"}
+	}
+	if c.Query("banned") == "true" {
+		filter["banned"] = true
+	}
+
+	userCollection := getUserCollection()
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "created_at", Value: -1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(skip))
+	findOptions.SetProjection(bson.M{"password": 0})
+
+	cursor, err := userCollection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve users", err))
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var users []models.User
+	if err := cursor.All(context.Background(), &users); err != nil {
+		c.Error(apierror.Internal("Failed to decode users", err))
+		return
+	}
+
+	totalCount, err := userCollection.CountDocuments(context.Background(), filter)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count users", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserListResponse{
+		Users: users,
+		Total: totalCount,
+	})
+}
+
+func (h *Handler) BanUser(c *gin.Context) {
+	h.setUserBanned(c, true)
+}
+
+func (h *Handler) UnbanUser(c *gin.Context) {
+	h.setUserBanned(c, false)
+}
+
+func (h *Handler) setUserBanned(c *gin.Context, banned bool) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid user ID"))
+		return
+	}
+
+	if banned && objectID.Hex() == c.GetString("user_id") {
+		c.Error(apierror.BadRequest("You cannot ban yourself"))
+		return
+	}
+
+	result, err := getUserCollection().UpdateOne(
+		context.Background(),
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{"banned": banned, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to update user", err))
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.Error(apierror.NotFound("User not found"))
+		return
+	}
+
+	eventType := audit.EventAdminUserUnbanned
+	if banned {
+		eventType = audit.EventAdminUserBanned
+	}
+	audit.Record(c, eventType, c.GetString("user_id"), objectID.Hex(), nil)
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "User updated successfully"})
+}
+
+func (h *Handler) RenameUser(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid user ID"))
+		return
+	}
+
+	var request models.RenameUserRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apierror.FromBinding(err))
+		return
+	}
+
+	userCollection := getUserCollection()
+
+	var user models.User
+	err = userCollection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&user)
+	if err != nil {
+		c.Error(apierror.NotFound("User not found"))
+		return
+	}
+
+	var existingUser models.User
+	err = userCollection.FindOne(context.Background(), bson.M{"username": request.Username}).Decode(&existingUser)
+	if err == nil {
+		c.Error(apierror.Conflict(apierror.CodeUsernameTaken, "User with this username already exists"))
+		return
+	}
+
+	_, err = userCollection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{"username": request.Username, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to rename user", err))
+		return
+	}
+
+	_, err = config.GetCollection("leaderboard").UpdateMany(
+		context.Background(),
+		bson.M{"user_id": objectID.Hex(), "is_guest": false},
+		bson.M{"$set": bson.M{"username": request.Username}},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to rename leaderboard entries", err))
+		return
+	}
+
+	_, err = config.GetCollection(ratingsCollection).UpdateMany(
+		context.Background(),
+		bson.M{"user_id": objectID.Hex()},
+		bson.M{"$set": bson.M{"username": request.Username}},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to rename ratings", err))
+		return
+	}
+
+	_, err = config.GetCollection(dailyAttemptsCollection).UpdateMany(
+		context.Background(),
+		bson.M{"user_id": objectID.Hex()},
+		bson.M{"$set": bson.M{"username": request.Username}},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to rename daily attempts", err))
+		return
+	}
+
+	_, err = config.GetCollection(tournamentsCollection).UpdateMany(
+		context.Background(),
+		bson.M{"players.user_id": objectID.Hex()},
+		bson.M{
+			"$set": bson.M{"players.$[player].username": request.Username},
+			"$inc": bson.M{"version": 1},
+		},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: bson.A{bson.M{"player.user_id": objectID.Hex()}}}),
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to rename tournament players", err))
+		return
+	}
+
+	audit.Record(c, audit.EventAdminUserRenamed, c.GetString("user_id"), objectID.Hex(), map[string]any{
+		"old_username": user.Username,
+		"new_username": request.Username,
+	})
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "User renamed successfully"})
+}
+
+// ResetUserRecords wipes everything a user's games earned them: their game
+// records, recent games, stats, leaderboard entries and achievements.
+// Achievements go too because a reset usually follows cheating, and the
+// stats they were earned from are gone.
+func (h *Handler) ResetUserRecords(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid user ID"))
+		return
+	}
+
+	var user models.User
+	err = getUserCollection().FindOneAndUpdate(
+		context.Background(),
+		bson.M{"_id": objectID},
+		bson.M{
+			"$unset": bson.M{"game_records": "", "recent_games": "", "stats": "", "achievements": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetProjection(bson.M{"achievements": 1}),
+	).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.Error(apierror.NotFound("User not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to reset user's game records", err))
+		return
+	}
+	for _, a := range user.Achievements {
+		if err := countAchievementUnlocks(context.Background(), a.ID, -1); err != nil {
+			h.log.Warn("failed to uncount revoked achievement", slog.String("user_id", objectID.Hex()), slog.String("achievement_id", a.ID), slog.Any("error", err))
+		}
+	}
+
+	deleted, err := config.GetCollection("leaderboard").DeleteMany(
+		context.Background(),
+		bson.M{"user_id": objectID.Hex(), "is_guest": false},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to delete leaderboard entries", err))
+		return
+	}
+
+	audit.Record(c, audit.EventAdminUserRecordsReset, c.GetString("user_id"), objectID.Hex(), map[string]any{
+		"leaderboard_entries_deleted": deleted.DeletedCount,
+		"achievements_revoked":        len(user.Achievements),
+	})
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "User records reset successfully"})
+}
+
+func (h *Handler) DeleteLeaderboardEntry(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid leaderboard entry ID"))
+		return
+	}
+
+	leaderboardCollection := config.GetCollection("leaderboard")
+
+	var entry models.LeaderboardEntry
+	err = leaderboardCollection.FindOneAndDelete(context.Background(), bson.M{"_id": objectID}).Decode(&entry)
+	if err != nil {
+		c.Error(apierror.NotFound("Leaderboard entry not found"))
+		return
+	}
+
+	audit.Record(c, audit.EventAdminLeaderboardDeleted, c.GetString("user_id"), objectID.Hex(), map[string]any{
+		"game_type": entry.GameType,
+		"score":     entry.Score,
+		"username":  entry.Username,
+	})
+	if !entry.Hidden {
+		h.publishLeaderboardRemoved(entry)
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Leaderboard entry deleted successfully"})
+}
+
+func (h *Handler) HideLeaderboardEntry(c *gin.Context) {
+	h.setLeaderboardEntryHidden(c, true)
+}
+
+func (h *Handler) UnhideLeaderboardEntry(c *gin.Context) {
+	h.setLeaderboardEntryHidden(c, false)
+}
+
+func (h *Handler) setLeaderboardEntryHidden(c *gin.Context, hidden bool) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid leaderboard entry ID"))
+		return
+	}
+
+	var entry models.LeaderboardEntry
+	err = config.GetCollection("leaderboard").FindOneAndUpdate(
+		context.Background(),
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{"hidden": hidden}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.Error(apierror.NotFound("Leaderboard entry not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to update leaderboard entry", err))
+		return
+	}
+
+	if hidden {
+		h.publishLeaderboardRemoved(entry)
+	} else {
+		h.publishLeaderboardEntry(entry)
+	}
+
+	eventType := audit.EventAdminLeaderboardUnhidden
+	if hidden {
+		eventType = audit.EventAdminLeaderboardHidden
+	}
+	audit.Record(c, eventType, c.GetString("user_id"), objectID.Hex(), nil)
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Leaderboard entry updated successfully"})
+}
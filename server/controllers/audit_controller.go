@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/audit"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (h *Handler) ListAuditEvents(c *gin.Context) {
+	limit := 50
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if val, err := strconv.ParseInt(limitParam, 10, 64); err == nil && val > 0 && val <= 500 {
+			limit = int(val)
+		}
+	}
+
+	skip := 0
+	if skipParam := c.Query("skip"); skipParam != "" {
+		if val, err := strconv.ParseInt(skipParam, 10, 64); err == nil && val >= 0 {
+			skip = int(val)
+		}
+	}
+
+	filter := bson.M{}
+	if eventType := c.Query("type"); eventType != "" {
+		filter["type"] = eventType
+	}
+	if actor := c.Query("actor"); actor != "" {
+		filter["actor_id"] = actor
+	}
+	if target := c.Query("target"); target != "" {
+		filter["target_id"] = target
+	}
+	if ip := c.Query("ip"); ip != "" {
+		filter["ip"] = ip
+	}
+
+	createdAt := bson.M{}
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.Error(apierror.Validation("since must be an RFC3339 timestamp", apierror.FieldError{Field: "since", Reason: "datetime"}))
+			return
+		}
+		createdAt["$gte"] = t
+	}
+	if until := c.Query("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			c.Error(apierror.Validation("until must be an RFC3339 timestamp", apierror.FieldError{Field: "until", Reason: "datetime"}))
+			return
+		}
+		createdAt["$lt"] = t
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+
+	auditCollection := config.GetCollection(audit.CollectionName)
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "created_at", Value: -1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(skip))
+
+	cursor, err := auditCollection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve audit events", err))
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var events []models.AuditEvent
+	if err := cursor.All(context.Background(), &events); err != nil {
+		c.Error(apierror.Internal("Failed to decode audit events", err))
+		return
+	}
+
+	totalCount, err := auditCollection.CountDocuments(context.Background(), filter)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count audit events", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AuditEventListResponse{
+		Events: events,
+		Total:  totalCount,
+	})
+}
@@ -2,29 +2,34 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/audit"
 	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
+	"github.com/markbakos/infinite-minesweeper/server/middleware"
 	"github.com/markbakos/infinite-minesweeper/server/models"
 	"github.com/markbakos/infinite-minesweeper/server/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func getUserCollection() *mongo.Collection {
 	return config.GetCollection("users")
 }
 
-func RegisterUser(c *gin.Context) {
+func (h *Handler) RegisterUser(c *gin.Context) {
 	var request models.RegisterRequest
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apierror.FromBinding(err))
 		return
 	}
 
@@ -33,13 +38,13 @@ func RegisterUser(c *gin.Context) {
 	var existingUser models.User
 	err := userCollection.FindOne(context.Background(), bson.M{"username": request.Username}).Decode(&existingUser)
 	if err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "User with this username already exists"})
+		c.Error(apierror.Conflict(apierror.CodeUsernameTaken, "User with this username already exists"))
 		return
 	}
 
 	hashedPassword, err := utils.HashPassword(request.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		c.Error(apierror.Internal("Failed to hash password", err))
 		return
 	}
 
@@ -48,19 +53,23 @@ func RegisterUser(c *gin.Context) {
 		ID:        primitive.NewObjectID(),
 		Username:  request.Username,
 		Password:  hashedPassword,
+		Role:      models.RoleUser,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 
 	_, err = userCollection.InsertOne(context.Background(), newUser)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		c.Error(apierror.Internal("Failed to create user", err))
 		return
 	}
 
-	token, err := generateToken(newUser.ID.Hex())
+	metrics.UsersRegistered.Inc()
+	audit.Record(c, audit.EventUserRegistered, newUser.ID.Hex(), "", map[string]any{"username": newUser.Username})
+
+	token, err := h.generateToken(newUser.ID.Hex(), newUser.EffectiveRole())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to Generate token"})
+		c.Error(apierror.Internal("Failed to generate token", err))
 		return
 	}
 
@@ -70,10 +79,10 @@ func RegisterUser(c *gin.Context) {
 	})
 }
 
-func LoginUser(c *gin.Context) {
+func (h *Handler) LoginUser(c *gin.Context) {
 	var request models.LoginRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apierror.FromBinding(err))
 		return
 	}
 
@@ -82,41 +91,52 @@ func LoginUser(c *gin.Context) {
 	var user models.User
 	err := userCollection.FindOne(context.Background(), bson.M{"username": request.Username}).Decode(&user)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		audit.Record(c, audit.EventLoginFailed, "", "", map[string]any{"username": request.Username, "reason": "unknown_user"})
+		c.Error(apierror.Unauthorized(apierror.CodeInvalidCredentials, "Invalid username or password"))
 		return
 	}
 
 	if !utils.CheckPasswordHash(request.Password, user.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		audit.Record(c, audit.EventLoginFailed, "", user.ID.Hex(), map[string]any{"username": request.Username, "reason": "wrong_password"})
+		c.Error(apierror.Unauthorized(apierror.CodeInvalidCredentials, "Invalid username or password"))
+		return
+	}
+
+	if user.Banned {
+		audit.Record(c, audit.EventLoginFailed, "", user.ID.Hex(), map[string]any{"username": request.Username, "reason": "banned"})
+		c.Error(apierror.Forbidden(apierror.CodeAccountBanned, "This account has been banned"))
 		return
 	}
 
-	token, err := generateToken(user.ID.Hex())
+	token, err := h.generateToken(user.ID.Hex(), user.EffectiveRole())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.Error(apierror.Internal("Failed to generate token", err))
 		return
 	}
 
+	audit.Record(c, audit.EventLoginSucceeded, user.ID.Hex(), "", nil)
+
 	c.JSON(http.StatusOK, models.AuthResponse{
 		Token:    token,
 		Username: user.Username,
 	})
 }
 
-func generateToken(userID string) (string, error) {
+func (h *Handler) generateToken(userID string, role string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": userID,
+		"role":    role,
 		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(),
 	})
 
-	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return token.SignedString([]byte(h.cfg.JWTSecret))
 }
 
-func GetCurrentUser(c *gin.Context) {
+func (h *Handler) GetCurrentUser(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	objectID, err := primitive.ObjectIDFromHex(userID.(string))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		c.Error(apierror.BadRequest("Invalid user ID"))
 		return
 	}
 
@@ -125,12 +145,33 @@ func GetCurrentUser(c *gin.Context) {
 	var user models.User
 	err = userCollection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&user)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		c.Error(apierror.NotFound("User not found"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":       user.ID,
-		"username": user.Username,
+	c.JSON(http.StatusOK, models.CurrentUserResponse{
+		ID:       user.ID.Hex(),
+		Username: user.Username,
+		Role:     user.EffectiveRole(),
 	})
 }
+
+// LookupAccount loads the current role and ban state of a registered user
+// for middleware.AccountMiddleware.
+func LookupAccount(ctx context.Context, userID string) (middleware.Account, error) {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return middleware.Account{}, middleware.ErrAccountNotFound
+	}
+
+	var user models.User
+	findOptions := options.FindOne().SetProjection(bson.M{"role": 1, "banned": 1})
+	err = getUserCollection().FindOne(ctx, bson.M{"_id": objectID}, findOptions).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return middleware.Account{}, middleware.ErrAccountNotFound
+	}
+	if err != nil {
+		return middleware.Account{}, err
+	}
+	return middleware.Account{Role: user.EffectiveRole(), Banned: user.Banned}, nil
+}
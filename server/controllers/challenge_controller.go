@@ -0,0 +1,504 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/live"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/markbakos/infinite-minesweeper/server/notification"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const challengesCollection = "challenges"
+
+var challengeStates = map[string]bool{
+	models.ChallengePending:   true,
+	models.ChallengeOpen:      true,
+	models.ChallengePlaying:   true,
+	models.ChallengeCompleted: true,
+	models.ChallengeDeclined:  true,
+	models.ChallengeExpired:   true,
+}
+
+// challengeStateFilter matches challenges in state. Challenges are not
+// marked expired when their time runs out, so expired means pending or
+// open past the deadline. Challenges still being played when they expire
+// are decided by CloseExpiredChallenges instead.
+func challengeStateFilter(state string, now time.Time) bson.M {
+	switch state {
+	case models.ChallengeExpired:
+		return bson.M{"state": bson.M{"$in": bson.A{models.ChallengePending, models.ChallengeOpen}}, "expires_at": bson.M{"$lte": now}}
+	case models.ChallengePending, models.ChallengeOpen:
+		return bson.M{"state": state, "expires_at": bson.M{"$gt": now}}
+	default:
+		return bson.M{"state": state}
+	}
+}
+
+// challengeVisible reports whether userID may see ch: its players, or
+// anyone holding the link to a challenge nobody has taken up yet.
+func challengeVisible(ch models.Challenge, userID string) bool {
+	return ch.ChallengerID == userID || ch.OpponentID == userID || ch.OpponentID == ""
+}
+
+// presentChallenges prepares challenges for userID: it reports challenges
+// whose time ran out as expired, hides the board and the challenger's replay
+// from the opponent until the challenge is over and fills in usernames.
+func presentChallenges(ctx context.Context, challenges []models.Challenge, userID string, now time.Time) error {
+	var userIDs []string
+	for i := range challenges {
+		ch := &challenges[i]
+		if (ch.State == models.ChallengePending || ch.State == models.ChallengeOpen) && !now.Before(ch.ExpiresAt) {
+			ch.State = models.ChallengeExpired
+		}
+		if ch.ChallengerID != userID && (ch.State == models.ChallengePending || ch.State == models.ChallengeOpen || ch.State == models.ChallengePlaying) {
+			ch.Seed = 0
+			if ch.Challenger != nil {
+				ch.Challenger.Replay = nil
+			}
+		}
+		userIDs = append(userIDs, ch.ChallengerID)
+		if ch.OpponentID != "" {
+			userIDs = append(userIDs, ch.OpponentID)
+		}
+	}
+
+	usernames, err := lookupUsernames(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	for i := range challenges {
+		challenges[i].ChallengerName = usernames[challenges[i].ChallengerID]
+		challenges[i].OpponentName = usernames[challenges[i].OpponentID]
+	}
+	return nil
+}
+
+// CreateChallenge challenges another player, or anyone the challenge's link
+// is shared with when no username is given, to beat the authenticated
+// player's result on a board. The challenger plays first over the live
+// channel.
+func (h *Handler) CreateChallenge(c *gin.Context) {
+	if c.GetBool("is_guest") {
+		c.Error(apierror.Forbidden(apierror.CodeForbidden, "Guests cannot send challenges"))
+		return
+	}
+	var request models.CreateChallengeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apierror.FromBinding(err))
+		return
+	}
+	userObjectID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid user ID"))
+		return
+	}
+	userID := userObjectID.Hex()
+	ctx := c.Request.Context()
+
+	var opponentID string
+	if request.Username != "" {
+		var opponent models.User
+		err := getUserCollection().FindOne(ctx, bson.M{"username": request.Username}).Decode(&opponent)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.Error(apierror.NotFound("User not found"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal("Failed to find user", err))
+			return
+		}
+		opponentID = opponent.ID.Hex()
+		if opponentID == userID {
+			c.Error(apierror.Validation("You cannot challenge yourself", apierror.FieldError{Field: "username", Reason: "self"}))
+			return
+		}
+
+		var blocks []models.Block
+		err = findAll(ctx, config.GetCollection(blocksCollection), bson.M{"_id": bson.M{"$in": bson.A{blockID(userID, opponentID), blockID(opponentID, userID)}}}, options.Find(), &blocks)
+		if err != nil {
+			c.Error(apierror.Internal("Failed to check blocked users", err))
+			return
+		}
+		for _, b := range blocks {
+			if b.BlockerID == opponentID {
+				c.Error(apierror.NotFound("User not found"))
+				return
+			}
+		}
+		if len(blocks) > 0 {
+			c.Error(apierror.Conflict(apierror.CodeUserBlocked, "Unblock this user before challenging them"))
+			return
+		}
+	}
+
+	seed := rand.Int64()
+	if request.Seed != nil {
+		seed = *request.Seed
+	}
+	now := time.Now()
+	ch := models.Challenge{
+		ID:           primitive.NewObjectID(),
+		GameType:     request.GameType,
+		Seed:         seed,
+		ChallengerID: userID,
+		OpponentID:   opponentID,
+		State:        models.ChallengePending,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(h.cfg.ChallengeTTL),
+	}
+	if _, err := config.GetCollection(challengesCollection).InsertOne(ctx, ch); err != nil {
+		c.Error(apierror.Internal("Failed to create challenge", err))
+		return
+	}
+
+	challenges := []models.Challenge{ch}
+	if err := presentChallenges(ctx, challenges, userID, now); err != nil {
+		c.Error(apierror.Internal("Failed to retrieve usernames", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, challenges[0])
+}
+
+// ListChallenges is the authenticated player's challenge inbox: the
+// challenges they sent or received, optionally in one state, newest first.
+func (h *Handler) ListChallenges(c *gin.Context) {
+	state := c.Query("state")
+	if state != "" && !challengeStates[state] {
+		c.Error(apierror.Validation("State must be pending, open, playing, completed, declined or expired", apierror.FieldError{Field: "state", Reason: "oneof"}))
+		return
+	}
+	userID := c.GetString("user_id")
+	limit, skip := pageParams(c)
+	ctx := c.Request.Context()
+	now := time.Now()
+
+	filter := bson.M{"$or": bson.A{bson.M{"challenger_id": userID}, bson.M{"opponent_id": userID}}}
+	if state != "" {
+		filter = bson.M{"$and": bson.A{filter, challengeStateFilter(state, now)}}
+	}
+
+	collection := config.GetCollection(challengesCollection)
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "created_at", Value: -1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(skip))
+
+	challenges := []models.Challenge{}
+	if err := findAll(ctx, collection, filter, findOptions, &challenges); err != nil {
+		c.Error(apierror.Internal("Failed to retrieve challenges", err))
+		return
+	}
+	if err := presentChallenges(ctx, challenges, userID, now); err != nil {
+		c.Error(apierror.Internal("Failed to retrieve usernames", err))
+		return
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count challenges", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ChallengeListResponse{Challenges: challenges, Total: total})
+}
+
+// GetChallenge returns a challenge to its players, or to anyone with its
+// link while nobody has taken it up.
+func (h *Handler) GetChallenge(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid challenge ID"))
+		return
+	}
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+
+	var ch models.Challenge
+	err = config.GetCollection(challengesCollection).FindOne(ctx, bson.M{"_id": objectID}).Decode(&ch)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && !challengeVisible(ch, userID)) {
+		c.Error(apierror.NotFound("Challenge not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve challenge", err))
+		return
+	}
+
+	challenges := []models.Challenge{ch}
+	if err := presentChallenges(ctx, challenges, userID, time.Now()); err != nil {
+		c.Error(apierror.Internal("Failed to retrieve usernames", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, challenges[0])
+}
+
+// DeclineChallenge lets the player a challenge was sent to turn it down
+// before playing it.
+func (h *Handler) DeclineChallenge(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid challenge ID"))
+		return
+	}
+	userID := c.GetString("user_id")
+	ctx := c.Request.Context()
+	now := time.Now()
+
+	collection := config.GetCollection(challengesCollection)
+	var declined models.Challenge
+	err = collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":         objectID,
+			"opponent_id": userID,
+			"state":       bson.M{"$in": bson.A{models.ChallengePending, models.ChallengeOpen}},
+			"expires_at":  bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"state": models.ChallengeDeclined, "completed_at": now}},
+	).Decode(&declined)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		var ch models.Challenge
+		err := collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&ch)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments) || (err == nil && ch.OpponentID != userID):
+			c.Error(apierror.NotFound("Challenge not found"))
+		case err != nil:
+			c.Error(apierror.Internal("Failed to find challenge", err))
+		default:
+			c.Error(apierror.Conflict(apierror.CodeChallengeClosed, "The challenge can no longer be declined"))
+		}
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to decline challenge", err))
+		return
+	}
+	h.notifyFrom(ctx, declined.ChallengerID, notification.TypeChallengeDeclined, userID, "%s declined your challenge", map[string]string{"challenge_id": declined.ID.Hex()})
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Challenge declined"})
+}
+
+// StartChallengeGame claims a player's game in a challenge, returning
+// live.ErrChallengePlayed once they have started it and live.ErrNoChallenge
+// when it is not theirs to play or is no longer open. The challenger plays
+// first; the opponent, or the first other player to open a link challenge,
+// plays once the challenger's result is in. The live hub calls it when a
+// challenge game is opened.
+func StartChallengeGame(ctx context.Context, challengeID, userID string) (models.ChallengeGame, error) {
+	objectID, err := primitive.ObjectIDFromHex(challengeID)
+	if err != nil {
+		return models.ChallengeGame{}, live.ErrNoChallenge
+	}
+
+	collection := config.GetCollection(challengesCollection)
+	var ch models.Challenge
+	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&ch)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.ChallengeGame{}, live.ErrNoChallenge
+	}
+	if err != nil {
+		return models.ChallengeGame{}, fmt.Errorf("finding challenge: %w", err)
+	}
+
+	now := time.Now()
+	challenger := ch.ChallengerID == userID
+	switch {
+	case challenger && ch.Challenger != nil, ch.OpponentID == userID && ch.Opponent != nil:
+		return models.ChallengeGame{}, live.ErrChallengePlayed
+	case !now.Before(ch.ExpiresAt):
+		return models.ChallengeGame{}, live.ErrNoChallenge
+	case !challenger && (ch.OpponentID != "" && ch.OpponentID != userID):
+		return models.ChallengeGame{}, live.ErrNoChallenge
+	}
+
+	started := models.ChallengeResult{State: models.AttemptPlaying, StartedAt: now}
+	filter := bson.M{"_id": objectID, "expires_at": bson.M{"$gt": now}}
+	var update bson.M
+	if challenger {
+		filter["state"] = models.ChallengePending
+		filter["challenger"] = bson.M{"$exists": false}
+		update = bson.M{"challenger": started}
+	} else {
+		blocked, err := config.GetCollection(blocksCollection).CountDocuments(ctx,
+			bson.M{"_id": bson.M{"$in": bson.A{blockID(userID, ch.ChallengerID), blockID(ch.ChallengerID, userID)}}},
+		)
+		if err != nil {
+			return models.ChallengeGame{}, fmt.Errorf("checking blocked users: %w", err)
+		}
+		if blocked > 0 {
+			return models.ChallengeGame{}, live.ErrNoChallenge
+		}
+		filter["state"] = models.ChallengeOpen
+		filter["opponent_id"] = bson.M{"$in": bson.A{userID, nil}}
+		update = bson.M{"opponent_id": userID, "state": models.ChallengePlaying, "opponent": started}
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": update})
+	if err != nil {
+		return models.ChallengeGame{}, fmt.Errorf("saving challenge game: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return models.ChallengeGame{}, live.ErrNoChallenge
+	}
+
+	return models.ChallengeGame{
+		ChallengeID: challengeID,
+		PlayerID:    userID,
+		Challenger:  challenger,
+		GameType:    ch.GameType,
+		Seed:        ch.Seed,
+		State:       models.AttemptPlaying,
+		StartedAt:   now,
+	}, nil
+}
+
+// RecordChallengeGame stores how a challenge game ended. The challenger's
+// game opens the challenge to the opponent, who is only then notified; the
+// opponent's game decides it, in which case the completed challenge is
+// returned so both players can be told the outcome.
+func RecordChallengeGame(ctx context.Context, g models.ChallengeGame) (*models.Challenge, error) {
+	objectID, err := primitive.ObjectIDFromHex(g.ChallengeID)
+	if err != nil {
+		return nil, err
+	}
+	collection := config.GetCollection(challengesCollection)
+
+	if g.Challenger {
+		var ch models.Challenge
+		err := collection.FindOneAndUpdate(ctx,
+			bson.M{"_id": objectID, "challenger_id": g.PlayerID, "state": models.ChallengePending},
+			bson.M{"$set": bson.M{
+				"state":      models.ChallengeOpen,
+				"challenger": challengeResult(g),
+			}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&ch)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		challenges := []models.Challenge{ch}
+		if err := presentChallenges(ctx, challenges, ch.ChallengerID, time.Now()); err != nil {
+			return nil, err
+		}
+		notifyChallengeReceived(challenges[0])
+		return nil, nil
+	}
+
+	var ch models.Challenge
+	if err := collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&ch); err != nil {
+		return nil, fmt.Errorf("finding challenge: %w", err)
+	}
+	if ch.State != models.ChallengePlaying || ch.OpponentID != g.PlayerID || ch.Challenger == nil {
+		return nil, nil
+	}
+
+	opponent := challengeResult(g)
+	winnerID := challengeWinner(ch.ChallengerID, *ch.Challenger, ch.OpponentID, opponent)
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": objectID, "opponent_id": g.PlayerID, "state": models.ChallengePlaying},
+		bson.M{"$set": bson.M{
+			"state":        models.ChallengeCompleted,
+			"opponent":     opponent,
+			"winner_id":    winnerID,
+			"completed_at": g.FinishedAt,
+		}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, nil
+	}
+
+	ch.State = models.ChallengeCompleted
+	ch.Opponent = &opponent
+	ch.WinnerID = winnerID
+	ch.CompletedAt = g.FinishedAt
+	challenges := []models.Challenge{ch}
+	if err := presentChallenges(ctx, challenges, ch.ChallengerID, time.Now()); err != nil {
+		return nil, err
+	}
+	notifyChallengeCompleted(challenges[0])
+	return &challenges[0], nil
+}
+
+// CloseExpiredChallenges decides the challenges whose opponent was still
+// playing when they expired. Live sessions are kept in memory, so such a
+// game may have been lost to a restart and would never be recorded; it ends
+// as abandoned, which tells both players the outcome. The scheduler calls
+// it periodically.
+func CloseExpiredChallenges(ctx context.Context, now time.Time) error {
+	var expired []models.Challenge
+	err := findAll(ctx, config.GetCollection(challengesCollection),
+		bson.M{"state": models.ChallengePlaying, "expires_at": bson.M{"$lte": now}},
+		options.Find(), &expired,
+	)
+	if err != nil {
+		return fmt.Errorf("finding expired challenges: %w", err)
+	}
+
+	var errs []error
+	for _, ch := range expired {
+		g := models.ChallengeGame{
+			ChallengeID: ch.ID.Hex(),
+			PlayerID:    ch.OpponentID,
+			GameType:    ch.GameType,
+			Seed:        ch.Seed,
+			State:       models.AttemptAbandoned,
+			FinishedAt:  &now,
+		}
+		if ch.Opponent != nil {
+			g.StartedAt = ch.Opponent.StartedAt
+			g.TimeInSeconds = int(now.Sub(g.StartedAt) / time.Second)
+		}
+		if _, err := RecordChallengeGame(ctx, g); err != nil {
+			errs = append(errs, fmt.Errorf("challenge %s: %w", ch.ID.Hex(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func challengeResult(g models.ChallengeGame) models.ChallengeResult {
+	return models.ChallengeResult{
+		State:         g.State,
+		Score:         g.Score,
+		TimeInSeconds: g.TimeInSeconds,
+		StartedAt:     g.StartedAt,
+		FinishedAt:    g.FinishedAt,
+		Replay:        g.Replay,
+	}
+}
+
+// challengeWinner returns the player with the higher score, or the faster
+// one on equal scores, and no one for a draw.
+func challengeWinner(challengerID string, challenger models.ChallengeResult, opponentID string, opponent models.ChallengeResult) string {
+	switch {
+	case challenger.Score > opponent.Score:
+		return challengerID
+	case opponent.Score > challenger.Score:
+		return opponentID
+	case challenger.TimeInSeconds < opponent.TimeInSeconds:
+		return challengerID
+	case opponent.TimeInSeconds < challenger.TimeInSeconds:
+		return opponentID
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestChallengeWinner(t *testing.T) {
+	tests := []struct {
+		name       string
+		challenger models.ChallengeResult
+		opponent   models.ChallengeResult
+		want       string
+	}{
+		{name: "Higher Score Wins", challenger: models.ChallengeResult{Score: 20, TimeInSeconds: 90}, opponent: models.ChallengeResult{Score: 10, TimeInSeconds: 30}, want: "challenger"},
+		{name: "Opponent Higher Score", challenger: models.ChallengeResult{Score: 10}, opponent: models.ChallengeResult{Score: 20}, want: "opponent"},
+		{name: "Tie Faster Challenger", challenger: models.ChallengeResult{Score: 10, TimeInSeconds: 30}, opponent: models.ChallengeResult{Score: 10, TimeInSeconds: 60}, want: "challenger"},
+		{name: "Tie Faster Opponent", challenger: models.ChallengeResult{Score: 10, TimeInSeconds: 60}, opponent: models.ChallengeResult{Score: 10, TimeInSeconds: 30}, want: "opponent"},
+		{name: "Draw", challenger: models.ChallengeResult{Score: 10, TimeInSeconds: 30}, opponent: models.ChallengeResult{Score: 10, TimeInSeconds: 30}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, challengeWinner("challenger", tt.challenger, "opponent", tt.opponent))
+		})
+	}
+}
+
+func TestChallengeStateFilter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		state string
+		want  bson.M
+	}{
+		{state: models.ChallengePending, want: bson.M{"state": models.ChallengePending, "expires_at": bson.M{"$gt": now}}},
+		{state: models.ChallengeOpen, want: bson.M{"state": models.ChallengeOpen, "expires_at": bson.M{"$gt": now}}},
+		{state: models.ChallengeExpired, want: bson.M{"state": bson.M{"$in": bson.A{models.ChallengePending, models.ChallengeOpen}}, "expires_at": bson.M{"$lte": now}}},
+		{state: models.ChallengePlaying, want: bson.M{"state": models.ChallengePlaying}},
+		{state: models.ChallengeCompleted, want: bson.M{"state": models.ChallengeCompleted}},
+		{state: models.ChallengeDeclined, want: bson.M{"state": models.ChallengeDeclined}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			assert.Equal(t, tt.want, challengeStateFilter(tt.state, now))
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/live"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const dailyAttemptsCollection = "daily_attempts"
+
+var errDailyBanned = errors.New("banned users cannot play daily challenges")
+
+// dailyAttemptFilter selects a player's attempt at one daily challenge.
+func dailyAttemptFilter(attempt models.DailyAttempt) bson.M {
+	filter := bson.M{"date": attempt.Date, "game_type": attempt.GameType}
+	if attempt.IsGuest {
+		filter["guest_id"] = attempt.GuestID
+	} else {
+		filter["user_id"] = attempt.UserID
+	}
+	return filter
+}
+
+// EnsureDailyIndexes creates the unique index that allows each player a
+// single attempt at each daily challenge. Registered attempts have no
+// guest_id and guest attempts no user_id, so one index covers both.
+func EnsureDailyIndexes(ctx context.Context) error {
+	_, err := config.GetCollection(dailyAttemptsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "date", Value: 1},
+			{Key: "game_type", Value: 1},
+			{Key: "user_id", Value: 1},
+			{Key: "guest_id", Value: 1},
+		},
+		Options: options.Index().SetName("one_attempt_per_player").SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("creating daily attempt index: %w", err)
+	}
+	return nil
+}
+
+// StartDailyAttempt claims a player's attempt at a daily challenge, returning
+// live.ErrDailyAttempted if they already have one. The live hub calls it
+// when a daily game is opened, so a reconnect or a new tab cannot retry the
+// board.
+func StartDailyAttempt(ctx context.Context, attempt models.DailyAttempt) error {
+	if attempt.IsGuest {
+		attempt.Username = "Guest_" + attempt.GuestID[0:6]
+	} else {
+		objectID, err := primitive.ObjectIDFromHex(attempt.UserID)
+		if err != nil {
+			return fmt.Errorf("invalid user ID: %w", err)
+		}
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"_id": objectID}).Decode(&user); err != nil {
+			return fmt.Errorf("finding daily player: %w", err)
+		}
+		if user.Banned {
+			return errDailyBanned
+		}
+		attempt.Username = user.Username
+	}
+
+	result, err := config.GetCollection(dailyAttemptsCollection).UpdateOne(ctx,
+		dailyAttemptFilter(attempt),
+		bson.M{"$setOnInsert": attempt},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent upsert for the same player won the race.
+		return live.ErrDailyAttempted
+	}
+	if err != nil {
+		return fmt.Errorf("saving daily attempt: %w", err)
+	}
+	if result.UpsertedCount == 0 {
+		return live.ErrDailyAttempted
+	}
+	return nil
+}
+
+// RecordDailyAttempt stores how a daily attempt ended. Only an attempt that
+// is still being played is updated, so the first result stands.
+func RecordDailyAttempt(ctx context.Context, attempt models.DailyAttempt) error {
+	filter := dailyAttemptFilter(attempt)
+	filter["state"] = models.AttemptPlaying
+
+	_, err := config.GetCollection(dailyAttemptsCollection).UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{
+			"state":           attempt.State,
+			"score":           attempt.Score,
+			"time_in_seconds": attempt.TimeInSeconds,
+			"finished_at":     attempt.FinishedAt,
+		},
+	})
+	return err
+}
+
+// dailyGameType reads the gameType query parameter, defaulting to normal.
+func dailyGameType(c *gin.Context) (string, bool) {
+	gameType := c.DefaultQuery("gameType", "normal")
+	if gameType != "normal" && gameType != "infinite" {
+		c.Error(apierror.Validation("Game type must be normal or infinite", apierror.FieldError{Field: "gameType", Reason: "oneof"}))
+		return "", false
+	}
+	return gameType, true
+}
+
+// hideTodaysSeeds clears the seeds of attempts at today's challenges, which
+// would give the board away to players who have not had their attempt.
+func hideTodaysSeeds(attempts []models.DailyAttempt, today string) {
+	for i := range attempts {
+		if attempts[i].Date == today {
+			attempts[i].Seed = 0
+		}
+	}
+}
+
+// GetDailyLeaderboard ranks the finished attempts of registered players at
+// a daily challenge, today's unless a past date is given, by score and then
+// by time.
+func (h *Handler) GetDailyLeaderboard(c *gin.Context) {
+	gameType, ok := dailyGameType(c)
+	if !ok {
+		return
+	}
+
+	today := game.DailyDate(time.Now())
+	date := c.DefaultQuery("date", today)
+	if _, err := time.Parse(game.DailyDateLayout, date); err != nil || date > today {
+		c.Error(apierror.Validation("Date must be today or an earlier day formatted as YYYY-MM-DD", apierror.FieldError{Field: "date", Reason: "date"}))
+		return
+	}
+	limit, skip := pageParams(c)
+
+	collection := config.GetCollection(dailyAttemptsCollection)
+	filter := bson.M{"date": date, "game_type": gameType, "is_guest": false, "state": bson.M{"$ne": models.AttemptPlaying}}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "score", Value: -1}, {Key: "time_in_seconds", Value: 1}, {Key: "finished_at", Value: 1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(skip))
+
+	attempts := []models.DailyAttempt{}
+	if err := findAll(c.Request.Context(), collection, filter, findOptions, &attempts); err != nil {
+		c.Error(apierror.Internal("Failed to retrieve daily leaderboard", err))
+		return
+	}
+	hideTodaysSeeds(attempts, today)
+
+	total, err := collection.CountDocuments(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count daily attempts", err))
+		return
+	}
+
+	response := models.DailyLeaderboardResponse{Attempts: attempts, Total: total, Date: date, GameType: gameType}
+	if date != today {
+		response.Seed = game.DailySeed([]byte(h.cfg.DailySeedKey), date, gameType)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetDailyArchive summarises the past daily challenges of a game type that
+// registered players played, most recent first, with the seeds to replay
+// them.
+func (h *Handler) GetDailyArchive(c *gin.Context) {
+	gameType, ok := dailyGameType(c)
+	if !ok {
+		return
+	}
+	limit, skip := pageParams(c)
+
+	ctx := c.Request.Context()
+	collection := config.GetCollection(dailyAttemptsCollection)
+	pastDays := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"game_type": gameType,
+			"date":      bson.M{"$lt": game.DailyDate(time.Now())},
+			"is_guest":  false,
+			"state":     bson.M{"$ne": models.AttemptPlaying},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}, {Key: "time_in_seconds", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":          "$date",
+			"seed":         bson.M{"$first": "$seed"},
+			"players":      bson.M{"$sum": 1},
+			"top_score":    bson.M{"$first": "$score"},
+			"top_username": bson.M{"$first": "$username"},
+		}}},
+	}
+
+	page := append(mongo.Pipeline{}, pastDays...)
+	page = append(page,
+		bson.D{{Key: "$sort", Value: bson.M{"_id": -1}}},
+		bson.D{{Key: "$skip", Value: skip}},
+		bson.D{{Key: "$limit", Value: limit}},
+		bson.D{{Key: "$addFields", Value: bson.M{"date": "$_id", "game_type": gameType}}},
+	)
+	cursor, err := collection.Aggregate(ctx, page)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve daily archive", err))
+		return
+	}
+	days := []models.DailySummary{}
+	if err := cursor.All(ctx, &days); err != nil {
+		c.Error(apierror.Internal("Failed to decode daily archive", err))
+		return
+	}
+
+	count := append(mongo.Pipeline{}, pastDays...)
+	count = append(count, bson.D{{Key: "$count", Value: "total"}})
+	cursor, err = collection.Aggregate(ctx, count)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count daily archive", err))
+		return
+	}
+	var counted []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &counted); err != nil {
+		c.Error(apierror.Internal("Failed to count daily archive", err))
+		return
+	}
+	var total int64
+	if len(counted) > 0 {
+		total = counted[0].Total
+	}
+
+	c.JSON(http.StatusOK, models.DailyArchiveResponse{Days: days, Total: total, GameType: gameType})
+}
+
+// GetDailyAttempts lists the authenticated player's daily challenge
+// attempts, most recent first. Guests see the attempts made with their
+// guest ID.
+func (h *Handler) GetDailyAttempts(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.Error(apierror.BadRequest("User ID not found"))
+		return
+	}
+	limit, skip := pageParams(c)
+
+	collection := config.GetCollection(dailyAttemptsCollection)
+	filter := bson.M{"user_id": userID}
+	if c.GetBool("is_guest") {
+		filter = bson.M{"guest_id": userID}
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "date", Value: -1}, {Key: "game_type", Value: 1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(skip))
+
+	attempts := []models.DailyAttempt{}
+	if err := findAll(c.Request.Context(), collection, filter, findOptions, &attempts); err != nil {
+		c.Error(apierror.Internal("Failed to retrieve daily attempts", err))
+		return
+	}
+	hideTodaysSeeds(attempts, game.DailyDate(time.Now()))
+
+	total, err := collection.CountDocuments(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count daily attempts", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.DailyAttemptListResponse{Attempts: attempts, Total: total})
+}
@@ -0,0 +1,461 @@
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/markbakos/infinite-minesweeper/server/notification"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	friendshipsCollection = "friendships"
+	blocksCollection      = "blocks"
+
+	leaderboardScopeGlobal  = "global"
+	leaderboardScopeFriends = "friends"
+)
+
+// friendshipID identifies the friendship between two users regardless of
+// who sent the request.
+func friendshipID(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + ":" + b
+}
+
+func blockID(blockerID, blockedID string) string {
+	return blockerID + ">" + blockedID
+}
+
+// accountID returns the ID of the authenticated user, reporting an error
+// when they are a guest, who cannot have friends.
+func accountID(c *gin.Context) (string, bool) {
+	if c.GetBool("is_guest") {
+		c.Error(apierror.Forbidden(apierror.CodeForbidden, "Guests cannot have friends"))
+		return "", false
+	}
+	objectID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid user ID"))
+		return "", false
+	}
+	return objectID.Hex(), true
+}
+
+// otherUserID returns the user named by the id path parameter, who must not
+// be the authenticated user.
+func otherUserID(c *gin.Context, userID string) (string, bool) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid user ID"))
+		return "", false
+	}
+	if objectID.Hex() == userID {
+		c.Error(apierror.BadRequest("You cannot do this to yourself"))
+		return "", false
+	}
+	return objectID.Hex(), true
+}
+
+// GetFriends lists the authenticated user's friends, pending requests and
+// blocked users.
+func (h *Handler) GetFriends(c *gin.Context) {
+	userID, ok := accountID(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	var friendships []models.Friendship
+	if err := findAll(ctx, config.GetCollection(friendshipsCollection), bson.M{"users": userID}, options.Find(), &friendships); err != nil {
+		c.Error(apierror.Internal("Failed to retrieve friends", err))
+		return
+	}
+	var blocks []models.Block
+	if err := findAll(ctx, config.GetCollection(blocksCollection), bson.M{"blocker_id": userID}, options.Find(), &blocks); err != nil {
+		c.Error(apierror.Internal("Failed to retrieve blocked users", err))
+		return
+	}
+
+	var otherIDs []string
+	for _, f := range friendships {
+		otherIDs = append(otherIDs, otherFriend(f, userID))
+	}
+	for _, b := range blocks {
+		otherIDs = append(otherIDs, b.BlockedID)
+	}
+	usernames, err := lookupUsernames(ctx, otherIDs)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve usernames", err))
+		return
+	}
+
+	response := models.FriendListResponse{
+		Friends:  []models.Friend{},
+		Incoming: []models.Friend{},
+		Outgoing: []models.Friend{},
+		Blocked:  []models.Friend{},
+	}
+	for _, f := range friendships {
+		otherID := otherFriend(f, userID)
+		friend := models.Friend{UserID: otherID, Username: usernames[otherID], Since: f.CreatedAt}
+		switch {
+		case f.State == models.FriendshipAccepted:
+			if f.AcceptedAt != nil {
+				friend.Since = *f.AcceptedAt
+			}
+			response.Friends = append(response.Friends, friend)
+		case f.AddresseeID == userID:
+			response.Incoming = append(response.Incoming, friend)
+		default:
+			response.Outgoing = append(response.Outgoing, friend)
+		}
+	}
+	for _, b := range blocks {
+		response.Blocked = append(response.Blocked, models.Friend{UserID: b.BlockedID, Username: usernames[b.BlockedID], Since: b.CreatedAt})
+	}
+	for _, list := range [][]models.Friend{response.Friends, response.Incoming, response.Outgoing, response.Blocked} {
+		slices.SortFunc(list, func(a, b models.Friend) int { return cmp.Compare(a.Username, b.Username) })
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func otherFriend(f models.Friendship, userID string) string {
+	if f.RequesterID == userID {
+		return f.AddresseeID
+	}
+	return f.RequesterID
+}
+
+// lookupUsernames maps user IDs to their current usernames.
+func lookupUsernames(ctx context.Context, userIDs []string) (map[string]string, error) {
+	usernames := make(map[string]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return usernames, nil
+	}
+
+	objectIDs := make([]primitive.ObjectID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+
+	var users []models.User
+	findOptions := options.Find().SetProjection(bson.M{"username": 1})
+	if err := findAll(ctx, getUserCollection(), bson.M{"_id": bson.M{"$in": objectIDs}}, findOptions, &users); err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		usernames[u.ID.Hex()] = u.Username
+	}
+	return usernames, nil
+}
+
+// SendFriendRequest asks another user to be friends. A request to a user
+// who has already asked the caller accepts theirs instead.
+func (h *Handler) SendFriendRequest(c *gin.Context) {
+	userID, ok := accountID(c)
+	if !ok {
+		return
+	}
+	var request models.FriendRequestRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apierror.FromBinding(err))
+		return
+	}
+	ctx := c.Request.Context()
+
+	var target models.User
+	err := getUserCollection().FindOne(ctx, bson.M{"username": request.Username}).Decode(&target)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.Error(apierror.NotFound("User not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to find user", err))
+		return
+	}
+	targetID := target.ID.Hex()
+	if targetID == userID {
+		c.Error(apierror.Validation("You cannot send a friend request to yourself", apierror.FieldError{Field: "username", Reason: "self"}))
+		return
+	}
+
+	var blocks []models.Block
+	err = findAll(ctx, config.GetCollection(blocksCollection), bson.M{"_id": bson.M{"$in": bson.A{blockID(userID, targetID), blockID(targetID, userID)}}}, options.Find(), &blocks)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to check blocked users", err))
+		return
+	}
+	for _, b := range blocks {
+		if b.BlockerID == targetID {
+			// Users who blocked the caller are hidden from them.
+			c.Error(apierror.NotFound("User not found"))
+			return
+		}
+	}
+	if len(blocks) > 0 {
+		c.Error(apierror.Conflict(apierror.CodeUserBlocked, "Unblock this user before sending them a friend request"))
+		return
+	}
+
+	collection := config.GetCollection(friendshipsCollection)
+	id := friendshipID(userID, targetID)
+	now := time.Now()
+	result, err := collection.UpdateOne(ctx,
+		bson.M{"_id": id, "state": models.FriendshipPending, "requester_id": targetID},
+		bson.M{"$set": bson.M{"state": models.FriendshipAccepted, "accepted_at": now}},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to accept friend request", err))
+		return
+	}
+	if result.MatchedCount > 0 {
+		h.notifyFrom(ctx, targetID, notification.TypeFriendAccepted, userID, "%s accepted your friend request", nil)
+		c.JSON(http.StatusOK, models.MessageResponse{Message: "Friend request accepted"})
+		return
+	}
+
+	_, err = collection.InsertOne(ctx, models.Friendship{
+		ID:          id,
+		Users:       []string{userID, targetID},
+		RequesterID: userID,
+		AddresseeID: targetID,
+		State:       models.FriendshipPending,
+		CreatedAt:   now,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		var existing models.Friendship
+		if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&existing); err != nil {
+			c.Error(apierror.Internal("Failed to find friend request", err))
+			return
+		}
+		if existing.State == models.FriendshipAccepted {
+			c.Error(apierror.Conflict(apierror.CodeAlreadyFriends, "You are already friends"))
+			return
+		}
+		c.Error(apierror.Conflict(apierror.CodeRequestPending, "A friend request is already pending"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to send friend request", err))
+		return
+	}
+
+	h.notifyFrom(ctx, targetID, notification.TypeFriendRequest, userID, "%s sent you a friend request", nil)
+
+	c.JSON(http.StatusCreated, models.MessageResponse{Message: "Friend request sent"})
+}
+
+// AcceptFriendRequest accepts the request the user in the path sent to the
+// authenticated user.
+func (h *Handler) AcceptFriendRequest(c *gin.Context) {
+	userID, ok := accountID(c)
+	if !ok {
+		return
+	}
+	requesterID, ok := otherUserID(c, userID)
+	if !ok {
+		return
+	}
+
+	result, err := config.GetCollection(friendshipsCollection).UpdateOne(c.Request.Context(),
+		bson.M{"_id": friendshipID(userID, requesterID), "state": models.FriendshipPending, "addressee_id": userID},
+		bson.M{"$set": bson.M{"state": models.FriendshipAccepted, "accepted_at": time.Now()}},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to accept friend request", err))
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.Error(apierror.NotFound("Friend request not found"))
+		return
+	}
+	h.notifyFrom(c.Request.Context(), requesterID, notification.TypeFriendAccepted, userID, "%s accepted your friend request", nil)
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Friend request accepted"})
+}
+
+// DeclineFriendRequest declines a request from the user in the path, or
+// withdraws one sent to them.
+func (h *Handler) DeclineFriendRequest(c *gin.Context) {
+	h.deleteFriendship(c, models.FriendshipPending, "Friend request not found", "Friend request removed")
+}
+
+// RemoveFriend ends a friendship with the user in the path.
+func (h *Handler) RemoveFriend(c *gin.Context) {
+	h.deleteFriendship(c, models.FriendshipAccepted, "Friend not found", "Friend removed")
+}
+
+func (h *Handler) deleteFriendship(c *gin.Context, state, notFound, message string) {
+	userID, ok := accountID(c)
+	if !ok {
+		return
+	}
+	otherID, ok := otherUserID(c, userID)
+	if !ok {
+		return
+	}
+
+	result, err := config.GetCollection(friendshipsCollection).DeleteOne(c.Request.Context(), bson.M{"_id": friendshipID(userID, otherID), "state": state})
+	if err != nil {
+		c.Error(apierror.Internal("Failed to update friends", err))
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.Error(apierror.NotFound(notFound))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: message})
+}
+
+// BlockUser blocks the user in the path, ending any friendship or request
+// between them and the authenticated user.
+func (h *Handler) BlockUser(c *gin.Context) {
+	userID, ok := accountID(c)
+	if !ok {
+		return
+	}
+	blockedID, ok := otherUserID(c, userID)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	objectID, _ := primitive.ObjectIDFromHex(blockedID)
+	count, err := getUserCollection().CountDocuments(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		c.Error(apierror.Internal("Failed to find user", err))
+		return
+	}
+	if count == 0 {
+		c.Error(apierror.NotFound("User not found"))
+		return
+	}
+
+	id := blockID(userID, blockedID)
+	_, err = config.GetCollection(blocksCollection).UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$setOnInsert": models.Block{ID: id, BlockerID: userID, BlockedID: blockedID, CreatedAt: time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to block user", err))
+		return
+	}
+	if _, err := config.GetCollection(friendshipsCollection).DeleteOne(ctx, bson.M{"_id": friendshipID(userID, blockedID)}); err != nil {
+		c.Error(apierror.Internal("Failed to remove friendship", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "User blocked"})
+}
+
+// UnblockUser lifts a block on the user in the path.
+func (h *Handler) UnblockUser(c *gin.Context) {
+	userID, ok := accountID(c)
+	if !ok {
+		return
+	}
+	blockedID, ok := otherUserID(c, userID)
+	if !ok {
+		return
+	}
+
+	result, err := config.GetCollection(blocksCollection).DeleteOne(c.Request.Context(), bson.M{"_id": blockID(userID, blockedID)})
+	if err != nil {
+		c.Error(apierror.Internal("Failed to unblock user", err))
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.Error(apierror.NotFound("Blocked user not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "User unblocked"})
+}
+
+// friendIDs returns the IDs of userID's friends.
+func friendIDs(ctx context.Context, userID string) ([]string, error) {
+	var friendships []models.Friendship
+	err := findAll(ctx, config.GetCollection(friendshipsCollection), bson.M{"users": userID, "state": models.FriendshipAccepted}, options.Find(), &friendships)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(friendships))
+	for _, f := range friendships {
+		ids = append(ids, otherFriend(f, userID))
+	}
+	return ids, nil
+}
+
+// blockerIDs returns the IDs of the users who have blocked userID.
+func blockerIDs(ctx context.Context, userID string) ([]string, error) {
+	var blocks []models.Block
+	if err := findAll(ctx, config.GetCollection(blocksCollection), bson.M{"blocked_id": userID}, options.Find(), &blocks); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		ids = append(ids, b.BlockerID)
+	}
+	return ids, nil
+}
+
+// scopeLeaderboard narrows a leaderboard filter to what the viewer may see.
+// The friends scope keeps only the viewer and their friends, and signed in
+// viewers never see the users who blocked them.
+func (h *Handler) scopeLeaderboard(c *gin.Context, filter bson.M, scope string) bool {
+	friends := scope == leaderboardScopeFriends
+	switch {
+	case c.GetString("user_id") == "" && friends:
+		c.Error(apierror.Unauthorized(apierror.CodeMissingToken, "Sign in to see your friends' scores"))
+		return false
+	case c.GetString("user_id") == "", c.GetBool("is_guest") && !friends:
+		// Only registered users can be blocked.
+		return true
+	}
+	userID, ok := accountID(c)
+	if !ok {
+		return false
+	}
+
+	if friends {
+		ids, err := friendIDs(c.Request.Context(), userID)
+		if err != nil {
+			c.Error(apierror.Internal("Failed to retrieve friends", err))
+			return false
+		}
+		filter["user_id"] = bson.M{"$in": append(ids, userID)}
+		filter["is_guest"] = false
+		return true
+	}
+
+	blockers, err := blockerIDs(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve blocked users", err))
+		return false
+	}
+	if len(blockers) > 0 {
+		filter["user_id"] = bson.M{"$nin": blockers}
+	}
+	return true
+}
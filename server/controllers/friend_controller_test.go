@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFriendshipID(t *testing.T) {
+	a, b := primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()
+
+	assert.Equal(t, friendshipID(a, b), friendshipID(b, a), "either user may send the request")
+	assert.NotEqual(t, blockID(a, b), blockID(b, a), "blocks are one-way")
+	assert.NotEqual(t, friendshipID(a, b), blockID(a, b))
+}
+
+func TestOtherFriend(t *testing.T) {
+	f := models.Friendship{RequesterID: "requester", AddresseeID: "addressee"}
+
+	assert.Equal(t, "addressee", otherFriend(f, "requester"))
+	assert.Equal(t, "requester", otherFriend(f, "addressee"))
+}
+
+func TestAccountID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name    string
+		userID  string
+		isGuest bool
+		wantOK  bool
+	}{
+		{name: "Registered User", userID: userID, wantOK: true},
+		{name: "Guest", userID: userID, isGuest: true},
+		{name: "Invalid User ID", userID: "guest_123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Set("user_id", tt.userID)
+			c.Set("is_guest", tt.isGuest)
+
+			id, ok := accountID(c)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, userID, id)
+				assert.Empty(t, c.Errors)
+			} else {
+				assert.Len(t, c.Errors, 1)
+			}
+		})
+	}
+}
+
+func TestOtherUserID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID, otherID := primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name   string
+		param  string
+		wantOK bool
+	}{
+		{name: "Other User", param: otherID, wantOK: true},
+		{name: "Self", param: userID},
+		{name: "Invalid ID", param: "nope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Params = gin.Params{{Key: "id", Value: tt.param}}
+
+			id, ok := otherUserID(c, userID)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, otherID, id)
+				assert.Empty(t, c.Errors)
+			} else {
+				assert.Len(t, c.Errors, 1)
+			}
+		})
+	}
+}
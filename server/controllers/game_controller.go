@@ -7,29 +7,40 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/audit"
 	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
 	"github.com/markbakos/infinite-minesweeper/server/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func SaveGameRecord(c *gin.Context) {
-	var gameRecord models.GameRecord
+// recentGamesKept is the number of saved games kept for a player's profile.
+const recentGamesKept = 10
 
-	if err := c.ShouldBindJSON(&gameRecord); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+func (h *Handler) SaveGameRecord(c *gin.Context) {
+	var request models.SaveGameRecordRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apierror.FromBinding(err))
 		return
 	}
 
+	gameRecord := models.GameRecord{
+		GameType:      request.GameType,
+		Score:         request.Score,
+		TimeInSeconds: request.TimeInSeconds,
+	}
+
 	if gameRecord.GameType != "normal" && gameRecord.GameType != "infinite" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Game type must be normal or infinite"})
+		c.Error(apierror.Validation("Game type must be normal or infinite", apierror.FieldError{Field: "game_type", Reason: "oneof"}))
 		return
 	}
 
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID not found"})
+		c.Error(apierror.BadRequest("User ID not found"))
 		return
 	}
 
@@ -57,9 +68,17 @@ func SaveGameRecord(c *gin.Context) {
 
 				_, err = leaderboardCollection.UpdateOne(context.Background(), filter, update)
 				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update guest game record"})
+					c.Error(apierror.Internal("Failed to update guest game record", err))
 					return
 				}
+				metrics.LeaderboardUpdates.WithLabelValues(gameRecord.GameType).Inc()
+
+				previousScore := existingEntry.Score
+				existingEntry.Score = gameRecord.Score
+				existingEntry.TimeInSeconds = gameRecord.TimeInSeconds
+				existingEntry.PlayedAt = gameRecord.PlayedAt
+				h.publishLeaderboardEntry(existingEntry)
+				h.notifyLeaderboardChange(existingEntry, previousScore, true)
 			}
 		} else {
 			leaderboardEntry := models.LeaderboardEntry{
@@ -75,22 +94,30 @@ func SaveGameRecord(c *gin.Context) {
 
 			_, err = leaderboardCollection.InsertOne(context.Background(), leaderboardEntry)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save guest game record"})
+				c.Error(apierror.Internal("Failed to save guest game record", err))
 				return
 			}
+			metrics.LeaderboardUpdates.WithLabelValues(gameRecord.GameType).Inc()
+			h.publishLeaderboardEntry(leaderboardEntry)
+			h.notifyLeaderboardChange(leaderboardEntry, 0, false)
 		}
 	} else {
 		userCollection := getUserCollection()
 		objectID, err := primitive.ObjectIDFromHex(userID.(string))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			c.Error(apierror.BadRequest("Invalid user ID"))
 			return
 		}
 
 		var user models.User
 		err = userCollection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&user)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			c.Error(apierror.NotFound("User not found"))
+			return
+		}
+
+		if user.Banned {
+			c.Error(apierror.Forbidden(apierror.CodeAccountBanned, "This account has been banned"))
 			return
 		}
 
@@ -120,10 +147,17 @@ func SaveGameRecord(c *gin.Context) {
 		_, err = userCollection.UpdateOne(
 			context.Background(),
 			bson.M{"_id": objectID},
-			bson.M{"$set": bson.M{"game_records": updatedRecords}},
+			bson.M{
+				"$set": bson.M{"game_records": updatedRecords},
+				"$push": bson.M{"recent_games": bson.M{
+					"$each":     []models.GameRecord{gameRecord},
+					"$position": 0,
+					"$slice":    recentGamesKept,
+				}},
+			},
 		)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user's game records"})
+			c.Error(apierror.Internal("Failed to update user's game records", err))
 			return
 		}
 
@@ -144,9 +178,17 @@ func SaveGameRecord(c *gin.Context) {
 
 				_, err = leaderboardCollection.UpdateOne(context.Background(), filter, update)
 				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update leaderboard entry"})
+					c.Error(apierror.Internal("Failed to update leaderboard entry", err))
 					return
 				}
+				metrics.LeaderboardUpdates.WithLabelValues(gameRecord.GameType).Inc()
+
+				previousScore := existingLeaderboardEntry.Score
+				existingLeaderboardEntry.Score = gameRecord.Score
+				existingLeaderboardEntry.TimeInSeconds = gameRecord.TimeInSeconds
+				existingLeaderboardEntry.PlayedAt = gameRecord.PlayedAt
+				h.publishLeaderboardEntry(existingLeaderboardEntry)
+				h.notifyLeaderboardChange(existingLeaderboardEntry, previousScore, true)
 			} else {
 				leaderboardEntry := models.LeaderboardEntry{
 					ID:            primitive.NewObjectID(),
@@ -161,20 +203,31 @@ func SaveGameRecord(c *gin.Context) {
 
 				_, err = leaderboardCollection.InsertOne(context.Background(), leaderboardEntry)
 				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save game record to leaderboard"})
+					c.Error(apierror.Internal("Failed to save game record to leaderboard", err))
 					return
 				}
+				metrics.LeaderboardUpdates.WithLabelValues(gameRecord.GameType).Inc()
+				h.publishLeaderboardEntry(leaderboardEntry)
+				h.notifyLeaderboardChange(leaderboardEntry, 0, false)
 			}
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Game record saved successfully"})
+	metrics.GamesSaved.WithLabelValues(gameRecord.GameType, metrics.PlayerKind(isGuest == true)).Inc()
+	audit.Record(c, audit.EventGameRecordSaved, userID.(string), "", map[string]any{
+		"game_type":       gameRecord.GameType,
+		"score":           gameRecord.Score,
+		"time_in_seconds": gameRecord.TimeInSeconds,
+		"guest":           isGuest == true,
+	})
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Game record saved successfully"})
 }
 
-func GetUserGameRecords(c *gin.Context) {
+func (h *Handler) GetUserGameRecords(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID not found"})
+		c.Error(apierror.BadRequest("User ID not found"))
 		return
 	}
 
@@ -190,14 +243,14 @@ func GetUserGameRecords(c *gin.Context) {
 
 		cursor, err := leaderboardCollection.Find(context.Background(), filter)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve guest records"})
+			c.Error(apierror.Internal("Failed to retrieve guest records", err))
 			return
 		}
 		defer cursor.Close(context.Background())
 
 		var records []models.LeaderboardEntry
 		if err := cursor.All(context.Background(), &records); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode guest records"})
+			c.Error(apierror.Internal("Failed to decode guest records", err))
 			return
 		}
 
@@ -211,15 +264,15 @@ func GetUserGameRecords(c *gin.Context) {
 			})
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"records": gameRecords,
+		c.JSON(http.StatusOK, models.GameRecordsResponse{
+			Records: gameRecords,
 		})
 		return
 	}
 
 	objectID, err := primitive.ObjectIDFromHex(userID.(string))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+		c.Error(apierror.BadRequest("Invalid user ID"))
 		return
 	}
 
@@ -228,7 +281,7 @@ func GetUserGameRecords(c *gin.Context) {
 	var user models.User
 	err = userCollection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&user)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		c.Error(apierror.NotFound("User not found"))
 		return
 	}
 
@@ -245,12 +298,12 @@ func GetUserGameRecords(c *gin.Context) {
 		filteredRecords = user.GameRecords
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"records": filteredRecords,
+	c.JSON(http.StatusOK, models.GameRecordsResponse{
+		Records: filteredRecords,
 	})
 }
 
-func GetLeaderboard(c *gin.Context) {
+func (h *Handler) GetLeaderboard(c *gin.Context) {
 	gameType := c.Query("gameType")
 	if gameType == "" {
 		gameType = "normal"
@@ -270,42 +323,37 @@ func GetLeaderboard(c *gin.Context) {
 		}
 	}
 
-	leaderboardCollection := config.GetCollection("leaderboard")
-
-	findOptions := options.Find()
-	findOptions.SetSort(bson.D{{Key: "score", Value: -1}})
-	findOptions.SetLimit(int64(limit))
-	findOptions.SetSkip(int64(skip))
-
-	cursor, err := leaderboardCollection.Find(
-		context.Background(),
-		bson.M{"game_type": gameType},
-		findOptions,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve leaderboard"})
+	scope := c.Query("scope")
+	if scope != "" && scope != leaderboardScopeGlobal && scope != leaderboardScopeFriends {
+		c.Error(apierror.Validation("Scope must be global or friends", apierror.FieldError{Field: "scope", Reason: "oneof"}))
 		return
 	}
-	defer cursor.Close(context.Background())
+	filter := leaderboardFilter(gameType)
+	if !h.scopeLeaderboard(c, filter, scope) {
+		return
+	}
+
+	leaderboardCollection := config.GetCollection("leaderboard")
 
-	var leaderboard []models.LeaderboardEntry
-	if err := cursor.All(context.Background(), &leaderboard); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode leaderboard entries"})
+	leaderboard, err := findLeaderboardEntries(context.Background(), filter, limit, skip)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve leaderboard", err))
 		return
 	}
 
 	totalCount, err := leaderboardCollection.CountDocuments(
 		context.Background(),
-		bson.M{"game_type": gameType},
+		filter,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count leaderboard entries"})
+		c.Error(apierror.Internal("Failed to count leaderboard entries", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"leaderboard": leaderboard,
-		"total":       totalCount,
-		"game_type":   gameType,
+	c.JSON(http.StatusOK, models.LeaderboardPageResponse{
+		Leaderboard: leaderboard,
+		Total:       totalCount,
+		GameType:    gameType,
+		Scope:       scope,
 	})
 }
@@ -6,11 +6,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/audit"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
+	"github.com/markbakos/infinite-minesweeper/server/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"os"
 )
 
-func CreateGuestSession(c *gin.Context) {
+func (h *Handler) CreateGuestSession(c *gin.Context) {
 	guestID := primitive.NewObjectID().Hex()
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
@@ -19,15 +22,18 @@ func CreateGuestSession(c *gin.Context) {
 		"exp":     time.Now().Add(time.Hour * 24).Unix(),
 	})
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	tokenString, err := token.SignedString([]byte(h.cfg.JWTSecret))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate guest token"})
+		c.Error(apierror.Internal("Failed to generate guest token", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token":    tokenString,
-		"username": "Guest_" + guestID[0:6],
-		"guest":    true,
+	metrics.GuestSessions.Inc()
+	audit.Record(c, audit.EventGuestSessionCreated, guestID, "", nil)
+
+	c.JSON(http.StatusOK, models.GuestSessionResponse{
+		Token:    tokenString,
+		Username: "Guest_" + guestID[0:6],
+		Guest:    true,
 	})
 }
@@ -2,22 +2,24 @@ package controllers
 
 import (
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/markbakos/infinite-minesweeper/server/config"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCreateGuestSession(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	os.Setenv("JWT_SECRET", "test-secret-key")
+	h := NewHandler(&config.Config{JWTSecret: "test-secret-key"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
 
 	router := gin.New()
-	router.GET("/guest", CreateGuestSession)
+	router.GET("/guest", h.CreateGuestSession)
 
 	req := httptest.NewRequest(http.MethodGet, "/guest", nil)
 	resp := httptest.NewRecorder()
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Handler carries the dependencies shared by the HTTP handlers. Handlers
+// report failures with c.Error and leave rendering to middleware.ErrorHandler.
+type Handler struct {
+	cfg *config.Config
+	log *slog.Logger
+}
+
+func NewHandler(cfg *config.Config, logger *slog.Logger) *Handler {
+	return &Handler{cfg: cfg, log: logger}
+}
+
+// pageParams reads the limit and skip query parameters, ignoring values
+// that are not positive.
+func pageParams(c *gin.Context) (limit, skip int) {
+	limit = 20
+	if val, err := strconv.Atoi(c.Query("limit")); err == nil && val > 0 {
+		limit = val
+	}
+	if val, err := strconv.Atoi(c.Query("skip")); err == nil && val >= 0 {
+		skip = val
+	}
+	return limit, skip
+}
+
+// findAll decodes every document matching filter into results.
+func findAll(ctx context.Context, collection *mongo.Collection, filter bson.M, findOptions *options.FindOptions, results any) error {
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	return cursor.All(ctx, results)
+}
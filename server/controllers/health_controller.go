@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/buildinfo"
+	"github.com/markbakos/infinite-minesweeper/server/health"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+)
+
+const readinessTimeout = 2 * time.Second
+
+func (h *Handler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, models.StatusResponse{Status: health.StatusOK})
+}
+
+func (h *Handler) Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	report := health.Ready(ctx)
+	if report.Status != health.StatusOK {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *Handler) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, buildinfo.Get())
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/markbakos/infinite-minesweeper/server/pubsub"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	leaderboardEventSnapshot = "snapshot"
+	leaderboardEventEntry    = "entry"
+	leaderboardEventRemoved  = "removed"
+
+	defaultStreamLimit = 10
+	maxStreamLimit     = 100
+
+	// leaderboardStreamBuffer is the number of events held for a stream
+	// before it is dropped as too slow.
+	leaderboardStreamBuffer = 32
+	// streamKeepAlive keeps idle streams from being closed by proxies.
+	streamKeepAlive = 15 * time.Second
+	publishTimeout  = 5 * time.Second
+)
+
+// leaderboardEvent is the message published on a leaderboard topic. Rank is
+// carried outside the payload so each stream can skip entries below its
+// limit without decoding them.
+type leaderboardEvent struct {
+	Event string          `json:"event"`
+	Rank  int64           `json:"rank,omitempty"`
+	Data  json.RawMessage `json:"data"`
+}
+
+func leaderboardTopic(gameType string) string {
+	return "leaderboard:" + gameType
+}
+
+func leaderboardFilter(gameType string) bson.M {
+	return bson.M{"game_type": gameType, "hidden": bson.M{"$ne": true}}
+}
+
+// publishLeaderboardEntry tells open streams about a new or improved entry.
+// Entries hidden by moderators are never published. Failures are logged
+// rather than returned: the entry has been saved and the streams catch up on
+// their next snapshot.
+func (h *Handler) publishLeaderboardEntry(entry models.LeaderboardEntry) {
+	if entry.Hidden {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	filter := leaderboardFilter(entry.GameType)
+	filter["score"] = bson.M{"$gt": entry.Score}
+	higher, err := config.GetCollection("leaderboard").CountDocuments(ctx, filter)
+	if err != nil {
+		h.log.Warn("failed to rank leaderboard entry", slog.String("entry_id", entry.ID.Hex()), slog.Any("error", err))
+		return
+	}
+
+	rank := higher + 1
+	linkProfile(&entry)
+	h.publishLeaderboardEvent(entry.GameType, leaderboardEventEntry, rank, models.LeaderboardEntryEvent{Entry: entry, Rank: rank})
+}
+
+func (h *Handler) publishLeaderboardRemoved(entry models.LeaderboardEntry) {
+	h.publishLeaderboardEvent(entry.GameType, leaderboardEventRemoved, 0, models.LeaderboardRemovedEvent{ID: entry.ID.Hex()})
+}
+
+func (h *Handler) publishLeaderboardEvent(gameType, event string, rank int64, payload any) {
+	data, err := json.Marshal(payload)
+	if err == nil {
+		data, err = json.Marshal(leaderboardEvent{Event: event, Rank: rank, Data: data})
+	}
+	if err != nil {
+		h.log.Error("failed to encode leaderboard event", slog.Any("error", err))
+		return
+	}
+	pubsub.Default().Publish(leaderboardTopic(gameType), data)
+}
+
+// StreamLeaderboard sends the top of a leaderboard as a Server-Sent Events
+// stream: a snapshot first, then entry and removed events as scores are
+// saved and moderated. A client that falls behind has its stream ended and
+// picks up a fresh snapshot when EventSource reconnects.
+func (h *Handler) StreamLeaderboard(c *gin.Context) {
+	gameType := c.DefaultQuery("gameType", "normal")
+	if gameType != "normal" && gameType != "infinite" {
+		c.Error(apierror.Validation("Game type must be normal or infinite", apierror.FieldError{Field: "gameType", Reason: "oneof"}))
+		return
+	}
+
+	limit := defaultStreamLimit
+	if limitParam := c.Query("limit"); limitParam != "" {
+		val, err := strconv.Atoi(limitParam)
+		if err != nil || val < 1 || val > maxStreamLimit {
+			c.Error(apierror.Validation(fmt.Sprintf("Limit must be between 1 and %d", maxStreamLimit), apierror.FieldError{Field: "limit", Reason: "range"}))
+			return
+		}
+		limit = val
+	}
+
+	// Subscribing before reading the snapshot means no update is missed,
+	// at the cost of possibly repeating one the snapshot already contains.
+	sub := pubsub.Default().Subscribe(leaderboardTopic(gameType), leaderboardStreamBuffer)
+	defer sub.Close()
+
+	ctx := c.Request.Context()
+	collection := config.GetCollection("leaderboard")
+	filter := leaderboardFilter(gameType)
+
+	leaderboard, err := findLeaderboardEntries(ctx, filter, limit, 0)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve leaderboard", err))
+		return
+	}
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count leaderboard entries", err))
+		return
+	}
+
+	// The stream outlives the server's write timeout.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	metrics.StreamSubscribers.WithLabelValues("leaderboard").Inc()
+	defer metrics.StreamSubscribers.WithLabelValues("leaderboard").Dec()
+
+	snapshot, err := json.Marshal(models.LeaderboardPageResponse{
+		Leaderboard: leaderboard,
+		Total:       total,
+		GameType:    gameType,
+	})
+	if err != nil {
+		h.log.Error("failed to encode leaderboard snapshot", slog.Any("error", err))
+		return
+	}
+	if !writeServerSentEvent(c, leaderboardEventSnapshot, snapshot) {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case data, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			var event leaderboardEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				h.log.Error("failed to decode leaderboard event", slog.Any("error", err))
+				continue
+			}
+			if event.Event == leaderboardEventEntry && event.Rank > int64(limit) {
+				continue
+			}
+			if !writeServerSentEvent(c, event.Event, event.Data) {
+				return
+			}
+
+		case <-keepAlive.C:
+			if _, err := io.WriteString(c.Writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// writeServerSentEvent writes one event and flushes it to the client,
+// reporting whether the client is still connected.
+func writeServerSentEvent(c *gin.Context, event string, data []byte) bool {
+	if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return false
+	}
+	c.Writer.Flush()
+	return true
+}
+
+// findLeaderboardEntries returns the entries matching filter, highest score
+// first.
+func findLeaderboardEntries(ctx context.Context, filter bson.M, limit, skip int) ([]models.LeaderboardEntry, error) {
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "score", Value: -1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(skip))
+
+	cursor, err := config.GetCollection("leaderboard").Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var leaderboard []models.LeaderboardEntry
+	if err := cursor.All(ctx, &leaderboard); err != nil {
+		return nil, err
+	}
+	for i := range leaderboard {
+		linkProfile(&leaderboard[i])
+	}
+	return leaderboard, nil
+}
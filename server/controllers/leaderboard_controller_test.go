@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/markbakos/infinite-minesweeper/server/pubsub"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPublishLeaderboardEntrySkipsHiddenEntries(t *testing.T) {
+	h := NewHandler(&config.Config{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	sub := pubsub.Default().Subscribe(leaderboardTopic("normal"), 1)
+	defer sub.Close()
+
+	// Hidden entries are skipped before the entry is ranked, so no database
+	// is needed.
+	h.publishLeaderboardEntry(models.LeaderboardEntry{ID: primitive.NewObjectID(), GameType: "normal", Score: 100, Hidden: true})
+
+	select {
+	case data := <-sub.C():
+		t.Fatalf("hidden entry was published: %s", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/live"
+)
+
+// LiveGame upgrades the request to a WebSocket on which the player opens or
+// resumes a server-side game session. See the live package for the protocol.
+func (h *Handler) LiveGame(c *gin.Context) {
+	hub := live.Default()
+	if hub == nil {
+		c.Error(apierror.Unavailable("Live games are not available"))
+		return
+	}
+
+	player := live.Player{ID: c.GetString("user_id"), Guest: c.GetBool("is_guest")}
+
+	if err := hub.Serve(c.Writer, c.Request, player); err != nil {
+		c.Error(liveError(err, "Failed to start live game"))
+	}
+}
+
+// SpectateGame streams a public live session read-only, over a WebSocket
+// when the client asks for an upgrade and as Server-Sent Events otherwise.
+func (h *Handler) SpectateGame(c *gin.Context) {
+	hub := live.Default()
+	if hub == nil {
+		c.Error(apierror.Unavailable("Live games are not available"))
+		return
+	}
+
+	if err := hub.Spectate(c.Writer, c.Request, c.Param("id")); err != nil {
+		c.Error(liveError(err, "Failed to spectate live game"))
+	}
+}
+
+func liveError(err error, message string) *apierror.Error {
+	switch {
+	case errors.Is(err, live.ErrSessionNotFound):
+		return apierror.NotFound("Session not found or not public")
+	case errors.Is(err, live.ErrTooManyConnections):
+		return apierror.Unavailable("Too many live connections, try again later")
+	case errors.Is(err, live.ErrClosed):
+		return apierror.Unavailable("Server is shutting down")
+	default:
+		return apierror.Internal(message, err)
+	}
+}
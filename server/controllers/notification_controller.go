@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/markbakos/infinite-minesweeper/server/notification"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notifiedRanks is the size of the top of the leaderboard whose players are
+// told when they are pushed out of it.
+const notifiedRanks = 10
+
+// ListNotifications returns the authenticated player's notifications,
+// newest first, with the number still unread.
+func (h *Handler) ListNotifications(c *gin.Context) {
+	filter := bson.M{"user_id": c.GetString("user_id")}
+	if unread := c.Query("unread"); unread != "" {
+		onlyUnread, err := strconv.ParseBool(unread)
+		if err != nil {
+			c.Error(apierror.Validation("Unread must be true or false", apierror.FieldError{Field: "unread", Reason: "boolean"}))
+			return
+		}
+		if onlyUnread {
+			filter["read"] = false
+		}
+	}
+	limit, skip := pageParams(c)
+	ctx := c.Request.Context()
+
+	collection := config.GetCollection(notification.CollectionName)
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(skip))
+
+	notifications := []models.Notification{}
+	if err := findAll(ctx, collection, filter, findOptions, &notifications); err != nil {
+		c.Error(apierror.Internal("Failed to retrieve notifications", err))
+		return
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count notifications", err))
+		return
+	}
+	unread, err := collection.CountDocuments(ctx, bson.M{"user_id": c.GetString("user_id"), "read": false})
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count unread notifications", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NotificationListResponse{Notifications: notifications, Total: total, Unread: unread})
+}
+
+// GetUnreadNotificationCount returns how many of the authenticated player's
+// notifications are unread, for badges that do not need the inbox itself.
+func (h *Handler) GetUnreadNotificationCount(c *gin.Context) {
+	unread, err := config.GetCollection(notification.CollectionName).CountDocuments(c.Request.Context(),
+		bson.M{"user_id": c.GetString("user_id"), "read": false},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count unread notifications", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UnreadCountResponse{Unread: unread})
+}
+
+// MarkNotificationRead marks one of the authenticated player's
+// notifications as read.
+func (h *Handler) MarkNotificationRead(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid notification ID"))
+		return
+	}
+
+	collection := config.GetCollection(notification.CollectionName)
+	result, err := collection.UpdateOne(c.Request.Context(),
+		bson.M{"_id": objectID, "user_id": c.GetString("user_id"), "read": false},
+		bson.M{"$set": bson.M{"read": true, "read_at": time.Now()}},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to mark notification as read", err))
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := collection.CountDocuments(c.Request.Context(), bson.M{"_id": objectID, "user_id": c.GetString("user_id")})
+		if err != nil {
+			c.Error(apierror.Internal("Failed to find notification", err))
+			return
+		}
+		if count == 0 {
+			c.Error(apierror.NotFound("Notification not found"))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Notification marked as read"})
+}
+
+// MarkAllNotificationsRead marks every notification of the authenticated
+// player as read.
+func (h *Handler) MarkAllNotificationsRead(c *gin.Context) {
+	_, err := config.GetCollection(notification.CollectionName).UpdateMany(c.Request.Context(),
+		bson.M{"user_id": c.GetString("user_id"), "read": false},
+		bson.M{"$set": bson.M{"read": true, "read_at": time.Now()}},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to mark notifications as read", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Notifications marked as read"})
+}
+
+// notifyFrom tells recipientID about something fromID did. message has a
+// single %s verb, which is replaced with fromID's username. Failures are
+// logged: the action itself has already succeeded.
+func (h *Handler) notifyFrom(ctx context.Context, recipientID string, t notification.Type, fromID, message string, data map[string]string) {
+	usernames, err := lookupUsernames(ctx, []string{fromID})
+	if err != nil {
+		h.log.Warn("failed to look up notification sender", slog.String("user_id", fromID), slog.Any("error", err))
+		return
+	}
+	if data == nil {
+		data = map[string]string{}
+	}
+	data["user_id"] = fromID
+	data["username"] = usernames[fromID]
+	notification.Send(recipientID, t, fmt.Sprintf(message, usernames[fromID]), data)
+}
+
+// notifyLeaderboardChange tells players what a new or improved leaderboard
+// entry did to them: the player it pushed out of the top ranks and the
+// friends of its owner it overtook. hadEntry reports whether entry improved
+// on an earlier score of previousScore. The queries run in the background
+// so that saving a game does not wait for them, and failures are logged
+// rather than returned, like publishLeaderboardEntry.
+func (h *Handler) notifyLeaderboardChange(entry models.LeaderboardEntry, previousScore int, hadEntry bool) {
+	if entry.Hidden {
+		return
+	}
+
+	notification.Compose(func(ctx context.Context) {
+		if err := notifyKnockedOut(ctx, entry, previousScore, hadEntry); err != nil {
+			h.log.Warn("failed to notify knocked out player", slog.String("entry_id", entry.ID.Hex()), slog.Any("error", err))
+		}
+		if entry.UserID == "" {
+			return
+		}
+		if err := notifyOvertakenFriends(ctx, entry, previousScore, hadEntry); err != nil {
+			h.log.Warn("failed to notify overtaken friends", slog.String("entry_id", entry.ID.Hex()), slog.Any("error", err))
+		}
+	})
+}
+
+// notifyKnockedOut tells the player now just below the top ranks that entry
+// pushed them out, unless entry was already among the top ranks before.
+func notifyKnockedOut(ctx context.Context, entry models.LeaderboardEntry, previousScore int, hadEntry bool) error {
+	if hadEntry {
+		filter := leaderboardFilter(entry.GameType)
+		filter["score"] = bson.M{"$gt": previousScore}
+		higher, err := config.GetCollection("leaderboard").CountDocuments(ctx, filter)
+		if err != nil {
+			return err
+		}
+		// higher counts the improved entry itself.
+		if higher <= notifiedRanks {
+			return nil
+		}
+	}
+
+	below, err := findLeaderboardEntries(ctx, leaderboardFilter(entry.GameType), 1, notifiedRanks)
+	if err != nil {
+		return err
+	}
+	if len(below) == 0 || below[0].ID == entry.ID || below[0].Score >= entry.Score {
+		return nil
+	}
+
+	notification.Send(below[0].UserID, notification.TypeLeaderboardKnockedOut,
+		fmt.Sprintf("%s knocked you out of the %s top %d", entry.Username, entry.GameType, notifiedRanks),
+		map[string]string{"game_type": entry.GameType, "user_id": entry.UserID, "username": entry.Username, "score": strconv.Itoa(entry.Score)},
+	)
+	return nil
+}
+
+// notifyOvertakenFriends tells the friends of entry's owner whose score
+// entry has just beaten.
+func notifyOvertakenFriends(ctx context.Context, entry models.LeaderboardEntry, previousScore int, hadEntry bool) error {
+	friends, err := friendIDs(ctx, entry.UserID)
+	if err != nil {
+		return err
+	}
+	if len(friends) == 0 {
+		return nil
+	}
+
+	score := bson.M{"$lt": entry.Score}
+	if hadEntry {
+		score["$gte"] = previousScore
+	}
+	filter := leaderboardFilter(entry.GameType)
+	filter["user_id"] = bson.M{"$in": friends}
+	filter["is_guest"] = false
+	filter["score"] = score
+
+	var overtaken []models.LeaderboardEntry
+	if err := findAll(ctx, config.GetCollection("leaderboard"), filter, options.Find(), &overtaken); err != nil {
+		return err
+	}
+	for _, friend := range overtaken {
+		notification.Send(friend.UserID, notification.TypeFriendBeatScore,
+			fmt.Sprintf("%s beat your %s score of %d with %d", entry.Username, entry.GameType, friend.Score, entry.Score),
+			map[string]string{"game_type": entry.GameType, "user_id": entry.UserID, "username": entry.Username, "score": strconv.Itoa(entry.Score)},
+		)
+	}
+	return nil
+}
+
+// notifyChallengeReceived tells the opponent of a challenge that the
+// challenger has set a score for them to beat. Open challenges have no
+// opponent to tell.
+func notifyChallengeReceived(ch models.Challenge) {
+	notification.Send(ch.OpponentID, notification.TypeChallengeReceived,
+		fmt.Sprintf("%s challenged you to beat their %s score", ch.ChallengerName, ch.GameType),
+		map[string]string{"challenge_id": ch.ID.Hex(), "user_id": ch.ChallengerID, "username": ch.ChallengerName},
+	)
+}
+
+// notifyChallengeCompleted tells both players of a decided challenge how it
+// ended. ch has its usernames filled in.
+func notifyChallengeCompleted(ch models.Challenge) {
+	data := map[string]string{"challenge_id": ch.ID.Hex()}
+	for _, side := range []struct{ userID, otherName string }{
+		{ch.ChallengerID, ch.OpponentName},
+		{ch.OpponentID, ch.ChallengerName},
+	} {
+		var message string
+		switch ch.WinnerID {
+		case "":
+			message = fmt.Sprintf("Your challenge with %s ended in a draw", side.otherName)
+		case side.userID:
+			message = fmt.Sprintf("You won your challenge with %s", side.otherName)
+		default:
+			message = fmt.Sprintf("%s won your challenge", side.otherName)
+		}
+		notification.Send(side.userID, notification.TypeChallengeCompleted, message, data)
+	}
+}
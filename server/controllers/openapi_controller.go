@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/openapi"
+)
+
+func (h *Handler) GetOpenAPISpec(c *gin.Context) {
+	spec, err := openapi.Spec()
+	if err != nil {
+		c.Error(apierror.Internal("Failed to build API specification", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, spec)
+}
@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/achievement"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// profilePath is where the public profile of username is served.
+func profilePath(username string) string {
+	return "/api/v1/users/" + url.PathEscape(username)
+}
+
+// linkProfile points entry at its owner's public profile. Guests have none.
+func linkProfile(entry *models.LeaderboardEntry) {
+	if !entry.IsGuest && entry.Username != "" {
+		entry.Profile = profilePath(entry.Username)
+	}
+}
+
+// GetUserProfile returns the public profile of the user in the path. Each
+// section is shown according to the user's privacy settings; users who
+// blocked the viewer are hidden from them.
+func (h *Handler) GetUserProfile(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var user models.User
+	err := getUserCollection().FindOne(ctx, bson.M{"username": c.Param("username")}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.Error(apierror.NotFound("User not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to find user", err))
+		return
+	}
+	userID := user.ID.Hex()
+
+	viewerID := ""
+	if !c.GetBool("is_guest") {
+		viewerID = c.GetString("user_id")
+	}
+	relation, err := profileRelation(ctx, userID, viewerID)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to check friendship", err))
+		return
+	}
+	if relation == relationBlocked {
+		c.Error(apierror.NotFound("User not found"))
+		return
+	}
+
+	profile := models.PublicProfile{ID: userID, Username: user.Username, JoinedAt: user.CreatedAt}
+	show := func(section, visibility string) bool {
+		if visible(visibility, relation) {
+			return true
+		}
+		profile.Hidden = append(profile.Hidden, section)
+		return false
+	}
+
+	// Game types whose scores a moderator hid from the leaderboards are left
+	// out of the records too, so that the profile agrees with profileRanks.
+	hidden, err := hiddenGameTypes(ctx, userID)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to check hidden scores", err))
+		return
+	}
+	if show(models.ProfileSectionPersonalBests, user.Privacy.PersonalBests) {
+		profile.PersonalBests = withoutGameTypes(user.GameRecords, hidden)
+	}
+	if show(models.ProfileSectionAchievements, user.Privacy.Achievements) {
+		names := make(map[string]string)
+		for _, rule := range achievement.Rules() {
+			names[rule.ID] = rule.Name
+		}
+		for _, a := range user.Achievements {
+			a.Name = names[a.ID]
+			profile.Achievements = append(profile.Achievements, a)
+		}
+	}
+	if show(models.ProfileSectionRecentGames, user.Privacy.RecentGames) {
+		profile.RecentGames = withoutGameTypes(user.RecentGames, hidden)
+	}
+	if show(models.ProfileSectionRank, user.Privacy.Rank) {
+		profile.Ranks, err = profileRanks(ctx, userID)
+		if err != nil {
+			c.Error(apierror.Internal("Failed to rank user", err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetPrivacySettings returns the authenticated player's privacy settings.
+func (h *Handler) GetPrivacySettings(c *gin.Context) {
+	objectID, ok := profileOwnerID(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	err := getUserCollection().FindOne(c.Request.Context(), bson.M{"_id": objectID}).Decode(&user)
+	if err != nil {
+		c.Error(apierror.NotFound("User not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, withDefaultVisibility(user.Privacy))
+}
+
+// UpdatePrivacySettings replaces the authenticated player's privacy
+// settings. Sections left out become public.
+func (h *Handler) UpdatePrivacySettings(c *gin.Context) {
+	var request models.PrivacySettings
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apierror.FromBinding(err))
+		return
+	}
+	request = withDefaultVisibility(request)
+	for _, setting := range []struct{ field, value string }{
+		{models.ProfileSectionPersonalBests, request.PersonalBests},
+		{models.ProfileSectionAchievements, request.Achievements},
+		{models.ProfileSectionRecentGames, request.RecentGames},
+		{models.ProfileSectionRank, request.Rank},
+	} {
+		switch setting.value {
+		case models.VisibilityPublic, models.VisibilityFriends, models.VisibilityPrivate:
+		default:
+			c.Error(apierror.Validation("Visibility must be public, friends or private", apierror.FieldError{Field: setting.field, Reason: "oneof"}))
+			return
+		}
+	}
+
+	objectID, ok := profileOwnerID(c)
+	if !ok {
+		return
+	}
+
+	result, err := getUserCollection().UpdateOne(c.Request.Context(), bson.M{"_id": objectID}, bson.M{"$set": bson.M{"privacy": request}})
+	if err != nil {
+		c.Error(apierror.Internal("Failed to update privacy settings", err))
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.Error(apierror.NotFound("User not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+// profileOwnerID returns the ID of the authenticated user, reporting an
+// error when they are a guest, who has no profile.
+func profileOwnerID(c *gin.Context) (primitive.ObjectID, bool) {
+	if c.GetBool("is_guest") {
+		c.Error(apierror.Forbidden(apierror.CodeForbidden, "Guests do not have a profile"))
+		return primitive.NilObjectID, false
+	}
+	objectID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid user ID"))
+		return primitive.NilObjectID, false
+	}
+	return objectID, true
+}
+
+func withDefaultVisibility(p models.PrivacySettings) models.PrivacySettings {
+	for _, v := range []*string{&p.PersonalBests, &p.Achievements, &p.RecentGames, &p.Rank} {
+		if *v == "" {
+			*v = models.VisibilityPublic
+		}
+	}
+	return p
+}
+
+// relation is how the viewer of a profile relates to its owner.
+type relation int
+
+const (
+	relationStranger relation = iota
+	relationFriend
+	relationSelf
+	relationBlocked
+)
+
+// profileRelation reports how viewerID relates to userID. viewerID is empty
+// for anonymous viewers and guests.
+func profileRelation(ctx context.Context, userID, viewerID string) (relation, error) {
+	switch viewerID {
+	case "":
+		return relationStranger, nil
+	case userID:
+		return relationSelf, nil
+	}
+
+	blocked, err := config.GetCollection(blocksCollection).CountDocuments(ctx, bson.M{"_id": blockID(userID, viewerID)})
+	if err != nil {
+		return relationStranger, err
+	}
+	if blocked > 0 {
+		return relationBlocked, nil
+	}
+
+	friends, err := config.GetCollection(friendshipsCollection).CountDocuments(ctx,
+		bson.M{"_id": friendshipID(userID, viewerID), "state": models.FriendshipAccepted},
+	)
+	if err != nil {
+		return relationStranger, err
+	}
+	if friends > 0 {
+		return relationFriend, nil
+	}
+	return relationStranger, nil
+}
+
+func visible(visibility string, r relation) bool {
+	switch r {
+	case relationSelf:
+		return true
+	case relationFriend:
+		return visibility != models.VisibilityPrivate
+	}
+	return visibility == "" || visibility == models.VisibilityPublic
+}
+
+// hiddenGameTypes returns the game types of userID's leaderboard entries
+// hidden by a moderator.
+func hiddenGameTypes(ctx context.Context, userID string) ([]any, error) {
+	return config.GetCollection("leaderboard").Distinct(ctx, "game_type",
+		bson.M{"user_id": userID, "is_guest": false, "hidden": true},
+	)
+}
+
+func withoutGameTypes(records []models.GameRecord, gameTypes []any) []models.GameRecord {
+	var kept []models.GameRecord
+	for _, record := range records {
+		if !slices.Contains(gameTypes, any(record.GameType)) {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+// profileRanks returns userID's place on every leaderboard they have a
+// visible entry on.
+func profileRanks(ctx context.Context, userID string) ([]models.ProfileRank, error) {
+	collection := config.GetCollection("leaderboard")
+
+	var entries []models.LeaderboardEntry
+	filter := bson.M{"user_id": userID, "is_guest": false, "hidden": bson.M{"$ne": true}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "game_type", Value: 1}})
+	if err := findAll(ctx, collection, filter, findOptions, &entries); err != nil {
+		return nil, err
+	}
+
+	var ranks []models.ProfileRank
+	for _, entry := range entries {
+		filter := leaderboardFilter(entry.GameType)
+		players, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		filter["score"] = bson.M{"$gt": entry.Score}
+		higher, err := collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		ranks = append(ranks, models.ProfileRank{GameType: entry.GameType, Rank: higher + 1, Players: players})
+	}
+	return ranks, nil
+}
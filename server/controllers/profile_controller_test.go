@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVisible(t *testing.T) {
+	tests := []struct {
+		name       string
+		visibility string
+		relation   relation
+		want       bool
+	}{
+		{name: "Unset Stranger", visibility: "", relation: relationStranger, want: true},
+		{name: "Public Stranger", visibility: models.VisibilityPublic, relation: relationStranger, want: true},
+		{name: "Friends Stranger", visibility: models.VisibilityFriends, relation: relationStranger, want: false},
+		{name: "Private Stranger", visibility: models.VisibilityPrivate, relation: relationStranger, want: false},
+		{name: "Public Friend", visibility: models.VisibilityPublic, relation: relationFriend, want: true},
+		{name: "Friends Friend", visibility: models.VisibilityFriends, relation: relationFriend, want: true},
+		{name: "Private Friend", visibility: models.VisibilityPrivate, relation: relationFriend, want: false},
+		{name: "Private Self", visibility: models.VisibilityPrivate, relation: relationSelf, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, visible(tt.visibility, tt.relation))
+		})
+	}
+}
+
+func TestProfileRelationWithoutDatabase(t *testing.T) {
+	// Anonymous viewers and owners are told apart before any lookup, so no
+	// database is needed.
+	tests := []struct {
+		name     string
+		viewerID string
+		want     relation
+	}{
+		{name: "Anonymous", viewerID: "", want: relationStranger},
+		{name: "Self", viewerID: "user1", want: relationSelf},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := profileRelation(context.Background(), "user1", tt.viewerID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, r)
+		})
+	}
+}
+
+func TestWithoutGameTypes(t *testing.T) {
+	records := []models.GameRecord{{GameType: "normal", Score: 10}, {GameType: "infinite", Score: 20}, {GameType: "normal", Score: 30}}
+
+	assert.Equal(t, records, withoutGameTypes(records, nil))
+	assert.Equal(t, []models.GameRecord{{GameType: "infinite", Score: 20}}, withoutGameTypes(records, []any{"normal"}))
+	assert.Empty(t, withoutGameTypes(records, []any{"normal", "infinite"}))
+}
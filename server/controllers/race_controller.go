@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const raceResultsCollection = "race_results"
+
+// SaveRaceResult stores the result of a finished race and, for ranked
+// races, updates the racers' ratings. The live hub calls it when a race
+// ends; races are arbitrated by the server, so clients cannot submit them
+// through SaveGameRecord. Saving a result with the same ID again completes
+// an earlier call that failed part way without storing anything twice.
+func SaveRaceResult(ctx context.Context, result models.RaceResult) error {
+	if result.ID.IsZero() {
+		result.ID = primitive.NewObjectID()
+	}
+	_, err := config.GetCollection(raceResultsCollection).UpdateOne(ctx,
+		bson.M{"_id": result.ID},
+		bson.M{"$setOnInsert": result},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil || !result.Ranked {
+		return err
+	}
+	return UpdateRatings(ctx, result.GameType, result.ID.Hex(), result.Players, result.FinishedAt)
+}
+
+// GetRaceResults lists the races the authenticated player took part in,
+// most recent first.
+func (h *Handler) GetRaceResults(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.Error(apierror.BadRequest("User ID not found"))
+		return
+	}
+
+	limit := 20
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if val, err := strconv.ParseInt(limitParam, 10, 64); err == nil && val > 0 {
+			limit = int(val)
+		}
+	}
+
+	skip := 0
+	if skipParam := c.Query("skip"); skipParam != "" {
+		if val, err := strconv.ParseInt(skipParam, 10, 64); err == nil && val >= 0 {
+			skip = int(val)
+		}
+	}
+
+	collection := config.GetCollection(raceResultsCollection)
+	filter := bson.M{"players.player_id": userID}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "finished_at", Value: -1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(skip))
+
+	cursor, err := collection.Find(context.Background(), filter, findOptions)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve races", err))
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	races := []models.RaceResult{}
+	if err := cursor.All(context.Background(), &races); err != nil {
+		c.Error(apierror.Internal("Failed to decode races", err))
+		return
+	}
+
+	total, err := collection.CountDocuments(context.Background(), filter)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count races", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RaceResultListResponse{Races: races, Total: total})
+}
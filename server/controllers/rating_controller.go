@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/markbakos/infinite-minesweeper/server/rating"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ratingsCollection       = "ratings"
+	ratingHistoryCollection = "rating_history"
+)
+
+// rankedModes are the multiplayer modes players are rated in.
+var rankedModes = map[string]bool{game.TypeRace: true}
+
+// EnsureRatingIndexes creates the unique indexes that let UpdateRatings be
+// retried: one rating per player and mode, and one history entry per player
+// and match.
+func EnsureRatingIndexes(ctx context.Context) error {
+	_, err := config.GetCollection(ratingsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "mode", Value: 1}},
+		Options: options.Index().SetName("one_rating_per_mode").SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("creating rating index: %w", err)
+	}
+	_, err = config.GetCollection(ratingHistoryCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "match_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetName("one_change_per_match").SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("creating rating history index: %w", err)
+	}
+	return nil
+}
+
+// UpdateRatings rates the registered players of a finished ranked match.
+// Guests neither gain a rating nor count as opponents, so a match with fewer
+// than two registered players changes nothing.
+//
+// The new ratings are stored in the rating history first and then copied to
+// each player's rating, which remembers the last match applied to it. A call
+// that failed part way can therefore be repeated: it reuses the stored
+// history and skips the players already rated.
+func UpdateRatings(ctx context.Context, mode, matchID string, placements []models.RacePlacement, playedAt time.Time) error {
+	var players []models.RacePlacement
+	var userIDs []string
+	for _, p := range placements {
+		if p.IsGuest {
+			continue
+		}
+		players = append(players, p)
+		userIDs = append(userIDs, p.PlayerID)
+	}
+	if len(players) < 2 {
+		return nil
+	}
+
+	changes, err := ratingChanges(ctx, mode, matchID, players, userIDs, playedAt)
+	if err != nil {
+		return err
+	}
+
+	usernames, err := ratedUsernames(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+
+	collection := config.GetCollection(ratingsCollection)
+	for _, change := range changes {
+		wins := 0
+		if change.Place == 1 {
+			wins = 1
+		}
+		_, err := collection.UpdateOne(ctx,
+			bson.M{"user_id": change.UserID, "mode": mode, "last_match_id": bson.M{"$ne": matchID}},
+			bson.M{
+				"$set": bson.M{
+					"username":      usernames[change.UserID],
+					"rating":        change.Rating,
+					"deviation":     change.Deviation,
+					"volatility":    change.Volatility,
+					"last_match_id": matchID,
+					"updated_at":    playedAt,
+				},
+				"$inc": bson.M{"matches": 1, "wins": wins},
+			},
+			options.Update().SetUpsert(true),
+		)
+		// The upsert only collides with the player's rating when the match
+		// has already been applied to it.
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("saving rating: %w", err)
+		}
+	}
+	return nil
+}
+
+// ratingChanges returns how matchID changes the players' ratings. They are
+// worked out from the current ratings and stored the first time, and read
+// back from the rating history when the match is rated again.
+func ratingChanges(ctx context.Context, mode, matchID string, players []models.RacePlacement, userIDs []string, playedAt time.Time) ([]models.RatingChange, error) {
+	history := config.GetCollection(ratingHistoryCollection)
+	var changes []models.RatingChange
+	if err := findAll(ctx, history, bson.M{"match_id": matchID}, options.Find(), &changes); err != nil {
+		return nil, fmt.Errorf("finding rating history: %w", err)
+	}
+	if len(changes) == len(players) {
+		return changes, nil
+	}
+
+	var existing []models.PlayerRating
+	if err := findAll(ctx, config.GetCollection(ratingsCollection), bson.M{"mode": mode, "user_id": bson.M{"$in": userIDs}}, options.Find(), &existing); err != nil {
+		return nil, fmt.Errorf("finding ratings: %w", err)
+	}
+	current := make(map[string]models.PlayerRating, len(existing))
+	for _, r := range existing {
+		current[r.UserID] = r
+	}
+
+	before := make([]rating.Rating, len(players))
+	places := make([]int, len(players))
+	for i, p := range players {
+		before[i] = rating.Default()
+		if r, ok := current[p.PlayerID]; ok {
+			before[i] = rating.Rating{Rating: r.Rating, Deviation: r.Deviation, Volatility: r.Volatility}
+		}
+		places[i] = p.Place
+	}
+	after := rating.UpdateMatch(before, places)
+
+	changes = make([]models.RatingChange, len(players))
+	documents := make([]any, len(players))
+	for i, p := range players {
+		changes[i] = models.RatingChange{
+			ID:         primitive.NewObjectID(),
+			UserID:     p.PlayerID,
+			Mode:       mode,
+			MatchID:    matchID,
+			Place:      p.Place,
+			Opponents:  len(players) - 1,
+			Rating:     after[i].Rating,
+			Deviation:  after[i].Deviation,
+			Volatility: after[i].Volatility,
+			Change:     after[i].Rating - before[i].Rating,
+			PlayedAt:   playedAt,
+		}
+		documents[i] = changes[i]
+	}
+
+	// Entries left by an earlier attempt are kept; the others are added.
+	_, err := history.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("saving rating history: %w", err)
+	}
+	if err != nil {
+		changes = nil
+		if err := findAll(ctx, history, bson.M{"match_id": matchID}, options.Find(), &changes); err != nil {
+			return nil, fmt.Errorf("finding rating history: %w", err)
+		}
+	}
+	return changes, nil
+}
+
+// ratedUsernames returns the usernames of the users in userIDs.
+func ratedUsernames(ctx context.Context, userIDs []string) (map[string]string, error) {
+	var objectIDs []primitive.ObjectID
+	for _, id := range userIDs {
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+
+	var users []models.User
+	err := findAll(ctx, getUserCollection(), bson.M{"_id": bson.M{"$in": objectIDs}}, options.Find().SetProjection(bson.M{"username": 1}), &users)
+	if err != nil {
+		return nil, fmt.Errorf("finding rated users: %w", err)
+	}
+	usernames := make(map[string]string, len(users))
+	for _, user := range users {
+		usernames[user.ID.Hex()] = user.Username
+	}
+	return usernames, nil
+}
+
+// LookupRating returns a user's race rating, or the starting rating if they
+// have not played a ranked race. Matchmaking uses it to queue players.
+func LookupRating(ctx context.Context, userID string) (float64, error) {
+	var r models.PlayerRating
+	err := config.GetCollection(ratingsCollection).FindOne(ctx, bson.M{"user_id": userID, "mode": game.TypeRace}).Decode(&r)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return rating.DefaultRating, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return r.Rating, nil
+}
+
+// rankedMode reads the mode query parameter, defaulting to race.
+func rankedMode(c *gin.Context) (string, bool) {
+	mode := c.DefaultQuery("mode", game.TypeRace)
+	if !rankedModes[mode] {
+		c.Error(apierror.Validation("Mode must be a ranked mode", apierror.FieldError{Field: "mode", Reason: "oneof"}))
+		return "", false
+	}
+	return mode, true
+}
+
+// GetRatings lists the rated players of a ranked mode, highest rating first.
+func (h *Handler) GetRatings(c *gin.Context) {
+	mode, ok := rankedMode(c)
+	if !ok {
+		return
+	}
+	limit, skip := pageParams(c)
+
+	collection := config.GetCollection(ratingsCollection)
+	filter := bson.M{"mode": mode}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "rating", Value: -1}, {Key: "matches", Value: -1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(skip))
+
+	ratings := []models.PlayerRating{}
+	if err := findAll(c.Request.Context(), collection, filter, findOptions, &ratings); err != nil {
+		c.Error(apierror.Internal("Failed to retrieve ratings", err))
+		return
+	}
+
+	total, err := collection.CountDocuments(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count ratings", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RatingListResponse{Ratings: ratings, Total: total, Mode: mode})
+}
+
+// GetRatingHistory lists a user's ranked matches in a mode, most recent
+// first.
+func (h *Handler) GetRatingHistory(c *gin.Context) {
+	userID := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(userID); err != nil {
+		c.Error(apierror.BadRequest("Invalid user ID"))
+		return
+	}
+	mode, ok := rankedMode(c)
+	if !ok {
+		return
+	}
+	limit, skip := pageParams(c)
+
+	collection := config.GetCollection(ratingHistoryCollection)
+	filter := bson.M{"user_id": userID, "mode": mode}
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "played_at", Value: -1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(skip))
+
+	history := []models.RatingChange{}
+	if err := findAll(c.Request.Context(), collection, filter, findOptions, &history); err != nil {
+		c.Error(apierror.Internal("Failed to retrieve rating history", err))
+		return
+	}
+
+	total, err := collection.CountDocuments(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count rating history", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RatingHistoryResponse{History: history, Total: total, Mode: mode})
+}
@@ -0,0 +1,592 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/audit"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/live"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/markbakos/infinite-minesweeper/server/tournament"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	tournamentsCollection     = "tournaments"
+	tournamentGamesCollection = "tournament_games"
+
+	defaultTournamentPlayers = 64
+)
+
+var tournamentStates = map[string]bool{
+	models.TournamentRegistering: true,
+	models.TournamentRunning:     true,
+	models.TournamentFinished:    true,
+	models.TournamentCancelled:   true,
+}
+
+// errTournamentChanged means another update saved the tournament first.
+// The scheduler tries again on its next tick.
+var errTournamentChanged = errors.New("tournament changed concurrently")
+
+func (h *Handler) CreateTournament(c *gin.Context) {
+	var request models.CreateTournamentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(apierror.FromBinding(err))
+		return
+	}
+
+	if request.Format != tournament.FormatSingleElimination && request.Rounds == 0 {
+		c.Error(apierror.Validation("Swiss and cumulative tournaments need a number of rounds", apierror.FieldError{Field: "rounds", Reason: "required"}))
+		return
+	}
+	if !request.StartsAt.After(time.Now()) {
+		c.Error(apierror.Validation("Tournaments must start in the future", apierror.FieldError{Field: "starts_at", Reason: "future"}))
+		return
+	}
+
+	t := models.Tournament{
+		ID:           primitive.NewObjectID(),
+		Name:         request.Name,
+		Format:       request.Format,
+		GameType:     request.GameType,
+		RoundMinutes: request.RoundMinutes,
+		MaxPlayers:   request.MaxPlayers,
+		Seeds:        request.Seeds,
+		State:        models.TournamentRegistering,
+		StartsAt:     request.StartsAt.UTC(),
+		Players:      []models.TournamentPlayer{},
+		Rounds:       []models.TournamentRound{},
+		CreatedBy:    c.GetString("user_id"),
+		CreatedAt:    time.Now(),
+	}
+	if t.Format != tournament.FormatSingleElimination {
+		t.RoundCount = request.Rounds
+	}
+	if t.MaxPlayers == 0 {
+		t.MaxPlayers = defaultTournamentPlayers
+	}
+
+	if _, err := config.GetCollection(tournamentsCollection).InsertOne(context.Background(), t); err != nil {
+		c.Error(apierror.Internal("Failed to create tournament", err))
+		return
+	}
+
+	audit.Record(c, audit.EventAdminTournamentCreated, c.GetString("user_id"), t.ID.Hex(), map[string]any{
+		"name":   t.Name,
+		"format": t.Format,
+	})
+
+	c.JSON(http.StatusCreated, t)
+}
+
+func (h *Handler) CancelTournament(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid tournament ID"))
+		return
+	}
+
+	collection := config.GetCollection(tournamentsCollection)
+	result, err := collection.UpdateOne(context.Background(),
+		bson.M{"_id": objectID, "state": bson.M{"$in": bson.A{models.TournamentRegistering, models.TournamentRunning}}},
+		bson.M{
+			"$set": bson.M{"state": models.TournamentCancelled, "finished_at": time.Now()},
+			"$inc": bson.M{"version": 1},
+		},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to cancel tournament", err))
+		return
+	}
+	if result.MatchedCount == 0 {
+		count, err := collection.CountDocuments(context.Background(), bson.M{"_id": objectID})
+		switch {
+		case err != nil:
+			c.Error(apierror.Internal("Failed to find tournament", err))
+		case count == 0:
+			c.Error(apierror.NotFound("Tournament not found"))
+		default:
+			c.Error(apierror.Conflict(apierror.CodeTournamentClosed, "Tournament has already ended"))
+		}
+		return
+	}
+
+	audit.Record(c, audit.EventAdminTournamentCancelled, c.GetString("user_id"), objectID.Hex(), nil)
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Tournament cancelled"})
+}
+
+// ListTournaments lists tournaments, optionally in one state, latest start
+// first.
+func (h *Handler) ListTournaments(c *gin.Context) {
+	filter := bson.M{}
+	if state := c.Query("state"); state != "" {
+		if !tournamentStates[state] {
+			c.Error(apierror.Validation("State must be registering, running, finished or cancelled", apierror.FieldError{Field: "state", Reason: "oneof"}))
+			return
+		}
+		filter["state"] = state
+	}
+	limit, skip := pageParams(c)
+
+	collection := config.GetCollection(tournamentsCollection)
+
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "starts_at", Value: -1}})
+	findOptions.SetLimit(int64(limit))
+	findOptions.SetSkip(int64(skip))
+
+	tournaments := []models.Tournament{}
+	if err := findAll(c.Request.Context(), collection, filter, findOptions, &tournaments); err != nil {
+		c.Error(apierror.Internal("Failed to retrieve tournaments", err))
+		return
+	}
+	for i := range tournaments {
+		hideOpenRoundSeed(&tournaments[i])
+	}
+
+	total, err := collection.CountDocuments(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to count tournaments", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TournamentListResponse{Tournaments: tournaments, Total: total})
+}
+
+// GetTournament returns a tournament with its rounds and standings.
+func (h *Handler) GetTournament(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid tournament ID"))
+		return
+	}
+
+	var t models.Tournament
+	err = config.GetCollection(tournamentsCollection).FindOne(c.Request.Context(), bson.M{"_id": objectID}).Decode(&t)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.Error(apierror.NotFound("Tournament not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve tournament", err))
+		return
+	}
+	hideOpenRoundSeed(&t)
+
+	c.JSON(http.StatusOK, t)
+}
+
+// hideOpenRoundSeed clears the seed of a round that is still being played,
+// which would give its board away to players who have not played it yet.
+func hideOpenRoundSeed(t *models.Tournament) {
+	for i := range t.Rounds {
+		if !t.Rounds[i].Closed {
+			t.Rounds[i].Seed = 0
+		}
+	}
+}
+
+// RegisterForTournament enters the authenticated player into a tournament
+// whose registration is open.
+func (h *Handler) RegisterForTournament(c *gin.Context) {
+	if c.GetBool("is_guest") {
+		c.Error(apierror.Forbidden(apierror.CodeForbidden, "Guests cannot enter tournaments"))
+		return
+	}
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid tournament ID"))
+		return
+	}
+	userObjectID, err := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid user ID"))
+		return
+	}
+
+	var user models.User
+	if err := getUserCollection().FindOne(context.Background(), bson.M{"_id": userObjectID}).Decode(&user); err != nil {
+		c.Error(apierror.NotFound("User not found"))
+		return
+	}
+	if user.Banned {
+		c.Error(apierror.Forbidden(apierror.CodeAccountBanned, "This account has been banned"))
+		return
+	}
+
+	now := time.Now()
+	userID := userObjectID.Hex()
+	collection := config.GetCollection(tournamentsCollection)
+	result, err := collection.UpdateOne(context.Background(),
+		bson.M{
+			"_id":             objectID,
+			"state":           models.TournamentRegistering,
+			"starts_at":       bson.M{"$gt": now},
+			"players.user_id": bson.M{"$ne": userID},
+			"$expr":           bson.M{"$lt": bson.A{bson.M{"$size": "$players"}, "$max_players"}},
+		},
+		bson.M{
+			"$push": bson.M{"players": models.TournamentPlayer{UserID: userID, Username: user.Username, RegisteredAt: now}},
+			"$inc":  bson.M{"version": 1},
+		},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to register for tournament", err))
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		var t models.Tournament
+		err := collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&t)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			c.Error(apierror.NotFound("Tournament not found"))
+		case err != nil:
+			c.Error(apierror.Internal("Failed to find tournament", err))
+		case t.State != models.TournamentRegistering || !t.StartsAt.After(now):
+			c.Error(apierror.Conflict(apierror.CodeTournamentClosed, "Registration is closed"))
+		case slices.ContainsFunc(t.Players, func(p models.TournamentPlayer) bool { return p.UserID == userID }):
+			c.Error(apierror.Conflict(apierror.CodeAlreadyRegistered, "You are already registered"))
+		default:
+			c.Error(apierror.Conflict(apierror.CodeTournamentFull, "Tournament is full"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Registered for tournament"})
+}
+
+// WithdrawFromTournament removes the authenticated player from a tournament
+// that has not started.
+func (h *Handler) WithdrawFromTournament(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.BadRequest("Invalid tournament ID"))
+		return
+	}
+	userID := c.GetString("user_id")
+
+	collection := config.GetCollection(tournamentsCollection)
+	result, err := collection.UpdateOne(context.Background(),
+		bson.M{"_id": objectID, "state": models.TournamentRegistering, "players.user_id": userID},
+		bson.M{
+			"$pull": bson.M{"players": bson.M{"user_id": userID}},
+			"$inc":  bson.M{"version": 1},
+		},
+	)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to withdraw from tournament", err))
+		return
+	}
+
+	if result.MatchedCount == 0 {
+		var t models.Tournament
+		err := collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&t)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			c.Error(apierror.NotFound("Tournament not found"))
+		case err != nil:
+			c.Error(apierror.Internal("Failed to find tournament", err))
+		case t.State != models.TournamentRegistering:
+			c.Error(apierror.Conflict(apierror.CodeTournamentClosed, "The tournament has already started"))
+		default:
+			c.Error(apierror.NotFound("You are not registered for this tournament"))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Withdrawn from tournament"})
+}
+
+// StartTournamentGame claims a player's game in the current round of a
+// tournament, returning live.ErrNotInTournament unless they have a game to
+// play in it and live.ErrTournamentGamePlayed once they have started it.
+// The live hub calls it when a tournament game is opened.
+func StartTournamentGame(ctx context.Context, tournamentID, userID string) (models.TournamentGame, error) {
+	objectID, err := primitive.ObjectIDFromHex(tournamentID)
+	if err != nil {
+		return models.TournamentGame{}, live.ErrNotInTournament
+	}
+
+	var t models.Tournament
+	err = config.GetCollection(tournamentsCollection).FindOne(ctx, bson.M{"_id": objectID}).Decode(&t)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.TournamentGame{}, live.ErrNotInTournament
+	}
+	if err != nil {
+		return models.TournamentGame{}, fmt.Errorf("finding tournament: %w", err)
+	}
+
+	now := time.Now()
+	if t.State != models.TournamentRunning || len(t.Rounds) == 0 {
+		return models.TournamentGame{}, live.ErrNotInTournament
+	}
+	round := t.Rounds[len(t.Rounds)-1]
+	if round.Closed || !now.Before(round.EndsAt) {
+		return models.TournamentGame{}, live.ErrNotInTournament
+	}
+	i := slices.IndexFunc(t.Players, func(p models.TournamentPlayer) bool { return p.UserID == userID })
+	if i < 0 || !tournament.Plays(t.Format, toMatches(round.Matches), toPlayer(t.Players[i])) {
+		return models.TournamentGame{}, live.ErrNotInTournament
+	}
+
+	g := models.TournamentGame{
+		TournamentID: tournamentID,
+		Round:        round.Number,
+		UserID:       userID,
+		GameType:     t.GameType,
+		Seed:         round.Seed,
+		State:        models.AttemptPlaying,
+		StartedAt:    now,
+		Deadline:     round.EndsAt,
+	}
+	result, err := config.GetCollection(tournamentGamesCollection).UpdateOne(ctx,
+		bson.M{"tournament_id": tournamentID, "round": round.Number, "user_id": userID},
+		bson.M{"$setOnInsert": g},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return models.TournamentGame{}, fmt.Errorf("saving tournament game: %w", err)
+	}
+	if result.UpsertedCount == 0 {
+		return models.TournamentGame{}, live.ErrTournamentGamePlayed
+	}
+	return g, nil
+}
+
+// RecordTournamentGame stores how a tournament game ended. A game finished
+// after its round closed is left unfinished and does not count.
+func RecordTournamentGame(ctx context.Context, g models.TournamentGame) error {
+	_, err := config.GetCollection(tournamentGamesCollection).UpdateOne(ctx,
+		bson.M{
+			"tournament_id": g.TournamentID,
+			"round":         g.Round,
+			"user_id":       g.UserID,
+			"state":         models.AttemptPlaying,
+			"deadline":      bson.M{"$gte": g.FinishedAt},
+		},
+		bson.M{"$set": bson.M{
+			"state":           g.State,
+			"score":           g.Score,
+			"time_in_seconds": g.TimeInSeconds,
+			"finished_at":     g.FinishedAt,
+		}},
+	)
+	return err
+}
+
+// AdvanceTournaments starts the tournaments whose registration has closed,
+// closes rounds that are over and starts the next round or finishes the
+// tournament. The tournament scheduler calls it periodically.
+func AdvanceTournaments(ctx context.Context, now time.Time) error {
+	var tournaments []models.Tournament
+	err := findAll(ctx, config.GetCollection(tournamentsCollection), bson.M{"$or": bson.A{
+		bson.M{"state": models.TournamentRegistering, "starts_at": bson.M{"$lte": now}},
+		bson.M{"state": models.TournamentRunning},
+	}}, options.Find(), &tournaments)
+	if err != nil {
+		return fmt.Errorf("finding due tournaments: %w", err)
+	}
+
+	var errs []error
+	for i := range tournaments {
+		if err := advanceTournament(ctx, &tournaments[i], now); err != nil && !errors.Is(err, errTournamentChanged) {
+			errs = append(errs, fmt.Errorf("tournament %s: %w", tournaments[i].ID.Hex(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func advanceTournament(ctx context.Context, t *models.Tournament, now time.Time) error {
+	if t.State == models.TournamentRegistering {
+		if len(t.Players) < 2 {
+			t.State = models.TournamentCancelled
+			t.FinishedAt = &now
+			return saveTournament(ctx, t)
+		}
+		for i := range t.Players {
+			t.Players[i].Seed = i + 1
+		}
+		t.RoundCount = tournament.Rounds(t.Format, len(t.Players), t.RoundCount)
+		t.State = models.TournamentRunning
+		startRound(t, now)
+		return saveTournament(ctx, t)
+	}
+
+	round := &t.Rounds[len(t.Rounds)-1]
+	results, _, err := roundResults(ctx, t, round.Number)
+	if err != nil {
+		return err
+	}
+	players := toPlayers(t.Players)
+	matches := toMatches(round.Matches)
+	if now.Before(round.EndsAt) {
+		for _, p := range players {
+			if tournament.Plays(t.Format, matches, p) && !results[p.ID].Played {
+				return nil
+			}
+		}
+	}
+
+	// Live sessions are kept in memory, so a game still being played when
+	// the round closes may have been lost to a restart and would never be
+	// recorded. Such games end as abandoned rather than as a silent forfeit.
+	_, err = config.GetCollection(tournamentGamesCollection).UpdateMany(ctx,
+		bson.M{"tournament_id": t.ID.Hex(), "round": round.Number, "state": models.AttemptPlaying},
+		bson.M{"$set": bson.M{"state": models.AttemptAbandoned, "finished_at": now}},
+	)
+	if err != nil {
+		return fmt.Errorf("abandoning tournament games: %w", err)
+	}
+	results, abandoned, err := roundResults(ctx, t, round.Number)
+	if err != nil {
+		return err
+	}
+
+	tournament.Score(t.Format, round.Number, players, matches, results)
+	round.Matches = fromMatches(matches)
+	round.Abandoned = abandoned
+	round.Closed = true
+	setStandings(t, players)
+
+	if round.Number >= t.RoundCount {
+		t.State = models.TournamentFinished
+		t.FinishedAt = &now
+	} else {
+		startRound(t, now)
+	}
+	return saveTournament(ctx, t)
+}
+
+// startRound pairs the next round and opens it for RoundMinutes.
+func startRound(t *models.Tournament, now time.Time) {
+	number := len(t.Rounds) + 1
+	seed := rand.Int64()
+	if number <= len(t.Seeds) {
+		seed = t.Seeds[number-1]
+	}
+
+	var previous []tournament.Match
+	if number > 1 {
+		previous = toMatches(t.Rounds[number-2].Matches)
+	}
+	matches := tournament.Pair(t.Format, number, toPlayers(t.Players), previous)
+
+	t.Rounds = append(t.Rounds, models.TournamentRound{
+		Number:   number,
+		Seed:     seed,
+		StartsAt: now,
+		EndsAt:   now.Add(time.Duration(t.RoundMinutes) * time.Minute),
+		Matches:  fromMatches(matches),
+	})
+	t.CurrentRound = number
+}
+
+// roundResults collects the games played in a round and the players who
+// abandoned theirs. A game counts as played once it has ended before the
+// round closed.
+func roundResults(ctx context.Context, t *models.Tournament, round int) (map[string]tournament.Result, []string, error) {
+	var games []models.TournamentGame
+	findOptions := options.Find().SetSort(bson.D{{Key: "user_id", Value: 1}})
+	err := findAll(ctx, config.GetCollection(tournamentGamesCollection), bson.M{"tournament_id": t.ID.Hex(), "round": round}, findOptions, &games)
+	if err != nil {
+		return nil, nil, fmt.Errorf("finding tournament games: %w", err)
+	}
+
+	results := make(map[string]tournament.Result, len(games))
+	var abandoned []string
+	for _, g := range games {
+		results[g.UserID] = tournament.Result{Score: g.Score, TimeInSeconds: g.TimeInSeconds, Played: g.State != models.AttemptPlaying}
+		if g.State == models.AttemptAbandoned {
+			abandoned = append(abandoned, g.UserID)
+		}
+	}
+	return results, abandoned, nil
+}
+
+// setStandings stores players in standings order.
+func setStandings(t *models.Tournament, players []tournament.Player) {
+	registered := make(map[string]models.TournamentPlayer, len(t.Players))
+	for _, p := range t.Players {
+		registered[p.UserID] = p
+	}
+
+	standings := make([]models.TournamentPlayer, 0, len(players))
+	for i, p := range tournament.Rank(t.Format, players) {
+		player := registered[p.ID]
+		player.Rank = i + 1
+		player.Points = p.Points
+		player.Score = p.Score
+		player.TimeInSeconds = p.TimeInSeconds
+		player.Opponents = p.Opponents
+		player.Byes = p.Byes
+		player.EliminatedIn = p.EliminatedIn
+		standings = append(standings, player)
+	}
+	t.Players = standings
+}
+
+// saveTournament replaces the stored tournament unless it has changed since
+// t was read.
+func saveTournament(ctx context.Context, t *models.Tournament) error {
+	version := t.Version
+	t.Version++
+	result, err := config.GetCollection(tournamentsCollection).ReplaceOne(ctx, bson.M{"_id": t.ID, "version": version}, t)
+	if err != nil {
+		return fmt.Errorf("saving tournament: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return errTournamentChanged
+	}
+	return nil
+}
+
+func toPlayer(p models.TournamentPlayer) tournament.Player {
+	return tournament.Player{
+		ID:            p.UserID,
+		Seed:          p.Seed,
+		Points:        p.Points,
+		Score:         p.Score,
+		TimeInSeconds: p.TimeInSeconds,
+		Opponents:     p.Opponents,
+		Byes:          p.Byes,
+		EliminatedIn:  p.EliminatedIn,
+	}
+}
+
+func toPlayers(players []models.TournamentPlayer) []tournament.Player {
+	converted := make([]tournament.Player, len(players))
+	for i, p := range players {
+		converted[i] = toPlayer(p)
+	}
+	return converted
+}
+
+func toMatches(matches []models.TournamentMatch) []tournament.Match {
+	converted := make([]tournament.Match, len(matches))
+	for i, m := range matches {
+		converted[i] = tournament.Match{Players: m.Players, WinnerID: m.WinnerID}
+	}
+	return converted
+}
+
+func fromMatches(matches []tournament.Match) []models.TournamentMatch {
+	converted := make([]models.TournamentMatch, len(matches))
+	for i, m := range matches {
+		converted[i] = models.TournamentMatch{Players: m.Players, WinnerID: m.WinnerID}
+	}
+	return converted
+}
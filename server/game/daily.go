@@ -0,0 +1,26 @@
+package game
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+)
+
+// DailyDateLayout formats the UTC day a daily challenge belongs to.
+const DailyDateLayout = "2006-01-02"
+
+// DailyDate returns the daily challenge day that t falls on. Days start at
+// midnight UTC.
+func DailyDate(t time.Time) string {
+	return t.UTC().Format(DailyDateLayout)
+}
+
+// DailySeed derives the seed of the daily challenge board for one game type
+// on one day. The seed is keyed with secret so that upcoming boards cannot
+// be generated ahead of time.
+func DailySeed(secret []byte, date, gameType string) int64 {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("daily:" + date + ":" + gameType))
+	return int64(binary.BigEndian.Uint64(mac.Sum(nil)))
+}
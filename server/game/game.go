@@ -0,0 +1,486 @@
+package game
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Game types, matching the game_type stored on records and leaderboards.
+// Races are played on normal boards and co-op rooms on infinite boards;
+// TypeRace and TypeCoop only tag them.
+const (
+	TypeNormal   = "normal"
+	TypeInfinite = "infinite"
+	TypeRace     = "race"
+	TypeCoop     = "coop"
+)
+
+const (
+	// NormalSize and NormalMines describe the fixed board of normal mode.
+	NormalSize  = 15
+	NormalMines = 35
+
+	// InfiniteMineChance is the probability of any infinite mode cell being
+	// a mine.
+	InfiniteMineChance = 0.15
+
+	// ViewSize is the width and height of the default viewport.
+	ViewSize = 15
+
+	// maxExploredCells bounds the memory a single infinite game may use.
+	maxExploredCells = 250_000
+)
+
+var (
+	ErrUnknownType   = errors.New("unknown game type")
+	ErrGameOver      = errors.New("game is over")
+	ErrNotExplored   = errors.New("cell is outside the explored area")
+	ErrExploreLimit  = errors.New("explored area limit reached")
+	ErrInvalidExtent = errors.New("invalid viewport size")
+)
+
+type State string
+
+const (
+	StatePlaying State = "playing"
+	StateWon     State = "won"
+	StateLost    State = "lost"
+)
+
+type CellStatus string
+
+const (
+	CellHidden   CellStatus = "hidden"
+	CellFlagged  CellStatus = "flagged"
+	CellRevealed CellStatus = "revealed"
+	CellMine     CellStatus = "mine"
+)
+
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Cell is the client-visible state of one cell. Value is the number of
+// adjacent mines and is only meaningful for revealed cells.
+type Cell struct {
+	X      int        `json:"x"`
+	Y      int        `json:"y"`
+	Status CellStatus `json:"status"`
+	Value  int        `json:"value,omitempty"`
+}
+
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (r Rect) Contains(p Point) bool {
+	return p.X >= r.X && p.X < r.X+r.Width && p.Y >= r.Y && p.Y < r.Y+r.Height
+}
+
+// Viewport returns the default-sized viewport with its top left corner at
+// (x, y).
+func Viewport(x, y int) Rect {
+	return Rect{X: x, Y: y, Width: ViewSize, Height: ViewSize}
+}
+
+var neighbours = [8]Point{
+	{-1, -1}, {0, -1}, {1, -1},
+	{-1, 0}, {1, 0},
+	{-1, 1}, {0, 1}, {1, 1},
+}
+
+// Game is the server-side state of one minesweeper game. Mines are derived
+// from the seed, so two games with the same type and seed have identical
+// boards. Game is not safe for concurrent use.
+type Game struct {
+	Type      string
+	Seed      int64
+	State     State
+	Score     int
+	StartedAt time.Time
+	EndedAt   time.Time
+
+	// SurviveMines keeps the game going when a mine is revealed. The mine
+	// stays uncovered and is counted in MinesHit; it is up to the caller to
+	// decide when the game is lost.
+	SurviveMines bool
+	MinesHit     int
+
+	// FlagsPlaced counts every flag placed, including flags later removed.
+	FlagsPlaced int
+
+	board    board
+	revealed map[Point]int
+	flagged  map[Point]bool
+	// explored holds the infinite mode cells that have been inside a
+	// viewport. Reveals never spread beyond it, as on the client.
+	explored map[Point]struct{}
+	// detonated holds the mines revealed while SurviveMines was set.
+	detonated map[Point]bool
+	now       func() time.Time
+}
+
+// New starts a game of the given type whose board is derived from seed.
+func New(gameType string, seed int64) (*Game, error) {
+	g := &Game{
+		Type:      gameType,
+		Seed:      seed,
+		State:     StatePlaying,
+		revealed:  make(map[Point]int),
+		flagged:   make(map[Point]bool),
+		detonated: make(map[Point]bool),
+		now:       time.Now,
+	}
+
+	switch gameType {
+	case TypeNormal:
+		g.board = newNormalBoard(seed)
+	case TypeInfinite:
+		g.board = infiniteBoard{seed: uint64(seed)}
+		g.explored = make(map[Point]struct{})
+	default:
+		return nil, ErrUnknownType
+	}
+	return g, nil
+}
+
+// Explore makes the cells in r available for play and returns the visible
+// state of every non-hidden cell in r.
+func (g *Game) Explore(r Rect) ([]Cell, error) {
+	if r.Width <= 0 || r.Height <= 0 || r.Width > 4*ViewSize || r.Height > 4*ViewSize {
+		return nil, ErrInvalidExtent
+	}
+
+	if g.explored != nil {
+		if len(g.explored)+r.Width*r.Height > maxExploredCells {
+			return nil, ErrExploreLimit
+		}
+		for y := r.Y; y < r.Y+r.Height; y++ {
+			for x := r.X; x < r.X+r.Width; x++ {
+				g.explored[Point{x, y}] = struct{}{}
+			}
+		}
+	}
+
+	return g.View(r), nil
+}
+
+// View returns every non-hidden cell in r. Cells that are not listed are
+// hidden.
+func (g *Game) View(r Rect) []Cell {
+	var cells []Cell
+	for y := r.Y; y < r.Y+r.Height; y++ {
+		for x := r.X; x < r.X+r.Width; x++ {
+			if cell, visible := g.cell(Point{x, y}); visible {
+				cells = append(cells, cell)
+			}
+		}
+	}
+	return cells
+}
+
+func (g *Game) cell(p Point) (Cell, bool) {
+	if value, ok := g.revealed[p]; ok {
+		return Cell{X: p.X, Y: p.Y, Status: CellRevealed, Value: value}, true
+	}
+	if g.detonated[p] {
+		return Cell{X: p.X, Y: p.Y, Status: CellMine}, true
+	}
+	if g.State == StateLost && g.board.isMine(p) && (g.explored == nil || g.isExplored(p)) {
+		return Cell{X: p.X, Y: p.Y, Status: CellMine}, true
+	}
+	if g.flagged[p] {
+		return Cell{X: p.X, Y: p.Y, Status: CellFlagged}, true
+	}
+	return Cell{}, false
+}
+
+// Progress is the share of safe cells revealed, from 0 to 1. Boards that
+// cannot be won report 0.
+func (g *Game) Progress() float64 {
+	safe, bounded := g.board.safeCells()
+	if !bounded {
+		return 0
+	}
+	return float64(len(g.revealed)) / float64(safe)
+}
+
+// CellsRevealed is the number of safe cells revealed.
+func (g *Game) CellsRevealed() int {
+	return len(g.revealed)
+}
+
+// Elapsed is the time spent playing, from the first move until the game
+// ended or now.
+func (g *Game) Elapsed() time.Duration {
+	switch {
+	case g.StartedAt.IsZero():
+		return 0
+	case g.EndedAt.IsZero():
+		return g.now().Sub(g.StartedAt)
+	default:
+		return g.EndedAt.Sub(g.StartedAt)
+	}
+}
+
+// Reveal uncovers the cell at p, spreading through cells with no adjacent
+// mines, and returns the cells that changed.
+func (g *Game) Reveal(p Point) ([]Cell, error) {
+	if err := g.checkMove(p); err != nil {
+		return nil, err
+	}
+	if g.flagged[p] || g.detonated[p] {
+		return nil, nil
+	}
+	if _, ok := g.revealed[p]; ok {
+		return nil, nil
+	}
+	g.start()
+
+	return g.reveal([]Point{p}), nil
+}
+
+// ToggleFlag flags or unflags a hidden cell.
+func (g *Game) ToggleFlag(p Point) ([]Cell, error) {
+	if err := g.checkMove(p); err != nil {
+		return nil, err
+	}
+	if _, ok := g.revealed[p]; ok || g.detonated[p] {
+		return nil, nil
+	}
+	g.start()
+
+	if g.flagged[p] {
+		delete(g.flagged, p)
+		return []Cell{{X: p.X, Y: p.Y, Status: CellHidden}}, nil
+	}
+	g.flagged[p] = true
+	g.FlagsPlaced++
+	return []Cell{{X: p.X, Y: p.Y, Status: CellFlagged}}, nil
+}
+
+// Chord reveals every unflagged neighbour of a revealed number once the
+// matching number of neighbours has been flagged.
+func (g *Game) Chord(p Point) ([]Cell, error) {
+	if err := g.checkMove(p); err != nil {
+		return nil, err
+	}
+	value, ok := g.revealed[p]
+	if !ok || value == 0 {
+		return nil, nil
+	}
+
+	flags := 0
+	var targets []Point
+	for _, n := range g.neighbours(p) {
+		if g.flagged[n] || g.detonated[n] {
+			flags++
+		} else if _, revealed := g.revealed[n]; !revealed {
+			targets = append(targets, n)
+		}
+	}
+	if flags != value || len(targets) == 0 {
+		return nil, nil
+	}
+
+	return g.reveal(targets), nil
+}
+
+func (g *Game) checkMove(p Point) error {
+	if g.State != StatePlaying {
+		return ErrGameOver
+	}
+	if !g.playable(p) {
+		return ErrNotExplored
+	}
+	return nil
+}
+
+func (g *Game) start() {
+	if g.StartedAt.IsZero() {
+		g.StartedAt = g.now()
+	}
+}
+
+func (g *Game) playable(p Point) bool {
+	if g.explored != nil {
+		return g.isExplored(p)
+	}
+	return g.board.inBounds(p)
+}
+
+func (g *Game) isExplored(p Point) bool {
+	_, ok := g.explored[p]
+	return ok
+}
+
+func (g *Game) neighbours(p Point) []Point {
+	points := make([]Point, 0, len(neighbours))
+	for _, d := range neighbours {
+		n := Point{p.X + d.X, p.Y + d.Y}
+		if g.playable(n) {
+			points = append(points, n)
+		}
+	}
+	return points
+}
+
+// reveal uncovers the given cells and flood fills from any that have no
+// adjacent mines. Hitting a mine ends the game.
+func (g *Game) reveal(start []Point) []Cell {
+	var changed []Cell
+	queue := append([]Point(nil), start...)
+
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		if _, ok := g.revealed[p]; ok || g.flagged[p] || g.detonated[p] {
+			continue
+		}
+
+		if g.board.isMine(p) {
+			if !g.SurviveMines {
+				return append(changed, g.lose(p)...)
+			}
+			g.detonated[p] = true
+			g.MinesHit++
+			changed = append(changed, Cell{X: p.X, Y: p.Y, Status: CellMine})
+			continue
+		}
+
+		value := 0
+		for _, d := range neighbours {
+			if g.board.isMine(Point{p.X + d.X, p.Y + d.Y}) {
+				value++
+			}
+		}
+		g.revealed[p] = value
+		changed = append(changed, Cell{X: p.X, Y: p.Y, Status: CellRevealed, Value: value})
+
+		if value == 0 {
+			queue = append(queue, g.neighbours(p)...)
+		} else {
+			g.Score += g.board.points(p)
+		}
+	}
+
+	if safe, bounded := g.board.safeCells(); bounded && len(g.revealed) == safe {
+		g.State = StateWon
+		g.EndedAt = g.now()
+	}
+	return changed
+}
+
+// Resign ends a game that is still being played as lost.
+func (g *Game) Resign() {
+	if g.State == StatePlaying {
+		g.State = StateLost
+		g.EndedAt = g.now()
+	}
+}
+
+// lose ends the game and returns the mine that was hit. Normal games also
+// show every other mine on the board.
+func (g *Game) lose(hit Point) []Cell {
+	g.State = StateLost
+	g.EndedAt = g.now()
+
+	cells := []Cell{{X: hit.X, Y: hit.Y, Status: CellMine}}
+	if normal, ok := g.board.(*normalBoard); ok {
+		for p := range normal.mines {
+			if p != hit {
+				cells = append(cells, Cell{X: p.X, Y: p.Y, Status: CellMine})
+			}
+		}
+	}
+	return cells
+}
+
+type board interface {
+	inBounds(p Point) bool
+	isMine(p Point) bool
+	// points is the score awarded for revealing a numbered cell.
+	points(p Point) int
+	// safeCells returns how many cells must be revealed to win, and false
+	// for boards that cannot be won.
+	safeCells() (int, bool)
+}
+
+type normalBoard struct {
+	seed  uint64
+	mines map[Point]bool
+}
+
+func newNormalBoard(seed int64) *normalBoard {
+	rng := rand.New(rand.NewPCG(uint64(seed), 0))
+	b := &normalBoard{seed: uint64(seed), mines: make(map[Point]bool, NormalMines)}
+	for _, i := range rng.Perm(NormalSize * NormalSize)[:NormalMines] {
+		b.mines[Point{i % NormalSize, i / NormalSize}] = true
+	}
+	return b
+}
+
+func (b *normalBoard) inBounds(p Point) bool {
+	return p.X >= 0 && p.X < NormalSize && p.Y >= 0 && p.Y < NormalSize
+}
+
+func (b *normalBoard) isMine(p Point) bool {
+	return b.mines[p]
+}
+
+func (b *normalBoard) points(p Point) int {
+	return cellPoints(hash(b.seed, uint64(p.X), uint64(p.Y)))
+}
+
+func (b *normalBoard) safeCells() (int, bool) {
+	return NormalSize*NormalSize - NormalMines, true
+}
+
+// infiniteBoard decides every cell independently from a hash of the seed and
+// its coordinates, so nothing has to be stored for unexplored cells.
+type infiniteBoard struct {
+	seed uint64
+}
+
+func (b infiniteBoard) inBounds(Point) bool {
+	return true
+}
+
+func (b infiniteBoard) isMine(p Point) bool {
+	h := hash(b.seed, uint64(p.X), uint64(p.Y))
+	return float64(h>>11)/(1<<53) < InfiniteMineChance
+}
+
+func (b infiniteBoard) points(p Point) int {
+	return cellPoints(hash(^b.seed, uint64(p.X), uint64(p.Y)))
+}
+
+func (b infiniteBoard) safeCells() (int, bool) {
+	return 0, false
+}
+
+// cellPoints awards between 35 and 50 points per numbered cell, the same
+// range the browser client uses.
+func cellPoints(h uint64) int {
+	return 35 + int(h%16)
+}
+
+// hash mixes its inputs with the SplitMix64 finalizer.
+func hash(values ...uint64) uint64 {
+	var h uint64 = 0x9e3779b97f4a7c15
+	for _, v := range values {
+		h ^= v + 0x9e3779b97f4a7c15 + (h << 6) + (h >> 2)
+		h ^= h >> 30
+		h *= 0xbf58476d1ce4e5b9
+		h ^= h >> 27
+		h *= 0x94d049bb133111eb
+		h ^= h >> 31
+	}
+	return h
+}
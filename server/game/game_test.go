@@ -0,0 +1,276 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGame(t *testing.T, gameType string, seed int64) *Game {
+	t.Helper()
+	g, err := New(gameType, seed)
+	require.NoError(t, err)
+	return g
+}
+
+// findCell returns the first cell in r matching the predicate.
+func findCell(t *testing.T, r Rect, match func(Point) bool) Point {
+	t.Helper()
+	for y := r.Y; y < r.Y+r.Height; y++ {
+		for x := r.X; x < r.X+r.Width; x++ {
+			if match(Point{x, y}) {
+				return Point{x, y}
+			}
+		}
+	}
+	t.Fatal("no matching cell")
+	return Point{}
+}
+
+func adjacentMines(g *Game, p Point) int {
+	count := 0
+	for _, d := range neighbours {
+		if g.board.isMine(Point{p.X + d.X, p.Y + d.Y}) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestNewUnknownType(t *testing.T) {
+	_, err := New("hard", 1)
+	assert.ErrorIs(t, err, ErrUnknownType)
+}
+
+func TestNormalBoardIsDeterministic(t *testing.T) {
+	a := newTestGame(t, TypeNormal, 42)
+	b := newTestGame(t, TypeNormal, 42)
+	c := newTestGame(t, TypeNormal, 43)
+
+	minesA := a.board.(*normalBoard).mines
+	assert.Len(t, minesA, NormalMines)
+	assert.Equal(t, minesA, b.board.(*normalBoard).mines)
+	assert.NotEqual(t, minesA, c.board.(*normalBoard).mines)
+}
+
+func TestInfiniteMineDensity(t *testing.T) {
+	g := newTestGame(t, TypeInfinite, 7)
+
+	mines := 0
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 200; x++ {
+			if g.board.isMine(Point{x, y}) {
+				mines++
+			}
+		}
+	}
+
+	assert.InDelta(t, InfiniteMineChance, float64(mines)/(200*200), 0.01)
+}
+
+func TestRevealSafeCell(t *testing.T) {
+	g := newTestGame(t, TypeNormal, 1)
+	board := Rect{Width: NormalSize, Height: NormalSize}
+	p := findCell(t, board, func(p Point) bool {
+		return !g.board.isMine(p) && adjacentMines(g, p) > 0
+	})
+
+	cells, err := g.Reveal(p)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Cell{{X: p.X, Y: p.Y, Status: CellRevealed, Value: adjacentMines(g, p)}}, cells)
+	assert.Equal(t, StatePlaying, g.State)
+	assert.GreaterOrEqual(t, g.Score, 35)
+	assert.LessOrEqual(t, g.Score, 50)
+	assert.False(t, g.StartedAt.IsZero())
+
+	again, err := g.Reveal(p)
+	require.NoError(t, err)
+	assert.Empty(t, again)
+}
+
+func TestRevealFloodFill(t *testing.T) {
+	g := newTestGame(t, TypeNormal, 1)
+	board := Rect{Width: NormalSize, Height: NormalSize}
+	p := findCell(t, board, func(p Point) bool {
+		return !g.board.isMine(p) && adjacentMines(g, p) == 0
+	})
+
+	cells, err := g.Reveal(p)
+	require.NoError(t, err)
+
+	assert.Greater(t, len(cells), 1)
+	for _, cell := range cells {
+		assert.Equal(t, CellRevealed, cell.Status)
+		assert.False(t, g.board.isMine(Point{cell.X, cell.Y}))
+		assert.True(t, board.Contains(Point{cell.X, cell.Y}))
+	}
+}
+
+func TestRevealMineEndsGame(t *testing.T) {
+	g := newTestGame(t, TypeNormal, 1)
+	board := Rect{Width: NormalSize, Height: NormalSize}
+	p := findCell(t, board, g.board.isMine)
+
+	cells, err := g.Reveal(p)
+	require.NoError(t, err)
+
+	assert.Equal(t, StateLost, g.State)
+	assert.Len(t, cells, NormalMines)
+	assert.Equal(t, Cell{X: p.X, Y: p.Y, Status: CellMine}, cells[0])
+	assert.False(t, g.EndedAt.IsZero())
+
+	_, err = g.Reveal(Point{0, 0})
+	assert.ErrorIs(t, err, ErrGameOver)
+}
+
+func TestWinNormalGame(t *testing.T) {
+	g := newTestGame(t, TypeNormal, 3)
+	assert.Zero(t, g.Progress())
+
+	for y := 0; y < NormalSize; y++ {
+		for x := 0; x < NormalSize; x++ {
+			if !g.board.isMine(Point{x, y}) {
+				_, err := g.Reveal(Point{x, y})
+				require.NoError(t, err)
+			}
+		}
+	}
+
+	assert.Equal(t, StateWon, g.State)
+	assert.Len(t, g.revealed, NormalSize*NormalSize-NormalMines)
+	assert.Equal(t, 1.0, g.Progress())
+}
+
+func TestToggleFlag(t *testing.T) {
+	g := newTestGame(t, TypeNormal, 1)
+	p := Point{3, 4}
+
+	cells, err := g.ToggleFlag(p)
+	require.NoError(t, err)
+	assert.Equal(t, []Cell{{X: 3, Y: 4, Status: CellFlagged}}, cells)
+
+	cells, err = g.Reveal(p)
+	require.NoError(t, err)
+	assert.Empty(t, cells, "flagged cells cannot be revealed")
+
+	cells, err = g.ToggleFlag(p)
+	require.NoError(t, err)
+	assert.Equal(t, []Cell{{X: 3, Y: 4, Status: CellHidden}}, cells)
+	assert.Equal(t, 1, g.FlagsPlaced, "removing a flag does not undo placing it")
+
+	_, err = g.ToggleFlag(Point{NormalSize, 0})
+	assert.ErrorIs(t, err, ErrNotExplored)
+}
+
+func TestChord(t *testing.T) {
+	g := newTestGame(t, TypeNormal, 1)
+	inner := Rect{X: 1, Y: 1, Width: NormalSize - 2, Height: NormalSize - 2}
+	p := findCell(t, inner, func(p Point) bool {
+		mines := adjacentMines(g, p)
+		return !g.board.isMine(p) && mines > 0 && mines < 8
+	})
+
+	_, err := g.Reveal(p)
+	require.NoError(t, err)
+
+	cells, err := g.Chord(p)
+	require.NoError(t, err)
+	assert.Empty(t, cells, "chord needs matching flags")
+
+	for _, n := range g.neighbours(p) {
+		if g.board.isMine(n) {
+			_, err := g.ToggleFlag(n)
+			require.NoError(t, err)
+		}
+	}
+
+	cells, err = g.Chord(p)
+	require.NoError(t, err)
+	assert.NotEmpty(t, cells)
+	assert.Equal(t, StatePlaying, g.State)
+	for _, n := range g.neighbours(p) {
+		if !g.board.isMine(n) {
+			assert.Contains(t, g.revealed, n)
+		}
+	}
+}
+
+func TestInfiniteRequiresExploration(t *testing.T) {
+	g := newTestGame(t, TypeInfinite, 9)
+	view := Viewport(100, -40)
+
+	_, err := g.Reveal(Point{100, -40})
+	assert.ErrorIs(t, err, ErrNotExplored)
+
+	cells, err := g.Explore(view)
+	require.NoError(t, err)
+	assert.Empty(t, cells)
+
+	p := findCell(t, view, func(p Point) bool {
+		return !g.board.isMine(p) && adjacentMines(g, p) == 0
+	})
+	cells, err = g.Reveal(p)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, cells)
+	for _, cell := range cells {
+		assert.True(t, view.Contains(Point{cell.X, cell.Y}), "reveal spread outside the explored area")
+	}
+
+	assert.ElementsMatch(t, cells, g.View(view))
+}
+
+func TestExploreRejectsInvalidViewport(t *testing.T) {
+	g := newTestGame(t, TypeInfinite, 1)
+
+	_, err := g.Explore(Rect{Width: 0, Height: ViewSize})
+	assert.ErrorIs(t, err, ErrInvalidExtent)
+
+	_, err = g.Explore(Rect{Width: 1000, Height: 1000})
+	assert.ErrorIs(t, err, ErrInvalidExtent)
+}
+
+func TestSurviveMines(t *testing.T) {
+	g := newTestGame(t, TypeInfinite, 9)
+	g.SurviveMines = true
+	view := Viewport(0, 0)
+	_, err := g.Explore(view)
+	require.NoError(t, err)
+
+	mine := findCell(t, view, g.board.isMine)
+	cells, err := g.Reveal(mine)
+	require.NoError(t, err)
+	assert.Equal(t, []Cell{{X: mine.X, Y: mine.Y, Status: CellMine}}, cells)
+	assert.Equal(t, StatePlaying, g.State)
+	assert.Equal(t, 1, g.MinesHit)
+	assert.Contains(t, g.View(view), cells[0], "the mine stays uncovered")
+
+	cells, err = g.Reveal(mine)
+	require.NoError(t, err)
+	assert.Empty(t, cells, "a mine only goes off once")
+	cells, err = g.ToggleFlag(mine)
+	require.NoError(t, err)
+	assert.Empty(t, cells)
+	assert.Equal(t, 1, g.MinesHit)
+
+	g.Resign()
+	assert.Equal(t, StateLost, g.State)
+	assert.False(t, g.EndedAt.IsZero())
+}
+
+func TestDailySeed(t *testing.T) {
+	secret := []byte("daily-test-secret")
+	day := time.Date(2026, 10, 19, 23, 59, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	assert.Equal(t, "2026-10-19", DailyDate(day))
+	assert.Equal(t, "2026-10-20", DailyDate(day.Add(3*time.Hour)))
+
+	seed := DailySeed(secret, "2026-10-19", TypeNormal)
+	assert.Equal(t, seed, DailySeed(secret, "2026-10-19", TypeNormal), "every player gets the same board")
+	assert.NotEqual(t, seed, DailySeed(secret, "2026-10-19", TypeInfinite))
+	assert.NotEqual(t, seed, DailySeed(secret, "2026-10-20", TypeNormal))
+	assert.NotEqual(t, seed, DailySeed([]byte("another-secret"), "2026-10-19", TypeNormal))
+}
@@ -0,0 +1,91 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Check reports whether a dependency is usable. It should return promptly
+// once ctx is done.
+type Check func(ctx context.Context) error
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusShutdown    = "shutting_down"
+)
+
+var (
+	mu           sync.RWMutex
+	checks       = map[string]Check{}
+	shuttingDown atomic.Bool
+)
+
+// Register adds a named readiness check, replacing any check with the same
+// name.
+func Register(name string, check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = check
+}
+
+// SetShuttingDown makes every later readiness report fail so load balancers
+// stop routing traffic while in-flight requests drain.
+func SetShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// Ready runs all registered checks concurrently and aggregates the results.
+func Ready(ctx context.Context) Report {
+	mu.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	current := make([]Check, len(names))
+	for i, name := range names {
+		current[i] = checks[name]
+	}
+	mu.RUnlock()
+
+	results := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i := range current {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := current[i](ctx); err != nil {
+				results[i] = CheckResult{Status: StatusUnavailable, Error: err.Error()}
+			} else {
+				results[i] = CheckResult{Status: StatusOK}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(names))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+
+	if shuttingDown.Load() {
+		report.Status = StatusShutdown
+	}
+	return report
+}
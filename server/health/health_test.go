@@ -0,0 +1,55 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func resetState(t *testing.T) {
+	t.Cleanup(func() {
+		mu.Lock()
+		checks = map[string]Check{}
+		mu.Unlock()
+		shuttingDown.Store(false)
+	})
+}
+
+func TestReady(t *testing.T) {
+	t.Run("All Checks Pass", func(t *testing.T) {
+		resetState(t)
+		Register("mongodb", func(ctx context.Context) error { return nil })
+		Register("worker", func(ctx context.Context) error { return nil })
+
+		report := Ready(context.Background())
+
+		assert.Equal(t, StatusOK, report.Status)
+		assert.Equal(t, CheckResult{Status: StatusOK}, report.Checks["mongodb"])
+		assert.Equal(t, CheckResult{Status: StatusOK}, report.Checks["worker"])
+	})
+
+	t.Run("Failing Check", func(t *testing.T) {
+		resetState(t)
+		Register("mongodb", func(ctx context.Context) error { return errors.New("connection refused") })
+		Register("worker", func(ctx context.Context) error { return nil })
+
+		report := Ready(context.Background())
+
+		assert.Equal(t, StatusUnavailable, report.Status)
+		assert.Equal(t, CheckResult{Status: StatusUnavailable, Error: "connection refused"}, report.Checks["mongodb"])
+		assert.Equal(t, StatusOK, report.Checks["worker"].Status)
+	})
+
+	t.Run("Shutting Down", func(t *testing.T) {
+		resetState(t)
+		Register("mongodb", func(ctx context.Context) error { return nil })
+		SetShuttingDown()
+
+		report := Ready(context.Background())
+
+		assert.Equal(t, StatusShutdown, report.Status)
+		assert.Equal(t, StatusOK, report.Checks["mongodb"].Status)
+	})
+}
@@ -0,0 +1,118 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+)
+
+// openChallenge starts the player's game in the head-to-head challenge
+// cmd.ChallengeID, on the board the other side plays. Like tournament games,
+// challenge games cannot be spectated.
+func (h *Hub) openChallenge(c *conn, cmd Command) {
+	if h.opts.StartChallengeGame == nil {
+		c.sendError(cmd.ID, ErrorChallengeUnavailable, "Challenges are not available")
+		return
+	}
+	if cmd.Public {
+		c.sendError(cmd.ID, ErrorChallengePrivate, "Challenge games cannot be spectated")
+		return
+	}
+	if c.player.Guest {
+		c.sendError(cmd.ID, ErrorChallengeNotFound, "Guests cannot play challenges")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	cg, err := h.opts.StartChallengeGame(ctx, cmd.ChallengeID, c.player.ID)
+	cancel()
+	switch {
+	case errors.Is(err, ErrNoChallenge):
+		c.sendError(cmd.ID, ErrorChallengeNotFound, "Challenge not found or no longer open")
+		return
+	case errors.Is(err, ErrChallengePlayed):
+		c.sendError(cmd.ID, ErrorChallengePlayed, "You have already played this challenge")
+		return
+	case err != nil:
+		h.log.Error("failed to start challenge game", slog.String("player_id", c.player.ID), slog.Any("error", err))
+		c.sendError(cmd.ID, ErrorChallengeUnavailable, "Challenges are unavailable, try again later")
+		return
+	}
+
+	g, err := game.New(cg.GameType, cg.Seed)
+	if err != nil {
+		c.sendError(cmd.ID, ErrorUnknownGameType, "game_type must be normal or infinite")
+		return
+	}
+
+	s := newSession(c.player, g)
+	s.challenge = &cg
+	h.addSession(c, s)
+	h.attach(c, s, cmd.ID)
+}
+
+// finishChallenge records the challenge game played in s once its game is
+// over and, when that game decided the challenge, tells both players how it
+// ended.
+func (h *Hub) finishChallenge(s *Session, o outcome) {
+	result := s.challengeResult(o)
+	if result == nil || h.opts.RecordChallengeGame == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	ch, err := h.opts.RecordChallengeGame(ctx, *result)
+	if err != nil {
+		h.log.Error("failed to record challenge game", slog.String("player_id", result.PlayerID), slog.Any("error", err))
+		return
+	}
+	if ch == nil {
+		return
+	}
+
+	msg := ChallengeResultMessage{Type: MessageChallengeResult, Challenge: *ch}
+	if msg.Challenge.Challenger != nil {
+		side := *msg.Challenge.Challenger
+		side.Replay = nil
+		msg.Challenge.Challenger = &side
+	}
+	if msg.Challenge.Opponent != nil {
+		side := *msg.Challenge.Opponent
+		side.Replay = nil
+		msg.Challenge.Opponent = &side
+	}
+	h.notify(ch.ChallengerID, msg)
+	h.notify(ch.OpponentID, msg)
+}
+
+// isChallenge reports whether s plays a challenge game. challenge never
+// changes once the session is created, so it is read without s.mu.
+func (s *Session) isChallenge() bool {
+	return s.challenge != nil
+}
+
+func (s *Session) challengeID() string {
+	if s.challenge == nil {
+		return ""
+	}
+	return s.challenge.ChallengeID
+}
+
+// challengeResult returns the challenge game played in s, with its replay,
+// as it ended with o, or nil for other sessions.
+func (s *Session) challengeResult(o outcome) *models.ChallengeGame {
+	if s.challenge == nil {
+		return nil
+	}
+	result := *s.challenge
+	result.State = o.state
+	result.Score = o.score
+	result.TimeInSeconds = o.timeInSeconds
+	result.FinishedAt = &o.finishedAt
+	result.Replay = o.replay
+	return &result
+}
@@ -0,0 +1,183 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const challengeTestSeed = 5151
+
+// useChallengeStore enables challenges on opts for a challenge "c1" that
+// player1 issued to player2. The challenge is decided once both have
+// played.
+func useChallengeStore(opts *Options) chan models.ChallengeGame {
+	recorded := make(chan models.ChallengeGame, 4)
+	started := map[string]bool{}
+	opts.StartChallengeGame = func(_ context.Context, challengeID, playerID string) (models.ChallengeGame, error) {
+		if challengeID != "c1" || (playerID != "player1" && playerID != "player2") {
+			return models.ChallengeGame{}, ErrNoChallenge
+		}
+		if started[playerID] {
+			return models.ChallengeGame{}, ErrChallengePlayed
+		}
+		started[playerID] = true
+		return models.ChallengeGame{
+			ChallengeID: challengeID,
+			PlayerID:    playerID,
+			Challenger:  playerID == "player1",
+			GameType:    game.TypeNormal,
+			Seed:        challengeTestSeed,
+			State:       models.AttemptPlaying,
+		}, nil
+	}
+	opts.RecordChallengeGame = func(_ context.Context, g models.ChallengeGame) (*models.Challenge, error) {
+		recorded <- g
+		if g.Challenger {
+			return nil, nil
+		}
+		result := &models.ChallengeResult{State: g.State, Score: g.Score, Replay: g.Replay}
+		return &models.Challenge{
+			GameType:     g.GameType,
+			Seed:         g.Seed,
+			ChallengerID: "player1",
+			OpponentID:   "player2",
+			State:        models.ChallengeCompleted,
+			Challenger:   result,
+			Opponent:     result,
+		}, nil
+	}
+	return recorded
+}
+
+func TestChallengeGame(t *testing.T) {
+	opts := testOptions()
+	recorded := useChallengeStore(&opts)
+	hub, url, now := newDailyServer(t, opts)
+
+	player1 := dial(t, url, "player1")
+	sendCommand(t, player1, Command{Type: CommandOpen, ID: 1, ChallengeID: "c1"})
+	session := readMessage[SessionMessage](t, player1)
+	require.Equal(t, MessageSession, session.Type)
+	assert.Equal(t, "c1", session.ChallengeID)
+
+	hub.mu.Lock()
+	s := hub.sessions[session.SessionID]
+	hub.mu.Unlock()
+	require.NotNil(t, s)
+	assert.Equal(t, int64(challengeTestSeed), s.game.Seed)
+
+	sendCommand(t, player1, Command{Type: CommandSetVisibility, ID: 2, Public: true})
+	assert.Equal(t, ErrorChallengePrivate, readMessage[ErrorMessage](t, player1).Code)
+
+	mine := firstMine(t, challengeTestSeed)
+	sendCommand(t, player1, Command{Type: CommandReveal, ID: 3, X: mine.X, Y: mine.Y})
+	require.Equal(t, game.StateLost, readMessage[DeltaMessage](t, player1).State)
+
+	select {
+	case g := <-recorded:
+		assert.Equal(t, "player1", g.PlayerID)
+		assert.Equal(t, models.AttemptLost, g.State)
+		assert.Equal(t, now, *g.FinishedAt)
+		require.Len(t, g.Replay, 1)
+		assert.Equal(t, CommandReveal, g.Replay[0].Type)
+		assert.Equal(t, mine, game.Point{X: g.Replay[0].X, Y: g.Replay[0].Y})
+	case <-time.After(5 * time.Second):
+		t.Fatal("no challenge game recorded")
+	}
+
+	sendCommand(t, player1, Command{Type: CommandOpen, ID: 4, ChallengeID: "c1"})
+	assert.Equal(t, ErrorChallengePlayed, readMessage[ErrorMessage](t, player1).Code)
+
+	// The opponent's game decides the challenge and both players are told
+	// the outcome, without the replays.
+	player2 := dial(t, url, "player2")
+	sendCommand(t, player2, Command{Type: CommandOpen, ID: 1, ChallengeID: "c1"})
+	require.Equal(t, MessageSession, readMessage[SessionMessage](t, player2).Type)
+	sendCommand(t, player2, Command{Type: CommandReveal, ID: 2, X: mine.X, Y: mine.Y})
+	require.Equal(t, game.StateLost, readMessage[DeltaMessage](t, player2).State)
+
+	for _, ws := range []*websocket.Conn{player2, player1} {
+		msg := readMessage[ChallengeResultMessage](t, ws)
+		require.Equal(t, MessageChallengeResult, msg.Type)
+		assert.Equal(t, models.ChallengeCompleted, msg.Challenge.State)
+		require.NotNil(t, msg.Challenge.Challenger)
+		assert.Empty(t, msg.Challenge.Challenger.Replay)
+	}
+}
+
+func TestChallengeReplayLimit(t *testing.T) {
+	g, err := game.New(game.TypeNormal, challengeTestSeed)
+	require.NoError(t, err)
+	s := newSession(Player{ID: "player1"}, g)
+	s.challenge = &models.ChallengeGame{}
+	s.replay = make([]models.ReplayMove, maxReplayMoves-1)
+
+	_, err = s.apply(Command{Type: CommandFlag, X: 1, Y: 1})
+	require.NoError(t, err)
+	assert.Len(t, s.replay, maxReplayMoves)
+
+	_, err = s.apply(Command{Type: CommandFlag, X: 1, Y: 1})
+	assert.ErrorIs(t, err, errReplayLimit)
+	assert.Len(t, s.replay, maxReplayMoves)
+	cells := s.game.View(game.Rect{X: 1, Y: 1, Width: 1, Height: 1})
+	require.Len(t, cells, 1)
+	assert.Equal(t, game.CellFlagged, cells[0].Status, "a rejected move is not applied")
+}
+
+func TestChallengeErrors(t *testing.T) {
+	opts := testOptions()
+	useChallengeStore(&opts)
+	_, url := newTestServer(t, opts)
+
+	tests := []struct {
+		name   string
+		player string
+		cmd    Command
+		code   string
+	}{
+		{name: "Not Challenged", player: "player3", cmd: Command{Type: CommandOpen, ChallengeID: "c1"}, code: ErrorChallengeNotFound},
+		{name: "Unknown Challenge", player: "player1", cmd: Command{Type: CommandOpen, ChallengeID: "c2"}, code: ErrorChallengeNotFound},
+		{name: "Guest", player: "player1&guest", cmd: Command{Type: CommandOpen, ChallengeID: "c1"}, code: ErrorChallengeNotFound},
+		{name: "Public", player: "player1", cmd: Command{Type: CommandOpen, ChallengeID: "c1", Public: true}, code: ErrorChallengePrivate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := dial(t, url, tt.player)
+			sendCommand(t, ws, tt.cmd)
+			assert.Equal(t, tt.code, readMessage[ErrorMessage](t, ws).Code)
+		})
+	}
+}
+
+func TestChallengeUnavailable(t *testing.T) {
+	tests := []struct {
+		name  string
+		start func(context.Context, string, string) (models.ChallengeGame, error)
+	}{
+		{name: "Disabled"},
+		{name: "Store Down", start: func(context.Context, string, string) (models.ChallengeGame, error) {
+			return models.ChallengeGame{}, errors.New("store down")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			opts.StartChallengeGame = tt.start
+			_, url := newTestServer(t, opts)
+			ws := dial(t, url, "player1")
+
+			sendCommand(t, ws, Command{Type: CommandOpen, ID: 1, ChallengeID: "c1"})
+			assert.Equal(t, ErrorChallengeUnavailable, readMessage[ErrorMessage](t, ws).Code)
+		})
+	}
+}
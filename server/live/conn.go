@@ -0,0 +1,171 @@
+package live
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
+)
+
+const (
+	// maxCommandSize is far larger than any valid command.
+	maxCommandSize = 1024
+	writeWait      = 10 * time.Second
+)
+
+type conn struct {
+	hub    *Hub
+	ws     *websocket.Conn
+	player Player
+
+	// session is only accessed from the read loop.
+	session *Session
+	// spectating is the session a read-only connection watches.
+	spectating *Session
+
+	outbox    chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	closeCode int
+	closeText string
+}
+
+func newConn(h *Hub, ws *websocket.Conn, player Player) *conn {
+	return &conn{
+		hub:    h,
+		ws:     ws,
+		player: player,
+		outbox: make(chan []byte, h.opts.SendBuffer),
+		done:   make(chan struct{}),
+	}
+}
+
+// readLoop handles commands one at a time until the connection fails or is
+// closed. A client that stops answering pings times out here.
+func (c *conn) readLoop() {
+	defer c.closeWith(websocket.CloseNormalClosure, "")
+
+	pongWait := 2 * c.hub.opts.PingInterval
+	c.ws.SetReadLimit(maxCommandSize)
+	_ = c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				c.hub.log.Debug("live connection closed", slog.Any("error", err))
+			}
+			return
+		}
+		_ = c.ws.SetReadDeadline(time.Now().Add(pongWait))
+
+		var cmd Command
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			c.sendError(0, ErrorInvalidMessage, "Commands must be JSON objects")
+			continue
+		}
+		c.hub.handle(c, cmd)
+	}
+}
+
+// writeLoop sends queued messages and heartbeats. It owns all writes to the
+// socket and closes it on exit, which also ends the read loop.
+func (c *conn) writeLoop() {
+	ticker := time.NewTicker(c.hub.opts.PingInterval)
+	defer func() {
+		ticker.Stop()
+		_ = c.ws.Close()
+	}()
+
+	for {
+		select {
+		case data := <-c.outbox:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+				c.closeWith(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				c.closeWith(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-c.done:
+			if c.closeCode != websocket.CloseAbnormalClosure {
+				message := websocket.FormatCloseMessage(c.closeCode, c.closeText)
+				_ = c.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait))
+			}
+			return
+		}
+	}
+}
+
+// send queues msg without blocking. A client whose queue is full is too slow
+// to keep up and is disconnected; its session stays resumable.
+func (c *conn) send(msg any) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		c.hub.log.Error("failed to encode live message", slog.Any("error", err))
+		return
+	}
+	c.enqueue(data)
+}
+
+func (c *conn) enqueue(data []byte) {
+	select {
+	case <-c.done:
+	case c.outbox <- data:
+	default:
+		metrics.LiveSlowConsumers.Inc()
+		c.closeWith(websocket.CloseTryAgainLater, "client too slow")
+	}
+}
+
+// deliver and end make a read-only connection a spectator.
+func (c *conn) deliver(_ string, data []byte) {
+	c.enqueue(data)
+}
+
+func (c *conn) end(code int, text string) {
+	c.closeWith(code, text)
+}
+
+func (c *conn) sendError(id int64, code, message string) {
+	c.send(ErrorMessage{Type: MessageError, ID: id, Code: code, Message: message})
+}
+
+func (c *conn) sendGameError(id int64, err error) {
+	switch {
+	case errors.Is(err, game.ErrGameOver):
+		c.sendError(id, ErrorGameOver, "The game is over")
+	case errors.Is(err, game.ErrNotExplored):
+		c.sendError(id, ErrorNotExplored, "Cell is outside the explored area")
+	case errors.Is(err, game.ErrExploreLimit):
+		c.sendError(id, ErrorExploreLimit, "Explored area limit reached")
+	case errors.Is(err, game.ErrInvalidExtent):
+		c.sendError(id, ErrorInvalidViewport, "Invalid viewport")
+	case errors.Is(err, errReplayLimit):
+		c.sendError(id, ErrorReplayLimit, "Move limit reached for this challenge")
+	default:
+		c.hub.log.Error("live command failed", slog.Any("error", err))
+		c.sendError(id, ErrorInvalidMessage, "Command failed")
+	}
+}
+
+// closeWith asks the writer to send a close frame with the given code and
+// shut the connection down. Only the first call has any effect.
+func (c *conn) closeWith(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.done)
+	})
+}
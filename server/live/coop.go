@@ -0,0 +1,454 @@
+package live
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
+)
+
+// member is a player in a co-op room. Members share the board but each keeps
+// their own viewport onto it.
+type member struct {
+	player   Player
+	conn     *conn
+	viewport game.Rect
+	lives    int
+	out      bool
+
+	revealed int
+	flags    int
+	score    int
+	minesHit int
+}
+
+func (m *member) stats() RoomPlayer {
+	return RoomPlayer{
+		PlayerID:  m.player.ID,
+		Guest:     m.player.Guest,
+		Connected: m.conn != nil,
+		Lives:     m.lives,
+		Out:       m.out,
+		Revealed:  m.revealed,
+		Flags:     m.flags,
+		Score:     m.score,
+		MinesHit:  m.minesHit,
+	}
+}
+
+// room is a co-op game on one infinite board explored by all of its members
+// at once. As with lobbies, the hub lock guards which room each player is in
+// and the room lock guards everything else; the hub lock is taken first.
+type room struct {
+	ID    string
+	rule  LossRule
+	lives int
+
+	mu      sync.Mutex
+	game    *game.Game
+	seq     uint64
+	members []*member
+	// idleSince is when the last connected member went away.
+	idleSince time.Time
+}
+
+func newRoom(rule LossRule, lives int) *room {
+	g, _ := game.New(game.TypeInfinite, rand.Int64())
+	g.SurviveMines = rule == LossLives
+	return &room{ID: newSessionID(), rule: rule, lives: lives, game: g}
+}
+
+// roomRules validates the loss rule and lives requested by create_room.
+func roomRules(cmd Command) (LossRule, int, bool) {
+	switch cmd.LossRule {
+	case "", LossShared:
+		return LossShared, 0, cmd.Lives == 0
+	case LossLives:
+		lives := cmd.Lives
+		if lives == 0 {
+			lives = DefaultRoomLives
+		}
+		return LossLives, lives, lives >= 1 && lives <= MaxRoomLives
+	default:
+		return "", 0, false
+	}
+}
+
+func (rm *room) member(playerID string) *member {
+	for _, m := range rm.members {
+		if m.player.ID == playerID {
+			return m
+		}
+	}
+	return nil
+}
+
+// join adds the player on c to the room, returning an error code if it is
+// full.
+func (rm *room) join(c *conn, id int64) (string, string) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if len(rm.members) >= MaxRoomPlayers {
+		return ErrorRoomFull, "The room is full"
+	}
+
+	m := &member{player: c.player, conn: c, viewport: game.Viewport(0, 0), lives: rm.lives}
+	rm.members = append(rm.members, m)
+	rm.broadcastRoom(c, id)
+	rm.sendView(m)
+	return "", ""
+}
+
+// rejoin moves a member of the room onto c.
+func (rm *room) rejoin(c *conn, id int64) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	m := rm.member(c.player.ID)
+	if m.conn != nil && m.conn != c {
+		m.conn.closeWith(CloseRoomTaken, "room joined on another connection")
+	}
+	m.conn = c
+
+	rm.broadcastRoom(c, id)
+	rm.sendView(m)
+}
+
+// leave removes a member who asked to go and reports whether the room is
+// now empty and should be discarded.
+func (rm *room) leave(playerID string) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.members = slices.DeleteFunc(rm.members, func(m *member) bool { return m.player.ID == playerID })
+	if len(rm.members) == 0 {
+		return true
+	}
+	rm.checkLost()
+	rm.broadcastRoom(nil, 0)
+	return false
+}
+
+// disconnect handles c closing. The player stays a member so they can
+// rejoin, and the room expires once nobody has been connected for a while.
+func (rm *room) disconnect(c *conn, now time.Time) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	m := rm.member(c.player.ID)
+	if m == nil || m.conn != c {
+		return
+	}
+	m.conn = nil
+	if !rm.connected() {
+		rm.idleSince = now
+	}
+	rm.broadcastRoom(nil, 0)
+}
+
+func (rm *room) connected() bool {
+	for _, m := range rm.members {
+		if m.conn != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// expired reports whether nobody has been connected to the room for longer
+// than ttl.
+func (rm *room) expired(now time.Time, ttl time.Duration) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return !rm.connected() && now.Sub(rm.idleSince) > ttl
+}
+
+// move applies a reveal, flag or chord command to the shared board on
+// behalf of the member on c and sends the change to everyone in the room.
+func (rm *room) move(c *conn, cmd Command) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	m := rm.member(c.player.ID)
+	if m == nil {
+		c.sendError(cmd.ID, ErrorNoRoom, "Join a room first")
+		return
+	}
+	if m.out {
+		c.sendError(cmd.ID, ErrorNoLives, "You have no lives left")
+		return
+	}
+
+	score, minesHit := rm.game.Score, rm.game.MinesHit
+	cells, err := move(rm.game, cmd)
+	if err != nil {
+		c.sendGameError(cmd.ID, err)
+		return
+	}
+
+	m.score += rm.game.Score - score
+	for _, cell := range cells {
+		switch cell.Status {
+		case game.CellRevealed:
+			m.revealed++
+		case game.CellFlagged:
+			m.flags++
+		}
+	}
+
+	hit := rm.game.MinesHit - minesHit
+	if rm.rule == LossShared && rm.game.State == game.StateLost {
+		hit = 1
+	}
+	if hit > 0 {
+		m.minesHit += hit
+		if rm.rule == LossLives {
+			m.lives = max(m.lives-hit, 0)
+			m.out = m.lives == 0
+			rm.checkLost()
+		}
+	}
+
+	rm.seq++
+	delta := RoomDeltaMessage{
+		Type:      MessageRoomDelta,
+		RoomID:    rm.ID,
+		PlayerID:  m.player.ID,
+		Seq:       rm.seq,
+		State:     rm.game.State,
+		Score:     rm.game.Score,
+		ElapsedMS: rm.game.Elapsed().Milliseconds(),
+		Cells:     nonNil(cells),
+		Player:    m.stats(),
+	}
+	for _, other := range rm.members {
+		if other.conn == nil {
+			continue
+		}
+		if other == m {
+			reply := delta
+			reply.ID = cmd.ID
+			other.conn.send(reply)
+		} else {
+			other.conn.send(delta)
+		}
+	}
+
+	if hit > 0 {
+		rm.broadcastRoom(nil, 0)
+	}
+}
+
+// checkLost ends a lives game once no member has a life left. The caller
+// holds rm.mu.
+func (rm *room) checkLost() {
+	if rm.rule != LossLives {
+		return
+	}
+	for _, m := range rm.members {
+		if !m.out {
+			return
+		}
+	}
+	rm.game.Resign()
+}
+
+// moveViewport moves the viewport of the member on c, exploring the shared
+// board. Only that member is told about it.
+func (rm *room) moveViewport(c *conn, cmd Command) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	m := rm.member(c.player.ID)
+	if m == nil {
+		c.sendError(cmd.ID, ErrorNoRoom, "Join a room first")
+		return
+	}
+	viewport := m.viewport
+	viewport.X, viewport.Y = cmd.X, cmd.Y
+
+	cells, err := rm.game.Explore(viewport)
+	if err != nil {
+		c.sendGameError(cmd.ID, err)
+		return
+	}
+	m.viewport = viewport
+	c.send(ViewportMessage{Type: MessageViewport, ID: cmd.ID, Viewport: viewport, Cells: nonNil(cells)})
+}
+
+// sendView sends a member the shared board inside their viewport. The caller
+// holds rm.mu.
+func (rm *room) sendView(m *member) {
+	cells, err := rm.game.Explore(m.viewport)
+	if err != nil {
+		m.conn.sendGameError(0, err)
+		return
+	}
+	m.conn.send(ViewportMessage{Type: MessageViewport, Viewport: m.viewport, Cells: nonNil(cells)})
+}
+
+func (rm *room) message(id int64) RoomMessage {
+	msg := RoomMessage{
+		Type:       MessageRoom,
+		ID:         id,
+		RoomID:     rm.ID,
+		GameType:   game.TypeCoop,
+		LossRule:   rm.rule,
+		Lives:      rm.lives,
+		State:      rm.game.State,
+		Score:      rm.game.Score,
+		ElapsedMS:  rm.game.Elapsed().Milliseconds(),
+		Seq:        rm.seq,
+		Players:    []RoomPlayer{},
+		MaxPlayers: MaxRoomPlayers,
+	}
+	for _, m := range rm.members {
+		msg.Players = append(msg.Players, m.stats())
+	}
+	return msg
+}
+
+// broadcastRoom sends the room to every connected member, replying to the
+// command id on to.
+func (rm *room) broadcastRoom(to *conn, id int64) {
+	msg := rm.message(0)
+	for _, m := range rm.members {
+		if m.conn == nil {
+			continue
+		}
+		if m.conn == to {
+			reply := msg
+			reply.ID = id
+			m.conn.send(reply)
+		} else {
+			m.conn.send(msg)
+		}
+	}
+}
+
+func (h *Hub) createRoom(c *conn, cmd Command) {
+	rule, lives, ok := roomRules(cmd)
+	if !ok {
+		c.sendError(cmd.ID, ErrorInvalidRules, "loss_rule must be shared or lives, with 1 to 9 lives")
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.roomOf[c.player.ID] != nil {
+		c.sendError(cmd.ID, ErrorAlreadyInRoom, "Leave your current room first")
+		return
+	}
+	rm := newRoom(rule, lives)
+	h.rooms[rm.ID] = rm
+	metrics.LiveRooms.Inc()
+	h.enterRoom(c, rm, cmd.ID)
+}
+
+// joinRoom puts the player into the requested room, or back into the room
+// they are already in.
+func (h *Hub) joinRoom(c *conn, cmd Command) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if current := h.roomOf[c.player.ID]; current != nil {
+		if cmd.RoomID != "" && cmd.RoomID != current.ID {
+			c.sendError(cmd.ID, ErrorAlreadyInRoom, "Leave your current room first")
+			return
+		}
+		current.rejoin(c, cmd.ID)
+		return
+	}
+
+	rm, ok := h.rooms[cmd.RoomID]
+	if !ok {
+		c.sendError(cmd.ID, ErrorRoomNotFound, "Room not found")
+		return
+	}
+	h.enterRoom(c, rm, cmd.ID)
+}
+
+// enterRoom adds the player on c to rm. The caller holds h.mu.
+func (h *Hub) enterRoom(c *conn, rm *room, id int64) {
+	if code, message := rm.join(c, id); code != "" {
+		c.sendError(id, code, message)
+		return
+	}
+	h.roomOf[c.player.ID] = rm
+}
+
+func (h *Hub) leaveRoom(c *conn, id int64) {
+	h.mu.Lock()
+	rm := h.roomOf[c.player.ID]
+	if rm == nil {
+		h.mu.Unlock()
+		c.sendError(id, ErrorNoRoom, "Join a room first")
+		return
+	}
+	delete(h.roomOf, c.player.ID)
+	if rm.leave(c.player.ID) {
+		h.removeRoom(rm)
+	}
+	h.mu.Unlock()
+
+	rm.mu.Lock()
+	c.send(rm.message(id))
+	rm.mu.Unlock()
+}
+
+// playerRoom returns the room the player on c is in, if any.
+func (h *Hub) playerRoom(c *conn) *room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.roomOf[c.player.ID]
+}
+
+// roomMove plays a move in the player's co-op room. It reports false when
+// they are not in one.
+func (h *Hub) roomMove(c *conn, cmd Command) bool {
+	rm := h.playerRoom(c)
+	if rm == nil {
+		return false
+	}
+	rm.move(c, cmd)
+	return true
+}
+
+// roomViewport moves the player's viewport in their co-op room. It reports
+// false when they are not in one.
+func (h *Hub) roomViewport(c *conn, cmd Command) bool {
+	rm := h.playerRoom(c)
+	if rm == nil {
+		return false
+	}
+	rm.moveViewport(c, cmd)
+	return true
+}
+
+// disconnectMember is called with h.mu held when c closes.
+func (h *Hub) disconnectMember(c *conn) {
+	if rm := h.roomOf[c.player.ID]; rm != nil {
+		rm.disconnect(c, h.now())
+	}
+}
+
+// removeRoom forgets rm and its members. The caller holds h.mu.
+func (h *Hub) removeRoom(rm *room) {
+	if h.rooms[rm.ID] != rm {
+		return
+	}
+	delete(h.rooms, rm.ID)
+	for playerID, other := range h.roomOf {
+		if other == rm {
+			delete(h.roomOf, playerID)
+		}
+	}
+	metrics.LiveRooms.Dec()
+}
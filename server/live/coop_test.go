@@ -0,0 +1,223 @@
+package live
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openRoom creates a room on host and has guest join it, returning the room
+// once both have received their view of the board.
+func openRoom(t *testing.T, host, guest *websocket.Conn, rule LossRule, lives int) RoomMessage {
+	t.Helper()
+
+	sendCommand(t, host, Command{Type: CommandCreateRoom, ID: 1, LossRule: rule, Lives: lives})
+	room := readMessage[RoomMessage](t, host)
+	require.Equal(t, game.TypeCoop, room.GameType)
+	readType[ViewportMessage](t, host, MessageViewport)
+
+	sendCommand(t, guest, Command{Type: CommandJoinRoom, ID: 1, RoomID: room.RoomID})
+	joined := readMessage[RoomMessage](t, guest)
+	require.Len(t, joined.Players, 2)
+	readType[ViewportMessage](t, guest, MessageViewport)
+	readType[RoomMessage](t, host, MessageRoom)
+	return joined
+}
+
+// roomBoardCells splits the initial viewport of a room's board into mines
+// and safe cells.
+func roomBoardCells(t *testing.T, hub *Hub, roomID string) (mines, safe []game.Point) {
+	t.Helper()
+
+	hub.mu.Lock()
+	rm := hub.rooms[roomID]
+	hub.mu.Unlock()
+	require.NotNil(t, rm)
+
+	rm.mu.Lock()
+	seed := rm.game.Seed
+	rm.mu.Unlock()
+
+	view := game.Viewport(0, 0)
+	for y := view.Y; y < view.Y+view.Height; y++ {
+		for x := view.X; x < view.X+view.Width; x++ {
+			g, err := game.New(game.TypeInfinite, seed)
+			require.NoError(t, err)
+			_, err = g.Explore(view)
+			require.NoError(t, err)
+			p := game.Point{X: x, Y: y}
+			_, err = g.Reveal(p)
+			require.NoError(t, err)
+			if g.State == game.StateLost {
+				mines = append(mines, p)
+			} else {
+				safe = append(safe, p)
+			}
+		}
+	}
+	return mines, safe
+}
+
+func TestCoopSharesBoard(t *testing.T) {
+	hub, url := newTestServer(t, testOptions())
+	host := dial(t, url, "player1")
+	guest := dial(t, url, "player2")
+	room := openRoom(t, host, guest, "", 0)
+	assert.Equal(t, LossShared, room.LossRule)
+	_, safe := roomBoardCells(t, hub, room.RoomID)
+
+	sendCommand(t, host, Command{Type: CommandFlag, ID: 2, X: safe[0].X, Y: safe[0].Y})
+	mine := readMessage[RoomDeltaMessage](t, host)
+	assert.Equal(t, int64(2), mine.ID)
+	theirs := readMessage[RoomDeltaMessage](t, guest)
+	assert.Zero(t, theirs.ID, "members do not see each other's command IDs")
+	assert.Equal(t, "player1", theirs.PlayerID)
+	assert.Equal(t, []game.Cell{{X: safe[0].X, Y: safe[0].Y, Status: game.CellFlagged}}, theirs.Cells)
+	assert.Equal(t, 1, theirs.Player.Flags)
+
+	sendCommand(t, guest, Command{Type: CommandReveal, ID: 3, X: safe[1].X, Y: safe[1].Y})
+	delta := readMessage[RoomDeltaMessage](t, host)
+	assert.Equal(t, "player2", delta.PlayerID)
+	assert.Equal(t, uint64(2), delta.Seq)
+	assert.NotEmpty(t, delta.Cells)
+	assert.Equal(t, len(delta.Cells), delta.Player.Revealed)
+	assert.Equal(t, delta.Score, delta.Player.Score, "the shared score is all player2's so far")
+
+	// Viewports are per player but explore the same board.
+	sendCommand(t, guest, Command{Type: CommandMoveViewport, ID: 4, X: 5, Y: 5})
+	view := readType[ViewportMessage](t, guest, MessageViewport)
+	assert.Equal(t, int64(4), view.ID)
+	assert.Equal(t, game.Viewport(5, 5), view.Viewport)
+
+	sendCommand(t, host, Command{Type: CommandReveal, ID: 5, X: game.ViewSize + 2, Y: game.ViewSize + 2})
+	delta = readMessage[RoomDeltaMessage](t, host)
+	assert.Equal(t, "player1", delta.PlayerID, "player1 may play cells player2 has explored")
+}
+
+func TestCoopLossRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      LossRule
+		lives     int
+		afterHit  game.State
+		hostLives int
+	}{
+		{name: "Shared", rule: LossShared, afterHit: game.StateLost},
+		{name: "Lives", rule: LossLives, lives: 1, afterHit: game.StatePlaying},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			opts.SendBuffer = 64
+			hub, url := newTestServer(t, opts)
+			host := dial(t, url, "player1")
+			guest := dial(t, url, "player2")
+			room := openRoom(t, host, guest, tt.rule, tt.lives)
+			mines, _ := roomBoardCells(t, hub, room.RoomID)
+			require.GreaterOrEqual(t, len(mines), 2)
+
+			sendCommand(t, host, Command{Type: CommandReveal, ID: 2, X: mines[0].X, Y: mines[0].Y})
+			delta := readMessage[RoomDeltaMessage](t, host)
+			assert.Equal(t, tt.afterHit, delta.State)
+			assert.Equal(t, 1, delta.Player.MinesHit)
+			assert.Contains(t, delta.Cells, game.Cell{X: mines[0].X, Y: mines[0].Y, Status: game.CellMine})
+
+			update := readType[RoomMessage](t, guest, MessageRoom)
+			assert.Equal(t, tt.hostLives, update.Players[0].Lives)
+
+			if tt.rule == LossShared {
+				assert.False(t, update.Players[0].Out)
+				sendCommand(t, guest, Command{Type: CommandReveal, ID: 3, X: mines[1].X, Y: mines[1].Y})
+				assert.Equal(t, ErrorGameOver, readType[ErrorMessage](t, guest, MessageError).Code)
+				return
+			}
+
+			assert.True(t, update.Players[0].Out)
+			sendCommand(t, host, Command{Type: CommandReveal, ID: 3, X: mines[1].X, Y: mines[1].Y})
+			assert.Equal(t, ErrorNoLives, readType[ErrorMessage](t, host, MessageError).Code)
+
+			sendCommand(t, guest, Command{Type: CommandReveal, ID: 4, X: mines[1].X, Y: mines[1].Y})
+			delta = readType[RoomDeltaMessage](t, guest, MessageRoomDelta)
+			assert.Equal(t, game.StateLost, delta.State, "the game ends when nobody has lives left")
+		})
+	}
+}
+
+func TestCoopRejoin(t *testing.T) {
+	hub, url := newTestServer(t, testOptions())
+	host := dial(t, url, "player1")
+	guest := dial(t, url, "player2")
+	room := openRoom(t, host, guest, LossLives, 2)
+	assert.Equal(t, 2, room.Lives)
+
+	sendCommand(t, guest, Command{Type: CommandFlag, X: 1, Y: 1})
+	readMessage[RoomDeltaMessage](t, guest)
+	require.NoError(t, guest.Close())
+	left := readType[RoomMessage](t, host, MessageRoom)
+	assert.False(t, left.Players[1].Connected)
+
+	again := dial(t, url, "player2")
+	sendCommand(t, again, Command{Type: CommandJoinRoom, ID: 5})
+	rejoined := readMessage[RoomMessage](t, again)
+	assert.Equal(t, int64(5), rejoined.ID)
+	assert.Equal(t, room.RoomID, rejoined.RoomID)
+	assert.Equal(t, 1, rejoined.Players[1].Flags)
+	view := readMessage[ViewportMessage](t, again)
+	assert.Contains(t, view.Cells, game.Cell{X: 1, Y: 1, Status: game.CellFlagged})
+
+	sendCommand(t, again, Command{Type: CommandLeaveRoom, ID: 6})
+	rejoined = readMessage[RoomMessage](t, again)
+	assert.Len(t, rejoined.Players, 1)
+
+	sendCommand(t, host, Command{Type: CommandLeaveRoom, ID: 7})
+	left = readType[RoomMessage](t, host, MessageRoom)
+	for left.ID != 7 {
+		left = readType[RoomMessage](t, host, MessageRoom)
+	}
+	hub.mu.Lock()
+	assert.Empty(t, hub.rooms)
+	assert.Empty(t, hub.roomOf)
+	hub.mu.Unlock()
+}
+
+func TestRoomErrors(t *testing.T) {
+	_, url := newTestServer(t, testOptions())
+	ws := dial(t, url, "player1")
+
+	sendCommand(t, ws, Command{Type: CommandLeaveRoom})
+	assert.Equal(t, ErrorNoRoom, readMessage[ErrorMessage](t, ws).Code)
+
+	sendCommand(t, ws, Command{Type: CommandJoinRoom, RoomID: "missing"})
+	assert.Equal(t, ErrorRoomNotFound, readMessage[ErrorMessage](t, ws).Code)
+
+	for _, cmd := range []Command{
+		{Type: CommandCreateRoom, LossRule: "sudden_death"},
+		{Type: CommandCreateRoom, LossRule: LossLives, Lives: MaxRoomLives + 1},
+		{Type: CommandCreateRoom, LossRule: LossShared, Lives: 2},
+	} {
+		sendCommand(t, ws, cmd)
+		assert.Equal(t, ErrorInvalidRules, readMessage[ErrorMessage](t, ws).Code)
+	}
+
+	sendCommand(t, ws, Command{Type: CommandCreateRoom})
+	room := readMessage[RoomMessage](t, ws)
+	readMessage[ViewportMessage](t, ws)
+
+	sendCommand(t, ws, Command{Type: CommandCreateRoom})
+	assert.Equal(t, ErrorAlreadyInRoom, readMessage[ErrorMessage](t, ws).Code)
+
+	for i := 2; i <= MaxRoomPlayers; i++ {
+		player := dial(t, url, fmt.Sprintf("player%d", i))
+		sendCommand(t, player, Command{Type: CommandJoinRoom, RoomID: room.RoomID})
+		assert.Equal(t, room.RoomID, readMessage[RoomMessage](t, player).RoomID)
+	}
+
+	late := dial(t, url, "player9")
+	sendCommand(t, late, Command{Type: CommandJoinRoom, RoomID: room.RoomID})
+	assert.Equal(t, ErrorRoomFull, readMessage[ErrorMessage](t, late).Code)
+}
@@ -0,0 +1,155 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+)
+
+const storeTimeout = 5 * time.Second
+
+// openDaily starts the player's one attempt at today's daily challenge of
+// cmd.GameType. Daily games cannot be spectated, so nobody can learn the
+// board from another player's attempt.
+func (h *Hub) openDaily(c *conn, cmd Command) {
+	if h.opts.StartDaily == nil {
+		c.sendError(cmd.ID, ErrorDailyUnavailable, "Daily challenges are not available")
+		return
+	}
+	if cmd.Public {
+		c.sendError(cmd.ID, ErrorDailyPrivate, "Daily challenge games cannot be spectated")
+		return
+	}
+
+	now := h.now()
+	date := game.DailyDate(now)
+	seed := game.DailySeed(h.opts.DailySecret, date, cmd.GameType)
+	g, err := game.New(cmd.GameType, seed)
+	if err != nil {
+		c.sendError(cmd.ID, ErrorUnknownGameType, "game_type must be normal or infinite")
+		return
+	}
+
+	attempt := &models.DailyAttempt{
+		Date:      date,
+		GameType:  cmd.GameType,
+		Seed:      seed,
+		IsGuest:   c.player.Guest,
+		State:     models.AttemptPlaying,
+		StartedAt: now,
+	}
+	if c.player.Guest {
+		attempt.GuestID = c.player.ID
+	} else {
+		attempt.UserID = c.player.ID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	err = h.opts.StartDaily(ctx, *attempt)
+	cancel()
+	if errors.Is(err, ErrDailyAttempted) {
+		c.sendError(cmd.ID, ErrorDailyAttempted, "You have already played today's daily challenge")
+		return
+	}
+	if err != nil {
+		h.log.Error("failed to start daily attempt", slog.String("player_id", c.player.ID), slog.Any("error", err))
+		c.sendError(cmd.ID, ErrorDailyUnavailable, "Daily challenges are unavailable, try again later")
+		return
+	}
+	metrics.DailyAttempts.WithLabelValues(models.AttemptPlaying).Inc()
+
+	s := newSession(c.player, g)
+	s.daily = attempt
+	h.addSession(c, s)
+	h.attach(c, s, cmd.ID)
+}
+
+// finishScored records the daily attempt, tournament game or challenge game
+// played in s once its game is over, and counts the game towards its
+// owner's stats. abandon ends a game that is still being played, for
+// sessions that are being discarded.
+func (h *Hub) finishScored(s *Session, abandon bool) {
+	o, ok := s.finish(abandon, h.now())
+	if !ok {
+		return
+	}
+	h.finishDaily(s, o)
+	h.finishTournament(s, o)
+	h.finishChallenge(s, o)
+	h.finishGame(s, o)
+}
+
+// finishGame counts a game its registered owner finished towards their
+// stats and achievements. Abandoned games are not counted. Achievements are
+// decided here, from the game the server saw being played, rather than from
+// the records clients save.
+func (h *Hub) finishGame(s *Session, o outcome) {
+	if s.guest || o.state == models.AttemptAbandoned || h.opts.RecordGame == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	err := h.opts.RecordGame(ctx, models.FinishedGame{
+		PlayerID:      s.OwnerID,
+		GameType:      o.gameType,
+		Won:           o.state == string(game.StateWon),
+		Score:         o.score,
+		TimeInSeconds: o.timeInSeconds,
+		CellsRevealed: o.cellsRevealed,
+		FlagsPlaced:   o.flagsPlaced,
+		FinishedAt:    o.finishedAt,
+	})
+	if err != nil {
+		h.log.Error("failed to record finished game", slog.String("player_id", s.OwnerID), slog.Any("error", err))
+	}
+}
+
+func (h *Hub) finishDaily(s *Session, o outcome) {
+	attempt := s.dailyResult(o)
+	if attempt == nil {
+		return
+	}
+	metrics.DailyAttempts.WithLabelValues(attempt.State).Inc()
+	if h.opts.RecordDaily == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := h.opts.RecordDaily(ctx, *attempt); err != nil {
+		h.log.Error("failed to record daily attempt", slog.String("player_id", attempt.PlayerID()), slog.Any("error", err))
+	}
+}
+
+// isDaily reports whether s plays a daily challenge. daily never changes
+// once the session is created, so it is read without s.mu.
+func (s *Session) isDaily() bool {
+	return s.daily != nil
+}
+
+func (s *Session) dailyDate() string {
+	if s.daily == nil {
+		return ""
+	}
+	return s.daily.Date
+}
+
+// dailyResult returns the daily attempt played in s as it ended with o, or
+// nil for other sessions.
+func (s *Session) dailyResult(o outcome) *models.DailyAttempt {
+	if s.daily == nil {
+		return nil
+	}
+	attempt := *s.daily
+	attempt.State = o.state
+	attempt.Score = o.score
+	attempt.TimeInSeconds = o.timeInSeconds
+	attempt.FinishedAt = &o.finishedAt
+	return &attempt
+}
@@ -0,0 +1,200 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var dailyTestSecret = []byte("daily-test-secret")
+
+// dailyStore stands in for the daily attempts collection.
+type dailyStore struct {
+	mu       sync.Mutex
+	claimed  map[string]bool
+	recorded chan models.DailyAttempt
+}
+
+// useDailyStore enables daily challenges on opts, backed by a new store.
+func useDailyStore(opts *Options) *dailyStore {
+	store := &dailyStore{claimed: make(map[string]bool), recorded: make(chan models.DailyAttempt, 4)}
+	opts.DailySecret = dailyTestSecret
+	opts.StartDaily = func(_ context.Context, attempt models.DailyAttempt) error {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+
+		key := attempt.Date + "/" + attempt.GameType + "/" + attempt.PlayerID()
+		if store.claimed[key] {
+			return ErrDailyAttempted
+		}
+		store.claimed[key] = true
+		return nil
+	}
+	opts.RecordDaily = func(_ context.Context, attempt models.DailyAttempt) error {
+		store.recorded <- attempt
+		return nil
+	}
+	return store
+}
+
+func (s *dailyStore) next(t *testing.T) models.DailyAttempt {
+	t.Helper()
+	select {
+	case attempt := <-s.recorded:
+		return attempt
+	case <-time.After(5 * time.Second):
+		t.Fatal("no daily attempt recorded")
+		return models.DailyAttempt{}
+	}
+}
+
+func newDailyServer(t *testing.T, opts Options) (*Hub, string, time.Time) {
+	t.Helper()
+	hub, url := newTestServer(t, opts)
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	hub.now = func() time.Time { return now }
+	return hub, url, now
+}
+
+func openDailyGame(t *testing.T, ws *websocket.Conn, gameType string) SessionMessage {
+	t.Helper()
+	sendCommand(t, ws, Command{Type: CommandOpen, ID: 1, GameType: gameType, Daily: true})
+	session := readMessage[SessionMessage](t, ws)
+	require.Equal(t, MessageSession, session.Type)
+	return session
+}
+
+// firstMine returns a mine on the normal board generated from seed.
+func firstMine(t *testing.T, seed int64) game.Point {
+	t.Helper()
+	for y := 0; y < game.NormalSize; y++ {
+		for x := 0; x < game.NormalSize; x++ {
+			g, err := game.New(game.TypeNormal, seed)
+			require.NoError(t, err)
+			p := game.Point{X: x, Y: y}
+			_, err = g.Reveal(p)
+			require.NoError(t, err)
+			if g.State == game.StateLost {
+				return p
+			}
+		}
+	}
+	t.Fatal("board has no mines")
+	return game.Point{}
+}
+
+func TestDailyChallenge(t *testing.T) {
+	opts := testOptions()
+	store := useDailyStore(&opts)
+	hub, url, now := newDailyServer(t, opts)
+	seed := game.DailySeed(dailyTestSecret, "2026-10-19", game.TypeNormal)
+
+	player := dial(t, url, "player1")
+	guest := dial(t, url, "guest1&guest")
+	for _, ws := range []*websocket.Conn{player, guest} {
+		session := openDailyGame(t, ws, game.TypeNormal)
+		assert.Equal(t, "2026-10-19", session.DailyDate)
+
+		hub.mu.Lock()
+		s := hub.sessions[session.SessionID]
+		hub.mu.Unlock()
+		require.NotNil(t, s)
+		assert.Equal(t, seed, s.game.Seed, "every player gets the same board")
+	}
+
+	mine := firstMine(t, seed)
+	sendCommand(t, player, Command{Type: CommandReveal, ID: 2, X: mine.X, Y: mine.Y})
+	delta := readMessage[DeltaMessage](t, player)
+	require.Equal(t, game.StateLost, delta.State)
+
+	attempt := store.next(t)
+	assert.Equal(t, "player1", attempt.UserID)
+	assert.False(t, attempt.IsGuest)
+	assert.Equal(t, "2026-10-19", attempt.Date)
+	assert.Equal(t, game.TypeNormal, attempt.GameType)
+	assert.Equal(t, seed, attempt.Seed)
+	assert.Equal(t, models.AttemptLost, attempt.State)
+	assert.Equal(t, now, *attempt.FinishedAt)
+
+	sendCommand(t, player, Command{Type: CommandFlag, ID: 3, X: 0, Y: 0})
+	assert.Equal(t, ErrorGameOver, readMessage[ErrorMessage](t, player).Code)
+	select {
+	case extra := <-store.recorded:
+		t.Fatalf("attempt recorded twice: %+v", extra)
+	default:
+	}
+
+	sendCommand(t, player, Command{Type: CommandOpen, ID: 4, GameType: game.TypeNormal, Daily: true})
+	errMsg := readMessage[ErrorMessage](t, player)
+	assert.Equal(t, ErrorDailyAttempted, errMsg.Code)
+	assert.Equal(t, int64(4), errMsg.ID)
+
+	// The infinite challenge is a separate attempt on its own board.
+	session := openDailyGame(t, player, game.TypeInfinite)
+	assert.Equal(t, game.TypeInfinite, session.GameType)
+
+	// Replacing an unfinished daily game abandons the attempt.
+	openGame(t, guest, game.TypeNormal)
+	attempt = store.next(t)
+	assert.Equal(t, "guest1", attempt.GuestID)
+	assert.Empty(t, attempt.UserID)
+	assert.True(t, attempt.IsGuest)
+	assert.Equal(t, models.AttemptAbandoned, attempt.State)
+}
+
+func TestDailyErrors(t *testing.T) {
+	opts := testOptions()
+	useDailyStore(&opts)
+	_, url, _ := newDailyServer(t, opts)
+	ws := dial(t, url, "player1")
+
+	tests := []struct {
+		name string
+		cmd  Command
+		code string
+	}{
+		{name: "Unknown Game Type", cmd: Command{Type: CommandOpen, GameType: game.TypeRace, Daily: true}, code: ErrorUnknownGameType},
+		{name: "Public", cmd: Command{Type: CommandOpen, GameType: game.TypeNormal, Daily: true, Public: true}, code: ErrorDailyPrivate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sendCommand(t, ws, tt.cmd)
+			assert.Equal(t, tt.code, readMessage[ErrorMessage](t, ws).Code)
+		})
+	}
+
+	openDailyGame(t, ws, game.TypeNormal)
+	sendCommand(t, ws, Command{Type: CommandSetVisibility, ID: 2, Public: true})
+	assert.Equal(t, ErrorDailyPrivate, readMessage[ErrorMessage](t, ws).Code)
+}
+
+func TestDailyUnavailable(t *testing.T) {
+	tests := []struct {
+		name       string
+		startDaily func(context.Context, models.DailyAttempt) error
+	}{
+		{name: "Disabled"},
+		{name: "Store Down", startDaily: func(context.Context, models.DailyAttempt) error { return errors.New("store down") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			opts.StartDaily = tt.startDaily
+			_, url := newTestServer(t, opts)
+			ws := dial(t, url, "player1")
+
+			sendCommand(t, ws, Command{Type: CommandOpen, ID: 1, GameType: game.TypeNormal, Daily: true})
+			assert.Equal(t, ErrorDailyUnavailable, readMessage[ErrorMessage](t, ws).Code)
+		})
+	}
+}
@@ -0,0 +1,572 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/matchmaking"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
+	"github.com/markbakos/infinite-minesweeper/server/middleware"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+)
+
+var (
+	ErrTooManyConnections = errors.New("too many live connections")
+	ErrClosed             = errors.New("live hub is closed")
+	ErrSessionNotFound    = errors.New("live session not found")
+	// ErrDailyAttempted is returned by StartDaily when the player has
+	// already had their attempt at a daily challenge.
+	ErrDailyAttempted = errors.New("daily challenge already attempted")
+	// ErrNotInTournament is returned by StartTournamentGame when the player
+	// has no game to play in the tournament's current round, and
+	// ErrTournamentGamePlayed when they have already started it.
+	ErrNotInTournament      = errors.New("not playing in tournament round")
+	ErrTournamentGamePlayed = errors.New("tournament game already played")
+	// ErrNoChallenge is returned by StartChallengeGame when the challenge
+	// does not exist, has expired or is not the player's to play, and
+	// ErrChallengePlayed when the player has already played it.
+	ErrNoChallenge     = errors.New("challenge not available")
+	ErrChallengePlayed = errors.New("challenge already played")
+)
+
+type Options struct {
+	// AllowedOrigins restricts which browser origins may connect, using the
+	// same patterns as the CORS configuration. Requests without an Origin
+	// header, such as those from native clients, are always allowed.
+	AllowedOrigins []string
+	// MaxConnections bounds the number of open connections and therefore
+	// the number of connection goroutines.
+	MaxConnections int
+	// PingInterval is how often the server pings each client. A client that
+	// sends nothing, not even a pong, for two intervals is disconnected.
+	PingInterval time.Duration
+	// SessionTTL is how long a session or co-op room without a connection
+	// can be resumed.
+	SessionTTL time.Duration
+	// SendBuffer is the number of outgoing messages queued per connection.
+	// A client that falls further behind is disconnected and has to resume.
+	SendBuffer int
+	// RaceReconnectGrace is how long a racer who lost their connection can
+	// rejoin before they forfeit.
+	RaceReconnectGrace time.Duration
+	// RecordRace stores the result of a finished race. It may be nil. A
+	// failed call is retried with the same result, so it must be
+	// idempotent on the result's ID.
+	RecordRace func(context.Context, models.RaceResult) error
+	// RecordGame counts a game a registered player finished in a session
+	// towards their stats and achievements. It may be nil.
+	RecordGame func(context.Context, models.FinishedGame) error
+
+	// Matchmaking configures the ranked queue, which is matched every
+	// MatchInterval. Ranked matchmaking is off when MatchInterval is zero.
+	Matchmaking   matchmaking.Options
+	MatchInterval time.Duration
+	// LookupRating returns a registered player's ranked rating. When nil
+	// every player is queued at the default rating.
+	LookupRating func(ctx context.Context, playerID string) (float64, error)
+
+	// DailySecret keys the daily challenge seeds. StartDaily claims a
+	// player's one attempt at a daily challenge and RecordDaily stores the
+	// attempt once it is over. Daily challenges are off when StartDaily is
+	// nil.
+	DailySecret []byte
+	StartDaily  func(context.Context, models.DailyAttempt) error
+	RecordDaily func(context.Context, models.DailyAttempt) error
+
+	// StartTournamentGame claims a player's game in the current round of a
+	// tournament and RecordTournamentGame stores it once it is over.
+	// Tournament games are off when StartTournamentGame is nil.
+	StartTournamentGame  func(ctx context.Context, tournamentID, playerID string) (models.TournamentGame, error)
+	RecordTournamentGame func(context.Context, models.TournamentGame) error
+
+	// StartChallengeGame claims a player's game in a head-to-head challenge
+	// and RecordChallengeGame stores it once it is over, returning the
+	// challenge when that game decided it. Challenges are off when
+	// StartChallengeGame is nil.
+	StartChallengeGame  func(ctx context.Context, challengeID, playerID string) (models.ChallengeGame, error)
+	RecordChallengeGame func(context.Context, models.ChallengeGame) (*models.Challenge, error)
+}
+
+// Player identifies the authenticated user behind a connection.
+type Player struct {
+	ID    string
+	Guest bool
+}
+
+// Hub owns the live game sessions and the WebSocket connections playing
+// them. Each connection uses exactly two goroutines: the HTTP handler
+// goroutine reads commands and a writer goroutine sends replies.
+type Hub struct {
+	opts     Options
+	log      *slog.Logger
+	upgrader websocket.Upgrader
+	slots    chan struct{}
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+	byOwner  map[string]*Session
+	conns    map[*conn]struct{}
+	lobbies  map[string]*lobby
+	lobbyOf  map[string]*lobby
+	rooms    map[string]*room
+	roomOf   map[string]*room
+	queue    *matchmaking.Queue
+	queued   map[string]*conn
+	closed   bool
+
+	wg   sync.WaitGroup
+	stop chan struct{}
+	now  func() time.Time
+}
+
+func NewHub(opts Options, logger *slog.Logger) *Hub {
+	h := &Hub{
+		opts:     opts,
+		log:      logger,
+		slots:    make(chan struct{}, opts.MaxConnections),
+		sessions: make(map[string]*Session),
+		byOwner:  make(map[string]*Session),
+		conns:    make(map[*conn]struct{}),
+		lobbies:  make(map[string]*lobby),
+		lobbyOf:  make(map[string]*lobby),
+		rooms:    make(map[string]*room),
+		roomOf:   make(map[string]*room),
+		queued:   make(map[string]*conn),
+		stop:     make(chan struct{}),
+		now:      time.Now,
+	}
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 4096,
+		CheckOrigin:     h.checkOrigin,
+	}
+
+	h.queue = matchmaking.New(opts.Matchmaking, matchmaking.ClockFunc(func() time.Time { return h.now() }))
+
+	h.wg.Add(1)
+	go h.expireSessions()
+	if opts.MatchInterval > 0 {
+		h.wg.Add(1)
+		go h.matchmake()
+	}
+	return h
+}
+
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || middleware.OriginAllowed(h.opts.AllowedOrigins, origin)
+}
+
+// Serve upgrades the request to a WebSocket and handles commands until the
+// connection closes. It returns an error without writing a response when the
+// hub cannot accept the connection; once the upgrade has been attempted the
+// response has been written and Serve returns nil.
+func (h *Hub) Serve(w http.ResponseWriter, r *http.Request, player Player) error {
+	release, err := h.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ws, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.log.Debug("websocket upgrade failed", slog.Any("error", err))
+		return nil
+	}
+
+	h.run(newConn(h, ws, player))
+	return nil
+}
+
+// acquire reserves a connection slot and keeps Close waiting until the
+// returned release function is called.
+func (h *Hub) acquire() (func(), error) {
+	select {
+	case h.slots <- struct{}{}:
+	default:
+		return nil, ErrTooManyConnections
+	}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		<-h.slots
+		return nil, ErrClosed
+	}
+	h.wg.Add(1)
+	h.mu.Unlock()
+
+	return func() {
+		h.wg.Done()
+		<-h.slots
+	}, nil
+}
+
+// run handles an upgraded connection until it closes.
+func (h *Hub) run(c *conn) {
+	if !h.register(c) {
+		c.closeWith(websocket.CloseGoingAway, "server shutting down")
+	}
+
+	metrics.LiveConnections.Inc()
+	defer metrics.LiveConnections.Dec()
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		c.writeLoop()
+	}()
+
+	c.readLoop()
+
+	h.unregister(c)
+}
+
+func (h *Hub) register(c *conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return false
+	}
+	h.conns[c] = struct{}{}
+	return true
+}
+
+func (h *Hub) unregister(c *conn) {
+	h.mu.Lock()
+	delete(h.conns, c)
+	if c.spectating == nil {
+		h.disconnectRacer(c)
+		h.disconnectMember(c)
+		h.disconnectQueued(c)
+	}
+	h.mu.Unlock()
+
+	if c.session != nil {
+		c.session.detach(c, h.now())
+	}
+	if c.spectating != nil {
+		c.spectating.removeSpectator(c)
+	}
+}
+
+// handle runs one command read from c.
+func (h *Hub) handle(c *conn, cmd Command) {
+	metrics.LiveCommands.WithLabelValues(commandLabel(cmd.Type)).Inc()
+
+	if c.spectating != nil && cmd.Type != CommandPing {
+		c.sendError(cmd.ID, ErrorReadOnly, "Spectators cannot send commands")
+		return
+	}
+
+	switch cmd.Type {
+	case CommandPing:
+		c.send(PongMessage{Type: MessagePong, ID: cmd.ID})
+
+	case CommandOpen:
+		if cmd.Daily {
+			h.openDaily(c, cmd)
+			return
+		}
+		if cmd.TournamentID != "" {
+			h.openTournament(c, cmd)
+			return
+		}
+		if cmd.ChallengeID != "" {
+			h.openChallenge(c, cmd)
+			return
+		}
+		g, err := game.New(cmd.GameType, rand.Int64())
+		if err != nil {
+			c.sendError(cmd.ID, ErrorUnknownGameType, "game_type must be normal or infinite")
+			return
+		}
+		delay, ok := spectatorDelay(cmd.DelaySeconds)
+		if !ok {
+			c.sendError(cmd.ID, ErrorInvalidDelay, "delay_seconds is out of range")
+			return
+		}
+		s := newSession(c.player, g)
+		h.addSession(c, s)
+		if cmd.Public {
+			s.setVisibility(0, true, delay)
+		}
+		h.attach(c, s, cmd.ID)
+
+	case CommandSetVisibility:
+		if c.session == nil {
+			c.sendError(cmd.ID, ErrorNoSession, "Open or resume a session first")
+			return
+		}
+		if cmd.Public && c.session.isDaily() {
+			c.sendError(cmd.ID, ErrorDailyPrivate, "Daily challenge games cannot be spectated")
+			return
+		}
+		if cmd.Public && c.session.isTournament() {
+			c.sendError(cmd.ID, ErrorTournamentPrivate, "Tournament games cannot be spectated")
+			return
+		}
+		if cmd.Public && c.session.isChallenge() {
+			c.sendError(cmd.ID, ErrorChallengePrivate, "Challenge games cannot be spectated")
+			return
+		}
+		delay, ok := spectatorDelay(cmd.DelaySeconds)
+		if !ok {
+			c.sendError(cmd.ID, ErrorInvalidDelay, "delay_seconds is out of range")
+			return
+		}
+		c.send(c.session.setVisibility(cmd.ID, cmd.Public, delay))
+
+	case CommandResume:
+		h.mu.Lock()
+		s, ok := h.sessions[cmd.SessionID]
+		h.mu.Unlock()
+		if !ok || s.OwnerID != c.player.ID {
+			c.sendError(cmd.ID, ErrorSessionNotFound, "Session not found or expired")
+			return
+		}
+		h.attach(c, s, cmd.ID)
+
+	// Moves go to the player's race while one is running, then to their
+	// co-op room and only then to their own session.
+	case CommandReveal, CommandFlag, CommandChord:
+		if h.raceMove(c, cmd) || h.roomMove(c, cmd) {
+			return
+		}
+		if c.session == nil {
+			c.sendError(cmd.ID, ErrorNoSession, "Open or resume a session first")
+			return
+		}
+		delta, err := c.session.apply(cmd)
+		if err != nil {
+			c.sendGameError(cmd.ID, err)
+			return
+		}
+		c.send(delta)
+		h.finishScored(c.session, false)
+
+	case CommandMoveViewport:
+		if h.roomViewport(c, cmd) {
+			return
+		}
+		if c.session == nil {
+			c.sendError(cmd.ID, ErrorNoSession, "Open or resume a session first")
+			return
+		}
+		msg, err := c.session.moveViewport(cmd.ID, cmd.X, cmd.Y)
+		if err != nil {
+			c.sendGameError(cmd.ID, err)
+			return
+		}
+		c.send(msg)
+
+	case CommandCreateLobby:
+		h.createLobby(c, cmd.ID)
+
+	case CommandJoinLobby:
+		h.joinLobby(c, cmd)
+
+	case CommandLeaveLobby:
+		h.leaveLobby(c, cmd.ID)
+
+	case CommandReady:
+		h.setReady(c, cmd)
+
+	case CommandCreateRoom:
+		h.createRoom(c, cmd)
+
+	case CommandJoinRoom:
+		h.joinRoom(c, cmd)
+
+	case CommandLeaveRoom:
+		h.leaveRoom(c, cmd.ID)
+
+	case CommandQueue:
+		if h.opts.MatchInterval <= 0 {
+			c.sendError(cmd.ID, ErrorUnknownCommand, "Matchmaking is not available")
+			return
+		}
+		h.joinQueue(c, cmd.ID)
+
+	case CommandLeaveQueue:
+		h.leaveQueue(c, cmd.ID)
+
+	default:
+		c.sendError(cmd.ID, ErrorUnknownCommand, "Unknown command type")
+	}
+}
+
+// addSession stores the new session s for the player on c, ending any
+// session they already had so each player holds at most one.
+func (h *Hub) addSession(c *conn, s *Session) {
+	h.mu.Lock()
+	previous := h.byOwner[s.OwnerID]
+	if previous != nil {
+		delete(h.sessions, previous.ID)
+	}
+	h.sessions[s.ID] = s
+	h.byOwner[s.OwnerID] = s
+	h.mu.Unlock()
+
+	if previous == nil {
+		metrics.LiveSessions.Inc()
+		return
+	}
+	if old := previous.attach(nil); old != nil && old != c {
+		old.closeWith(CloseSessionTaken, "session replaced by a new game")
+	}
+	previous.end()
+	h.finishScored(previous, true)
+}
+
+// attach moves c onto session s, disconnecting any other connection that was
+// playing it, and sends the session snapshot.
+func (h *Hub) attach(c *conn, s *Session, id int64) {
+	if c.session != nil && c.session != s {
+		c.session.detach(c, h.now())
+	}
+	c.session = s
+
+	if previous := s.attach(c); previous != nil {
+		previous.closeWith(CloseSessionTaken, "session resumed on another connection")
+	}
+
+	snapshot, err := s.snapshot(id)
+	if err != nil {
+		c.sendGameError(id, err)
+		return
+	}
+	c.send(snapshot)
+}
+
+func (h *Hub) expireSessions() {
+	defer h.wg.Done()
+
+	interval := min(h.opts.SessionTTL/2, time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			h.removeExpired()
+		}
+	}
+}
+
+func (h *Hub) removeExpired() {
+	now := h.now()
+
+	h.mu.Lock()
+	var ended []*Session
+	for id, s := range h.sessions {
+		if s.expired(now, h.opts.SessionTTL) {
+			delete(h.sessions, id)
+			if h.byOwner[s.OwnerID] == s {
+				delete(h.byOwner, s.OwnerID)
+			}
+			s.end()
+			metrics.LiveSessions.Dec()
+			ended = append(ended, s)
+		}
+	}
+	for _, rm := range h.rooms {
+		if rm.expired(now, h.opts.SessionTTL) {
+			h.removeRoom(rm)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, s := range ended {
+		h.finishScored(s, true)
+	}
+}
+
+// Close disconnects every client and stops background work, waiting until
+// all connection goroutines have exited or ctx is done.
+func (h *Hub) Close(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.stop)
+		for c := range h.conns {
+			c.closeWith(websocket.CloseGoingAway, "server shutting down")
+		}
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func spectatorDelay(seconds int) (time.Duration, bool) {
+	if seconds < 0 || seconds > MaxSpectatorDelaySeconds {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// commandLabel keeps the command metric label bounded.
+func commandLabel(command string) string {
+	switch command {
+	case CommandOpen, CommandResume, CommandReveal, CommandFlag, CommandChord, CommandMoveViewport, CommandSetVisibility, CommandPing,
+		CommandCreateLobby, CommandJoinLobby, CommandLeaveLobby, CommandReady,
+		CommandCreateRoom, CommandJoinRoom, CommandLeaveRoom, CommandQueue, CommandLeaveQueue:
+		return command
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	defaultMu  sync.RWMutex
+	defaultHub *Hub
+)
+
+// Start creates the hub used by the HTTP handlers.
+func Start(opts Options, logger *slog.Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultHub = NewHub(opts, logger)
+}
+
+// Stop closes the hub created by Start.
+func Stop(ctx context.Context) error {
+	defaultMu.Lock()
+	hub := defaultHub
+	defaultHub = nil
+	defaultMu.Unlock()
+
+	if hub == nil {
+		return nil
+	}
+	return hub.Close(ctx)
+}
+
+// Default returns the hub created by Start, or nil when live games are not
+// running.
+func Default() *Hub {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultHub
+}
@@ -0,0 +1,336 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testOptions() Options {
+	return Options{
+		MaxConnections: 10,
+		PingInterval:   time.Second,
+		SessionTTL:     time.Minute,
+		SendBuffer:     16,
+	}
+}
+
+// newTestServer serves the hub with the player ID taken from the "player"
+// query parameter in place of JWT authentication, playing as a guest when
+// the "guest" parameter is present. Paths under /spectate/ watch the session
+// named by the rest of the path.
+func newTestServer(t *testing.T, opts Options) (*Hub, string) {
+	t.Helper()
+
+	hub := NewHub(opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if sessionID, ok := strings.CutPrefix(r.URL.Path, "/spectate/"); ok {
+			err = hub.Spectate(w, r, sessionID)
+		} else {
+			err = hub.Serve(w, r, Player{ID: r.URL.Query().Get("player"), Guest: r.URL.Query().Has("guest")})
+		}
+
+		switch {
+		case errors.Is(err, ErrSessionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		assert.NoError(t, hub.Close(ctx))
+		srv.Close()
+	})
+
+	return hub, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url, player string) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(url+"/?player="+player, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ws.Close() })
+	return ws
+}
+
+func sendCommand(t *testing.T, ws *websocket.Conn, cmd Command) {
+	t.Helper()
+	require.NoError(t, ws.WriteJSON(cmd))
+}
+
+func readMessage[T any](t *testing.T, ws *websocket.Conn) T {
+	t.Helper()
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, data, err := ws.ReadMessage()
+	require.NoError(t, err)
+
+	var msg T
+	require.NoError(t, json.Unmarshal(data, &msg), string(data))
+	return msg
+}
+
+func openGame(t *testing.T, ws *websocket.Conn, gameType string) SessionMessage {
+	t.Helper()
+	sendCommand(t, ws, Command{Type: CommandOpen, ID: 1, GameType: gameType})
+	session := readMessage[SessionMessage](t, ws)
+	require.Equal(t, MessageSession, session.Type)
+	return session
+}
+
+func expectClose(t *testing.T, ws *websocket.Conn, code int) {
+	t.Helper()
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		_, _, err := ws.ReadMessage()
+		if err != nil {
+			assert.True(t, websocket.IsCloseError(err, code), "expected close code %d, got %v", code, err)
+			return
+		}
+	}
+}
+
+func TestOpenAndPlay(t *testing.T) {
+	_, url := newTestServer(t, testOptions())
+	ws := dial(t, url, "player1")
+
+	session := openGame(t, ws, game.TypeInfinite)
+	assert.NotEmpty(t, session.SessionID)
+	assert.Equal(t, int64(1), session.ID)
+	assert.Equal(t, game.TypeInfinite, session.GameType)
+	assert.Equal(t, game.StatePlaying, session.State)
+	assert.Equal(t, game.Viewport(0, 0), session.Viewport)
+	assert.Empty(t, session.Cells)
+
+	sendCommand(t, ws, Command{Type: CommandFlag, ID: 2, X: 3, Y: 4})
+	delta := readMessage[DeltaMessage](t, ws)
+	assert.Equal(t, MessageDelta, delta.Type)
+	assert.Equal(t, int64(2), delta.ID)
+	assert.Equal(t, uint64(1), delta.Seq)
+	assert.Equal(t, []game.Cell{{X: 3, Y: 4, Status: game.CellFlagged}}, delta.Cells)
+
+	sendCommand(t, ws, Command{Type: CommandReveal, ID: 3, X: 3, Y: 4})
+	delta = readMessage[DeltaMessage](t, ws)
+	assert.Equal(t, uint64(2), delta.Seq)
+	assert.Empty(t, delta.Cells, "flagged cells are not revealed")
+
+	sendCommand(t, ws, Command{Type: CommandMoveViewport, ID: 4, X: 2, Y: -2})
+	viewport := readMessage[ViewportMessage](t, ws)
+	assert.Equal(t, MessageViewport, viewport.Type)
+	assert.Equal(t, game.Viewport(2, -2), viewport.Viewport)
+	assert.Equal(t, []game.Cell{{X: 3, Y: 4, Status: game.CellFlagged}}, viewport.Cells)
+
+	sendCommand(t, ws, Command{Type: CommandReveal, ID: 5, X: 100, Y: 100})
+	errMsg := readMessage[ErrorMessage](t, ws)
+	assert.Equal(t, ErrorNotExplored, errMsg.Code)
+	assert.Equal(t, int64(5), errMsg.ID)
+
+	sendCommand(t, ws, Command{Type: CommandPing, ID: 6})
+	pong := readMessage[PongMessage](t, ws)
+	assert.Equal(t, PongMessage{Type: MessagePong, ID: 6}, pong)
+}
+
+func TestCommandErrors(t *testing.T) {
+	_, url := newTestServer(t, testOptions())
+	ws := dial(t, url, "player1")
+
+	tests := []struct {
+		name         string
+		payload      string
+		expectedCode string
+	}{
+		{name: "Invalid JSON", payload: `not json`, expectedCode: ErrorInvalidMessage},
+		{name: "Unknown Command", payload: `{"type":"explode"}`, expectedCode: ErrorUnknownCommand},
+		{name: "Move Without Session", payload: `{"type":"reveal","x":1,"y":1}`, expectedCode: ErrorNoSession},
+		{name: "Unknown Game Type", payload: `{"type":"open","game_type":"hard"}`, expectedCode: ErrorUnknownGameType},
+		{name: "Unknown Session", payload: `{"type":"resume","session_id":"missing"}`, expectedCode: ErrorSessionNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte(tt.payload)))
+			msg := readMessage[ErrorMessage](t, ws)
+			assert.Equal(t, MessageError, msg.Type)
+			assert.Equal(t, tt.expectedCode, msg.Code)
+		})
+	}
+}
+
+func TestResumeAfterReconnect(t *testing.T) {
+	_, url := newTestServer(t, testOptions())
+
+	first := dial(t, url, "player1")
+	session := openGame(t, first, game.TypeNormal)
+	sendCommand(t, first, Command{Type: CommandFlag, X: 0, Y: 0})
+	readMessage[DeltaMessage](t, first)
+	require.NoError(t, first.Close())
+
+	other := dial(t, url, "player2")
+	sendCommand(t, other, Command{Type: CommandResume, SessionID: session.SessionID})
+	assert.Equal(t, ErrorSessionNotFound, readMessage[ErrorMessage](t, other).Code, "sessions belong to their owner")
+
+	second := dial(t, url, "player1")
+	sendCommand(t, second, Command{Type: CommandResume, ID: 7, SessionID: session.SessionID})
+	resumed := readMessage[SessionMessage](t, second)
+
+	assert.Equal(t, session.SessionID, resumed.SessionID)
+	assert.Equal(t, int64(7), resumed.ID)
+	assert.Equal(t, uint64(1), resumed.Seq)
+	assert.Equal(t, []game.Cell{{X: 0, Y: 0, Status: game.CellFlagged}}, resumed.Cells)
+}
+
+func TestResumeElsewhereClosesOldConnection(t *testing.T) {
+	_, url := newTestServer(t, testOptions())
+
+	first := dial(t, url, "player1")
+	session := openGame(t, first, game.TypeNormal)
+
+	second := dial(t, url, "player1")
+	sendCommand(t, second, Command{Type: CommandResume, SessionID: session.SessionID})
+	readMessage[SessionMessage](t, second)
+
+	expectClose(t, first, CloseSessionTaken)
+}
+
+func TestOpeningNewGameReplacesSession(t *testing.T) {
+	hub, url := newTestServer(t, testOptions())
+	ws := dial(t, url, "player1")
+
+	first := openGame(t, ws, game.TypeNormal)
+	second := openGame(t, ws, game.TypeInfinite)
+	assert.NotEqual(t, first.SessionID, second.SessionID)
+
+	hub.mu.Lock()
+	assert.Len(t, hub.sessions, 1)
+	hub.mu.Unlock()
+
+	sendCommand(t, ws, Command{Type: CommandResume, SessionID: first.SessionID})
+	assert.Equal(t, ErrorSessionNotFound, readMessage[ErrorMessage](t, ws).Code)
+}
+
+func TestConnectionLimit(t *testing.T) {
+	opts := testOptions()
+	opts.MaxConnections = 1
+	_, url := newTestServer(t, opts)
+
+	dial(t, url, "player1")
+
+	_, resp, err := websocket.DefaultDialer.Dial(url+"/?player=player2", nil)
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestUnresponsiveClientTimesOut(t *testing.T) {
+	opts := testOptions()
+	opts.PingInterval = 50 * time.Millisecond
+	hub, url := newTestServer(t, opts)
+
+	ws := dial(t, url, "player1")
+	openGame(t, ws, game.TypeNormal)
+
+	// The client does not read, so it never answers pings.
+	assert.Eventually(t, func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return len(hub.conns) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSlowConsumerIsDisconnected(t *testing.T) {
+	opts := testOptions()
+	opts.SendBuffer = 1
+	hub := NewHub(opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { _ = hub.Close(context.Background()) })
+
+	// Without a writer draining the outbox the second message overflows it.
+	c := newConn(hub, nil, Player{ID: "player1"})
+	c.send(PongMessage{Type: MessagePong})
+	c.send(PongMessage{Type: MessagePong})
+
+	select {
+	case <-c.done:
+		assert.Equal(t, websocket.CloseTryAgainLater, c.closeCode)
+	default:
+		t.Fatal("slow connection was not closed")
+	}
+}
+
+func TestSessionsExpireWithoutConnection(t *testing.T) {
+	hub, url := newTestServer(t, testOptions())
+
+	ws := dial(t, url, "player1")
+	session := openGame(t, ws, game.TypeNormal)
+	require.NoError(t, ws.Close())
+
+	assert.Eventually(t, func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return len(hub.conns) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	hub.removeExpired()
+	hub.mu.Lock()
+	assert.Contains(t, hub.sessions, session.SessionID, "sessions stay resumable within the TTL")
+	hub.mu.Unlock()
+
+	hub.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	hub.removeExpired()
+	hub.mu.Lock()
+	assert.NotContains(t, hub.sessions, session.SessionID)
+	hub.mu.Unlock()
+}
+
+func TestCloseDisconnectsClients(t *testing.T) {
+	hub, url := newTestServer(t, testOptions())
+	ws := dial(t, url, "player1")
+	openGame(t, ws, game.TypeNormal)
+
+	require.NoError(t, hub.Close(context.Background()))
+	expectClose(t, ws, websocket.CloseGoingAway)
+}
+
+func TestFinishedGamesAreRecorded(t *testing.T) {
+	opts := testOptions()
+	var recorded []models.FinishedGame
+	opts.RecordGame = func(_ context.Context, g models.FinishedGame) error {
+		recorded = append(recorded, g)
+		return nil
+	}
+	hub, _ := newTestServer(t, opts)
+
+	finish := func(player Player, abandon bool) {
+		g, err := game.New(game.TypeNormal, 1)
+		require.NoError(t, err)
+		_, err = g.ToggleFlag(game.Point{X: 1, Y: 1})
+		require.NoError(t, err)
+		if !abandon {
+			g.Resign()
+		}
+		hub.finishScored(newSession(player, g), abandon)
+	}
+	finish(Player{ID: "player1"}, false)
+	finish(Player{ID: "guest1", Guest: true}, false)
+	finish(Player{ID: "player2"}, true)
+
+	require.Len(t, recorded, 1, "guests' and abandoned games are not counted")
+	assert.Equal(t, "player1", recorded[0].PlayerID)
+	assert.Equal(t, game.TypeNormal, recorded[0].GameType)
+	assert.False(t, recorded[0].Won)
+	assert.Equal(t, 1, recorded[0].FlagsPlaced)
+}
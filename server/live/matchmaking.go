@@ -0,0 +1,154 @@
+package live
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/markbakos/infinite-minesweeper/server/matchmaking"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
+	"github.com/markbakos/infinite-minesweeper/server/rating"
+)
+
+const lookupRatingTimeout = 5 * time.Second
+
+// joinQueue puts the player on c in the ranked matchmaking queue. Ranked
+// races are rated, so guests cannot queue.
+func (h *Hub) joinQueue(c *conn, id int64) {
+	if c.player.Guest {
+		c.sendError(id, ErrorRankedGuest, "Sign in to play ranked races")
+		return
+	}
+
+	r := rating.DefaultRating
+	if h.opts.LookupRating != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), lookupRatingTimeout)
+		defer cancel()
+		var err error
+		if r, err = h.opts.LookupRating(ctx, c.player.ID); err != nil {
+			h.log.Error("failed to look up rating", slog.String("player_id", c.player.ID), slog.Any("error", err))
+			c.sendError(id, ErrorRatingUnavailable, "Ratings are unavailable, try again later")
+			return
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.lobbyOf[c.player.ID] != nil {
+		c.sendError(id, ErrorAlreadyInLobby, "Leave your current lobby first")
+		return
+	}
+	if err := h.queue.Join(matchmaking.Ticket{PlayerID: c.player.ID, Rating: r}); err != nil {
+		c.sendError(id, ErrorAlreadyQueued, "You are already in the queue")
+		return
+	}
+	h.queued[c.player.ID] = c
+	metrics.MatchmakingQueued.Inc()
+
+	c.send(QueueMessage{
+		Type:           MessageQueue,
+		ID:             id,
+		Status:         QueueWaiting,
+		Rating:         r,
+		TimeoutSeconds: int(h.opts.Matchmaking.Timeout / time.Second),
+	})
+}
+
+func (h *Hub) leaveQueue(c *conn, id int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.queued[c.player.ID] == nil {
+		c.sendError(id, ErrorNotQueued, "You are not in the queue")
+		return
+	}
+	h.dequeue(c.player.ID)
+	c.send(QueueMessage{Type: MessageQueue, ID: id, Status: QueueLeft})
+}
+
+// dequeue takes a player out of the queue. The caller holds h.mu.
+func (h *Hub) dequeue(playerID string) *conn {
+	c := h.queued[playerID]
+	if c == nil {
+		return nil
+	}
+	h.queue.Leave(playerID)
+	delete(h.queued, playerID)
+	metrics.MatchmakingQueued.Dec()
+	return c
+}
+
+// disconnectQueued is called with h.mu held when c closes.
+func (h *Hub) disconnectQueued(c *conn) {
+	if h.queued[c.player.ID] == c {
+		h.dequeue(c.player.ID)
+	}
+}
+
+func (h *Hub) matchmake() {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(h.opts.MatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			h.matchPlayers()
+		}
+	}
+}
+
+// matchPlayers starts a ranked race for every pair the queue matches and
+// tells players who waited too long that they have been taken out of it.
+func (h *Hub) matchPlayers() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	matches, expired := h.queue.Match()
+	for _, t := range expired {
+		if c := h.queued[t.PlayerID]; c != nil {
+			delete(h.queued, t.PlayerID)
+			metrics.MatchmakingQueued.Dec()
+			metrics.MatchmakingOutcomes.WithLabelValues("timed_out").Inc()
+			c.send(QueueMessage{Type: MessageQueue, Status: QueueTimedOut})
+		}
+	}
+	for _, m := range matches {
+		h.startRankedRace(m)
+	}
+}
+
+// startRankedRace opens a lobby for a matched pair and starts the race
+// without a ready check. The caller holds h.mu.
+func (h *Hub) startRankedRace(m matchmaking.Match) {
+	now := h.now()
+	l := &lobby{ID: newSessionID(), rankedMatch: true, state: LobbyWaiting, hostID: m.Players[0].PlayerID}
+	msg := MatchFoundMessage{Type: MessageMatchFound, LobbyID: l.ID}
+	for _, t := range m.Players {
+		c := h.queued[t.PlayerID]
+		delete(h.queued, t.PlayerID)
+		metrics.MatchmakingQueued.Dec()
+		metrics.MatchmakingOutcomes.WithLabelValues("matched").Inc()
+
+		l.racers = append(l.racers, &racer{player: c.player, conn: c, ready: true})
+		h.lobbyOf[t.PlayerID] = l
+		msg.Players = append(msg.Players, MatchedPlayer{PlayerID: t.PlayerID, Rating: t.Rating})
+	}
+	h.lobbies[l.ID] = l
+	metrics.LiveLobbies.Inc()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, r := range l.racers {
+		found := msg
+		found.WaitedMS = now.Sub(m.Players[i].JoinedAt).Milliseconds()
+		r.conn.send(found)
+	}
+	l.broadcastLobby(nil, 0)
+	l.start(now)
+}
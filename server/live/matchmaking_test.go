@@ -0,0 +1,156 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/matchmaking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newMatchmakingServer starts a hub whose queue is only matched when the
+// test calls matchPlayers, on a clock the test controls.
+func newMatchmakingServer(t *testing.T, opts Options, ratings map[string]float64) (*Hub, string, *fakeClock) {
+	t.Helper()
+
+	opts.Matchmaking = matchmaking.DefaultOptions()
+	opts.MatchInterval = time.Hour
+	opts.LookupRating = func(_ context.Context, playerID string) (float64, error) {
+		r, ok := ratings[playerID]
+		if !ok {
+			return 0, errors.New("rating store down")
+		}
+		return r, nil
+	}
+
+	hub, url := newTestServer(t, opts)
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	hub.now = clock.Now
+	return hub, url, clock
+}
+
+func queue(t *testing.T, ws *websocket.Conn) QueueMessage {
+	t.Helper()
+	sendCommand(t, ws, Command{Type: CommandQueue, ID: 1})
+	msg := readMessage[QueueMessage](t, ws)
+	require.Equal(t, QueueWaiting, msg.Status)
+	return msg
+}
+
+func TestMatchmakingStartsRankedRace(t *testing.T) {
+	opts := testOptions()
+	results := recordRaces(&opts)
+	hub, url, clock := newMatchmakingServer(t, opts, map[string]float64{"player1": 1500, "player2": 1550, "player3": 2000})
+
+	player1 := dial(t, url, "player1")
+	player2 := dial(t, url, "player2")
+	player3 := dial(t, url, "player3")
+	queued := queue(t, player1)
+	assert.Equal(t, 1500.0, queued.Rating)
+	assert.Equal(t, 120, queued.TimeoutSeconds)
+	clock.Advance(3 * time.Second)
+	queue(t, player2)
+	queue(t, player3)
+
+	hub.matchPlayers()
+
+	var lobbyID string
+	for i, ws := range []*websocket.Conn{player1, player2} {
+		found := readMessage[MatchFoundMessage](t, ws)
+		assert.Equal(t, []MatchedPlayer{{PlayerID: "player1", Rating: 1500}, {PlayerID: "player2", Rating: 1550}}, found.Players)
+		assert.Equal(t, []int64{3000, 0}[i], found.WaitedMS)
+		lobbyID = found.LobbyID
+
+		lobby := readMessage[LobbyMessage](t, ws)
+		assert.True(t, lobby.Ranked)
+		assert.Equal(t, LobbyWaiting, lobby.State, "the lobby is sent before the race starts")
+		start := readMessage[RaceStartMessage](t, ws)
+		assert.Equal(t, lobbyID, start.LobbyID)
+	}
+
+	sendCommand(t, player3, Command{Type: CommandJoinLobby, LobbyID: lobbyID})
+	assert.Equal(t, ErrorAlreadyQueued, readMessage[ErrorMessage](t, player3).Code)
+
+	clock.Advance(2 * time.Minute)
+	hub.matchPlayers()
+	timedOut := readMessage[QueueMessage](t, player3)
+	assert.Equal(t, QueueTimedOut, timedOut.Status)
+
+	mines, _ := raceBoardCells(t, hub, lobbyID)
+	sendCommand(t, player1, Command{Type: CommandReveal, X: mines[0].X, Y: mines[0].Y})
+	select {
+	case result := <-results:
+		assert.True(t, result.Ranked)
+		assert.Equal(t, "player2", result.WinnerID)
+		assert.Equal(t, game.TypeRace, result.GameType)
+	case <-time.After(5 * time.Second):
+		t.Fatal("race result was not recorded")
+	}
+}
+
+func TestQueueErrors(t *testing.T) {
+	hub, url, _ := newMatchmakingServer(t, testOptions(), map[string]float64{"player1": 1500})
+
+	guest := dial(t, url, "guest1&guest")
+	sendCommand(t, guest, Command{Type: CommandQueue})
+	assert.Equal(t, ErrorRankedGuest, readMessage[ErrorMessage](t, guest).Code)
+
+	unrated := dial(t, url, "player2")
+	sendCommand(t, unrated, Command{Type: CommandQueue})
+	assert.Equal(t, ErrorRatingUnavailable, readMessage[ErrorMessage](t, unrated).Code)
+
+	ws := dial(t, url, "player1")
+	sendCommand(t, ws, Command{Type: CommandLeaveQueue})
+	assert.Equal(t, ErrorNotQueued, readMessage[ErrorMessage](t, ws).Code)
+
+	queue(t, ws)
+	sendCommand(t, ws, Command{Type: CommandQueue})
+	assert.Equal(t, ErrorAlreadyQueued, readMessage[ErrorMessage](t, ws).Code)
+	sendCommand(t, ws, Command{Type: CommandCreateLobby})
+	assert.Equal(t, ErrorAlreadyQueued, readMessage[ErrorMessage](t, ws).Code)
+
+	sendCommand(t, ws, Command{Type: CommandLeaveQueue, ID: 4})
+	assert.Equal(t, QueueMessage{Type: MessageQueue, ID: 4, Status: QueueLeft}, readMessage[QueueMessage](t, ws))
+
+	sendCommand(t, ws, Command{Type: CommandCreateLobby})
+	readMessage[LobbyMessage](t, ws)
+	sendCommand(t, ws, Command{Type: CommandQueue})
+	assert.Equal(t, ErrorAlreadyInLobby, readMessage[ErrorMessage](t, ws).Code)
+
+	sendCommand(t, ws, Command{Type: CommandLeaveLobby})
+	readMessage[LobbyMessage](t, ws)
+	queue(t, ws)
+	require.NoError(t, ws.Close())
+	assert.Eventually(t, func() bool { return hub.queue.Len() == 0 }, 5*time.Second, 10*time.Millisecond, "disconnecting leaves the queue")
+}
+
+func TestMatchmakingDisabled(t *testing.T) {
+	_, url := newTestServer(t, testOptions())
+	ws := dial(t, url, "player1")
+
+	sendCommand(t, ws, Command{Type: CommandQueue})
+	assert.Equal(t, ErrorUnknownCommand, readMessage[ErrorMessage](t, ws).Code)
+}
@@ -0,0 +1,25 @@
+package live
+
+import "github.com/markbakos/infinite-minesweeper/server/models"
+
+// SendNotification pushes n to every connection of the player it is for.
+// Players who are not connected see it in their inbox later.
+func (h *Hub) SendNotification(n models.Notification) {
+	h.notify(n.UserID, NotificationMessage{Type: MessageNotification, Notification: n})
+}
+
+// notify sends msg to every connection of the player playerID.
+func (h *Hub) notify(playerID string, msg any) {
+	if playerID == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.conns {
+		if c.player.ID == playerID && c.spectating == nil {
+			c.send(msg)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package live
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendNotification(t *testing.T) {
+	hub, url := newTestServer(t, testOptions())
+
+	phone := dial(t, url, "player1")
+	laptop := dial(t, url, "player1")
+	other := dial(t, url, "player2")
+	require.Eventually(t, func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return len(hub.conns) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	hub.SendNotification(models.Notification{UserID: "player1", Type: "friend_request", Message: "player2 sent you a friend request"})
+
+	for _, ws := range []*websocket.Conn{phone, laptop} {
+		msg := readMessage[NotificationMessage](t, ws)
+		assert.Equal(t, MessageNotification, msg.Type)
+		assert.Equal(t, "friend_request", msg.Notification.Type)
+		assert.Equal(t, "player2 sent you a friend request", msg.Notification.Message)
+	}
+
+	sendCommand(t, other, Command{Type: CommandPing, ID: 1})
+	assert.Equal(t, PongMessage{Type: MessagePong, ID: 1}, readMessage[PongMessage](t, other))
+}
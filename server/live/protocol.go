@@ -0,0 +1,414 @@
+package live
+
+import (
+	"time"
+
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+)
+
+// Commands sent by the client. Every command may carry an id that is echoed
+// on the reply so clients can match responses to requests.
+const (
+	CommandOpen          = "open"
+	CommandResume        = "resume"
+	CommandReveal        = "reveal"
+	CommandFlag          = "flag"
+	CommandChord         = "chord"
+	CommandMoveViewport  = "move_viewport"
+	CommandSetVisibility = "set_visibility"
+	CommandPing          = "ping"
+
+	CommandCreateLobby = "create_lobby"
+	CommandJoinLobby   = "join_lobby"
+	CommandLeaveLobby  = "leave_lobby"
+	CommandReady       = "ready"
+
+	CommandCreateRoom = "create_room"
+	CommandJoinRoom   = "join_room"
+	CommandLeaveRoom  = "leave_room"
+
+	CommandQueue      = "queue"
+	CommandLeaveQueue = "leave_queue"
+)
+
+// A race needs at least MinRacePlayers and lobbies hold at most
+// MaxRacePlayers.
+const (
+	MinRacePlayers = 2
+	MaxRacePlayers = 8
+)
+
+// Co-op rooms hold at most MaxRoomPlayers. Under the lives rule each player
+// starts with DefaultRoomLives unless the room asks for up to MaxRoomLives.
+const (
+	MaxRoomPlayers   = 8
+	DefaultRoomLives = 3
+	MaxRoomLives     = 9
+)
+
+// MaxSpectatorDelaySeconds bounds the delay a player can put between their
+// moves and what spectators see.
+const MaxSpectatorDelaySeconds = 600
+
+// Message types sent by the server.
+const (
+	MessageSession    = "session"
+	MessageDelta      = "delta"
+	MessageViewport   = "viewport"
+	MessageError      = "error"
+	MessagePong       = "pong"
+	MessageVisibility = "visibility"
+	MessageClosed     = "closed"
+
+	MessageLobby        = "lobby"
+	MessageRaceStart    = "race_start"
+	MessageRaceProgress = "race_progress"
+	MessageRaceResult   = "race_result"
+
+	MessageRoom      = "room"
+	MessageRoomDelta = "room_delta"
+
+	MessageQueue      = "queue"
+	MessageMatchFound = "match_found"
+
+	MessageChallengeResult = "challenge_result"
+	MessageNotification    = "notification"
+)
+
+// Error codes carried by error messages.
+const (
+	ErrorInvalidMessage    = "invalid_message"
+	ErrorUnknownCommand    = "unknown_command"
+	ErrorUnknownGameType   = "unknown_game_type"
+	ErrorNoSession         = "no_session"
+	ErrorSessionNotFound   = "session_not_found"
+	ErrorGameOver          = "game_over"
+	ErrorNotExplored       = "not_explored"
+	ErrorExploreLimit      = "explore_limit"
+	ErrorInvalidViewport   = "invalid_viewport"
+	ErrorInvalidDelay      = "invalid_delay"
+	ErrorReadOnly          = "read_only"
+	ErrorLobbyNotFound     = "lobby_not_found"
+	ErrorLobbyFull         = "lobby_full"
+	ErrorLobbyStarted      = "lobby_started"
+	ErrorNoLobby           = "no_lobby"
+	ErrorAlreadyInLobby    = "already_in_lobby"
+	ErrorRoomNotFound      = "room_not_found"
+	ErrorRoomFull          = "room_full"
+	ErrorNoRoom            = "no_room"
+	ErrorAlreadyInRoom     = "already_in_room"
+	ErrorInvalidRules      = "invalid_rules"
+	ErrorNoLives           = "no_lives"
+	ErrorAlreadyQueued     = "already_queued"
+	ErrorNotQueued         = "not_queued"
+	ErrorRankedGuest       = "ranked_requires_account"
+	ErrorRatingUnavailable = "rating_unavailable"
+	ErrorDailyUnavailable  = "daily_unavailable"
+	ErrorDailyAttempted    = "daily_attempted"
+	ErrorDailyPrivate      = "daily_private"
+
+	ErrorTournamentUnavailable = "tournament_unavailable"
+	ErrorTournamentPlayed      = "tournament_played"
+	ErrorNotInTournament       = "not_in_tournament"
+	ErrorTournamentPrivate     = "tournament_private"
+
+	ErrorChallengeUnavailable = "challenge_unavailable"
+	ErrorChallengeNotFound    = "challenge_not_found"
+	ErrorChallengePlayed      = "challenge_played"
+	ErrorChallengePrivate     = "challenge_private"
+	ErrorReplayLimit          = "replay_limit"
+)
+
+// Close codes in the private 4000-4999 range used when the server ends a
+// connection for an application reason.
+const (
+	CloseSessionTaken   = 4001
+	CloseSessionEnded   = 4002
+	CloseSessionPrivate = 4003
+	CloseLobbyTaken     = 4004
+	CloseRoomTaken      = 4005
+)
+
+type Command struct {
+	Type      string `json:"type"`
+	ID        int64  `json:"id,omitempty"`
+	GameType  string `json:"game_type,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	X         int    `json:"x"`
+	Y         int    `json:"y"`
+
+	// Daily opens the player's attempt at today's daily challenge of
+	// GameType instead of a random board.
+	Daily bool `json:"daily,omitempty"`
+	// TournamentID opens the player's game in the current round of a
+	// tournament instead of a random board.
+	TournamentID string `json:"tournament_id,omitempty"`
+	// ChallengeID opens the player's game in a head-to-head challenge.
+	ChallengeID string `json:"challenge_id,omitempty"`
+
+	// Public and DelaySeconds set who may spectate the session, on open and
+	// set_visibility.
+	Public       bool `json:"public,omitempty"`
+	DelaySeconds int  `json:"delay_seconds,omitempty"`
+
+	// LobbyID names the lobby to join; join_lobby without it joins any
+	// lobby with room or opens a new one. Ready is used by ready.
+	LobbyID string `json:"lobby_id,omitempty"`
+	Ready   bool   `json:"ready,omitempty"`
+
+	// RoomID names the co-op room to join. LossRule and Lives configure a
+	// room on create_room.
+	RoomID   string   `json:"room_id,omitempty"`
+	LossRule LossRule `json:"loss_rule,omitempty"`
+	Lives    int      `json:"lives,omitempty"`
+}
+
+// SessionMessage is a full snapshot of a session, sent when a game is opened
+// or resumed and when a spectator starts watching. Cells lists every
+// non-hidden cell in the viewport. DailyDate is set on daily challenges and
+// TournamentID and Round on tournament games and ChallengeID on challenge
+// games.
+type SessionMessage struct {
+	Type         string      `json:"type"`
+	ID           int64       `json:"id,omitempty"`
+	SessionID    string      `json:"session_id"`
+	GameType     string      `json:"game_type"`
+	State        game.State  `json:"state"`
+	Score        int         `json:"score"`
+	ElapsedMS    int64       `json:"elapsed_ms"`
+	Seq          uint64      `json:"seq"`
+	Public       bool        `json:"public"`
+	DelaySeconds int         `json:"delay_seconds"`
+	DailyDate    string      `json:"daily_date,omitempty"`
+	TournamentID string      `json:"tournament_id,omitempty"`
+	Round        int         `json:"round,omitempty"`
+	ChallengeID  string      `json:"challenge_id,omitempty"`
+	Viewport     game.Rect   `json:"viewport"`
+	Cells        []game.Cell `json:"cells"`
+}
+
+// DeltaMessage lists the cells changed by one command. Seq increases by one
+// for every delta in a session.
+type DeltaMessage struct {
+	Type      string      `json:"type"`
+	ID        int64       `json:"id,omitempty"`
+	Seq       uint64      `json:"seq"`
+	State     game.State  `json:"state"`
+	Score     int         `json:"score"`
+	ElapsedMS int64       `json:"elapsed_ms"`
+	Cells     []game.Cell `json:"cells"`
+}
+
+type ViewportMessage struct {
+	Type     string      `json:"type"`
+	ID       int64       `json:"id,omitempty"`
+	Viewport game.Rect   `json:"viewport"`
+	Cells    []game.Cell `json:"cells"`
+}
+
+// VisibilityMessage confirms a set_visibility command.
+type VisibilityMessage struct {
+	Type         string `json:"type"`
+	ID           int64  `json:"id,omitempty"`
+	Public       bool   `json:"public"`
+	DelaySeconds int    `json:"delay_seconds"`
+	Spectators   int    `json:"spectators"`
+}
+
+type LobbyState string
+
+const (
+	LobbyWaiting  LobbyState = "waiting"
+	LobbyRacing   LobbyState = "racing"
+	LobbyFinished LobbyState = "finished"
+)
+
+type LobbyPlayer struct {
+	PlayerID  string `json:"player_id"`
+	Ready     bool   `json:"ready"`
+	Connected bool   `json:"connected"`
+}
+
+// LobbyMessage describes a lobby. It is sent to every member whenever
+// someone joins, leaves, changes their ready state or reconnects.
+type LobbyMessage struct {
+	Type       string        `json:"type"`
+	ID         int64         `json:"id,omitempty"`
+	LobbyID    string        `json:"lobby_id"`
+	State      LobbyState    `json:"state"`
+	Ranked     bool          `json:"ranked"`
+	HostID     string        `json:"host_id"`
+	Players    []LobbyPlayer `json:"players"`
+	MinPlayers int           `json:"min_players"`
+	MaxPlayers int           `json:"max_players"`
+}
+
+// RaceStartMessage starts a race once every player is ready. Every racer
+// gets the same board. A player rejoining a race receives it again with the
+// cells they have already uncovered.
+type RaceStartMessage struct {
+	Type      string      `json:"type"`
+	LobbyID   string      `json:"lobby_id"`
+	GameType  string      `json:"game_type"`
+	Board     game.Rect   `json:"board"`
+	Mines     int         `json:"mines"`
+	StartedAt time.Time   `json:"started_at"`
+	Seq       uint64      `json:"seq"`
+	State     game.State  `json:"state"`
+	Cells     []game.Cell `json:"cells"`
+}
+
+// RaceProgressMessage reports a racer's progress as the percentage of safe
+// cells they have revealed.
+type RaceProgressMessage struct {
+	Type      string     `json:"type"`
+	LobbyID   string     `json:"lobby_id"`
+	PlayerID  string     `json:"player_id"`
+	Progress  int        `json:"progress"`
+	State     game.State `json:"state"`
+	Forfeited bool       `json:"forfeited,omitempty"`
+}
+
+type RaceStanding struct {
+	PlayerID  string     `json:"player_id"`
+	Place     int        `json:"place"`
+	Progress  int        `json:"progress"`
+	Score     int        `json:"score"`
+	State     game.State `json:"state"`
+	Forfeited bool       `json:"forfeited,omitempty"`
+	ElapsedMS int64      `json:"elapsed_ms"`
+}
+
+// RaceResultMessage ends a race. The lobby closes once it has been sent.
+type RaceResultMessage struct {
+	Type      string         `json:"type"`
+	LobbyID   string         `json:"lobby_id"`
+	WinnerID  string         `json:"winner_id"`
+	Standings []RaceStanding `json:"standings"`
+}
+
+// LossRule decides what a mine does in a co-op room.
+type LossRule string
+
+const (
+	// LossShared ends the game for everyone on the first mine.
+	LossShared LossRule = "shared"
+	// LossLives costs the player who hit the mine a life. Players without
+	// lives can only watch, and the game is lost once nobody has any left.
+	LossLives LossRule = "lives"
+)
+
+// RoomPlayer is a member of a co-op room and what they have contributed.
+type RoomPlayer struct {
+	PlayerID  string `json:"player_id"`
+	Guest     bool   `json:"guest"`
+	Connected bool   `json:"connected"`
+	Lives     int    `json:"lives"`
+	Out       bool   `json:"out"`
+	Revealed  int    `json:"revealed"`
+	Flags     int    `json:"flags"`
+	Score     int    `json:"score"`
+	MinesHit  int    `json:"mines_hit"`
+}
+
+// RoomMessage describes a co-op room. It is sent to every member whenever
+// someone joins, leaves, reconnects or loses a life, and when the game ends.
+// Lives is the number each player starts with under the lives rule.
+type RoomMessage struct {
+	Type       string       `json:"type"`
+	ID         int64        `json:"id,omitempty"`
+	RoomID     string       `json:"room_id"`
+	GameType   string       `json:"game_type"`
+	LossRule   LossRule     `json:"loss_rule"`
+	Lives      int          `json:"lives,omitempty"`
+	State      game.State   `json:"state"`
+	Score      int          `json:"score"`
+	ElapsedMS  int64        `json:"elapsed_ms"`
+	Seq        uint64       `json:"seq"`
+	Players    []RoomPlayer `json:"players"`
+	MaxPlayers int          `json:"max_players"`
+}
+
+// RoomDeltaMessage lists the cells changed by one member's command and is
+// sent to every member, whatever their viewport. Seq increases by one for
+// every delta in a room. Player carries the mover's updated contribution.
+type RoomDeltaMessage struct {
+	Type      string      `json:"type"`
+	ID        int64       `json:"id,omitempty"`
+	RoomID    string      `json:"room_id"`
+	PlayerID  string      `json:"player_id"`
+	Seq       uint64      `json:"seq"`
+	State     game.State  `json:"state"`
+	Score     int         `json:"score"`
+	ElapsedMS int64       `json:"elapsed_ms"`
+	Cells     []game.Cell `json:"cells"`
+	Player    RoomPlayer  `json:"player"`
+}
+
+type QueueStatus string
+
+const (
+	QueueWaiting  QueueStatus = "queued"
+	QueueLeft     QueueStatus = "left"
+	QueueTimedOut QueueStatus = "timed_out"
+)
+
+// QueueMessage replies to queue and leave_queue, and tells a player who
+// waited too long that they have been taken out of the queue.
+type QueueMessage struct {
+	Type           string      `json:"type"`
+	ID             int64       `json:"id,omitempty"`
+	Status         QueueStatus `json:"status"`
+	Rating         float64     `json:"rating,omitempty"`
+	TimeoutSeconds int         `json:"timeout_seconds,omitempty"`
+}
+
+type MatchedPlayer struct {
+	PlayerID string  `json:"player_id"`
+	Rating   float64 `json:"rating"`
+}
+
+// MatchFoundMessage tells a queued player who they were matched with. The
+// ranked race starts straight after, with the usual lobby and race_start
+// messages.
+type MatchFoundMessage struct {
+	Type     string          `json:"type"`
+	LobbyID  string          `json:"lobby_id"`
+	Players  []MatchedPlayer `json:"players"`
+	WaitedMS int64           `json:"waited_ms"`
+}
+
+// ChallengeResultMessage tells both players of a head-to-head challenge how
+// it ended. Replays are left out; they can be fetched from the REST API.
+type ChallengeResultMessage struct {
+	Type      string           `json:"type"`
+	Challenge models.Challenge `json:"challenge"`
+}
+
+// NotificationMessage pushes a new inbox notification to the player's
+// connected clients.
+type NotificationMessage struct {
+	Type         string              `json:"type"`
+	Notification models.Notification `json:"notification"`
+}
+
+// ClosedMessage ends a spectator event stream with the close code a
+// WebSocket spectator would receive.
+type ClosedMessage struct {
+	Type   string `json:"type"`
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+type ErrorMessage struct {
+	Type    string `json:"type"`
+	ID      int64  `json:"id,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type PongMessage struct {
+	Type string `json:"type"`
+	ID   int64  `json:"id,omitempty"`
+}
@@ -0,0 +1,669 @@
+package live
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	recordRaceTimeout = 10 * time.Second
+	// A race result is offered to RecordRace up to recordRaceAttempts
+	// times, waiting recordRaceRetryDelay longer after each failure.
+	recordRaceAttempts   = 3
+	recordRaceRetryDelay = 500 * time.Millisecond
+)
+
+// raceBoard is the area of the normal board every racer plays.
+var raceBoard = game.Rect{Width: game.NormalSize, Height: game.NormalSize}
+
+// racer is a player in a lobby. Their game is created when the race starts.
+type racer struct {
+	player    Player
+	conn      *conn
+	ready     bool
+	game      *game.Game
+	seq       uint64
+	progress  int
+	forfeited bool
+	// outAt is when the racer hit a mine or forfeited. Among racers who did
+	// not finish, whoever stayed in longer places higher.
+	outAt        time.Time
+	forfeitTimer *time.Timer
+}
+
+func (r *racer) active() bool {
+	return !r.forfeited && r.game.State == game.StatePlaying
+}
+
+// lobby gathers players for a race. The hub lock guards which lobby each
+// player is in; the lobby lock guards everything else, including the
+// racers' games. When both are needed the hub lock is taken first.
+type lobby struct {
+	ID string
+	// ranked lobbies are opened by matchmaking and start straight away.
+	// Only their results change ratings.
+	rankedMatch bool
+
+	mu        sync.Mutex
+	state     LobbyState
+	hostID    string
+	racers    []*racer
+	seed      int64
+	startedAt time.Time
+}
+
+func (l *lobby) racer(playerID string) *racer {
+	for _, r := range l.racers {
+		if r.player.ID == playerID {
+			return r
+		}
+	}
+	return nil
+}
+
+func (l *lobby) open() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return !l.rankedMatch && l.state == LobbyWaiting && len(l.racers) < MaxRacePlayers
+}
+
+// join adds the player on c to a waiting lobby, returning an error code if
+// the lobby cannot take them.
+func (l *lobby) join(c *conn, id int64) (string, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case l.state != LobbyWaiting:
+		return ErrorLobbyStarted, "The race has already started"
+	case len(l.racers) >= MaxRacePlayers:
+		return ErrorLobbyFull, "The lobby is full"
+	}
+
+	l.racers = append(l.racers, &racer{player: c.player, conn: c})
+	l.broadcastLobby(c, id)
+	return "", ""
+}
+
+// rejoin moves a member of the lobby onto c, which is how a racer who lost
+// their connection gets back into the race.
+func (l *lobby) rejoin(c *conn, id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := l.racer(c.player.ID)
+	if r.conn != nil && r.conn != c {
+		r.conn.closeWith(CloseLobbyTaken, "lobby joined on another connection")
+	}
+	r.conn = c
+	if r.forfeitTimer != nil {
+		r.forfeitTimer.Stop()
+		r.forfeitTimer = nil
+	}
+
+	l.broadcastLobby(c, id)
+	if l.state == LobbyRacing && !r.forfeited {
+		c.send(l.raceStart(r))
+	}
+}
+
+// leave removes a player who asked to go. A racer who leaves mid-race
+// forfeits and the race may finish as a result. empty reports that the
+// lobby has nobody left and should be discarded.
+func (l *lobby) leave(playerID string, now time.Time) (result *models.RaceResult, empty bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := l.racer(playerID)
+	if r == nil {
+		return nil, false
+	}
+
+	switch l.state {
+	case LobbyWaiting:
+		return nil, l.remove(r)
+	case LobbyRacing:
+		r.conn = nil
+		if r.active() {
+			l.forfeit(r, now)
+			return l.checkFinished(now), false
+		}
+	}
+	return nil, false
+}
+
+// disconnect handles c closing. Players leave a waiting lobby straight away
+// but keep their place in a race for grace, after which onTimeout runs.
+func (l *lobby) disconnect(c *conn, grace time.Duration, onTimeout func()) (left, empty bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := l.racer(c.player.ID)
+	if r == nil || r.conn != c {
+		return false, false
+	}
+
+	switch l.state {
+	case LobbyWaiting:
+		return true, l.remove(r)
+	case LobbyRacing:
+		r.conn = nil
+		if r.active() {
+			r.forfeitTimer = time.AfterFunc(grace, onTimeout)
+		}
+		l.broadcastLobby(nil, 0)
+	}
+	return false, false
+}
+
+// forfeitAway forfeits a racer who did not reconnect in time.
+func (l *lobby) forfeitAway(playerID string, now time.Time) *models.RaceResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := l.racer(playerID)
+	if l.state != LobbyRacing || r == nil || r.conn != nil || !r.active() {
+		return nil
+	}
+	l.forfeit(r, now)
+	return l.checkFinished(now)
+}
+
+// remove takes r out of a waiting lobby, handing the lobby to the next
+// player if r was hosting. It reports whether the lobby is now empty.
+func (l *lobby) remove(r *racer) bool {
+	l.racers = slices.DeleteFunc(l.racers, func(other *racer) bool { return other == r })
+	if len(l.racers) == 0 {
+		return true
+	}
+	if l.hostID == r.player.ID {
+		l.hostID = l.racers[0].player.ID
+	}
+	l.broadcastLobby(nil, 0)
+	return false
+}
+
+func (l *lobby) forfeit(r *racer, now time.Time) {
+	r.forfeited = true
+	r.outAt = now
+	l.broadcast(l.progressMessage(r))
+}
+
+// setReady records a player's ready check and starts the race once enough
+// players are all ready.
+func (l *lobby) setReady(c *conn, id int64, ready bool, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.state != LobbyWaiting {
+		c.sendError(id, ErrorLobbyStarted, "The race has already started")
+		return
+	}
+	// The player may have left between the hub's lookup and this lock.
+	r := l.racer(c.player.ID)
+	if r == nil {
+		c.sendError(id, ErrorNoLobby, "You are not in this lobby")
+		return
+	}
+	r.ready = ready
+	l.broadcastLobby(c, id)
+
+	if len(l.racers) < MinRacePlayers {
+		return
+	}
+	for _, r := range l.racers {
+		if !r.ready {
+			return
+		}
+	}
+	l.start(now)
+}
+
+// start gives every racer a game on the same board.
+func (l *lobby) start(now time.Time) {
+	l.state = LobbyRacing
+	l.seed = rand.Int64()
+	l.startedAt = now
+
+	for _, r := range l.racers {
+		r.game, _ = game.New(game.TypeNormal, l.seed)
+		if r.conn != nil {
+			r.conn.send(l.raceStart(r))
+		}
+	}
+}
+
+// move applies a reveal, flag or chord command to the racer's game. It
+// reports false when the lobby is not racing, leaving the command to the
+// player's own session.
+func (l *lobby) move(c *conn, cmd Command, now time.Time) (bool, *models.RaceResult) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.state != LobbyRacing {
+		return false, nil
+	}
+	r := l.racer(c.player.ID)
+	if r == nil {
+		c.sendError(cmd.ID, ErrorNoLobby, "You are not in this lobby")
+		return true, nil
+	}
+	if r.forfeited {
+		c.sendError(cmd.ID, ErrorGameOver, "You forfeited the race")
+		return true, nil
+	}
+
+	cells, err := move(r.game, cmd)
+	if err != nil {
+		c.sendGameError(cmd.ID, err)
+		return true, nil
+	}
+
+	r.seq++
+	c.send(DeltaMessage{
+		Type:      MessageDelta,
+		ID:        cmd.ID,
+		Seq:       r.seq,
+		State:     r.game.State,
+		Score:     r.game.Score,
+		ElapsedMS: now.Sub(l.startedAt).Milliseconds(),
+		Cells:     nonNil(cells),
+	})
+
+	progress := int(r.game.Progress() * 100)
+	if progress == r.progress && r.game.State == game.StatePlaying {
+		return true, nil
+	}
+	r.progress = progress
+	if r.game.State == game.StateLost {
+		r.outAt = now
+	}
+	l.broadcast(l.progressMessage(r))
+	return true, l.checkFinished(now)
+}
+
+// checkFinished ends the race when someone has cleared the board or at most
+// one racer is still playing.
+func (l *lobby) checkFinished(now time.Time) *models.RaceResult {
+	var winner, last *racer
+	active := 0
+	for _, r := range l.racers {
+		if r.game.State == game.StateWon {
+			winner = r
+		}
+		if r.active() {
+			active++
+			last = r
+		}
+	}
+
+	switch {
+	case winner != nil:
+	case active == 1:
+		winner = last
+	case active == 0:
+		winner = l.ranked(nil, now)[0]
+	default:
+		return nil
+	}
+	return l.finish(winner, now)
+}
+
+// ranked orders the racers for the result: the winner first, then by
+// progress and by how long they stayed in the race.
+func (l *lobby) ranked(winner *racer, now time.Time) []*racer {
+	ranked := slices.Clone(l.racers)
+	slices.SortStableFunc(ranked, func(a, b *racer) int {
+		switch {
+		case a == winner:
+			return -1
+		case b == winner:
+			return 1
+		}
+		if c := cmp.Compare(b.progress, a.progress); c != 0 {
+			return c
+		}
+		return cmp.Compare(l.elapsed(b, now), l.elapsed(a, now))
+	})
+	return ranked
+}
+
+func (l *lobby) elapsed(r *racer, now time.Time) time.Duration {
+	switch {
+	case r.game.State == game.StateWon:
+		return r.game.EndedAt.Sub(l.startedAt)
+	case !r.outAt.IsZero():
+		return r.outAt.Sub(l.startedAt)
+	default:
+		return now.Sub(l.startedAt)
+	}
+}
+
+func (l *lobby) finish(winner *racer, now time.Time) *models.RaceResult {
+	l.state = LobbyFinished
+
+	result := &models.RaceResult{
+		ID:         primitive.NewObjectID(),
+		GameType:   game.TypeRace,
+		Ranked:     l.rankedMatch,
+		LobbyID:    l.ID,
+		Seed:       l.seed,
+		StartedAt:  l.startedAt,
+		FinishedAt: now,
+		WinnerID:   winner.player.ID,
+	}
+	msg := RaceResultMessage{Type: MessageRaceResult, LobbyID: l.ID, WinnerID: winner.player.ID}
+
+	for i, r := range l.ranked(winner, now) {
+		if r.forfeitTimer != nil {
+			r.forfeitTimer.Stop()
+		}
+		elapsed := l.elapsed(r, now)
+		msg.Standings = append(msg.Standings, RaceStanding{
+			PlayerID:  r.player.ID,
+			Place:     i + 1,
+			Progress:  r.progress,
+			Score:     r.game.Score,
+			State:     r.game.State,
+			Forfeited: r.forfeited,
+			ElapsedMS: elapsed.Milliseconds(),
+		})
+		result.Players = append(result.Players, models.RacePlacement{
+			PlayerID:      r.player.ID,
+			IsGuest:       r.player.Guest,
+			Place:         i + 1,
+			Progress:      r.progress,
+			Score:         r.game.Score,
+			State:         string(r.game.State),
+			Forfeited:     r.forfeited,
+			TimeInSeconds: int(elapsed.Seconds()),
+		})
+	}
+
+	l.broadcast(msg)
+	return result
+}
+
+func (l *lobby) raceStart(r *racer) RaceStartMessage {
+	return RaceStartMessage{
+		Type:      MessageRaceStart,
+		LobbyID:   l.ID,
+		GameType:  game.TypeRace,
+		Board:     raceBoard,
+		Mines:     game.NormalMines,
+		StartedAt: l.startedAt,
+		Seq:       r.seq,
+		State:     r.game.State,
+		Cells:     nonNil(r.game.View(raceBoard)),
+	}
+}
+
+func (l *lobby) progressMessage(r *racer) RaceProgressMessage {
+	return RaceProgressMessage{
+		Type:      MessageRaceProgress,
+		LobbyID:   l.ID,
+		PlayerID:  r.player.ID,
+		Progress:  r.progress,
+		State:     r.game.State,
+		Forfeited: r.forfeited,
+	}
+}
+
+func (l *lobby) message(id int64) LobbyMessage {
+	msg := LobbyMessage{
+		Type:       MessageLobby,
+		ID:         id,
+		LobbyID:    l.ID,
+		State:      l.state,
+		Ranked:     l.rankedMatch,
+		HostID:     l.hostID,
+		Players:    []LobbyPlayer{},
+		MinPlayers: MinRacePlayers,
+		MaxPlayers: MaxRacePlayers,
+	}
+	for _, r := range l.racers {
+		msg.Players = append(msg.Players, LobbyPlayer{PlayerID: r.player.ID, Ready: r.ready, Connected: r.conn != nil})
+	}
+	return msg
+}
+
+// broadcastLobby sends the lobby to every connected member, replying to the
+// command id on to.
+func (l *lobby) broadcastLobby(to *conn, id int64) {
+	msg := l.message(0)
+	for _, r := range l.racers {
+		if r.conn == nil {
+			continue
+		}
+		if r.conn == to {
+			reply := msg
+			reply.ID = id
+			r.conn.send(reply)
+		} else {
+			r.conn.send(msg)
+		}
+	}
+}
+
+func (l *lobby) broadcast(msg any) {
+	for _, r := range l.racers {
+		if r.conn != nil {
+			r.conn.send(msg)
+		}
+	}
+}
+
+func (h *Hub) createLobby(c *conn, id int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.lobbyOf[c.player.ID] != nil {
+		c.sendError(id, ErrorAlreadyInLobby, "Leave your current lobby first")
+		return
+	}
+	if h.queued[c.player.ID] != nil {
+		c.sendError(id, ErrorAlreadyQueued, "Leave the matchmaking queue first")
+		return
+	}
+	h.addLobby(c, id)
+}
+
+// joinLobby puts the player into the requested lobby, into any lobby with
+// room when none is named, or back into the lobby they are already in.
+func (h *Hub) joinLobby(c *conn, cmd Command) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if current := h.lobbyOf[c.player.ID]; current != nil {
+		if cmd.LobbyID != "" && cmd.LobbyID != current.ID {
+			c.sendError(cmd.ID, ErrorAlreadyInLobby, "Leave your current lobby first")
+			return
+		}
+		current.rejoin(c, cmd.ID)
+		return
+	}
+	if h.queued[c.player.ID] != nil {
+		c.sendError(cmd.ID, ErrorAlreadyQueued, "Leave the matchmaking queue first")
+		return
+	}
+
+	if cmd.LobbyID == "" {
+		for _, l := range h.lobbies {
+			if l.open() {
+				h.enterLobby(c, l, cmd.ID)
+				return
+			}
+		}
+		h.addLobby(c, cmd.ID)
+		return
+	}
+
+	l, ok := h.lobbies[cmd.LobbyID]
+	if !ok {
+		c.sendError(cmd.ID, ErrorLobbyNotFound, "Lobby not found")
+		return
+	}
+	h.enterLobby(c, l, cmd.ID)
+}
+
+// addLobby opens a lobby hosted by the player on c. The caller holds h.mu.
+func (h *Hub) addLobby(c *conn, id int64) {
+	l := &lobby{ID: newSessionID(), state: LobbyWaiting, hostID: c.player.ID}
+	h.lobbies[l.ID] = l
+	metrics.LiveLobbies.Inc()
+	h.enterLobby(c, l, id)
+}
+
+// enterLobby adds the player on c to l. The caller holds h.mu.
+func (h *Hub) enterLobby(c *conn, l *lobby, id int64) {
+	if code, message := l.join(c, id); code != "" {
+		c.sendError(id, code, message)
+		return
+	}
+	h.lobbyOf[c.player.ID] = l
+}
+
+func (h *Hub) leaveLobby(c *conn, id int64) {
+	h.mu.Lock()
+	l := h.lobbyOf[c.player.ID]
+	if l == nil {
+		h.mu.Unlock()
+		c.sendError(id, ErrorNoLobby, "Join a lobby first")
+		return
+	}
+	delete(h.lobbyOf, c.player.ID)
+	result, empty := l.leave(c.player.ID, h.now())
+	if empty {
+		h.removeLobby(l)
+	}
+	h.mu.Unlock()
+
+	l.mu.Lock()
+	c.send(l.message(id))
+	l.mu.Unlock()
+
+	if result != nil {
+		h.closeLobby(l, result)
+	}
+}
+
+func (h *Hub) setReady(c *conn, cmd Command) {
+	h.mu.Lock()
+	l := h.lobbyOf[c.player.ID]
+	h.mu.Unlock()
+
+	if l == nil {
+		c.sendError(cmd.ID, ErrorNoLobby, "Join a lobby first")
+		return
+	}
+	l.setReady(c, cmd.ID, cmd.Ready, h.now())
+}
+
+// raceMove plays a move in the race the player on c is in. It reports
+// false when they are not racing.
+func (h *Hub) raceMove(c *conn, cmd Command) bool {
+	h.mu.Lock()
+	l := h.lobbyOf[c.player.ID]
+	h.mu.Unlock()
+
+	if l == nil {
+		return false
+	}
+	handled, result := l.move(c, cmd, h.now())
+	if result != nil {
+		h.closeLobby(l, result)
+	}
+	return handled
+}
+
+// disconnectRacer is called with h.mu held when c closes.
+func (h *Hub) disconnectRacer(c *conn) {
+	l := h.lobbyOf[c.player.ID]
+	if l == nil {
+		return
+	}
+
+	playerID := c.player.ID
+	left, empty := l.disconnect(c, h.opts.RaceReconnectGrace, func() {
+		if result := l.forfeitAway(playerID, h.now()); result != nil {
+			h.closeLobby(l, result)
+		}
+	})
+	if left {
+		delete(h.lobbyOf, playerID)
+	}
+	if empty {
+		h.removeLobby(l)
+	}
+}
+
+// removeLobby forgets l. The caller holds h.mu.
+func (h *Hub) removeLobby(l *lobby) {
+	if h.lobbies[l.ID] == l {
+		delete(h.lobbies, l.ID)
+		metrics.LiveLobbies.Dec()
+	}
+}
+
+// closeLobby discards a finished lobby and records its result. Recording
+// runs in the background so that the racer whose move ended the race is not
+// kept waiting on the database; Close waits for it.
+func (h *Hub) closeLobby(l *lobby, result *models.RaceResult) {
+	h.mu.Lock()
+	h.removeLobby(l)
+	for _, p := range result.Players {
+		if h.lobbyOf[p.PlayerID] == l {
+			delete(h.lobbyOf, p.PlayerID)
+		}
+	}
+	closed := h.closed
+	if !closed && h.opts.RecordRace != nil {
+		h.wg.Add(1)
+	}
+	h.mu.Unlock()
+
+	metrics.RacesFinished.Inc()
+	if h.opts.RecordRace == nil {
+		return
+	}
+	if closed {
+		// Close may already be waiting, so it is too late to add to the
+		// wait group.
+		h.recordRace(l.ID, *result)
+		return
+	}
+	go func() {
+		defer h.wg.Done()
+		h.recordRace(l.ID, *result)
+	}()
+}
+
+// recordRace stores result, retrying when RecordRace fails so that a
+// transient database error does not leave the racers unrated.
+func (h *Hub) recordRace(lobbyID string, result models.RaceResult) {
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), recordRaceTimeout)
+		err := h.opts.RecordRace(ctx, result)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt == recordRaceAttempts {
+			h.log.Error("failed to record race result", slog.String("lobby_id", lobbyID), slog.Int("attempts", attempt), slog.Any("error", err))
+			return
+		}
+		h.log.Warn("failed to record race result, retrying", slog.String("lobby_id", lobbyID), slog.Any("error", err))
+		time.Sleep(time.Duration(attempt) * recordRaceRetryDelay)
+	}
+}
@@ -0,0 +1,302 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// readType reads messages until one of type msgType arrives.
+func readType[T any](t *testing.T, ws *websocket.Conn, msgType string) T {
+	t.Helper()
+	for {
+		require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, data, err := ws.ReadMessage()
+		require.NoError(t, err)
+
+		var envelope struct {
+			Type string `json:"type"`
+		}
+		require.NoError(t, json.Unmarshal(data, &envelope), string(data))
+		if envelope.Type == msgType {
+			var msg T
+			require.NoError(t, json.Unmarshal(data, &msg), string(data))
+			return msg
+		}
+	}
+}
+
+// startRace has host and guest join one lobby and ready up, returning the
+// lobby ID once both have received the race start.
+func startRace(t *testing.T, host, guest *websocket.Conn) string {
+	t.Helper()
+
+	sendCommand(t, host, Command{Type: CommandCreateLobby, ID: 1})
+	lobby := readMessage[LobbyMessage](t, host)
+	require.Equal(t, LobbyWaiting, lobby.State)
+
+	sendCommand(t, guest, Command{Type: CommandJoinLobby, ID: 1, LobbyID: lobby.LobbyID})
+	joined := readMessage[LobbyMessage](t, guest)
+	require.Len(t, joined.Players, 2)
+
+	sendCommand(t, host, Command{Type: CommandReady, ID: 2, Ready: true})
+	sendCommand(t, guest, Command{Type: CommandReady, ID: 2, Ready: true})
+
+	for _, ws := range []*websocket.Conn{host, guest} {
+		start := readType[RaceStartMessage](t, ws, MessageRaceStart)
+		require.Equal(t, lobby.LobbyID, start.LobbyID)
+		require.Equal(t, game.TypeRace, start.GameType)
+		require.Empty(t, start.Cells)
+	}
+	return lobby.LobbyID
+}
+
+// raceBoardCells splits the race board into mines and safe cells.
+func raceBoardCells(t *testing.T, hub *Hub, lobbyID string) (mines, safe []game.Point) {
+	t.Helper()
+
+	hub.mu.Lock()
+	l := hub.lobbies[lobbyID]
+	hub.mu.Unlock()
+	require.NotNil(t, l)
+
+	l.mu.Lock()
+	seed := l.seed
+	l.mu.Unlock()
+
+	for y := 0; y < game.NormalSize; y++ {
+		for x := 0; x < game.NormalSize; x++ {
+			g, err := game.New(game.TypeNormal, seed)
+			require.NoError(t, err)
+			p := game.Point{X: x, Y: y}
+			_, err = g.Reveal(p)
+			require.NoError(t, err)
+			if g.State == game.StateLost {
+				mines = append(mines, p)
+			} else {
+				safe = append(safe, p)
+			}
+		}
+	}
+	return mines, safe
+}
+
+func recordRaces(opts *Options) <-chan models.RaceResult {
+	results := make(chan models.RaceResult, 1)
+	opts.RecordRace = func(_ context.Context, result models.RaceResult) error {
+		results <- result
+		return nil
+	}
+	return results
+}
+
+func TestRaceToClearBoard(t *testing.T) {
+	opts := testOptions()
+	opts.SendBuffer = 512
+	results := recordRaces(&opts)
+	hub, url := newTestServer(t, opts)
+
+	host := dial(t, url, "player1")
+	guest := dial(t, url, "player2")
+	lobbyID := startRace(t, host, guest)
+	_, safe := raceBoardCells(t, hub, lobbyID)
+
+	revealed := make(map[game.Point]bool)
+	for _, p := range safe {
+		if revealed[p] {
+			continue
+		}
+		sendCommand(t, host, Command{Type: CommandReveal, ID: 3, X: p.X, Y: p.Y})
+		delta := readType[DeltaMessage](t, host, MessageDelta)
+		for _, cell := range delta.Cells {
+			revealed[game.Point{X: cell.X, Y: cell.Y}] = true
+		}
+	}
+
+	progress := readType[RaceProgressMessage](t, guest, MessageRaceProgress)
+	assert.Equal(t, "player1", progress.PlayerID)
+	assert.Positive(t, progress.Progress)
+
+	for _, ws := range []*websocket.Conn{host, guest} {
+		result := readType[RaceResultMessage](t, ws, MessageRaceResult)
+		assert.Equal(t, "player1", result.WinnerID)
+		require.Len(t, result.Standings, 2)
+		assert.Equal(t, RaceStanding{PlayerID: "player1", Place: 1, Progress: 100, Score: result.Standings[0].Score, State: game.StateWon, ElapsedMS: result.Standings[0].ElapsedMS}, result.Standings[0])
+		assert.Equal(t, "player2", result.Standings[1].PlayerID)
+		assert.Equal(t, game.StatePlaying, result.Standings[1].State)
+	}
+
+	select {
+	case result := <-results:
+		assert.Equal(t, game.TypeRace, result.GameType)
+		assert.Equal(t, lobbyID, result.LobbyID)
+		assert.Equal(t, "player1", result.WinnerID)
+		assert.Len(t, result.Players, 2)
+	case <-time.After(5 * time.Second):
+		t.Fatal("race result was not recorded")
+	}
+
+	hub.mu.Lock()
+	assert.Empty(t, hub.lobbies)
+	assert.Empty(t, hub.lobbyOf)
+	hub.mu.Unlock()
+}
+
+func TestRaceLastPlayerStandingWins(t *testing.T) {
+	hub, url := newTestServer(t, testOptions())
+
+	host := dial(t, url, "player1")
+	guest := dial(t, url, "player2")
+	lobbyID := startRace(t, host, guest)
+	mines, _ := raceBoardCells(t, hub, lobbyID)
+
+	sendCommand(t, host, Command{Type: CommandReveal, X: mines[0].X, Y: mines[0].Y})
+	delta := readType[DeltaMessage](t, host, MessageDelta)
+	assert.Equal(t, game.StateLost, delta.State)
+
+	result := readType[RaceResultMessage](t, guest, MessageRaceResult)
+	assert.Equal(t, "player2", result.WinnerID)
+	assert.Equal(t, game.StateLost, result.Standings[1].State)
+}
+
+func TestRaceForfeitAfterDisconnect(t *testing.T) {
+	opts := testOptions()
+	opts.RaceReconnectGrace = 50 * time.Millisecond
+	_, url := newTestServer(t, opts)
+
+	host := dial(t, url, "player1")
+	guest := dial(t, url, "player2")
+	startRace(t, host, guest)
+	require.NoError(t, guest.Close())
+
+	lobby := readType[LobbyMessage](t, host, MessageLobby)
+	assert.False(t, lobby.Players[1].Connected)
+
+	progress := readType[RaceProgressMessage](t, host, MessageRaceProgress)
+	assert.Equal(t, "player2", progress.PlayerID)
+	assert.True(t, progress.Forfeited)
+
+	result := readType[RaceResultMessage](t, host, MessageRaceResult)
+	assert.Equal(t, "player1", result.WinnerID)
+	assert.True(t, result.Standings[1].Forfeited)
+}
+
+func TestRaceRejoin(t *testing.T) {
+	opts := testOptions()
+	opts.RaceReconnectGrace = time.Minute
+	_, url := newTestServer(t, opts)
+
+	host := dial(t, url, "player1")
+	guest := dial(t, url, "player2")
+	lobbyID := startRace(t, host, guest)
+
+	sendCommand(t, guest, Command{Type: CommandFlag, X: 0, Y: 0})
+	readType[DeltaMessage](t, guest, MessageDelta)
+	require.NoError(t, guest.Close())
+	readType[LobbyMessage](t, host, MessageLobby)
+
+	again := dial(t, url, "player2")
+	sendCommand(t, again, Command{Type: CommandJoinLobby, ID: 5})
+	lobby := readMessage[LobbyMessage](t, again)
+	assert.Equal(t, lobbyID, lobby.LobbyID)
+	assert.Equal(t, int64(5), lobby.ID)
+	assert.Equal(t, LobbyRacing, lobby.State)
+
+	start := readMessage[RaceStartMessage](t, again)
+	assert.Equal(t, uint64(1), start.Seq)
+	assert.Equal(t, []game.Cell{{X: 0, Y: 0, Status: game.CellFlagged}}, start.Cells)
+}
+
+func TestLobbyErrors(t *testing.T) {
+	_, url := newTestServer(t, testOptions())
+	ws := dial(t, url, "player1")
+
+	sendCommand(t, ws, Command{Type: CommandReady, Ready: true})
+	assert.Equal(t, ErrorNoLobby, readMessage[ErrorMessage](t, ws).Code)
+
+	sendCommand(t, ws, Command{Type: CommandJoinLobby, LobbyID: "missing"})
+	assert.Equal(t, ErrorLobbyNotFound, readMessage[ErrorMessage](t, ws).Code)
+
+	sendCommand(t, ws, Command{Type: CommandJoinLobby})
+	lobby := readMessage[LobbyMessage](t, ws)
+	assert.Equal(t, "player1", lobby.HostID)
+
+	sendCommand(t, ws, Command{Type: CommandCreateLobby})
+	assert.Equal(t, ErrorAlreadyInLobby, readMessage[ErrorMessage](t, ws).Code)
+
+	// Quick join fills the open lobby before opening another.
+	for i := 2; i <= MaxRacePlayers; i++ {
+		player := dial(t, url, fmt.Sprintf("player%d", i))
+		sendCommand(t, player, Command{Type: CommandJoinLobby})
+		assert.Equal(t, lobby.LobbyID, readMessage[LobbyMessage](t, player).LobbyID)
+	}
+
+	late := dial(t, url, "player9")
+	sendCommand(t, late, Command{Type: CommandJoinLobby, LobbyID: lobby.LobbyID})
+	assert.Equal(t, ErrorLobbyFull, readMessage[ErrorMessage](t, late).Code)
+
+	sendCommand(t, ws, Command{Type: CommandLeaveLobby, ID: 7})
+	left := readType[LobbyMessage](t, ws, MessageLobby)
+	for left.ID != 7 {
+		left = readType[LobbyMessage](t, ws, MessageLobby)
+	}
+	assert.Len(t, left.Players, MaxRacePlayers-1)
+	assert.Equal(t, "player2", left.HostID, "the next player takes over as host")
+}
+
+// A player can leave a lobby between the hub finding it and the lobby
+// handling their command.
+func TestLobbyCommandsAfterLeaving(t *testing.T) {
+	hub := NewHub(testOptions(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { _ = hub.Close(context.Background()) })
+	c := newConn(hub, nil, Player{ID: "player1"})
+	l := &lobby{ID: "lobby1", state: LobbyWaiting}
+
+	l.setReady(c, 1, true, time.Now())
+
+	l.state = LobbyRacing
+	handled, result := l.move(c, Command{Type: CommandReveal, ID: 2}, time.Now())
+	assert.True(t, handled)
+	assert.Nil(t, result)
+
+	for id := int64(1); id <= 2; id++ {
+		var msg ErrorMessage
+		require.NoError(t, json.Unmarshal(<-c.outbox, &msg))
+		assert.Equal(t, id, msg.ID)
+		assert.Equal(t, ErrorNoLobby, msg.Code)
+	}
+}
+
+func TestRecordRaceRetries(t *testing.T) {
+	opts := testOptions()
+	var ids []primitive.ObjectID
+	opts.RecordRace = func(_ context.Context, result models.RaceResult) error {
+		ids = append(ids, result.ID)
+		if len(ids) < recordRaceAttempts {
+			return errors.New("database unavailable")
+		}
+		return nil
+	}
+	hub := NewHub(opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { _ = hub.Close(context.Background()) })
+
+	result := models.RaceResult{ID: primitive.NewObjectID(), LobbyID: "lobby1"}
+	hub.recordRace(result.LobbyID, result)
+
+	require.Len(t, ids, recordRaceAttempts)
+	for _, id := range ids {
+		assert.Equal(t, result.ID, id, "every attempt stores the same race")
+	}
+}
@@ -0,0 +1,263 @@
+package live
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+)
+
+// Session is a game kept on the server so that a player can drop their
+// connection and resume where they left off.
+type Session struct {
+	ID      string
+	OwnerID string
+	// guest is set when the owner is a guest, whose games count towards no
+	// stats.
+	guest bool
+
+	mu         sync.Mutex
+	game       *game.Game
+	viewport   game.Rect
+	seq        uint64
+	conn       *conn
+	detachedAt time.Time
+
+	// public sessions can be watched by spectators, who see the game delay
+	// behind the player. feed is nil while the session is private.
+	public bool
+	delay  time.Duration
+	feed   *feed
+
+	// daily is the attempt played in a daily challenge session, tournament
+	// the game played in a tournament session and challenge the game played
+	// in a head-to-head challenge. Each is recorded once, when the game ends
+	// or the session is discarded. Challenge games keep a replay of their
+	// moves.
+	daily      *models.DailyAttempt
+	tournament *models.TournamentGame
+	challenge  *models.ChallengeGame
+	replay     []models.ReplayMove
+	recorded   bool
+}
+
+// outcome is how the game played in a session ended.
+type outcome struct {
+	gameType      string
+	state         string
+	score         int
+	timeInSeconds int
+	cellsRevealed int
+	flagsPlaced   int
+	finishedAt    time.Time
+	// replay holds the moves of a challenge game.
+	replay []models.ReplayMove
+}
+
+// finish returns how the game played in s ended, at most once. It reports
+// false once the outcome has been taken and, unless abandon is set, while the
+// game is still being played; a game abandoned while being played ends as
+// abandoned.
+func (s *Session) finish(abandon bool, now time.Time) (outcome, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.recorded {
+		return outcome{}, false
+	}
+	if s.game.State == game.StatePlaying && !abandon {
+		return outcome{}, false
+	}
+	s.recorded = true
+
+	o := outcome{
+		gameType:      s.game.Type,
+		state:         string(s.game.State),
+		score:         s.game.Score,
+		timeInSeconds: int(s.game.Elapsed() / time.Second),
+		cellsRevealed: s.game.CellsRevealed(),
+		flagsPlaced:   s.game.FlagsPlaced,
+		finishedAt:    now,
+		replay:        s.replay,
+	}
+	if s.game.State == game.StatePlaying {
+		o.state = models.AttemptAbandoned
+	}
+	return o, true
+}
+
+// maxReplayMoves bounds the replay of a challenge game. Both players'
+// replays are stored in the challenge document, which must stay well under
+// MongoDB's 16 MB document limit.
+const maxReplayMoves = 20_000
+
+var errReplayLimit = errors.New("replay move limit reached")
+
+func newSession(owner Player, g *game.Game) *Session {
+	return &Session{
+		ID:       newSessionID(),
+		OwnerID:  owner.ID,
+		guest:    owner.Guest,
+		game:     g,
+		viewport: initialViewport(g.Type),
+	}
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// initialViewport covers the whole board in normal mode and the area around
+// the origin in infinite mode, matching the browser client.
+func initialViewport(gameType string) game.Rect {
+	if gameType == game.TypeNormal {
+		return game.Rect{Width: game.NormalSize, Height: game.NormalSize}
+	}
+	return game.Viewport(0, 0)
+}
+
+// attach makes c the connection receiving the session's updates and returns
+// the connection it replaced, if any.
+func (s *Session) attach(c *conn) *conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.conn
+	s.conn = c
+	if previous == c {
+		return nil
+	}
+	return previous
+}
+
+func (s *Session) detach(c *conn, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == c {
+		s.conn = nil
+		s.detachedAt = now
+	}
+}
+
+// expired reports whether the session has had no connection for longer than
+// ttl.
+func (s *Session) expired(now time.Time, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conn == nil && now.Sub(s.detachedAt) > ttl
+}
+
+// snapshot explores the current viewport and describes the whole session.
+func (s *Session) snapshot(id int64) (SessionMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.snapshotLocked(id)
+}
+
+func (s *Session) snapshotLocked(id int64) (SessionMessage, error) {
+	cells, err := s.game.Explore(s.viewport)
+	if err != nil {
+		return SessionMessage{}, err
+	}
+
+	return SessionMessage{
+		Type:         MessageSession,
+		ID:           id,
+		SessionID:    s.ID,
+		GameType:     s.game.Type,
+		State:        s.game.State,
+		Score:        s.game.Score,
+		ElapsedMS:    s.game.Elapsed().Milliseconds(),
+		Seq:          s.seq,
+		Public:       s.public,
+		DelaySeconds: int(s.delay / time.Second),
+		DailyDate:    s.dailyDate(),
+		TournamentID: s.tournamentID(),
+		Round:        s.tournamentRound(),
+		ChallengeID:  s.challengeID(),
+		Viewport:     s.viewport,
+		Cells:        nonNil(cells),
+	}, nil
+}
+
+// apply runs a move command and returns the resulting delta.
+func (s *Session) apply(cmd Command) (DeltaMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.challenge != nil && len(s.replay) >= maxReplayMoves {
+		return DeltaMessage{}, errReplayLimit
+	}
+	cells, err := move(s.game, cmd)
+	if err != nil {
+		return DeltaMessage{}, err
+	}
+	if s.challenge != nil {
+		s.replay = append(s.replay, models.ReplayMove{Type: cmd.Type, X: cmd.X, Y: cmd.Y, AtMS: s.game.Elapsed().Milliseconds()})
+	}
+
+	s.seq++
+	delta := DeltaMessage{
+		Type:      MessageDelta,
+		ID:        cmd.ID,
+		Seq:       s.seq,
+		State:     s.game.State,
+		Score:     s.game.Score,
+		ElapsedMS: s.game.Elapsed().Milliseconds(),
+		Cells:     nonNil(cells),
+	}
+	s.publish(delta)
+	return delta, nil
+}
+
+// move runs a reveal, flag or chord command against g.
+func move(g *game.Game, cmd Command) ([]game.Cell, error) {
+	p := game.Point{X: cmd.X, Y: cmd.Y}
+
+	switch cmd.Type {
+	case CommandReveal:
+		return g.Reveal(p)
+	case CommandFlag:
+		return g.ToggleFlag(p)
+	case CommandChord:
+		return g.Chord(p)
+	default:
+		return nil, errors.New("not a move command")
+	}
+}
+
+// moveViewport explores the viewport with its top left corner at (x, y).
+func (s *Session) moveViewport(id int64, x, y int) (ViewportMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	viewport := s.viewport
+	viewport.X, viewport.Y = x, y
+
+	cells, err := s.game.Explore(viewport)
+	if err != nil {
+		return ViewportMessage{}, err
+	}
+	s.viewport = viewport
+
+	msg := ViewportMessage{Type: MessageViewport, ID: id, Viewport: viewport, Cells: nonNil(cells)}
+	s.publish(msg)
+	return msg, nil
+}
+
+// nonNil makes empty cell lists encode as [] rather than null.
+func nonNil(cells []game.Cell) []game.Cell {
+	if cells == nil {
+		return []game.Cell{}
+	}
+	return cells
+}
@@ -0,0 +1,43 @@
+package live
+
+import (
+	"testing"
+	"time"
+
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionFinish(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Playing", func(t *testing.T) {
+		g, err := game.New(game.TypeNormal, 1)
+		require.NoError(t, err)
+		s := newSession(Player{ID: "player1"}, g)
+
+		_, ok := s.finish(false, now)
+		assert.False(t, ok, "a game being played has no outcome yet")
+
+		o, ok := s.finish(true, now)
+		require.True(t, ok)
+		assert.Equal(t, models.AttemptAbandoned, o.state)
+		assert.Equal(t, now, o.finishedAt)
+
+		_, ok = s.finish(true, now)
+		assert.False(t, ok, "the outcome is taken once")
+	})
+
+	t.Run("Over", func(t *testing.T) {
+		g, err := game.New(game.TypeNormal, 1)
+		require.NoError(t, err)
+		g.Resign()
+		s := newSession(Player{ID: "player1"}, g)
+
+		o, ok := s.finish(false, now)
+		require.True(t, ok)
+		assert.Equal(t, string(game.StateLost), o.state)
+	})
+}
@@ -0,0 +1,388 @@
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
+)
+
+// spectator receives the feed of a public session. Both methods are called
+// with the session locked and must not block.
+type spectator interface {
+	deliver(messageType string, data []byte)
+	end(code int, text string)
+}
+
+type feedItem struct {
+	releaseAt time.Time
+	msg       any
+}
+
+// feed is what the spectators of a public session see. The player's messages
+// are held back for the session's delay, and the feed keeps its own copy of
+// the board as of the last released message so that a spectator joining
+// late starts from the delayed state rather than the live one.
+type feed struct {
+	delay       time.Duration
+	pending     []feedItem
+	lastRelease time.Time
+	timer       *time.Timer
+
+	// view and cells hold the released state once ready is set.
+	ready bool
+	view  SessionMessage
+	cells map[game.Point]game.Cell
+
+	spectators map[spectator]struct{}
+}
+
+func newFeed(delay time.Duration) *feed {
+	return &feed{
+		delay:      delay,
+		cells:      make(map[game.Point]game.Cell),
+		spectators: make(map[spectator]struct{}),
+	}
+}
+
+// snapshot describes the released state for a spectator that starts
+// watching.
+func (f *feed) snapshot() SessionMessage {
+	msg := f.view
+	msg.DelaySeconds = int(f.delay / time.Second)
+
+	var cells []game.Cell
+	r := msg.Viewport
+	for y := r.Y; y < r.Y+r.Height; y++ {
+		for x := r.X; x < r.X+r.Width; x++ {
+			if cell, ok := f.cells[game.Point{X: x, Y: y}]; ok {
+				cells = append(cells, cell)
+			}
+		}
+	}
+	msg.Cells = nonNil(cells)
+	return msg
+}
+
+// release applies a player message to the spectators' view and forwards it
+// without the player's command ID.
+func (f *feed) release(msg any) {
+	var messageType string
+	switch m := msg.(type) {
+	case SessionMessage:
+		m.ID = 0
+		f.view = m
+		f.ready = true
+		clear(f.cells)
+		f.applyCells(m.Cells)
+		messageType, msg = MessageSession, f.snapshot()
+	case DeltaMessage:
+		m.ID = 0
+		f.view.Seq, f.view.State, f.view.Score, f.view.ElapsedMS = m.Seq, m.State, m.Score, m.ElapsedMS
+		f.applyCells(m.Cells)
+		messageType, msg = MessageDelta, m
+	case ViewportMessage:
+		m.ID = 0
+		f.view.Viewport = m.Viewport
+		f.applyCells(m.Cells)
+		messageType, msg = MessageViewport, m
+	default:
+		return
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	for sp := range f.spectators {
+		sp.deliver(messageType, data)
+	}
+}
+
+func (f *feed) applyCells(cells []game.Cell) {
+	for _, cell := range cells {
+		p := game.Point{X: cell.X, Y: cell.Y}
+		if cell.Status == game.CellHidden {
+			delete(f.cells, p)
+		} else {
+			f.cells[p] = cell
+		}
+	}
+}
+
+// setVisibility makes the session public or private. A session made public
+// shows spectators its current state once the delay has passed; making it
+// private disconnects every spectator.
+func (s *Session) setVisibility(id int64, public bool, delay time.Duration) VisibilityMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.public = public
+	s.delay = delay
+
+	switch {
+	case !public:
+		s.endFeed(CloseSessionPrivate, "session made private")
+	case s.feed == nil:
+		s.feed = newFeed(delay)
+		if snapshot, err := s.snapshotLocked(0); err == nil {
+			s.publish(snapshot)
+		}
+	default:
+		s.feed.delay = delay
+	}
+
+	msg := VisibilityMessage{Type: MessageVisibility, ID: id, Public: public, DelaySeconds: int(delay / time.Second)}
+	if s.feed != nil {
+		msg.Spectators = len(s.feed.spectators)
+	}
+	return msg
+}
+
+func (s *Session) isPublic() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.public
+}
+
+// publish queues msg for spectators. The caller holds s.mu.
+func (s *Session) publish(msg any) {
+	f := s.feed
+	if f == nil {
+		return
+	}
+
+	// Release times never go backwards, so shortening the delay cannot
+	// reorder messages.
+	now := time.Now()
+	releaseAt := now.Add(f.delay)
+	if releaseAt.Before(f.lastRelease) {
+		releaseAt = f.lastRelease
+	}
+	f.lastRelease = releaseAt
+
+	if len(f.pending) == 0 && !releaseAt.After(now) {
+		f.release(msg)
+		return
+	}
+	f.pending = append(f.pending, feedItem{releaseAt: releaseAt, msg: msg})
+	s.scheduleRelease(f)
+}
+
+func (s *Session) scheduleRelease(f *feed) {
+	if f.timer != nil || len(f.pending) == 0 {
+		return
+	}
+	f.timer = time.AfterFunc(time.Until(f.pending[0].releaseAt), func() {
+		s.releaseDue(f)
+	})
+}
+
+func (s *Session) releaseDue(f *feed) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.feed != f {
+		return
+	}
+	f.timer = nil
+
+	now := time.Now()
+	n := 0
+	for n < len(f.pending) && !f.pending[n].releaseAt.After(now) {
+		f.release(f.pending[n].msg)
+		n++
+	}
+	f.pending = append(f.pending[:0], f.pending[n:]...)
+	s.scheduleRelease(f)
+}
+
+// addSpectator starts sending the session's feed to sp, beginning with a
+// snapshot. It reports false if the session is not public.
+func (s *Session) addSpectator(sp spectator) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.feed == nil {
+		return false
+	}
+	s.feed.spectators[sp] = struct{}{}
+	metrics.LiveSpectators.Inc()
+
+	if s.feed.ready {
+		if data, err := json.Marshal(s.feed.snapshot()); err == nil {
+			sp.deliver(MessageSession, data)
+		}
+	}
+	return true
+}
+
+func (s *Session) removeSpectator(sp spectator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.feed == nil {
+		return
+	}
+	if _, ok := s.feed.spectators[sp]; ok {
+		delete(s.feed.spectators, sp)
+		metrics.LiveSpectators.Dec()
+	}
+}
+
+// end disconnects the spectators of a session that is being discarded.
+func (s *Session) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.endFeed(CloseSessionEnded, "session ended")
+}
+
+// endFeed drops the feed along with any messages still held back by the
+// delay. The caller holds s.mu.
+func (s *Session) endFeed(code int, text string) {
+	f := s.feed
+	if f == nil {
+		return
+	}
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+	for sp := range f.spectators {
+		sp.end(code, text)
+	}
+	metrics.LiveSpectators.Sub(float64(len(f.spectators)))
+	s.feed = nil
+}
+
+// Spectate streams the public session sessionID to a read-only client: over
+// a WebSocket when the request asks for an upgrade and as Server-Sent Events
+// otherwise. Like Serve it returns an error without writing a response when
+// the spectator cannot be accepted.
+func (h *Hub) Spectate(w http.ResponseWriter, r *http.Request, sessionID string) error {
+	h.mu.Lock()
+	s := h.sessions[sessionID]
+	h.mu.Unlock()
+	if s == nil || !s.isPublic() {
+		return ErrSessionNotFound
+	}
+
+	release, err := h.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if websocket.IsWebSocketUpgrade(r) {
+		ws, err := h.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			h.log.Debug("websocket upgrade failed", slog.Any("error", err))
+			return nil
+		}
+
+		c := newConn(h, ws, Player{})
+		c.spectating = s
+		if !s.addSpectator(c) {
+			c.closeWith(CloseSessionEnded, "session is no longer public")
+		}
+		h.run(c)
+		return nil
+	}
+
+	return h.streamEvents(w, r, s)
+}
+
+// eventStream is a spectator reading the feed as Server-Sent Events.
+type eventStream struct {
+	events    chan streamEvent
+	done      chan struct{}
+	closeOnce sync.Once
+	closeCode int
+	closeText string
+}
+
+type streamEvent struct {
+	name string
+	data []byte
+}
+
+func (e *eventStream) deliver(messageType string, data []byte) {
+	select {
+	case <-e.done:
+	case e.events <- streamEvent{name: messageType, data: data}:
+	default:
+		metrics.LiveSlowConsumers.Inc()
+		e.end(websocket.CloseTryAgainLater, "client too slow")
+	}
+}
+
+func (e *eventStream) end(code int, text string) {
+	e.closeOnce.Do(func() {
+		e.closeCode = code
+		e.closeText = text
+		close(e.done)
+	})
+}
+
+// streamEvents sends the feed of s until the client goes away. When the
+// server ends the stream it sends a closed event carrying the same code a
+// WebSocket spectator would receive.
+func (h *Hub) streamEvents(w http.ResponseWriter, r *http.Request, s *Session) error {
+	stream := &eventStream{
+		events: make(chan streamEvent, h.opts.SendBuffer),
+		done:   make(chan struct{}),
+	}
+	if !s.addSpectator(stream) {
+		return ErrSessionNotFound
+	}
+	defer s.removeSpectator(stream)
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(h.opts.PingInterval)
+	defer ticker.Stop()
+
+	write := func(format string, args ...any) bool {
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	for {
+		select {
+		case event := <-stream.events:
+			if !write("event: %s\ndata: %s\n\n", event.name, event.data) {
+				return nil
+			}
+		case <-ticker.C:
+			if !write(": ping\n\n") {
+				return nil
+			}
+		case <-stream.done:
+			data, _ := json.Marshal(ClosedMessage{Type: MessageClosed, Code: stream.closeCode, Reason: stream.closeText})
+			write("event: %s\ndata: %s\n\n", MessageClosed, data)
+			return nil
+		case <-h.stop:
+			data, _ := json.Marshal(ClosedMessage{Type: MessageClosed, Code: websocket.CloseGoingAway, Reason: "server shutting down"})
+			write("event: %s\ndata: %s\n\n", MessageClosed, data)
+			return nil
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package live
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func spectate(t *testing.T, url, sessionID string) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(url+"/spectate/"+sessionID, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ws.Close() })
+	return ws
+}
+
+func openPublicGame(t *testing.T, ws *websocket.Conn, gameType string, delaySeconds int) SessionMessage {
+	t.Helper()
+	sendCommand(t, ws, Command{Type: CommandOpen, ID: 1, GameType: gameType, Public: true, DelaySeconds: delaySeconds})
+	session := readMessage[SessionMessage](t, ws)
+	require.Equal(t, MessageSession, session.Type)
+	require.True(t, session.Public)
+	return session
+}
+
+// readEvent reads one Server-Sent Event, skipping comments.
+func readEvent(t *testing.T, r *bufio.Reader) (string, []byte) {
+	t.Helper()
+
+	var name string
+	var data []byte
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = []byte(strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+func TestSpectatePublicSession(t *testing.T) {
+	_, url := newTestServer(t, testOptions())
+	player := dial(t, url, "player1")
+	session := openPublicGame(t, player, game.TypeNormal, 0)
+
+	spectator := spectate(t, url, session.SessionID)
+	snapshot := readMessage[SessionMessage](t, spectator)
+	assert.Equal(t, session.SessionID, snapshot.SessionID)
+	assert.Zero(t, snapshot.ID)
+	assert.True(t, snapshot.Public)
+	assert.Empty(t, snapshot.Cells)
+
+	sendCommand(t, player, Command{Type: CommandFlag, ID: 2, X: 1, Y: 1})
+	delta := readMessage[DeltaMessage](t, player)
+	watched := readMessage[DeltaMessage](t, spectator)
+	assert.Zero(t, watched.ID, "spectators do not see the player's command IDs")
+	delta.ID = 0
+	assert.Equal(t, delta, watched)
+
+	sendCommand(t, spectator, Command{Type: CommandReveal, ID: 3, X: 1, Y: 1})
+	assert.Equal(t, ErrorReadOnly, readMessage[ErrorMessage](t, spectator).Code)
+}
+
+func TestSpectateRespectsVisibility(t *testing.T) {
+	_, url := newTestServer(t, testOptions())
+	player := dial(t, url, "player1")
+	session := openGame(t, player, game.TypeNormal)
+	assert.False(t, session.Public)
+
+	_, resp, err := websocket.DefaultDialer.Dial(url+"/spectate/"+session.SessionID, nil)
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "private sessions cannot be watched")
+
+	sendCommand(t, player, Command{Type: CommandSetVisibility, ID: 2, DelaySeconds: MaxSpectatorDelaySeconds + 1})
+	assert.Equal(t, ErrorInvalidDelay, readMessage[ErrorMessage](t, player).Code)
+
+	sendCommand(t, player, Command{Type: CommandSetVisibility, ID: 3, Public: true})
+	visibility := readMessage[VisibilityMessage](t, player)
+	assert.Equal(t, VisibilityMessage{Type: MessageVisibility, ID: 3, Public: true}, visibility)
+
+	spectator := spectate(t, url, session.SessionID)
+	readMessage[SessionMessage](t, spectator)
+
+	sendCommand(t, player, Command{Type: CommandSetVisibility, ID: 4, Public: false})
+	visibility = readMessage[VisibilityMessage](t, player)
+	assert.False(t, visibility.Public)
+	expectClose(t, spectator, CloseSessionPrivate)
+}
+
+func TestSpectatorDelay(t *testing.T) {
+	_, url := newTestServer(t, testOptions())
+	player := dial(t, url, "player1")
+	started := time.Now()
+	session := openPublicGame(t, player, game.TypeNormal, 1)
+	assert.Equal(t, 1, session.DelaySeconds)
+
+	spectator := spectate(t, url, session.SessionID)
+	sendCommand(t, player, Command{Type: CommandFlag, X: 0, Y: 0})
+	readMessage[DeltaMessage](t, player)
+
+	snapshot := readMessage[SessionMessage](t, spectator)
+	assert.GreaterOrEqual(t, time.Since(started), time.Second)
+	assert.Empty(t, snapshot.Cells, "the snapshot is taken before the move")
+	assert.Equal(t, 1, snapshot.DelaySeconds)
+
+	delta := readMessage[DeltaMessage](t, spectator)
+	assert.Equal(t, []game.Cell{{X: 0, Y: 0, Status: game.CellFlagged}}, delta.Cells)
+
+	// A spectator joining now sees the first flag but not the second, which
+	// the delay still holds back.
+	sendCommand(t, player, Command{Type: CommandFlag, X: 1, Y: 0})
+	readMessage[DeltaMessage](t, player)
+
+	late := spectate(t, url, session.SessionID)
+	snapshot = readMessage[SessionMessage](t, late)
+	assert.Equal(t, []game.Cell{{X: 0, Y: 0, Status: game.CellFlagged}}, snapshot.Cells)
+}
+
+func TestSpectateOverServerSentEvents(t *testing.T) {
+	_, url := newTestServer(t, testOptions())
+	player := dial(t, url, "player1")
+	session := openPublicGame(t, player, game.TypeInfinite, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http"+strings.TrimPrefix(url, "ws")+"/spectate/"+session.SessionID, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	events := bufio.NewReader(resp.Body)
+
+	name, _ := readEvent(t, events)
+	assert.Equal(t, MessageSession, name)
+
+	sendCommand(t, player, Command{Type: CommandFlag, X: 2, Y: 2})
+	readMessage[DeltaMessage](t, player)
+	name, data := readEvent(t, events)
+	assert.Equal(t, MessageDelta, name)
+	var delta DeltaMessage
+	require.NoError(t, json.Unmarshal(data, &delta))
+	assert.Equal(t, []game.Cell{{X: 2, Y: 2, Status: game.CellFlagged}}, delta.Cells)
+
+	// Opening a new game discards the watched session.
+	openGame(t, player, game.TypeNormal)
+	name, data = readEvent(t, events)
+	assert.Equal(t, MessageClosed, name)
+	var closed ClosedMessage
+	require.NoError(t, json.Unmarshal(data, &closed))
+	assert.Equal(t, CloseSessionEnded, closed.Code)
+}
@@ -0,0 +1,104 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+)
+
+// openTournament starts the player's game in the current round of the
+// tournament cmd.TournamentID, on the board every player of the round gets.
+// Like daily challenges, tournament games cannot be spectated.
+func (h *Hub) openTournament(c *conn, cmd Command) {
+	if h.opts.StartTournamentGame == nil {
+		c.sendError(cmd.ID, ErrorTournamentUnavailable, "Tournaments are not available")
+		return
+	}
+	if cmd.Public {
+		c.sendError(cmd.ID, ErrorTournamentPrivate, "Tournament games cannot be spectated")
+		return
+	}
+	if c.player.Guest {
+		c.sendError(cmd.ID, ErrorNotInTournament, "Guests cannot play in tournaments")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	tg, err := h.opts.StartTournamentGame(ctx, cmd.TournamentID, c.player.ID)
+	cancel()
+	switch {
+	case errors.Is(err, ErrNotInTournament):
+		c.sendError(cmd.ID, ErrorNotInTournament, "You have no game to play in this tournament round")
+		return
+	case errors.Is(err, ErrTournamentGamePlayed):
+		c.sendError(cmd.ID, ErrorTournamentPlayed, "You have already played this tournament round")
+		return
+	case err != nil:
+		h.log.Error("failed to start tournament game", slog.String("player_id", c.player.ID), slog.Any("error", err))
+		c.sendError(cmd.ID, ErrorTournamentUnavailable, "Tournaments are unavailable, try again later")
+		return
+	}
+
+	g, err := game.New(tg.GameType, tg.Seed)
+	if err != nil {
+		c.sendError(cmd.ID, ErrorUnknownGameType, "game_type must be normal or infinite")
+		return
+	}
+
+	s := newSession(c.player, g)
+	s.tournament = &tg
+	h.addSession(c, s)
+	h.attach(c, s, cmd.ID)
+}
+
+// finishTournament records the tournament game played in s once its game is
+// over.
+func (h *Hub) finishTournament(s *Session, o outcome) {
+	result := s.tournamentResult(o)
+	if result == nil || h.opts.RecordTournamentGame == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := h.opts.RecordTournamentGame(ctx, *result); err != nil {
+		h.log.Error("failed to record tournament game", slog.String("player_id", result.UserID), slog.Any("error", err))
+	}
+}
+
+// isTournament reports whether s plays a tournament game. tournament never
+// changes once the session is created, so it is read without s.mu.
+func (s *Session) isTournament() bool {
+	return s.tournament != nil
+}
+
+func (s *Session) tournamentID() string {
+	if s.tournament == nil {
+		return ""
+	}
+	return s.tournament.TournamentID
+}
+
+func (s *Session) tournamentRound() int {
+	if s.tournament == nil {
+		return 0
+	}
+	return s.tournament.Round
+}
+
+// tournamentResult returns the tournament game played in s as it ended
+// with o, or nil for other sessions.
+func (s *Session) tournamentResult(o outcome) *models.TournamentGame {
+	if s.tournament == nil {
+		return nil
+	}
+	result := *s.tournament
+	result.State = o.state
+	result.Score = o.score
+	result.TimeInSeconds = o.timeInSeconds
+	result.FinishedAt = &o.finishedAt
+	return &result
+}
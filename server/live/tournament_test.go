@@ -0,0 +1,147 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tournamentTestSeed = 4242
+
+// useTournamentStore enables tournament games on opts for a tournament
+// "t1" in round 2 that only player1 and player2 play.
+func useTournamentStore(opts *Options) chan models.TournamentGame {
+	recorded := make(chan models.TournamentGame, 4)
+	started := map[string]bool{}
+	opts.StartTournamentGame = func(_ context.Context, tournamentID, playerID string) (models.TournamentGame, error) {
+		if tournamentID != "t1" || (playerID != "player1" && playerID != "player2") {
+			return models.TournamentGame{}, ErrNotInTournament
+		}
+		if started[playerID] {
+			return models.TournamentGame{}, ErrTournamentGamePlayed
+		}
+		started[playerID] = true
+		return models.TournamentGame{
+			TournamentID: tournamentID,
+			Round:        2,
+			UserID:       playerID,
+			GameType:     game.TypeNormal,
+			Seed:         tournamentTestSeed,
+			State:        models.AttemptPlaying,
+		}, nil
+	}
+	opts.RecordTournamentGame = func(_ context.Context, g models.TournamentGame) error {
+		recorded <- g
+		return nil
+	}
+	return recorded
+}
+
+func TestTournamentGame(t *testing.T) {
+	opts := testOptions()
+	recorded := useTournamentStore(&opts)
+	hub, url, now := newDailyServer(t, opts)
+
+	player1 := dial(t, url, "player1")
+	sendCommand(t, player1, Command{Type: CommandOpen, ID: 1, TournamentID: "t1"})
+	session := readMessage[SessionMessage](t, player1)
+	require.Equal(t, MessageSession, session.Type)
+	assert.Equal(t, "t1", session.TournamentID)
+	assert.Equal(t, 2, session.Round)
+	assert.Equal(t, game.TypeNormal, session.GameType)
+
+	hub.mu.Lock()
+	s := hub.sessions[session.SessionID]
+	hub.mu.Unlock()
+	require.NotNil(t, s)
+	assert.Equal(t, int64(tournamentTestSeed), s.game.Seed)
+
+	sendCommand(t, player1, Command{Type: CommandSetVisibility, ID: 2, Public: true})
+	assert.Equal(t, ErrorTournamentPrivate, readMessage[ErrorMessage](t, player1).Code)
+
+	mine := firstMine(t, tournamentTestSeed)
+	sendCommand(t, player1, Command{Type: CommandReveal, ID: 3, X: mine.X, Y: mine.Y})
+	require.Equal(t, game.StateLost, readMessage[DeltaMessage](t, player1).State)
+
+	select {
+	case g := <-recorded:
+		assert.Equal(t, "player1", g.UserID)
+		assert.Equal(t, models.AttemptLost, g.State)
+		assert.Equal(t, now, *g.FinishedAt)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no tournament game recorded")
+	}
+
+	sendCommand(t, player1, Command{Type: CommandOpen, ID: 4, TournamentID: "t1"})
+	assert.Equal(t, ErrorTournamentPlayed, readMessage[ErrorMessage](t, player1).Code)
+
+	// Opening another game abandons an unfinished tournament game, which
+	// then counts with the score reached.
+	player2 := dial(t, url, "player2")
+	sendCommand(t, player2, Command{Type: CommandOpen, ID: 1, TournamentID: "t1"})
+	require.Equal(t, MessageSession, readMessage[SessionMessage](t, player2).Type)
+	openGame(t, player2, game.TypeNormal)
+	select {
+	case g := <-recorded:
+		assert.Equal(t, "player2", g.UserID)
+		assert.Equal(t, models.AttemptAbandoned, g.State)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no tournament game recorded")
+	}
+}
+
+func TestTournamentErrors(t *testing.T) {
+	opts := testOptions()
+	useTournamentStore(&opts)
+	_, url := newTestServer(t, opts)
+
+	tests := []struct {
+		name   string
+		player string
+		cmd    Command
+		code   string
+	}{
+		{name: "Not Entered", player: "player3", cmd: Command{Type: CommandOpen, TournamentID: "t1"}, code: ErrorNotInTournament},
+		{name: "Unknown Tournament", player: "player1", cmd: Command{Type: CommandOpen, TournamentID: "t2"}, code: ErrorNotInTournament},
+		{name: "Guest", player: "player1&guest", cmd: Command{Type: CommandOpen, TournamentID: "t1"}, code: ErrorNotInTournament},
+		{name: "Public", player: "player1", cmd: Command{Type: CommandOpen, TournamentID: "t1", Public: true}, code: ErrorTournamentPrivate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := dial(t, url, tt.player)
+			sendCommand(t, ws, tt.cmd)
+			assert.Equal(t, tt.code, readMessage[ErrorMessage](t, ws).Code)
+		})
+	}
+}
+
+func TestTournamentUnavailable(t *testing.T) {
+	tests := []struct {
+		name  string
+		start func(context.Context, string, string) (models.TournamentGame, error)
+	}{
+		{name: "Disabled"},
+		{name: "Store Down", start: func(context.Context, string, string) (models.TournamentGame, error) {
+			return models.TournamentGame{}, errors.New("store down")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions()
+			opts.StartTournamentGame = tt.start
+			_, url := newTestServer(t, opts)
+			ws := dial(t, url, "player1")
+
+			sendCommand(t, ws, Command{Type: CommandOpen, ID: 1, TournamentID: "t1"})
+			assert.Equal(t, ErrorTournamentUnavailable, readMessage[ErrorMessage](t, ws).Code)
+		})
+	}
+}
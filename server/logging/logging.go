@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// New returns a logger writing to w at the given level ("debug", "info",
+// "warn" or "error") in the given format ("json" or "text").
+func New(w io.Writer, level string, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be %s or %s", format, FormatJSON, FormatText)
+	}
+}
+
+// ForRequest annotates logger with the request ID, route and, for
+// authenticated requests, the user ID of c.
+func ForRequest(c *gin.Context, logger *slog.Logger) *slog.Logger {
+	attrs := []any{
+		slog.String("request_id", c.GetString("request_id")),
+		slog.String("method", c.Request.Method),
+		slog.String("route", c.FullPath()),
+	}
+	if userID := c.GetString("user_id"); userID != "" {
+		attrs = append(attrs, slog.String("user_id", userID))
+	}
+	return logger.With(attrs...)
+}
@@ -1,47 +1,231 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"github.com/markbakos/infinite-minesweeper/server/audit"
 	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/controllers"
+	"github.com/markbakos/infinite-minesweeper/server/health"
+	"github.com/markbakos/infinite-minesweeper/server/live"
+	"github.com/markbakos/infinite-minesweeper/server/logging"
+	"github.com/markbakos/infinite-minesweeper/server/matchmaking"
+	"github.com/markbakos/infinite-minesweeper/server/middleware"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/markbakos/infinite-minesweeper/server/notification"
 	"github.com/markbakos/infinite-minesweeper/server/routes"
+	"github.com/markbakos/infinite-minesweeper/server/tournament"
 )
 
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: No .env file")
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
 	}
+}
+
+func run(args []string) error {
+	cfg, err := config.Load(args)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if cfg.PrintConfig {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(cfg.Redacted())
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	logger, err := logging.New(os.Stdout, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	err = config.ConnectDB(connectCtx, cfg)
+	if err == nil {
+		err = ensureIndexes(connectCtx, cfg)
+	}
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	audit.Start(logger)
+	live.Start(live.Options{
+		AllowedOrigins: cfg.CORSAllowedOrigins,
+		MaxConnections: cfg.LiveMaxConnections,
+		PingInterval:   cfg.LivePingInterval,
+		SessionTTL:     cfg.LiveSessionTTL,
+		SendBuffer:     64,
+
+		RaceReconnectGrace: cfg.LiveRaceReconnectGrace,
+		RecordRace:         controllers.SaveRaceResult,
+		RecordGame:         controllers.RecordFinishedGame,
+
+		Matchmaking:   matchmaking.DefaultOptions(),
+		MatchInterval: time.Second,
+		LookupRating:  controllers.LookupRating,
+
+		DailySecret: []byte(cfg.DailySeedKey),
+		StartDaily:  controllers.StartDailyAttempt,
+		RecordDaily: controllers.RecordDailyAttempt,
 
-	config.ConnectDB()
+		StartTournamentGame:  controllers.StartTournamentGame,
+		RecordTournamentGame: controllers.RecordTournamentGame,
 
-	router := gin.Default()
+		StartChallengeGame:  controllers.StartChallengeGame,
+		RecordChallengeGame: controllers.RecordChallengeGame,
+	}, logger)
+	notification.Start(notification.Options{
+		Limit:     cfg.NotificationLimit,
+		Retention: cfg.NotificationRetention,
+		Deliver: func(n models.Notification) {
+			if hub := live.Default(); hub != nil {
+				hub.SendNotification(n)
+			}
+		},
+	}, logger)
+	tournament.StartScheduler(10*time.Second, func(ctx context.Context, now time.Time) error {
+		return errors.Join(
+			controllers.AdvanceTournaments(ctx, now),
+			controllers.CloseExpiredChallenges(ctx, now),
+		)
+	}, logger)
 
-	router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "https://infinite-minesweeper.onrender.com")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+	health.Register("mongodb", config.PingDB)
+	health.Register("audit_writer", audit.Healthy)
+	health.Register("notification_writer", notification.Healthy)
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	router := gin.New()
+	// Without trusted proxies, X-Forwarded-For is ignored so that clients
+	// cannot forge the addresses recorded in the audit log.
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("setting trusted proxies: %w", err)
+	}
+
+	router.Use(middleware.RequestIDMiddleware())
+	router.Use(middleware.RequestLogger(logger))
+	router.Use(middleware.Recovery(logger))
+	router.Use(middleware.MetricsMiddleware())
+	router.Use(middleware.CORSMiddleware(middleware.CORSConfig{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	}))
+
+	routes.SetupRoutes(router, cfg, logger, controllers.LookupAccount)
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           router,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("server starting", slog.String("port", cfg.Port))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	select {
+	case err = <-serverErr:
+		if err != nil {
+			err = fmt.Errorf("server failed: %w", err)
 		}
+	case <-ctx.Done():
+		logger.Info("shutdown signal received, draining connections")
+	}
+	health.SetShuttingDown()
+	stop()
+
+	// Keep serving while load balancers see /readyz fail and stop sending
+	// new requests. A second signal kills the process, as stop has restored the
+	// default signal handling.
+	if err == nil && cfg.ShutdownDrainDelay > 0 {
+		logger.Info("waiting for load balancers to drain", slog.Duration("delay", cfg.ShutdownDrainDelay))
+		time.Sleep(cfg.ShutdownDrainDelay)
+	}
 
-		c.Next()
-	})
+	return errors.Join(err, shutdown(srv, cfg.ShutdownTimeout, logger))
+}
+
+// ensureIndexes creates the indexes the server relies on for correctness
+// and for clearing out old notifications.
+func ensureIndexes(ctx context.Context, cfg *config.Config) error {
+	for _, ensure := range []func(context.Context) error{
+		controllers.EnsureDailyIndexes,
+		controllers.EnsureRatingIndexes,
+		func(ctx context.Context) error { return notification.EnsureIndexes(ctx, cfg.NotificationRetention) },
+	} {
+		if err := ensure(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	routes.SetupRoutes(router)
+// shutdown stops accepting requests, waits for in-flight ones to finish, then
+// flushes background workers and closes the database connection, all within
+// the given timeout.
+func shutdown(srv *http.Server, timeout time.Duration, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("shutting down HTTP server: %w", err))
+	}
+
+	// Hijacked WebSocket connections are not tracked by srv.Shutdown.
+	if err := live.Stop(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("closing live connections: %w", err))
+	}
+
+	if err := tournament.StopScheduler(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("stopping tournament scheduler: %w", err))
+	}
+
+	if err := notification.Stop(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("flushing notifications: %w", err))
+	}
+
+	if err := audit.Stop(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("flushing audit log: %w", err))
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if err := config.DisconnectDB(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("disconnecting from MongoDB: %w", err))
 	}
 
-	log.Printf("Server starting on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server: ", err)
+	if len(errs) == 0 {
+		logger.Info("server stopped")
 	}
+	return errors.Join(errs...)
 }
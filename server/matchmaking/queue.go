@@ -0,0 +1,176 @@
+// Package matchmaking pairs players waiting for a ranked match by rating.
+// The queue keeps no goroutines of its own: its owner calls Match
+// periodically, and all time comes from a Clock, so a test can drive it step
+// by step with a fake clock.
+package matchmaking
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+var ErrAlreadyQueued = errors.New("player is already queued")
+
+// Clock tells the queue the time.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function such as time.Now to Clock.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time { return f() }
+
+type Options struct {
+	// InitialWindow is the largest rating difference accepted for a player
+	// who has just joined.
+	InitialWindow float64
+	// WindowGrowth widens the window by this many rating points for every
+	// second a player waits, up to MaxWindow.
+	WindowGrowth float64
+	MaxWindow    float64
+	// Timeout is how long a player waits before giving up on a match.
+	Timeout time.Duration
+}
+
+// DefaultOptions suit ratings on the Glicko scale.
+func DefaultOptions() Options {
+	return Options{
+		InitialWindow: 100,
+		WindowGrowth:  10,
+		MaxWindow:     400,
+		Timeout:       2 * time.Minute,
+	}
+}
+
+// Ticket is a player waiting in the queue.
+type Ticket struct {
+	PlayerID string
+	Rating   float64
+	JoinedAt time.Time
+}
+
+// Match is a pair of players the queue has taken out of the queue together.
+type Match struct {
+	Players [2]Ticket
+}
+
+type Queue struct {
+	opts  Options
+	clock Clock
+
+	mu      sync.Mutex
+	tickets []Ticket
+}
+
+func New(opts Options, clock Clock) *Queue {
+	return &Queue{opts: opts, clock: clock}
+}
+
+// Join adds a ticket to the queue. A ticket without JoinedAt joins now; one
+// that has it keeps its place and the window it has grown so far.
+func (q *Queue) Join(t Ticket) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.index(t.PlayerID) >= 0 {
+		return ErrAlreadyQueued
+	}
+	if t.JoinedAt.IsZero() {
+		t.JoinedAt = q.clock.Now()
+	}
+	q.tickets = append(q.tickets, t)
+	slices.SortStableFunc(q.tickets, func(a, b Ticket) int { return a.JoinedAt.Compare(b.JoinedAt) })
+	return nil
+}
+
+// Leave removes a player from the queue and reports whether they were in it.
+func (q *Queue) Leave(playerID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.index(playerID)
+	if i < 0 {
+		return false
+	}
+	q.tickets = slices.Delete(q.tickets, i, i+1)
+	return true
+}
+
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.tickets)
+}
+
+// Window returns the rating difference a player who joined at joinedAt
+// accepts now.
+func (q *Queue) Window(joinedAt time.Time) float64 {
+	return q.window(joinedAt, q.clock.Now())
+}
+
+func (q *Queue) window(joinedAt, now time.Time) float64 {
+	waited := now.Sub(joinedAt).Seconds()
+	return math.Min(q.opts.InitialWindow+q.opts.WindowGrowth*waited, q.opts.MaxWindow)
+}
+
+// Match removes and returns the players it can pair along with the tickets
+// that have timed out. The longest waiting player is matched first, with
+// the closest rated player whose window also accepts them.
+func (q *Queue) Match() (matches []Match, expired []Ticket) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.clock.Now()
+	waiting := q.tickets[:0]
+	for _, t := range q.tickets {
+		if now.Sub(t.JoinedAt) >= q.opts.Timeout {
+			expired = append(expired, t)
+		} else {
+			waiting = append(waiting, t)
+		}
+	}
+
+	matched := make([]bool, len(waiting))
+	for i, t := range waiting {
+		if matched[i] {
+			continue
+		}
+		best := -1
+		bestDiff := math.Inf(1)
+		for j := i + 1; j < len(waiting); j++ {
+			if matched[j] {
+				continue
+			}
+			other := waiting[j]
+			diff := math.Abs(t.Rating - other.Rating)
+			if diff > q.window(t.JoinedAt, now) || diff > q.window(other.JoinedAt, now) {
+				continue
+			}
+			if diff < bestDiff {
+				best, bestDiff = j, diff
+			}
+		}
+		if best >= 0 {
+			matched[i], matched[best] = true, true
+			matches = append(matches, Match{Players: [2]Ticket{t, waiting[best]}})
+		}
+	}
+
+	remaining := waiting[:0]
+	for i, t := range waiting {
+		if !matched[i] {
+			remaining = append(remaining, t)
+		}
+	}
+	q.tickets = remaining
+	return matches, expired
+}
+
+func (q *Queue) index(playerID string) int {
+	return slices.IndexFunc(q.tickets, func(t Ticket) bool { return t.PlayerID == playerID })
+}
@@ -0,0 +1,114 @@
+package matchmaking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestQueue() (*Queue, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	return New(DefaultOptions(), clock), clock
+}
+
+func matchedIDs(matches []Match) [][2]string {
+	var ids [][2]string
+	for _, m := range matches {
+		ids = append(ids, [2]string{m.Players[0].PlayerID, m.Players[1].PlayerID})
+	}
+	return ids
+}
+
+func TestMatchClosestRating(t *testing.T) {
+	q, clock := newTestQueue()
+	require.NoError(t, q.Join(Ticket{PlayerID: "a", Rating: 1500}))
+	clock.Advance(time.Second)
+	require.NoError(t, q.Join(Ticket{PlayerID: "b", Rating: 1590}))
+	require.NoError(t, q.Join(Ticket{PlayerID: "c", Rating: 1530}))
+	require.NoError(t, q.Join(Ticket{PlayerID: "d", Rating: 1900}))
+
+	assert.ErrorIs(t, q.Join(Ticket{PlayerID: "a", Rating: 1500}), ErrAlreadyQueued)
+
+	matches, expired := q.Match()
+	assert.Empty(t, expired)
+	assert.Equal(t, [][2]string{{"a", "c"}}, matchedIDs(matches), "the longest waiting player gets the closest rating")
+	assert.Equal(t, clock.now.Add(-time.Second), matches[0].Players[0].JoinedAt)
+	assert.Equal(t, 2, q.Len())
+}
+
+func TestWindowWidensOverTime(t *testing.T) {
+	q, clock := newTestQueue()
+	require.NoError(t, q.Join(Ticket{PlayerID: "a", Rating: 1500}))
+	require.NoError(t, q.Join(Ticket{PlayerID: "b", Rating: 1750}))
+
+	tests := []struct {
+		after   time.Duration
+		window  float64
+		matched bool
+	}{
+		{after: 0, window: 100},
+		{after: 10 * time.Second, window: 200},
+		{after: 14 * time.Second, window: 240},
+		{after: 15 * time.Second, window: 250, matched: true},
+	}
+
+	start := clock.now
+	for _, tt := range tests {
+		clock.now = start.Add(tt.after)
+		assert.Equal(t, tt.window, q.Window(start))
+
+		matches, _ := q.Match()
+		assert.Equal(t, tt.matched, len(matches) == 1, "after %s", tt.after)
+	}
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, DefaultOptions().MaxWindow, q.Window(start))
+}
+
+func TestWindowMustSuitBothPlayers(t *testing.T) {
+	q, clock := newTestQueue()
+	require.NoError(t, q.Join(Ticket{PlayerID: "veteran", Rating: 1500}))
+	clock.Advance(20 * time.Second)
+	require.NoError(t, q.Join(Ticket{PlayerID: "newcomer", Rating: 1750}))
+
+	matches, _ := q.Match()
+	assert.Empty(t, matches, "the newcomer's window is still narrow")
+
+	clock.Advance(15 * time.Second)
+	matches, _ = q.Match()
+	assert.Equal(t, [][2]string{{"veteran", "newcomer"}}, matchedIDs(matches))
+}
+
+func TestTimeoutAndLeave(t *testing.T) {
+	q, clock := newTestQueue()
+	require.NoError(t, q.Join(Ticket{PlayerID: "a", Rating: 1000}))
+	clock.Advance(time.Minute)
+	require.NoError(t, q.Join(Ticket{PlayerID: "b", Rating: 2000}))
+	require.NoError(t, q.Join(Ticket{PlayerID: "c", Rating: 2100}))
+
+	assert.True(t, q.Leave("c"))
+	assert.False(t, q.Leave("c"))
+
+	clock.Advance(time.Minute)
+	matches, expired := q.Match()
+	assert.Empty(t, matches)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "a", expired[0].PlayerID)
+	assert.Equal(t, 1, q.Len())
+
+	// A returning ticket keeps its original place in the queue.
+	require.NoError(t, q.Join(Ticket{PlayerID: "c", Rating: 2100, JoinedAt: clock.now.Add(-2 * time.Minute)}))
+	_, expired = q.Match()
+	require.Len(t, expired, 1)
+	assert.Equal(t, "c", expired[0].PlayerID)
+}
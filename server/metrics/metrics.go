@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Labels are restricted to bounded sets such as route templates, game types
+// and status codes. Never label with user IDs, usernames or raw paths.
+
+var (
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests processed, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	MongoCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongodb_command_duration_seconds",
+		Help:    "MongoDB command latency, by command name and outcome.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command", "outcome"})
+
+	GamesSaved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "minesweeper_games_saved_total",
+		Help: "Game records submitted, by game type and player kind (guest or registered).",
+	}, []string{"game_type", "player"})
+
+	UsersRegistered = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "minesweeper_users_registered_total",
+		Help: "Accounts created.",
+	})
+
+	GuestSessions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "minesweeper_guest_sessions_total",
+		Help: "Guest sessions created.",
+	})
+
+	LeaderboardUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "minesweeper_leaderboard_updates_total",
+		Help: "Leaderboard entries created or improved, by game type.",
+	}, []string{"game_type"})
+
+	LiveConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "minesweeper_live_connections",
+		Help: "Open live game WebSocket connections.",
+	})
+
+	LiveSessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "minesweeper_live_sessions",
+		Help: "Live game sessions held in memory, connected or awaiting resume.",
+	})
+
+	LiveCommands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "minesweeper_live_commands_total",
+		Help: "Live game commands received, by command type.",
+	}, []string{"command"})
+
+	LiveSlowConsumers = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "minesweeper_live_slow_consumers_total",
+		Help: "Live connections closed because the client could not keep up.",
+	})
+
+	LiveSpectators = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "minesweeper_live_spectators",
+		Help: "Spectators watching public live game sessions.",
+	})
+
+	LiveLobbies = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "minesweeper_live_lobbies",
+		Help: "Multiplayer race lobbies, waiting or racing.",
+	})
+
+	LiveRooms = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "minesweeper_live_coop_rooms",
+		Help: "Co-op rooms sharing an infinite board.",
+	})
+
+	MatchmakingQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "minesweeper_matchmaking_queued",
+		Help: "Players waiting in the ranked matchmaking queue.",
+	})
+
+	MatchmakingOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "minesweeper_matchmaking_outcomes_total",
+		Help: "Players leaving the matchmaking queue without cancelling, by outcome (matched or timed_out).",
+	}, []string{"outcome"})
+
+	DailyAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "minesweeper_daily_attempts_total",
+		Help: "Daily challenge attempts started (playing) and ended (won, lost or abandoned).",
+	}, []string{"state"})
+
+	RacesFinished = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "minesweeper_races_finished_total",
+		Help: "Multiplayer races that ended with a winner.",
+	})
+
+	PubSubDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "minesweeper_pubsub_dropped_subscribers_total",
+		Help: "In-process subscriptions closed because the subscriber fell behind.",
+	})
+
+	StreamSubscribers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "minesweeper_stream_subscribers",
+		Help: "Open Server-Sent Events streams, by stream.",
+	}, []string{"stream"})
+)
+
+// PlayerKind returns the "player" label value for GamesSaved.
+func PlayerKind(isGuest bool) string {
+	if isGuest {
+		return "guest"
+	}
+	return "registered"
+}
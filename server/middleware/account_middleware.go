@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+)
+
+// ErrAccountNotFound is returned by an AccountLookup for users that do not
+// exist, such as deleted accounts.
+var ErrAccountNotFound = errors.New("account not found")
+
+// Account is the current state of a registered user, which may have changed
+// since their token was issued.
+type Account struct {
+	Role   string
+	Banned bool
+}
+
+// AccountLookup loads the current state of the registered user userID.
+type AccountLookup func(ctx context.Context, userID string) (Account, error)
+
+// AccountMiddleware replaces the role in a registered user's token with
+// their current role and turns away banned users, so that demotions and bans
+// take effect before the token expires. It must be installed after one of
+// the auth middlewares; anonymous requests and guests pass through.
+func AccountMiddleware(lookup AccountLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" || c.GetBool("is_guest") {
+			c.Next()
+			return
+		}
+
+		account, err := lookup(c.Request.Context(), userID)
+		switch {
+		case errors.Is(err, ErrAccountNotFound):
+			c.Error(apierror.Unauthorized(apierror.CodeInvalidToken, "Invalid token"))
+			c.Abort()
+			return
+		case err != nil:
+			c.Error(apierror.Internal("Failed to load account", err))
+			c.Abort()
+			return
+		case account.Banned:
+			c.Error(apierror.Forbidden(apierror.CodeAccountBanned, "This account has been banned"))
+			c.Abort()
+			return
+		}
+
+		if account.Role == "" {
+			account.Role = models.RoleUser
+		}
+		c.Set("role", account.Role)
+		c.Next()
+	}
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		claims         jwt.MapClaims
+		account        Account
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Current Admin",
+			claims:         jwt.MapClaims{"user_id": "admin123", "role": models.RoleAdmin},
+			account:        Account{Role: models.RoleAdmin},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Promoted Since Token Was Issued",
+			claims:         jwt.MapClaims{"user_id": "user123"},
+			account:        Account{Role: models.RoleAdmin},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Demoted Since Token Was Issued",
+			claims:         jwt.MapClaims{"user_id": "admin123", "role": models.RoleAdmin},
+			account:        Account{Role: models.RoleUser},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"error":"Insufficient permissions","code":"forbidden"}`,
+		},
+		{
+			name:           "Banned Since Token Was Issued",
+			claims:         jwt.MapClaims{"user_id": "admin123", "role": models.RoleAdmin},
+			account:        Account{Role: models.RoleAdmin, Banned: true},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"error":"This account has been banned","code":"account_banned"}`,
+		},
+		{
+			name:           "Deleted Account",
+			claims:         jwt.MapClaims{"user_id": "admin123", "role": models.RoleAdmin},
+			err:            ErrAccountNotFound,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"error":"Invalid token","code":"invalid_token"}`,
+		},
+		{
+			name:           "Lookup Failure",
+			claims:         jwt.MapClaims{"user_id": "admin123", "role": models.RoleAdmin},
+			err:            errors.New("connection refused"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup := func(_ context.Context, userID string) (Account, error) {
+				assert.Equal(t, tt.claims["user_id"], userID)
+				return tt.account, tt.err
+			}
+
+			router := gin.New()
+			router.Use(ErrorHandler(slog.New(slog.NewTextHandler(io.Discard, nil))))
+			router.GET("/admin", AuthMiddleware("test-secret-key"), AccountMiddleware(lookup), RequireRole(models.RoleAdmin), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.Header.Set("Authorization", "Bearer "+signedToken(t, tt.claims))
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestAccountMiddlewareSkipsGuestsAndAnonymous(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	lookup := func(context.Context, string) (Account, error) {
+		t.Error("guests and anonymous viewers have no account to look up")
+		return Account{}, nil
+	}
+	router := gin.New()
+	router.Use(ErrorHandler(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	router.GET("/viewer", OptionalAuthMiddleware("test-secret-key"), AccountMiddleware(lookup), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, header := range []string{"", "Bearer " + signedToken(t, jwt.MapClaims{"user_id": "guest123", "guest": true})} {
+		req := httptest.NewRequest(http.MethodGet, "/viewer", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+}
+
+func signedToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret-key"))
+	require.NoError(t, err)
+	return token
+}
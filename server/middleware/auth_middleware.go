@@ -2,59 +2,99 @@ package middleware
 
 import (
 	"fmt"
-	"net/http"
-	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/models"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+			c.Error(apierror.Unauthorized(apierror.CodeMissingToken, "Authorization header is required"))
 			c.Abort()
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
+			c.Error(apierror.Unauthorized(apierror.CodeInvalidToken, "Authorization header format must be Bearer {token}"))
 			c.Abort()
 			return
 		}
 
-		tokenString := parts[1]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		authenticate(c, jwtSecret, parts[1])
+	}
+}
 
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+// OptionalAuthMiddleware authenticates requests that carry an Authorization
+// header like AuthMiddleware and lets anonymous requests through without a
+// user_id.
+func OptionalAuthMiddleware(jwtSecret string) gin.HandlerFunc {
+	required := AuthMiddleware(jwtSecret)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
 			return
 		}
+		required(c)
+	}
+}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userID := claims["user_id"].(string)
-			c.Set("user_id", userID)
+// WebSocketAuthMiddleware behaves like AuthMiddleware but also accepts the
+// token in the access_token query parameter, because browsers cannot set
+// headers on WebSocket handshakes.
+func WebSocketAuthMiddleware(jwtSecret string) gin.HandlerFunc {
+	fromHeader := AuthMiddleware(jwtSecret)
+	return func(c *gin.Context) {
+		token := c.Query("access_token")
+		if token == "" || c.GetHeader("Authorization") != "" {
+			fromHeader(c)
+			return
+		}
+		authenticate(c, jwtSecret, token)
+	}
+}
 
-			if isGuest, exists := claims["guest"]; exists {
-				c.Set("is_guest", isGuest.(bool))
-			} else {
-				c.Set("is_guest", false)
-			}
+// authenticate validates tokenString and stores its claims in the context,
+// aborting with 401 when it is not valid.
+func authenticate(c *gin.Context, jwtSecret string, tokenString string) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(jwtSecret), nil
+	})
 
-			c.Next()
+	if err != nil {
+		c.Error(apierror.Unauthorized(apierror.CodeInvalidToken, "Invalid token"))
+		c.Abort()
+		return
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		userID := claims["user_id"].(string)
+		c.Set("user_id", userID)
+
+		if isGuest, exists := claims["guest"]; exists {
+			c.Set("is_guest", isGuest.(bool))
 		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
+			c.Set("is_guest", false)
 		}
+
+		if role, ok := claims["role"].(string); ok && role != "" {
+			c.Set("role", role)
+		} else {
+			c.Set("role", models.RoleUser)
+		}
+
+		c.Next()
+	} else {
+		c.Error(apierror.Unauthorized(apierror.CodeInvalidToken, "Invalid token"))
+		c.Abort()
+		return
 	}
 }
@@ -1,9 +1,10 @@
 package middleware
 
 import (
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
 
@@ -14,7 +15,6 @@ import (
 
 func TestAuthMiddleware(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	os.Setenv("JWT_SECRET", "test-secret-key")
 
 	tests := []struct {
 		name           string
@@ -31,7 +31,7 @@ func TestAuthMiddleware(t *testing.T) {
 			setupAuth: func(req *http.Request) {
 			},
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   `{"error":"Authorization header is required"}`,
+			expectedBody:   `{"error":"Authorization header is required","code":"missing_token"}`,
 		},
 		{
 			name: "Invalid Authorization Format",
@@ -39,7 +39,7 @@ func TestAuthMiddleware(t *testing.T) {
 				req.Header.Set("Authorization", "InvalidFormat token123")
 			},
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   `{"error":"Authorization header format must be Bearer {token}"}`,
+			expectedBody:   `{"error":"Authorization header format must be Bearer {token}","code":"invalid_token"}`,
 		},
 		{
 			name: "Invalid Token",
@@ -47,7 +47,7 @@ func TestAuthMiddleware(t *testing.T) {
 				req.Header.Set("Authorization", "Bearer invalid.token.here")
 			},
 			expectedStatus: http.StatusUnauthorized,
-			expectedBody:   `{"error":"Invalid token"}`,
+			expectedBody:   `{"error":"Invalid token","code":"invalid_token"}`,
 		},
 		{
 			name: "Valid Regular User Token",
@@ -87,7 +87,8 @@ func TestAuthMiddleware(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			router := gin.New()
-			router.Use(AuthMiddleware())
+			router.Use(ErrorHandler(slog.New(slog.NewTextHandler(io.Discard, nil))))
+			router.Use(AuthMiddleware("test-secret-key"))
 
 			router.GET("/test", func(c *gin.Context) {
 				userID, exists := c.Get("user_id")
@@ -117,3 +118,121 @@ func TestAuthMiddleware(t *testing.T) {
 	}
 
 }
+
+func TestWebSocketAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "user123",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	tokenString, _ := token.SignedString([]byte("test-secret-key"))
+
+	tests := []struct {
+		name           string
+		path           string
+		header         string
+		expectedStatus int
+	}{
+		{
+			name:           "Query Token",
+			path:           "/test?access_token=" + tokenString,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Header Token",
+			path:           "/test",
+			header:         "Bearer " + tokenString,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid Query Token",
+			path:           "/test?access_token=invalid.token.here",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "No Token",
+			path:           "/test",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(ErrorHandler(slog.New(slog.NewTextHandler(io.Discard, nil))))
+			router.Use(WebSocketAuthMiddleware("test-secret-key"))
+
+			router.GET("/test", func(c *gin.Context) {
+				assert.Equal(t, "user123", c.GetString("user_id"))
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+		})
+	}
+}
+
+func TestOptionalAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "user123",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	tokenString, _ := token.SignedString([]byte("test-secret-key"))
+
+	tests := []struct {
+		name           string
+		header         string
+		expectedStatus int
+		expectedUserID string
+	}{
+		{
+			name:           "Anonymous",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Valid Token",
+			header:         "Bearer " + tokenString,
+			expectedStatus: http.StatusOK,
+			expectedUserID: "user123",
+		},
+		{
+			name:           "Invalid Token",
+			header:         "Bearer invalid.token.here",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(ErrorHandler(slog.New(slog.NewTextHandler(io.Discard, nil))))
+			router.Use(OptionalAuthMiddleware("test-secret-key"))
+
+			router.GET("/test", func(c *gin.Context) {
+				assert.Equal(t, tt.expectedUserID, c.GetString("user_id"))
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+		})
+	}
+}
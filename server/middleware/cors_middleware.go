@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CORSConfig struct {
+	// AllowedOrigins holds exact origins such as "https://example.com",
+	// wildcard subdomain patterns such as "https://*.example.com", or "*".
+	// Config validation rejects "*" together with AllowCredentials, which
+	// would let any site send credentialed requests.
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// CORSMiddleware answers preflight requests and echoes the request origin
+// back only when it matches one of the allowed origins. Origins that do not
+// match receive no CORS headers, so the browser blocks the response.
+func CORSMiddleware(cfg CORSConfig) gin.HandlerFunc {
+	allowedMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+
+		isPreflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if isPreflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if !OriginAllowed(cfg.AllowedOrigins, origin) {
+			if isPreflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+		if cfg.AllowCredentials {
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !isPreflight {
+			c.Next()
+			return
+		}
+
+		if !slices.Contains(cfg.AllowedMethods, strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		c.Writer.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+		if allowedHeaders != "" {
+			c.Writer.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+		}
+		if cfg.MaxAge > 0 {
+			c.Writer.Header().Set("Access-Control-Max-Age", maxAge)
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// OriginAllowed reports whether origin matches one of the allowed origin
+// patterns described on CORSConfig.
+func OriginAllowed(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+
+		scheme, domain, ok := strings.Cut(pattern, "://*.")
+		if !ok {
+			continue
+		}
+
+		prefix := scheme + "://"
+		suffix := "." + domain
+		if len(origin) <= len(prefix)+len(suffix) ||
+			!strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+			continue
+		}
+
+		subdomain := origin[len(prefix) : len(origin)-len(suffix)]
+		if subdomain != "" && !strings.ContainsAny(subdomain, "/:@") {
+			return true
+		}
+	}
+	return false
+}
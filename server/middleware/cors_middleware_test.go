@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := CORSConfig{
+		AllowedOrigins:   []string{"http://localhost:5173", "https://*.onrender.com"},
+		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		origin          string
+		requestMethod   string
+		expectedStatus  int
+		expectedOrigin  string
+		expectedMethods string
+		expectedMaxAge  string
+	}{
+		{
+			name:           "No Origin",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Exact Origin",
+			method:         http.MethodGet,
+			origin:         "http://localhost:5173",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "http://localhost:5173",
+		},
+		{
+			name:           "Wildcard Subdomain",
+			method:         http.MethodGet,
+			origin:         "https://infinite-minesweeper.onrender.com",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "https://infinite-minesweeper.onrender.com",
+		},
+		{
+			name:           "Wildcard Does Not Match Apex Domain",
+			method:         http.MethodGet,
+			origin:         "https://onrender.com",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Wildcard Does Not Match Other Scheme",
+			method:         http.MethodGet,
+			origin:         "http://staging.onrender.com",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Disallowed Origin",
+			method:         http.MethodGet,
+			origin:         "https://evil.example.com",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:            "Preflight Allowed",
+			method:          http.MethodOptions,
+			origin:          "http://localhost:5173",
+			requestMethod:   "POST",
+			expectedStatus:  http.StatusNoContent,
+			expectedOrigin:  "http://localhost:5173",
+			expectedMethods: "GET, POST, OPTIONS",
+			expectedMaxAge:  "3600",
+		},
+		{
+			name:           "Preflight Disallowed Origin",
+			method:         http.MethodOptions,
+			origin:         "https://evil.example.com",
+			requestMethod:  "POST",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Preflight Disallowed Method",
+			method:         http.MethodOptions,
+			origin:         "http://localhost:5173",
+			requestMethod:  "DELETE",
+			expectedStatus: http.StatusForbidden,
+			expectedOrigin: "http://localhost:5173",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(CORSMiddleware(cfg))
+
+			router.GET("/test", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(tt.method, "/test", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+			assert.Equal(t, tt.expectedOrigin, resp.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.expectedMethods, resp.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, tt.expectedMaxAge, resp.Header().Get("Access-Control-Max-Age"))
+
+			if tt.expectedOrigin != "" {
+				assert.Equal(t, "true", resp.Header().Get("Access-Control-Allow-Credentials"))
+			}
+			if tt.origin != "" {
+				assert.Contains(t, resp.Header().Values("Vary"), "Origin")
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeprecationPolicy struct {
+	// Since is when the routes were deprecated. When zero the Deprecation
+	// header is sent as "true".
+	Since time.Time
+	// Sunset is when the routes will be removed, or zero if not scheduled.
+	Sunset time.Time
+	// Successor maps a request path to the equivalent path in the version
+	// that replaces it. It is optional.
+	Successor func(path string) string
+}
+
+// Deprecated marks responses as coming from a deprecated API version using
+// the Deprecation (RFC 9745) and Sunset (RFC 8594) headers, and points clients
+// at the replacement route with a successor-version link.
+func Deprecated(policy DeprecationPolicy) gin.HandlerFunc {
+	deprecation := "true"
+	if !policy.Since.IsZero() {
+		deprecation = "@" + strconv.FormatInt(policy.Since.Unix(), 10)
+	}
+
+	var sunset string
+	if !policy.Sunset.IsZero() {
+		sunset = policy.Sunset.UTC().Format(http.TimeFormat)
+	}
+
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		header.Set("Deprecation", deprecation)
+		if sunset != "" {
+			header.Set("Sunset", sunset)
+		}
+		if policy.Successor != nil {
+			header.Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", policy.Successor(c.Request.URL.Path)))
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeprecated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name               string
+		policy             DeprecationPolicy
+		expectedDeprecated string
+		expectedSunset     string
+		expectedLink       string
+	}{
+		{
+			name:               "Undated",
+			policy:             DeprecationPolicy{},
+			expectedDeprecated: "true",
+		},
+		{
+			name: "Dated With Sunset",
+			policy: DeprecationPolicy{
+				Since:  time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+				Sunset: time.Date(2027, 4, 1, 0, 0, 0, 0, time.UTC),
+			},
+			expectedDeprecated: "@1792368000",
+			expectedSunset:     "Thu, 01 Apr 2027 00:00:00 GMT",
+		},
+		{
+			name: "Successor Link",
+			policy: DeprecationPolicy{
+				Successor: func(path string) string {
+					return "/api/v1" + strings.TrimPrefix(path, "/api")
+				},
+			},
+			expectedDeprecated: "true",
+			expectedLink:       `</api/v1/test>; rel="successor-version"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(Deprecated(tt.policy))
+			router.GET("/api/test", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tt.expectedDeprecated, resp.Header().Get("Deprecation"))
+			assert.Equal(t, tt.expectedSunset, resp.Header().Get("Sunset"))
+			assert.Equal(t, tt.expectedLink, resp.Header().Get("Link"))
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/logging"
+)
+
+// ErrorHandler renders the last error attached with c.Error as the standard
+// error response. Server errors are logged with their cause; the client only
+// sees the generic message and code.
+func ErrorHandler(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		apiErr := apierror.From(c.Errors.Last().Err)
+
+		if apiErr.Status >= http.StatusInternalServerError {
+			logging.ForRequest(c, logger).Error(apiErr.Message,
+				slog.String("code", string(apiErr.Code)),
+				slog.Any("error", apiErr.Cause),
+			)
+		} else {
+			logging.ForRequest(c, logger).Debug(apiErr.Message,
+				slog.String("code", string(apiErr.Code)),
+				slog.Int("status", apiErr.Status),
+			)
+		}
+
+		c.JSON(apiErr.Status, apiErr.Response())
+	}
+}
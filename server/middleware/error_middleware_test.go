@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type loginRequest struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required,min=8"`
+	}
+
+	tests := []struct {
+		name           string
+		handler        gin.HandlerFunc
+		body           string
+		expectedStatus int
+		expectedBody   string
+		expectLog      bool
+	}{
+		{
+			name: "API Error",
+			handler: func(c *gin.Context) {
+				c.Error(apierror.NotFound("User not found"))
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"User not found","code":"not_found"}`,
+		},
+		{
+			name: "Internal Error Hides Cause",
+			handler: func(c *gin.Context) {
+				c.Error(apierror.Internal("Failed to load user", errors.New("connection reset by peer")))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Failed to load user","code":"internal_error"}`,
+			expectLog:      true,
+		},
+		{
+			name: "Plain Error Treated As Internal",
+			handler: func(c *gin.Context) {
+				c.Error(errors.New("unexpected"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":"Internal server error","code":"internal_error"}`,
+			expectLog:      true,
+		},
+		{
+			name: "Validation Details Use JSON Field Names",
+			handler: func(c *gin.Context) {
+				var req loginRequest
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.Error(apierror.FromBinding(err))
+				}
+			},
+			body:           `{"password":"short"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: `{"error":"Request validation failed","code":"validation_failed","details":[
+				{"field":"username","reason":"required"},
+				{"field":"password","reason":"min"}
+			]}`,
+		},
+		{
+			name: "Malformed JSON",
+			handler: func(c *gin.Context) {
+				var req loginRequest
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.Error(apierror.FromBinding(err))
+				}
+			},
+			body:           `{"username":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Request body is not valid JSON","code":"invalid_request"}`,
+		},
+		{
+			name: "Handler Already Responded",
+			handler: func(c *gin.Context) {
+				c.Error(errors.New("ignored"))
+				c.JSON(http.StatusAccepted, gin.H{"message": "ok"})
+			},
+			expectedStatus: http.StatusAccepted,
+			expectedBody:   `{"message":"ok"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			router := gin.New()
+			router.Use(ErrorHandler(slog.New(slog.NewJSONHandler(&logs, nil))))
+			router.POST("/test", tt.handler)
+
+			req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+			assert.JSONEq(t, tt.expectedBody, resp.Body.String())
+
+			if tt.expectLog {
+				var entry map[string]any
+				require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+				assert.Equal(t, "ERROR", entry["level"])
+				assert.Equal(t, "/test", entry["route"])
+				assert.NotEmpty(t, entry["error"])
+			} else {
+				assert.Empty(t, logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/logging"
+)
+
+// RequestLogger writes one access log line per request. It replaces gin's
+// default text logger.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		logging.ForRequest(c, logger).LogAttrs(c.Request.Context(), level, "request",
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		)
+	}
+}
+
+// Recovery turns panics into 500 responses and logs them with the stack.
+func Recovery(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				logging.ForRequest(c, logger).Error("panic recovered",
+					slog.Any("panic", recovered),
+					slog.String("stack", string(debug.Stack())),
+				)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, apierror.Internal("Internal server error", nil).Response())
+			}
+		}()
+
+		c.Next()
+	}
+}
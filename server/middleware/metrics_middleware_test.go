@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(MetricsMiddleware())
+	router.GET("/users/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	matched := metrics.HTTPRequestsTotal.WithLabelValues("GET", "/users/:id", "200")
+	unmatched := metrics.HTTPRequestsTotal.WithLabelValues("OTHER", "unmatched", "404")
+	matchedBefore := testutil.ToFloat64(matched)
+	unmatchedBefore := testutil.ToFloat64(unmatched)
+
+	for _, path := range []string{"/users/1", "/users/2"} {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest("PROPFIND", "/does-not-exist", nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	assert.Equal(t, matchedBefore+2, testutil.ToFloat64(matched), "requests should be labelled by route template, not raw path")
+	assert.Equal(t, unmatchedBefore+1, testutil.ToFloat64(unmatched))
+}
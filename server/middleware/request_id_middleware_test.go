@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		incoming   string
+		expectSame bool
+	}{
+		{
+			name:       "Generated When Missing",
+			incoming:   "",
+			expectSame: false,
+		},
+		{
+			name:       "Propagated When Valid",
+			incoming:   "lb-7f3a9c12_abc.1",
+			expectSame: true,
+		},
+		{
+			name:       "Replaced When Malformed",
+			incoming:   "bad id\nwith newline",
+			expectSame: false,
+		},
+		{
+			name:       "Replaced When Too Long",
+			incoming:   strings.Repeat("a", 129),
+			expectSame: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(RequestIDMiddleware())
+
+			var seen string
+			router.GET("/test", func(c *gin.Context) {
+				seen = c.GetString("request_id")
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			header := resp.Header().Get(RequestIDHeader)
+			assert.NotEmpty(t, header)
+			assert.Equal(t, header, seen)
+			if tt.expectSame {
+				assert.Equal(t, tt.incoming, header)
+			} else {
+				assert.NotEqual(t, tt.incoming, header)
+				assert.Len(t, header, 32)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+)
+
+// RequireRole only lets through requests from users with one of the given
+// roles. It must be installed after AuthMiddleware and AccountMiddleware,
+// which set the user's current role.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.Error(apierror.Forbidden(apierror.CodeForbidden, "Insufficient permissions"))
+		c.Abort()
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		role           string
+		setRole        bool
+		expectedStatus int
+	}{
+		{
+			name:           "Admin Allowed",
+			role:           "admin",
+			setRole:        true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Regular User Forbidden",
+			role:           "user",
+			setRole:        true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Missing Role Forbidden",
+			setRole:        false,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(ErrorHandler(slog.New(slog.NewTextHandler(io.Discard, nil))))
+			router.Use(func(c *gin.Context) {
+				if tt.setRole {
+					c.Set("role", tt.role)
+				}
+				c.Next()
+			})
+			router.Use(RequireRole("admin"))
+
+			router.GET("/test", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+			if tt.expectedStatus == http.StatusForbidden {
+				assert.JSONEq(t, `{"error":"Insufficient permissions","code":"forbidden"}`, resp.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// PlayerStats are running totals over the games a registered player
+// finished in live sessions, kept for achievements. WinStreak counts consecutive normal games won;
+// infinite games cannot be won and leave it alone.
+type PlayerStats struct {
+	GamesPlayed int `bson:"games_played" json:"games_played"`
+	GamesWon    int `bson:"games_won" json:"games_won"`
+	WinStreak   int `bson:"win_streak" json:"win_streak"`
+}
+
+// FinishedGame is a game a registered player finished in a live session,
+// as the server saw it played. It counts towards their stats and
+// achievements.
+type FinishedGame struct {
+	PlayerID      string
+	GameType      string
+	Won           bool
+	Score         int
+	TimeInSeconds int
+	CellsRevealed int
+	FlagsPlaced   int
+	FinishedAt    time.Time
+}
+
+// UnlockedAchievement records when a player unlocked an achievement. Name is
+// filled in when the achievement is shown on a profile.
+type UnlockedAchievement struct {
+	ID         string    `bson:"id" json:"id"`
+	Name       string    `bson:"-" json:"name,omitempty"`
+	UnlockedAt time.Time `bson:"unlocked_at" json:"unlocked_at"`
+}
+
+// Achievement describes an achievement with how many players have unlocked
+// it. UnlockedAt is set when the signed in viewer has unlocked it.
+type Achievement struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Unlocked    int64      `json:"unlocked"`
+	Percentage  float64    `json:"percentage"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty"`
+}
+
+type AchievementListResponse struct {
+	Achievements []Achievement `json:"achievements"`
+	Players      int64         `json:"players"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AuditEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Type      string             `bson:"type" json:"type"`
+	ActorID   string             `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	TargetID  string             `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	IP        string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	Payload   map[string]any     `bson:"payload,omitempty" json:"payload,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
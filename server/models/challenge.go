@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Challenge states. The challenger plays first while the challenge is
+// pending; it is then open to the opponent until it expires, and completed
+// once the opponent's game is over.
+const (
+	ChallengePending   = "pending"
+	ChallengeOpen      = "open"
+	ChallengePlaying   = "playing"
+	ChallengeCompleted = "completed"
+	ChallengeDeclined  = "declined"
+	ChallengeExpired   = "expired"
+)
+
+// Challenge asks one player to beat another's result on the same board.
+// A challenge without an OpponentID is a link challenge, which the first
+// other player to open it takes up.
+type Challenge struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	GameType     string             `bson:"game_type" json:"game_type"`
+	Seed         int64              `bson:"seed" json:"seed,omitempty"`
+	ChallengerID string             `bson:"challenger_id" json:"challenger_id"`
+	OpponentID   string             `bson:"opponent_id,omitempty" json:"opponent_id,omitempty"`
+	// Usernames are looked up when the challenge is read so that they
+	// follow renames.
+	ChallengerName string           `bson:"-" json:"challenger_name,omitempty"`
+	OpponentName   string           `bson:"-" json:"opponent_name,omitempty"`
+	State          string           `bson:"state" json:"state"`
+	Challenger     *ChallengeResult `bson:"challenger,omitempty" json:"challenger,omitempty"`
+	Opponent       *ChallengeResult `bson:"opponent,omitempty" json:"opponent,omitempty"`
+	// WinnerID is empty for a draw.
+	WinnerID    string     `bson:"winner_id,omitempty" json:"winner_id,omitempty"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	ExpiresAt   time.Time  `bson:"expires_at" json:"expires_at"`
+	CompletedAt *time.Time `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// ChallengeResult is one side's game in a challenge. The challenger's
+// replay is attached so the opponent can watch it once they have played.
+type ChallengeResult struct {
+	State         string       `bson:"state" json:"state"`
+	Score         int          `bson:"score" json:"score"`
+	TimeInSeconds int          `bson:"time_in_seconds" json:"time_in_seconds"`
+	StartedAt     time.Time    `bson:"started_at" json:"started_at"`
+	FinishedAt    *time.Time   `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	Replay        []ReplayMove `bson:"replay,omitempty" json:"replay,omitempty"`
+}
+
+// ReplayMove is a move made AtMS milliseconds into a game.
+type ReplayMove struct {
+	Type string `bson:"type" json:"type"`
+	X    int    `bson:"x" json:"x"`
+	Y    int    `bson:"y" json:"y"`
+	AtMS int64  `bson:"at_ms" json:"at_ms"`
+}
+
+// ChallengeGame is a player's game in a challenge, played over the live
+// channel.
+type ChallengeGame struct {
+	ChallengeID   string
+	PlayerID      string
+	Challenger    bool
+	GameType      string
+	Seed          int64
+	State         string
+	Score         int
+	TimeInSeconds int
+	StartedAt     time.Time
+	FinishedAt    *time.Time
+	Replay        []ReplayMove
+}
+
+type CreateChallengeRequest struct {
+	// Username names the opponent. Without it anyone with the challenge's
+	// link may take it up.
+	Username string `json:"username"`
+	GameType string `json:"game_type" binding:"required,oneof=normal infinite"`
+	// Seed optionally fixes the board; otherwise a random one is used.
+	Seed *int64 `json:"seed"`
+}
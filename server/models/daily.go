@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// States of a scored game played over the live channel, such as a daily
+// challenge attempt or a tournament game. A game that was never finished,
+// because the player replaced or abandoned it, ends as abandoned.
+const (
+	AttemptPlaying   = "playing"
+	AttemptWon       = "won"
+	AttemptLost      = "lost"
+	AttemptAbandoned = "abandoned"
+)
+
+// DailyAttempt is a player's single attempt at a daily challenge. Every
+// player of a game type gets the board generated from the same Seed on Date.
+// Registered players are identified by UserID and guests by GuestID.
+// Anyone can mint a new guest ID, so guest attempts are kept but never
+// ranked.
+type DailyAttempt struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Date     string             `bson:"date" json:"date"`
+	GameType string             `bson:"game_type" json:"game_type"`
+	// Seed is left out of responses until the day is over.
+	Seed          int64      `bson:"seed" json:"seed,omitempty"`
+	UserID        string     `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	GuestID       string     `bson:"guest_id,omitempty" json:"guest_id,omitempty"`
+	Username      string     `bson:"username" json:"username"`
+	IsGuest       bool       `bson:"is_guest" json:"is_guest"`
+	State         string     `bson:"state" json:"state"`
+	Score         int        `bson:"score" json:"score"`
+	TimeInSeconds int        `bson:"time_in_seconds" json:"time_in_seconds"`
+	StartedAt     time.Time  `bson:"started_at" json:"started_at"`
+	FinishedAt    *time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// PlayerID returns the user or guest ID the attempt belongs to.
+func (a DailyAttempt) PlayerID() string {
+	if a.IsGuest {
+		return a.GuestID
+	}
+	return a.UserID
+}
+
+// DailySummary describes one archived daily challenge.
+type DailySummary struct {
+	Date        string `bson:"date" json:"date"`
+	GameType    string `bson:"game_type" json:"game_type"`
+	Seed        int64  `bson:"seed" json:"seed"`
+	Players     int    `bson:"players" json:"players"`
+	TopScore    int    `bson:"top_score" json:"top_score"`
+	TopUsername string `bson:"top_username" json:"top_username"`
+}
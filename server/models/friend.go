@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Friendship states. A friend request is pending until the addressee
+// accepts it; declining or removing a friend deletes the friendship.
+const (
+	FriendshipPending  = "pending"
+	FriendshipAccepted = "accepted"
+)
+
+// Friendship links two registered users. Its ID is derived from both user
+// IDs, so there is at most one friendship or request between two users.
+type Friendship struct {
+	ID          string     `bson:"_id" json:"-"`
+	Users       []string   `bson:"users" json:"-"`
+	RequesterID string     `bson:"requester_id" json:"requester_id"`
+	AddresseeID string     `bson:"addressee_id" json:"addressee_id"`
+	State       string     `bson:"state" json:"state"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	AcceptedAt  *time.Time `bson:"accepted_at,omitempty" json:"accepted_at,omitempty"`
+}
+
+// Block stops BlockedID from sending BlockerID friend requests or seeing
+// them on leaderboards.
+type Block struct {
+	ID        string    `bson:"_id" json:"-"`
+	BlockerID string    `bson:"blocker_id" json:"blocker_id"`
+	BlockedID string    `bson:"blocked_id" json:"blocked_id"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Friend is another user as listed by the friends endpoint. Since is when
+// the friendship was accepted, the request sent or the user blocked.
+type Friend struct {
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username"`
+	Since    time.Time `json:"since"`
+}
+
+type FriendRequestRequest struct {
+	Username string `json:"username" binding:"required"`
+}
@@ -16,6 +16,9 @@ type LeaderboardEntry struct {
 	Username      string             `bson:"username,omitempty" json:"username,omitempty"`
 	GuestID       string             `bson:"guest_id,omitempty" json:"guest_id,omitempty"`
 	IsGuest       bool               `bson:"is_guest" json:"is_guest"`
+	Hidden        bool               `bson:"hidden,omitempty" json:"hidden,omitempty"`
+	// Profile is the path of the public profile of a registered player.
+	Profile string `bson:"-" json:"profile,omitempty"`
 }
 
 type LeaderboardResponse struct {
@@ -34,3 +37,15 @@ type LeaderboardStats struct {
 	AverageScore      int    `json:"average_score"`
 	GameType          string `json:"game_type"`
 }
+
+// LeaderboardEntryEvent is streamed when an entry is added to the
+// leaderboard or its score changes.
+type LeaderboardEntryEvent struct {
+	Entry LeaderboardEntry `json:"entry"`
+	Rank  int64            `json:"rank"`
+}
+
+// LeaderboardRemovedEvent is streamed when an entry is deleted or hidden.
+type LeaderboardRemovedEvent struct {
+	ID string `json:"id"`
+}
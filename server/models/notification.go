@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification is an entry in a player's inbox. Data carries the IDs and
+// names a client needs to link the notification to what it is about.
+type Notification struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    string             `bson:"user_id" json:"-"`
+	Type      string             `bson:"type" json:"type"`
+	Message   string             `bson:"message" json:"message"`
+	Data      map[string]string  `bson:"data,omitempty" json:"data,omitempty"`
+	Read      bool               `bson:"read" json:"read"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	ReadAt    *time.Time         `bson:"read_at,omitempty" json:"read_at,omitempty"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Profile section visibilities.
+const (
+	VisibilityPublic  = "public"
+	VisibilityFriends = "friends"
+	VisibilityPrivate = "private"
+)
+
+// Profile sections, as reported in PublicProfile.Hidden.
+const (
+	ProfileSectionPersonalBests = "personal_bests"
+	ProfileSectionAchievements  = "achievements"
+	ProfileSectionRecentGames   = "recent_games"
+	ProfileSectionRank          = "rank"
+)
+
+// PrivacySettings decide who may see each section of a player's public
+// profile. An empty value means public, so accounts created before the
+// settings existed stay visible. The player always sees their whole profile.
+type PrivacySettings struct {
+	PersonalBests string `bson:"personal_bests,omitempty" json:"personal_bests"`
+	Achievements  string `bson:"achievements,omitempty" json:"achievements"`
+	RecentGames   string `bson:"recent_games,omitempty" json:"recent_games"`
+	Rank          string `bson:"rank,omitempty" json:"rank"`
+}
+
+// ProfileRank is a player's place on a leaderboard.
+type ProfileRank struct {
+	GameType string `json:"game_type"`
+	Rank     int64  `json:"rank"`
+	Players  int64  `json:"players"`
+}
+
+// PublicProfile is a player as others see them. Hidden lists the sections
+// the viewer is not allowed to see, which are left out.
+type PublicProfile struct {
+	ID            string                `json:"id"`
+	Username      string                `json:"username"`
+	JoinedAt      time.Time             `json:"joined_at"`
+	PersonalBests []GameRecord          `json:"personal_bests,omitempty"`
+	Achievements  []UnlockedAchievement `json:"achievements,omitempty"`
+	RecentGames   []GameRecord          `json:"recent_games,omitempty"`
+	Ranks         []ProfileRank         `json:"ranks,omitempty"`
+	Hidden        []string              `json:"hidden,omitempty"`
+}
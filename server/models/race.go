@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RaceResult is the outcome of a finished multiplayer race. Every racer
+// played the normal board generated from Seed. Ranked races were set up by
+// matchmaking and update the racers' ratings.
+type RaceResult struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	GameType   string             `bson:"game_type" json:"game_type"`
+	Ranked     bool               `bson:"ranked" json:"ranked"`
+	LobbyID    string             `bson:"lobby_id" json:"lobby_id"`
+	Seed       int64              `bson:"seed" json:"seed"`
+	StartedAt  time.Time          `bson:"started_at" json:"started_at"`
+	FinishedAt time.Time          `bson:"finished_at" json:"finished_at"`
+	WinnerID   string             `bson:"winner_id" json:"winner_id"`
+	Players    []RacePlacement    `bson:"players" json:"players"`
+}
+
+type RacePlacement struct {
+	PlayerID string `bson:"player_id" json:"player_id"`
+	IsGuest  bool   `bson:"is_guest" json:"is_guest"`
+	Place    int    `bson:"place" json:"place"`
+	// Progress is the percentage of safe cells the player revealed.
+	Progress      int    `bson:"progress" json:"progress"`
+	Score         int    `bson:"score" json:"score"`
+	State         string `bson:"state" json:"state"`
+	Forfeited     bool   `bson:"forfeited,omitempty" json:"forfeited,omitempty"`
+	TimeInSeconds int    `bson:"time_in_seconds" json:"time_in_seconds"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PlayerRating is a registered user's Glicko-2 rating in one ranked mode.
+// Guests are never rated.
+type PlayerRating struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID     string             `bson:"user_id" json:"user_id"`
+	Username   string             `bson:"username" json:"username"`
+	Mode       string             `bson:"mode" json:"mode"`
+	Rating     float64            `bson:"rating" json:"rating"`
+	Deviation  float64            `bson:"deviation" json:"deviation"`
+	Volatility float64            `bson:"volatility" json:"volatility"`
+	Matches    int                `bson:"matches" json:"matches"`
+	Wins       int                `bson:"wins" json:"wins"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+	// LastMatchID is the last match applied to the rating, so that a match
+	// rated again is not counted twice.
+	LastMatchID string `bson:"last_match_id,omitempty" json:"-"`
+}
+
+// RatingChange is one ranked match in a user's rating history, holding the
+// rating after the match and how much it moved.
+type RatingChange struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID     string             `bson:"user_id" json:"user_id"`
+	Mode       string             `bson:"mode" json:"mode"`
+	MatchID    string             `bson:"match_id" json:"match_id"`
+	Place      int                `bson:"place" json:"place"`
+	Opponents  int                `bson:"opponents" json:"opponents"`
+	Rating     float64            `bson:"rating" json:"rating"`
+	Deviation  float64            `bson:"deviation" json:"deviation"`
+	Volatility float64            `bson:"volatility" json:"volatility"`
+	Change     float64            `bson:"change" json:"change"`
+	PlayedAt   time.Time          `bson:"played_at" json:"played_at"`
+}
@@ -0,0 +1,109 @@
+package models
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+type GuestSessionResponse struct {
+	Token    string `json:"token"`
+	Username string `json:"username"`
+	Guest    bool   `json:"guest"`
+}
+
+type CurrentUserResponse struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type GameRecordsResponse struct {
+	Records []GameRecord `json:"records"`
+}
+
+type LeaderboardPageResponse struct {
+	Leaderboard []LeaderboardEntry `json:"leaderboard"`
+	Total       int64              `json:"total"`
+	GameType    string             `json:"game_type"`
+	Scope       string             `json:"scope,omitempty"`
+}
+
+type UserListResponse struct {
+	Users []User `json:"users"`
+	Total int64  `json:"total"`
+}
+
+type AuditEventListResponse struct {
+	Events []AuditEvent `json:"events"`
+	Total  int64        `json:"total"`
+}
+
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
+type RaceResultListResponse struct {
+	Races []RaceResult `json:"races"`
+	Total int64        `json:"total"`
+}
+
+type RatingListResponse struct {
+	Ratings []PlayerRating `json:"ratings"`
+	Total   int64          `json:"total"`
+	Mode    string         `json:"mode"`
+}
+
+type RatingHistoryResponse struct {
+	History []RatingChange `json:"history"`
+	Total   int64          `json:"total"`
+	Mode    string         `json:"mode"`
+}
+
+// DailyLeaderboardResponse ranks the finished attempts at one daily
+// challenge. Seed is only set once the day is over.
+type DailyLeaderboardResponse struct {
+	Attempts []DailyAttempt `json:"attempts"`
+	Total    int64          `json:"total"`
+	Date     string         `json:"date"`
+	GameType string         `json:"game_type"`
+	Seed     int64          `json:"seed,omitempty"`
+}
+
+type DailyArchiveResponse struct {
+	Days     []DailySummary `json:"days"`
+	Total    int64          `json:"total"`
+	GameType string         `json:"game_type"`
+}
+
+type DailyAttemptListResponse struct {
+	Attempts []DailyAttempt `json:"attempts"`
+	Total    int64          `json:"total"`
+}
+
+type TournamentListResponse struct {
+	Tournaments []Tournament `json:"tournaments"`
+	Total       int64        `json:"total"`
+}
+
+// FriendListResponse lists the authenticated user's friends, the requests
+// sent to them and by them, and the users they have blocked.
+type FriendListResponse struct {
+	Friends  []Friend `json:"friends"`
+	Incoming []Friend `json:"incoming"`
+	Outgoing []Friend `json:"outgoing"`
+	Blocked  []Friend `json:"blocked"`
+}
+
+type ChallengeListResponse struct {
+	Challenges []Challenge `json:"challenges"`
+	Total      int64       `json:"total"`
+}
+
+type NotificationListResponse struct {
+	Notifications []Notification `json:"notifications"`
+	Total         int64          `json:"total"`
+	Unread        int64          `json:"unread"`
+}
+
+type UnreadCountResponse struct {
+	Unread int64 `json:"unread"`
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Tournament states. Registration is open until StartsAt, after which the
+// scheduler runs the rounds one after another.
+const (
+	TournamentRegistering = "registering"
+	TournamentRunning     = "running"
+	TournamentFinished    = "finished"
+	TournamentCancelled   = "cancelled"
+)
+
+// Tournament is stored as a single document that holds everything needed to
+// carry on after a restart. Version increases with every change so that
+// concurrent updates cannot overwrite each other.
+type Tournament struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name     string             `bson:"name" json:"name"`
+	Format   string             `bson:"format" json:"format"`
+	GameType string             `bson:"game_type" json:"game_type"`
+	// RoundCount is fixed when the tournament starts for single
+	// elimination, which plays until one player is left.
+	RoundCount   int `bson:"round_count" json:"round_count"`
+	RoundMinutes int `bson:"round_minutes" json:"round_minutes"`
+	MaxPlayers   int `bson:"max_players" json:"max_players"`
+	// Seeds are the board seeds for the rounds in order. They are kept
+	// secret; each round publishes its seed once it starts.
+	Seeds        []int64            `bson:"seeds" json:"-"`
+	State        string             `bson:"state" json:"state"`
+	StartsAt     time.Time          `bson:"starts_at" json:"starts_at"`
+	CurrentRound int                `bson:"current_round" json:"current_round"`
+	Players      []TournamentPlayer `bson:"players" json:"players"`
+	Rounds       []TournamentRound  `bson:"rounds" json:"rounds"`
+	CreatedBy    string             `bson:"created_by" json:"created_by"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	FinishedAt   *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	Version      int                `bson:"version" json:"-"`
+}
+
+// TournamentPlayer is a registered player's standing. Players are kept in
+// standings order once the tournament has started.
+type TournamentPlayer struct {
+	UserID        string    `bson:"user_id" json:"user_id"`
+	Username      string    `bson:"username" json:"username"`
+	Seed          int       `bson:"seed" json:"seed"`
+	Rank          int       `bson:"rank,omitempty" json:"rank,omitempty"`
+	Points        float64   `bson:"points" json:"points"`
+	Score         int       `bson:"score" json:"score"`
+	TimeInSeconds int       `bson:"time_in_seconds" json:"time_in_seconds"`
+	Opponents     []string  `bson:"opponents,omitempty" json:"opponents,omitempty"`
+	Byes          int       `bson:"byes" json:"byes"`
+	EliminatedIn  int       `bson:"eliminated_in,omitempty" json:"eliminated_in,omitempty"`
+	RegisteredAt  time.Time `bson:"registered_at" json:"registered_at"`
+}
+
+// TournamentRound is a round that has started. Every player in it plays
+// the board generated from Seed before EndsAt.
+type TournamentRound struct {
+	Number   int               `bson:"number" json:"number"`
+	Seed     int64             `bson:"seed" json:"seed"`
+	StartsAt time.Time         `bson:"starts_at" json:"starts_at"`
+	EndsAt   time.Time         `bson:"ends_at" json:"ends_at"`
+	Matches  []TournamentMatch `bson:"matches,omitempty" json:"matches,omitempty"`
+	Closed   bool              `bson:"closed" json:"closed"`
+	// Abandoned lists the players whose game ended unfinished, including
+	// games still open when the round closed, such as those cut off by a
+	// server restart.
+	Abandoned []string `bson:"abandoned,omitempty" json:"abandoned,omitempty"`
+}
+
+// TournamentMatch pairs players within a round. A match with one player is
+// a bye. WinnerID is set when the round closes and left empty for a draw.
+type TournamentMatch struct {
+	Players  []string `bson:"players" json:"players"`
+	WinnerID string   `bson:"winner_id,omitempty" json:"winner_id,omitempty"`
+}
+
+// TournamentGame is a player's game in a tournament round, played over the
+// live channel. Results finished after Deadline do not count.
+type TournamentGame struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TournamentID  string             `bson:"tournament_id" json:"tournament_id"`
+	Round         int                `bson:"round" json:"round"`
+	UserID        string             `bson:"user_id" json:"user_id"`
+	GameType      string             `bson:"game_type" json:"game_type"`
+	Seed          int64              `bson:"seed" json:"seed"`
+	State         string             `bson:"state" json:"state"`
+	Score         int                `bson:"score" json:"score"`
+	TimeInSeconds int                `bson:"time_in_seconds" json:"time_in_seconds"`
+	StartedAt     time.Time          `bson:"started_at" json:"started_at"`
+	FinishedAt    *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	Deadline      time.Time          `bson:"deadline" json:"deadline"`
+}
+
+type CreateTournamentRequest struct {
+	Name     string `json:"name" binding:"required,max=80"`
+	Format   string `json:"format" binding:"required,oneof=single_elimination swiss cumulative"`
+	GameType string `json:"game_type" binding:"required,oneof=normal infinite"`
+	// Rounds is required for Swiss and cumulative tournaments and ignored
+	// for single elimination.
+	Rounds       int       `json:"rounds" binding:"omitempty,min=1,max=20"`
+	RoundMinutes int       `json:"round_minutes" binding:"required,min=1,max=10080"`
+	MaxPlayers   int       `json:"max_players" binding:"omitempty,min=2,max=256"`
+	StartsAt     time.Time `json:"starts_at" binding:"required"`
+	// Seeds optionally fixes the board of each round in order. Rounds
+	// without a seed get a random one.
+	Seeds []int64 `json:"seeds" binding:"max=20"`
+}
@@ -5,13 +5,36 @@ import (
 	"time"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	Username    string             `bson:"username" json:"username" binding:"required"`
 	Password    string             `bson:"password" json:"-" binding:"required"`
+	Role        string             `bson:"role,omitempty" json:"role,omitempty"`
+	Banned      bool               `bson:"banned,omitempty" json:"banned,omitempty"`
 	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
 	GameRecords []GameRecord       `bson:"game_records,omitempty" json:"game_records,omitempty"`
+
+	Stats        PlayerStats           `bson:"stats" json:"stats"`
+	Achievements []UnlockedAchievement `bson:"achievements,omitempty" json:"achievements,omitempty"`
+
+	// RecentGames holds the player's latest saved games, newest first.
+	RecentGames []GameRecord    `bson:"recent_games,omitempty" json:"recent_games,omitempty"`
+	Privacy     PrivacySettings `bson:"privacy" json:"privacy"`
+}
+
+// EffectiveRole returns the user's role, treating accounts created before
+// roles existed as regular users.
+func (u User) EffectiveRole() string {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
 }
 
 type GameRecord struct {
@@ -21,6 +44,12 @@ type GameRecord struct {
 	PlayedAt      time.Time `bson:"played_at" json:"played_at"`
 }
 
+type SaveGameRecordRequest struct {
+	GameType      string `json:"game_type"`
+	Score         int    `json:"score"`
+	TimeInSeconds int    `json:"time_in_seconds"`
+}
+
 type AuthResponse struct {
 	Token    string `json:"token"`
 	Username string `json:"username"`
@@ -35,3 +64,7 @@ type RegisterRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
+
+type RenameUserRequest struct {
+	Username string `json:"username" binding:"required"`
+}
@@ -0,0 +1,291 @@
+// Package notification keeps each player's notification inbox. Producers
+// queue notifications with Send; a background writer stores them, trims the
+// inbox to its retention limits and hands them to Options.Deliver so that
+// connected clients see them straight away. Producers that must query the
+// database to find out whom to notify queue that work with Compose, which
+// runs it in the background as well.
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Type string
+
+const (
+	TypeLeaderboardKnockedOut Type = "leaderboard_knocked_out"
+	TypeFriendBeatScore       Type = "friend_beat_score"
+	TypeFriendRequest         Type = "friend_request"
+	TypeFriendAccepted        Type = "friend_accepted"
+	TypeChallengeReceived     Type = "challenge_received"
+	TypeChallengeDeclined     Type = "challenge_declined"
+	TypeChallengeCompleted    Type = "challenge_completed"
+	TypeAchievementUnlocked   Type = "achievement_unlocked"
+)
+
+const (
+	CollectionName = "notifications"
+
+	queueSize    = 256
+	writeTimeout = 5 * time.Second
+)
+
+type Options struct {
+	// Limit is the number of notifications kept per player; older ones
+	// are deleted as new ones arrive.
+	Limit int
+	// Retention is how long a notification is kept.
+	Retention time.Duration
+	// Deliver pushes a stored notification to the player's connected
+	// clients. It must not block.
+	Deliver func(models.Notification)
+}
+
+var (
+	mu        sync.RWMutex
+	queue     chan models.Notification
+	jobs      chan func(context.Context)
+	wg        sync.WaitGroup
+	composers sync.WaitGroup
+	logger    = slog.Default()
+)
+
+// Start starts the background writer. Notifications sent before Start are
+// dropped.
+func Start(opts Options, l *slog.Logger) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	logger = l
+	queue = make(chan models.Notification, queueSize)
+	jobs = make(chan func(context.Context), queueSize)
+	wg.Add(1)
+	go writer(queue, opts)
+	composers.Add(1)
+	go composer(jobs)
+}
+
+// Stop runs queued Compose work, stores queued notifications and waits for
+// the writer to exit, giving up when ctx is done.
+func Stop(ctx context.Context) error {
+	mu.Lock()
+	if jobs != nil {
+		close(jobs)
+		jobs = nil
+	}
+	mu.Unlock()
+	if err := wait(ctx, &composers); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	if queue != nil {
+		close(queue)
+		queue = nil
+	}
+	mu.Unlock()
+	return wait(ctx, &wg)
+}
+
+func wait(ctx context.Context, group *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		group.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Healthy reports whether the background writer is running and keeping up
+// with sent notifications.
+func Healthy(ctx context.Context) error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if queue == nil {
+		return errors.New("notification writer is not running")
+	}
+	if len(queue) >= cap(queue)*9/10 || len(jobs) >= cap(jobs)*9/10 {
+		return errors.New("notification queue is backed up")
+	}
+	return nil
+}
+
+// composer runs queued Compose work one job at a time.
+func composer(jobs <-chan func(context.Context)) {
+	defer composers.Done()
+
+	for compose := range jobs {
+		ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+		compose(ctx)
+		cancel()
+	}
+}
+
+func writer(queue <-chan models.Notification, opts Options) {
+	defer wg.Done()
+
+	collection := config.GetCollection(CollectionName)
+	for n := range queue {
+		ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+		if _, err := collection.InsertOne(ctx, n); err != nil {
+			logger.Error("failed to store notification", slog.String("type", n.Type), slog.Any("error", err))
+			cancel()
+			continue
+		}
+		if opts.Deliver != nil {
+			opts.Deliver(n)
+		}
+		if err := prune(ctx, n.UserID, opts, n.CreatedAt); err != nil {
+			logger.Warn("failed to prune notifications", slog.String("user_id", n.UserID), slog.Any("error", err))
+		}
+		cancel()
+	}
+}
+
+// EnsureIndexes creates the indexes behind the inbox queries and a TTL
+// index that expires notifications after retention, so that inboxes which
+// receive nothing new are cleared too. A changed retention is applied to the
+// existing TTL index.
+func EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	collection := config.GetCollection(CollectionName)
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "read", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("inbox"),
+	})
+	if err != nil {
+		return fmt.Errorf("creating notification inbox index: %w", err)
+	}
+
+	expireAfter := int32(retention / time.Second)
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("expire_after_retention").SetExpireAfterSeconds(expireAfter),
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "IndexOptionsConflict" {
+		err = collection.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: CollectionName},
+			{Key: "index", Value: bson.D{
+				{Key: "name", Value: "expire_after_retention"},
+				{Key: "expireAfterSeconds", Value: expireAfter},
+			}},
+		}).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("creating notification expiry index: %w", err)
+	}
+	return nil
+}
+
+// prune deletes the player's notifications that are older than the
+// retention period or beyond the per-player limit.
+func prune(ctx context.Context, userID string, opts Options, now time.Time) error {
+	collection := config.GetCollection(CollectionName)
+	filter := bson.M{"user_id": userID}
+	if opts.Retention > 0 {
+		filter["created_at"] = bson.M{"$lt": now.Add(-opts.Retention)}
+		if _, err := collection.DeleteMany(ctx, filter); err != nil {
+			return err
+		}
+		delete(filter, "created_at")
+	}
+	if opts.Limit <= 0 {
+		return nil
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(opts.Limit)).
+		SetProjection(bson.M{"_id": 1})
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return err
+	}
+	var extra []models.Notification
+	if err := cursor.All(ctx, &extra); err != nil {
+		return err
+	}
+	if len(extra) == 0 {
+		return nil
+	}
+
+	ids := make([]primitive.ObjectID, len(extra))
+	for i, n := range extra {
+		ids[i] = n.ID
+	}
+	_, err = collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+// Send queues a notification for the player userID. Guests, who have no
+// inbox, are identified by an empty userID and skipped.
+func Send(userID string, t Type, message string, data map[string]string) {
+	if userID == "" {
+		return
+	}
+	enqueue(newNotification(userID, t, message, data))
+}
+
+func newNotification(userID string, t Type, message string, data map[string]string) models.Notification {
+	return models.Notification{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Type:      string(t),
+		Message:   message,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Compose queues compose to run in the background, off the caller's
+// request path. compose works out whom to notify and does so with Send; it
+// handles its own errors. Like notifications, the work is dropped when the
+// queue is full or the writer is not running.
+func Compose(compose func(ctx context.Context)) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if jobs == nil {
+		return
+	}
+
+	select {
+	case jobs <- compose:
+	default:
+		logger.Warn("notification queue full, dropping notification work")
+	}
+}
+
+func enqueue(n models.Notification) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if queue == nil {
+		return
+	}
+
+	select {
+	case queue <- n:
+	default:
+		logger.Warn("notification queue full, dropping notification", slog.String("type", n.Type))
+	}
+}
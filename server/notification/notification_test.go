@@ -0,0 +1,97 @@
+package notification
+
+import (
+	"context"
+	"testing"
+
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewNotification(t *testing.T) {
+	n := newNotification("user123", TypeFriendRequest, "player sent you a friend request", map[string]string{"user_id": "user456"})
+
+	assert.False(t, n.ID.IsZero())
+	assert.Equal(t, "user123", n.UserID)
+	assert.Equal(t, "friend_request", n.Type)
+	assert.Equal(t, "player sent you a friend request", n.Message)
+	assert.Equal(t, "user456", n.Data["user_id"])
+	assert.False(t, n.Read)
+	assert.False(t, n.CreatedAt.IsZero())
+}
+
+func TestEnqueue(t *testing.T) {
+	t.Run("Dropped Before Start", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			Send("user123", TypeFriendRequest, "hello", nil)
+		})
+	})
+
+	t.Run("Guests Skipped", func(t *testing.T) {
+		mu.Lock()
+		queue = make(chan models.Notification, 1)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			queue = nil
+			mu.Unlock()
+		}()
+
+		Send("", TypeLeaderboardKnockedOut, "hello", nil)
+		assert.Empty(t, queue)
+	})
+
+	t.Run("Dropped When Queue Full", func(t *testing.T) {
+		mu.Lock()
+		queue = make(chan models.Notification, 1)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			queue = nil
+			mu.Unlock()
+		}()
+
+		Send("user123", TypeFriendRequest, "first", nil)
+		Send("user123", TypeFriendAccepted, "second", nil)
+
+		assert.Len(t, queue, 1)
+		assert.Equal(t, "first", (<-queue).Message)
+	})
+}
+
+func TestCompose(t *testing.T) {
+	t.Run("Dropped Before Start", func(t *testing.T) {
+		ran := false
+		Compose(func(context.Context) { ran = true })
+		assert.False(t, ran)
+	})
+
+	t.Run("Runs In Background", func(t *testing.T) {
+		mu.Lock()
+		queue = make(chan models.Notification, 1)
+		jobs = make(chan func(context.Context), 1)
+		mu.Unlock()
+		composers.Add(1)
+		go composer(jobs)
+		defer func() {
+			mu.Lock()
+			queue = nil
+			mu.Unlock()
+		}()
+
+		Compose(func(ctx context.Context) {
+			_, hasDeadline := ctx.Deadline()
+			assert.True(t, hasDeadline)
+			Send("user123", TypeFriendBeatScore, "composed", nil)
+		})
+		mu.Lock()
+		close(jobs)
+		jobs = nil
+		mu.Unlock()
+		composers.Wait()
+
+		require.Len(t, queue, 1)
+		assert.Equal(t, "composed", (<-queue).Message)
+	})
+}
@@ -0,0 +1,697 @@
+package openapi
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+	"github.com/markbakos/infinite-minesweeper/server/apierror"
+	"github.com/markbakos/infinite-minesweeper/server/buildinfo"
+	"github.com/markbakos/infinite-minesweeper/server/health"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const Version = "1.0.0"
+
+// Versioned routes live under v1Prefix and are also served, deprecated, under
+// the unversioned legacyPrefix.
+const (
+	v1Prefix     = "/api/v1"
+	legacyPrefix = "/api"
+)
+
+// schemaTypes lists the Go types published under components/schemas. The
+// schemas are derived from the types' json tags so the document cannot drift
+// from what the handlers actually encode.
+var schemaTypes = map[string]any{
+	"Error":                   apierror.Response{},
+	"Message":                 models.MessageResponse{},
+	"Status":                  models.StatusResponse{},
+	"ReadinessReport":         health.Report{},
+	"BuildInfo":               buildinfo.Info{},
+	"LoginRequest":            models.LoginRequest{},
+	"RegisterRequest":         models.RegisterRequest{},
+	"RenameUserRequest":       models.RenameUserRequest{},
+	"AuthResponse":            models.AuthResponse{},
+	"GuestSessionResponse":    models.GuestSessionResponse{},
+	"CurrentUser":             models.CurrentUserResponse{},
+	"GameRecord":              models.GameRecord{},
+	"SaveGameRecordRequest":   models.SaveGameRecordRequest{},
+	"GameRecords":             models.GameRecordsResponse{},
+	"RaceResult":              models.RaceResult{},
+	"RaceResultList":          models.RaceResultListResponse{},
+	"LeaderboardEntry":        models.LeaderboardEntry{},
+	"LeaderboardPage":         models.LeaderboardPageResponse{},
+	"LeaderboardEntryEvent":   models.LeaderboardEntryEvent{},
+	"LeaderboardRemovedEvent": models.LeaderboardRemovedEvent{},
+	"PlayerRating":            models.PlayerRating{},
+	"RatingList":              models.RatingListResponse{},
+	"RatingChange":            models.RatingChange{},
+	"RatingHistory":           models.RatingHistoryResponse{},
+	"DailyAttempt":            models.DailyAttempt{},
+	"DailyLeaderboard":        models.DailyLeaderboardResponse{},
+	"DailySummary":            models.DailySummary{},
+	"DailyArchive":            models.DailyArchiveResponse{},
+	"DailyAttemptList":        models.DailyAttemptListResponse{},
+	"Tournament":              models.Tournament{},
+	"TournamentPlayer":        models.TournamentPlayer{},
+	"TournamentRound":         models.TournamentRound{},
+	"TournamentMatch":         models.TournamentMatch{},
+	"TournamentList":          models.TournamentListResponse{},
+	"CreateTournamentRequest": models.CreateTournamentRequest{},
+	"Friend":                  models.Friend{},
+	"FriendList":              models.FriendListResponse{},
+	"FriendRequestRequest":    models.FriendRequestRequest{},
+	"Challenge":               models.Challenge{},
+	"ChallengeResult":         models.ChallengeResult{},
+	"ReplayMove":              models.ReplayMove{},
+	"ChallengeList":           models.ChallengeListResponse{},
+	"CreateChallengeRequest":  models.CreateChallengeRequest{},
+	"Notification":            models.Notification{},
+	"NotificationList":        models.NotificationListResponse{},
+	"UnreadCount":             models.UnreadCountResponse{},
+	"PlayerStats":             models.PlayerStats{},
+	"UnlockedAchievement":     models.UnlockedAchievement{},
+	"Achievement":             models.Achievement{},
+	"AchievementList":         models.AchievementListResponse{},
+	"PrivacySettings":         models.PrivacySettings{},
+	"ProfileRank":             models.ProfileRank{},
+	"PublicProfile":           models.PublicProfile{},
+	"User":                    models.User{},
+	"UserList":                models.UserListResponse{},
+	"AuditEvent":              models.AuditEvent{},
+	"AuditEventList":          models.AuditEventListResponse{},
+}
+
+var (
+	once    sync.Once
+	spec    *openapi3.T
+	specErr error
+)
+
+// Spec returns the OpenAPI document describing the REST API.
+func Spec() (*openapi3.T, error) {
+	once.Do(func() {
+		spec, specErr = build()
+	})
+	return spec, specErr
+}
+
+func build() (*openapi3.T, error) {
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:       "Infinite Minesweeper API",
+			Description: "Accounts, guest sessions, game records and leaderboards for Infinite Minesweeper.",
+			Version:     Version,
+		},
+		Components: &openapi3.Components{
+			Schemas: openapi3.Schemas{},
+			SecuritySchemes: openapi3.SecuritySchemes{
+				"bearerAuth": &openapi3.SecuritySchemeRef{
+					Value: openapi3.NewJWTSecurityScheme(),
+				},
+			},
+		},
+		Paths: openapi3.NewPaths(),
+	}
+
+	generator := openapi3gen.NewGenerator(openapi3gen.SchemaCustomizer(customizeSchema))
+	for name, value := range schemaTypes {
+		ref, err := generator.NewSchemaRefForValue(value, doc.Components.Schemas)
+		if err != nil {
+			return nil, fmt.Errorf("generating schema %s: %w", name, err)
+		}
+		doc.Components.Schemas[name] = &openapi3.SchemaRef{Value: ref.Value}
+	}
+
+	for _, op := range operations {
+		doc.AddOperation(op.path, op.method, op.build())
+
+		if rest, ok := strings.CutPrefix(op.path, v1Prefix); ok {
+			legacy := op.build()
+			legacy.OperationID += "Legacy"
+			legacy.Description = "Deprecated alias of " + op.path + "."
+			legacy.Deprecated = true
+			doc.AddOperation(legacyPrefix+rest, op.method, legacy)
+		}
+	}
+
+	if err := openapi3.NewLoader().ResolveRefsIn(doc, nil); err != nil {
+		return nil, fmt.Errorf("resolving references: %w", err)
+	}
+
+	return doc, nil
+}
+
+var objectIDType = reflect.TypeOf(primitive.ObjectID{})
+
+// customizeSchema adjusts generated schemas to match encoding/json output:
+// ObjectIDs encode as hex strings, nil slices encode as null, and fields
+// without omitempty are always present.
+func customizeSchema(_ string, t reflect.Type, _ reflect.StructTag, schema *openapi3.Schema) error {
+	switch {
+	case t == objectIDType:
+		schema.Type = &openapi3.Types{"string"}
+		schema.Pattern = "^[0-9a-f]{24}$"
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+		schema.Nullable = true
+	case t.Kind() == reflect.Struct && schema.Properties != nil:
+		for i := 0; i < t.NumField(); i++ {
+			name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if name == "" || name == "-" || strings.Contains(opts, "omitempty") {
+				continue
+			}
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return nil
+}
+
+type operation struct {
+	method      string
+	path        string
+	id          string
+	summary     string
+	description string
+	tag         string
+	auth        bool
+	params      []*openapi3.Parameter
+	requestBody string
+	responses   map[int]string
+	// mediaType is the content type of successful responses that are not
+	// JSON. Their body is described as a string.
+	mediaType string
+	// optionalAuth marks operations that accept a bearer token without
+	// requiring one.
+	optionalAuth bool
+}
+
+func (o operation) build() *openapi3.Operation {
+	op := &openapi3.Operation{
+		OperationID: o.id,
+		Summary:     o.summary,
+		Description: o.description,
+		Tags:        []string{o.tag},
+		Responses:   openapi3.NewResponses(),
+	}
+	op.Responses.Delete("default")
+
+	switch {
+	case o.auth:
+		op.Security = &openapi3.SecurityRequirements{{"bearerAuth": []string{}}}
+	case o.optionalAuth:
+		op.Security = &openapi3.SecurityRequirements{{"bearerAuth": []string{}}, {}}
+	}
+
+	for _, param := range o.params {
+		op.Parameters = append(op.Parameters, &openapi3.ParameterRef{Value: param})
+	}
+
+	if o.requestBody != "" {
+		op.RequestBody = &openapi3.RequestBodyRef{
+			Value: openapi3.NewRequestBody().WithRequired(true).WithJSONSchemaRef(schemaRef(o.requestBody)),
+		}
+	}
+
+	responses := maps.Clone(o.responses)
+	if o.auth || o.optionalAuth {
+		// Tokens of deleted and banned accounts are turned away before the
+		// handler runs.
+		for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+			if _, ok := responses[status]; !ok {
+				responses[status] = "Error"
+			}
+		}
+	}
+	for status, schema := range responses {
+		response := openapi3.NewResponse().WithDescription(http.StatusText(status))
+		switch {
+		case status < http.StatusOK:
+			// Informational responses such as a WebSocket upgrade have no body.
+		case o.mediaType != "" && status < http.StatusBadRequest:
+			response.WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{o.mediaType}))
+		case schema == "":
+			response.WithJSONSchema(openapi3.NewObjectSchema())
+		default:
+			response.WithJSONSchemaRef(schemaRef(schema))
+		}
+		op.AddResponse(status, response)
+	}
+
+	return op
+}
+
+func schemaRef(name string) *openapi3.SchemaRef {
+	return openapi3.NewSchemaRef("#/components/schemas/"+name, nil)
+}
+
+func pathParam(name, description string) *openapi3.Parameter {
+	return openapi3.NewPathParameter(name).WithDescription(description).WithSchema(openapi3.NewStringSchema())
+}
+
+func queryParam(name, description string, schema *openapi3.Schema) *openapi3.Parameter {
+	return openapi3.NewQueryParameter(name).WithDescription(description).WithSchema(schema)
+}
+
+// errorResponses maps each status to the Error schema.
+func errorResponses(statuses ...int) map[int]string {
+	responses := map[int]string{}
+	for _, status := range statuses {
+		responses[status] = "Error"
+	}
+	return responses
+}
+
+func with(responses map[int]string, status int, schema string) map[int]string {
+	responses[status] = schema
+	return responses
+}
+
+var gameTypeSchema = openapi3.NewStringSchema().WithEnum("normal", "infinite")
+
+var tournamentStateSchema = openapi3.NewStringSchema().WithEnum("registering", "running", "finished", "cancelled")
+
+var leaderboardScopeSchema = openapi3.NewStringSchema().WithEnum("global", "friends")
+
+var challengeStateSchema = openapi3.NewStringSchema().WithEnum("pending", "open", "playing", "completed", "declined", "expired")
+
+var rankedModeSchema = openapi3.NewStringSchema().WithEnum("race")
+
+var paginationParams = []*openapi3.Parameter{
+	queryParam("limit", "Maximum number of items to return.", openapi3.NewIntegerSchema()),
+	queryParam("skip", "Number of items to skip.", openapi3.NewIntegerSchema()),
+}
+
+var operations = []operation{
+	{
+		method: http.MethodGet, path: "/healthz", id: "healthz", tag: "operations",
+		summary:   "Liveness probe",
+		responses: map[int]string{http.StatusOK: "Status"},
+	},
+	{
+		method: http.MethodGet, path: "/readyz", id: "readyz", tag: "operations",
+		summary:   "Readiness probe including MongoDB and background workers",
+		responses: map[int]string{http.StatusOK: "ReadinessReport", http.StatusServiceUnavailable: "ReadinessReport"},
+	},
+	{
+		method: http.MethodGet, path: "/version", id: "version", tag: "operations",
+		summary:   "Build information",
+		responses: map[int]string{http.StatusOK: "BuildInfo"},
+	},
+	{
+		method: http.MethodGet, path: "/metrics", id: "metrics", tag: "operations",
+		summary:   "Prometheus metrics in the text exposition format",
+		responses: map[int]string{http.StatusOK: ""},
+		mediaType: "text/plain",
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/openapi.json", id: "getOpenAPISpec", tag: "operations",
+		summary:   "This OpenAPI document",
+		responses: with(errorResponses(http.StatusInternalServerError), http.StatusOK, ""),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/auth/login", id: "login", tag: "auth",
+		summary:     "Log in with a username and password",
+		requestBody: "LoginRequest",
+		responses:   with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError), http.StatusOK, "AuthResponse"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/auth/register", id: "register", tag: "auth",
+		summary:     "Create an account",
+		requestBody: "RegisterRequest",
+		responses:   with(errorResponses(http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError), http.StatusCreated, "AuthResponse"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/auth/guest", id: "createGuestSession", tag: "auth",
+		summary:   "Start a guest session",
+		responses: with(errorResponses(http.StatusInternalServerError), http.StatusOK, "GuestSessionResponse"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/leaderboard", id: "getLeaderboard", tag: "leaderboard", optionalAuth: true,
+		summary: "Top scores for a game type",
+		description: "Signed in players do not see the scores of users who blocked them. The friends scope " +
+			"requires a registered account and ranks only the player and their friends.",
+		params: append([]*openapi3.Parameter{
+			queryParam("gameType", "Game type, defaults to normal.", gameTypeSchema),
+			queryParam("scope", "Whose scores to rank, defaults to global.", leaderboardScopeSchema),
+		}, paginationParams...),
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError), http.StatusOK, "LeaderboardPage"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/achievements", id: "listAchievements", tag: "achievements", optionalAuth: true,
+		summary: "Every achievement with how many players unlocked it",
+		description: "Percentages are of all registered players. Signed in players also see when they unlocked " +
+			"each achievement. Achievements are unlocked by games played in live sessions, and unlocking one " +
+			"sends an achievement_unlocked notification.",
+		responses: with(errorResponses(http.StatusUnauthorized, http.StatusInternalServerError), http.StatusOK, "AchievementList"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/leaderboard/stream", id: "streamLeaderboard", tag: "leaderboard",
+		summary: "Live updates to the top scores as Server-Sent Events",
+		description: "Sends a snapshot event holding a LeaderboardPage, then an entry event with a " +
+			"LeaderboardEntryEvent whenever an entry within the limit is added or improved and a removed " +
+			"event with a LeaderboardRemovedEvent when an entry is deleted or hidden. A client that falls " +
+			"behind has its stream closed and receives a new snapshot when it reconnects.",
+		params: []*openapi3.Parameter{
+			queryParam("gameType", "Game type, defaults to normal.", gameTypeSchema),
+			queryParam("limit", "Number of top entries to follow, defaults to 10.", openapi3.NewIntegerSchema().WithMin(1).WithMax(100)),
+		},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusInternalServerError), http.StatusOK, ""),
+		mediaType: "text/event-stream",
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/user", id: "getCurrentUser", tag: "users", auth: true,
+		summary:   "The authenticated user",
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound), http.StatusOK, "CurrentUser"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/user/privacy", id: "getPrivacySettings", tag: "users", auth: true,
+		summary:   "Who may see each section of the authenticated player's profile",
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound), http.StatusOK, "PrivacySettings"),
+	},
+	{
+		method: http.MethodPut, path: "/api/v1/user/privacy", id: "updatePrivacySettings", tag: "users", auth: true,
+		summary:     "Replace the authenticated player's privacy settings",
+		description: "Each section is public, friends or private. Sections left out become public. Guests have no profile.",
+		requestBody: "PrivacySettings",
+		responses:   with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "PrivacySettings"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/users/{username}", id: "getUserProfile", tag: "users", optionalAuth: true,
+		summary: "Public profile of a registered player",
+		description: "Sections the player's privacy settings hide from the viewer are left out and listed in hidden. " +
+			"Players always see their own profile in full, and users who blocked the viewer are not found. " +
+			"Leaderboard entries of registered players link here through their profile field.",
+		params:    []*openapi3.Parameter{pathParam("username", "Username.")},
+		responses: with(errorResponses(http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "PublicProfile"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/friends", id: "getFriends", tag: "friends", auth: true,
+		summary: "Friends, pending friend requests and blocked users of the authenticated player",
+		description: "Only registered players can have friends. Blocking a user ends any friendship or request " +
+			"between the two, stops them from sending friend requests and hides the blocker from their leaderboards.",
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError), http.StatusOK, "FriendList"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/friends/requests", id: "sendFriendRequest", tag: "friends", auth: true,
+		summary:     "Send a friend request, or accept one the user already sent",
+		requestBody: "FriendRequestRequest",
+		responses:   with(with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError), http.StatusOK, "Message"), http.StatusCreated, "Message"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/friends/requests/{id}/accept", id: "acceptFriendRequest", tag: "friends", auth: true,
+		summary:   "Accept a friend request",
+		params:    []*openapi3.Parameter{pathParam("id", "User ID of the player who sent the request.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodDelete, path: "/api/v1/friends/requests/{id}", id: "declineFriendRequest", tag: "friends", auth: true,
+		summary:   "Decline a friend request, or withdraw one sent",
+		params:    []*openapi3.Parameter{pathParam("id", "User ID of the other player.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodDelete, path: "/api/v1/friends/{id}", id: "removeFriend", tag: "friends", auth: true,
+		summary:   "Remove a friend",
+		params:    []*openapi3.Parameter{pathParam("id", "User ID of the friend.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/friends/{id}/block", id: "blockUser", tag: "friends", auth: true,
+		summary:   "Block a user",
+		params:    []*openapi3.Parameter{pathParam("id", "User ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodDelete, path: "/api/v1/friends/{id}/block", id: "unblockUser", tag: "friends", auth: true,
+		summary:   "Unblock a user",
+		params:    []*openapi3.Parameter{pathParam("id", "User ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/challenges", id: "createChallenge", tag: "challenges", auth: true,
+		summary: "Challenge a player to beat your result on a board",
+		description: "Without a username the challenge goes to the first other player who opens it through its " +
+			"shared link. The challenger plays first by sending open with challenge_id set over the live WebSocket; " +
+			"their result and replay are then attached and the opponent plays the same board once. Both players " +
+			"receive a challenge_result message when the opponent's game decides it. Challenges expire when their " +
+			"time runs out before being played.",
+		requestBody: "CreateChallengeRequest",
+		responses:   with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError), http.StatusCreated, "Challenge"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/challenges", id: "listChallenges", tag: "challenges", auth: true,
+		summary:     "Challenges the authenticated player sent or received, newest first",
+		description: "The board's seed and the challenger's replay are hidden from the opponent until the challenge is over.",
+		params: append([]*openapi3.Parameter{
+			queryParam("state", "Only return challenges in this state.", challengeStateSchema),
+		}, paginationParams...),
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError), http.StatusOK, "ChallengeList"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/challenges/{id}", id: "getChallenge", tag: "challenges", auth: true,
+		summary:   "A challenge, to its players or to anyone with its link before it is taken up",
+		params:    []*openapi3.Parameter{pathParam("id", "Challenge ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Challenge"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/challenges/{id}/decline", id: "declineChallenge", tag: "challenges", auth: true,
+		summary:   "Decline a challenge sent to you",
+		params:    []*openapi3.Parameter{pathParam("id", "Challenge ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/notifications", id: "listNotifications", tag: "notifications", auth: true,
+		summary: "Notifications of the authenticated player, newest first",
+		description: "Players are notified when they are knocked out of a leaderboard's top 10, when a friend beats " +
+			"their score, about friend requests and about challenges. Connected clients also receive each new " +
+			"notification as a notification message over the live WebSocket. Inboxes keep a limited number of " +
+			"recent notifications.",
+		params: append([]*openapi3.Parameter{
+			queryParam("unread", "Only return unread notifications.", openapi3.NewBoolSchema()),
+		}, paginationParams...),
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError), http.StatusOK, "NotificationList"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/notifications/unread", id: "getUnreadNotificationCount", tag: "notifications", auth: true,
+		summary:   "Number of unread notifications of the authenticated player",
+		responses: with(errorResponses(http.StatusUnauthorized, http.StatusInternalServerError), http.StatusOK, "UnreadCount"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/notifications/read", id: "markAllNotificationsRead", tag: "notifications", auth: true,
+		summary:   "Mark every notification as read",
+		responses: with(errorResponses(http.StatusUnauthorized, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/notifications/{id}/read", id: "markNotificationRead", tag: "notifications", auth: true,
+		summary:   "Mark a notification as read",
+		params:    []*openapi3.Parameter{pathParam("id", "Notification ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/game/record", id: "saveGameRecord", tag: "game", auth: true,
+		summary:     "Submit a finished game",
+		requestBody: "SaveGameRecordRequest",
+		responses:   with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/ratings", id: "getRatings", tag: "ratings",
+		summary: "Rated leaderboard for a ranked mode",
+		description: "Lists registered players by Glicko-2 rating, highest first. Ratings change after every " +
+			"ranked race, which players find through the live matchmaking queue; guests are never rated.",
+		params: append([]*openapi3.Parameter{
+			queryParam("mode", "Ranked mode, defaults to race.", rankedModeSchema),
+		}, paginationParams...),
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusInternalServerError), http.StatusOK, "RatingList"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/ratings/{id}/history", id: "getRatingHistory", tag: "ratings",
+		summary: "A user's rating after each ranked match, most recent first",
+		params: append([]*openapi3.Parameter{
+			pathParam("id", "User ID."),
+			queryParam("mode", "Ranked mode, defaults to race.", rankedModeSchema),
+		}, paginationParams...),
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusInternalServerError), http.StatusOK, "RatingHistory"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/daily", id: "getDailyLeaderboard", tag: "daily",
+		summary: "Leaderboard of a daily challenge",
+		description: "Every UTC day each game type has one board that every player, registered or guest, may " +
+			"attempt once by sending open with daily set over the live WebSocket. Finished attempts of registered " +
+			"players are ranked by score and then by time; guest attempts are kept but not ranked. The board's seed " +
+			"is only published once the day is over.",
+		params: append([]*openapi3.Parameter{
+			queryParam("gameType", "Game type, defaults to normal.", gameTypeSchema),
+			queryParam("date", "UTC day formatted as YYYY-MM-DD, defaults to today.", openapi3.NewStringSchema().WithFormat("date")),
+		}, paginationParams...),
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusInternalServerError), http.StatusOK, "DailyLeaderboard"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/daily/archive", id: "getDailyArchive", tag: "daily",
+		summary: "Past daily challenges, most recent first",
+		params: append([]*openapi3.Parameter{
+			queryParam("gameType", "Game type, defaults to normal.", gameTypeSchema),
+		}, paginationParams...),
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusInternalServerError), http.StatusOK, "DailyArchive"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/tournaments", id: "listTournaments", tag: "tournaments",
+		summary: "Tournaments, latest start first",
+		description: "Tournaments open for registration until they start. Every round, each player still in the " +
+			"tournament plays the round's board once by sending open with tournament_id set over the live WebSocket " +
+			"before the round ends. Single elimination and Swiss rounds pair players by score and then time, while " +
+			"cumulative tournaments add up every round's score. A round's seed is only published once it closes.",
+		params: append([]*openapi3.Parameter{
+			queryParam("state", "Only return tournaments in this state.", tournamentStateSchema),
+		}, paginationParams...),
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusInternalServerError), http.StatusOK, "TournamentList"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/tournaments/{id}", id: "getTournament", tag: "tournaments",
+		summary:   "A tournament with its rounds and standings",
+		params:    []*openapi3.Parameter{pathParam("id", "Tournament ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Tournament"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/tournaments/{id}/register", id: "registerForTournament", tag: "tournaments", auth: true,
+		summary:   "Enter a tournament before it starts",
+		params:    []*openapi3.Parameter{pathParam("id", "Tournament ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodDelete, path: "/api/v1/tournaments/{id}/register", id: "withdrawFromTournament", tag: "tournaments", auth: true,
+		summary:   "Withdraw from a tournament before it starts",
+		params:    []*openapi3.Parameter{pathParam("id", "Tournament ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/game/records", id: "getGameRecords", tag: "game", auth: true,
+		summary:   "Personal best records of the authenticated player",
+		params:    []*openapi3.Parameter{queryParam("gameType", "Only return records for this game type.", gameTypeSchema)},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "GameRecords"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/game/races", id: "getRaceResults", tag: "game", auth: true,
+		summary:   "Multiplayer races the authenticated player took part in",
+		params:    paginationParams,
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError), http.StatusOK, "RaceResultList"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/game/daily", id: "getDailyAttempts", tag: "game", auth: true,
+		summary:   "Daily challenge attempts of the authenticated player, most recent first",
+		params:    paginationParams,
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError), http.StatusOK, "DailyAttemptList"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/game/live", id: "liveGame", tag: "game", auth: true,
+		summary: "Play a server-side game over a WebSocket",
+		description: "Upgrades to a WebSocket carrying JSON messages. Clients send open, resume, reveal, flag, " +
+			"chord, move_viewport, set_visibility and ping commands and receive session snapshots, cell deltas, viewport " +
+			"updates and errors. Multiplayer races use the create_lobby, join_lobby, leave_lobby and ready " +
+			"commands and the lobby, race_start, race_progress and race_result messages. Co-op rooms sharing one " +
+			"infinite board use the create_room (with a shared or lives loss_rule), join_room and leave_room commands " +
+			"and the room and room_delta messages. Registered players join ranked matchmaking with queue and leave_queue, " +
+			"receiving queue and match_found messages before the ranked race starts. Sending open with daily set starts " +
+			"the player's one attempt at today's daily challenge and open with tournament_id set starts their game in " +
+			"the tournament's current round, and open with challenge_id set starts their game in a head-to-head " +
+			"challenge. New inbox notifications are pushed as notification messages. Browsers may pass the token " +
+			"in the access_token query parameter.",
+		params:    []*openapi3.Parameter{queryParam("access_token", "Bearer token, for clients that cannot set headers.", openapi3.NewStringSchema())},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusServiceUnavailable), http.StatusSwitchingProtocols, ""),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/game/live/{id}/spectate", id: "spectateGame", tag: "game",
+		summary: "Watch a public live game",
+		description: "Streams the session's snapshot, deltas and viewport moves, delayed by the player's " +
+			"chosen spectator delay. Upgrades to a read-only WebSocket when requested and otherwise " +
+			"responds with Server-Sent Events named after the message types, ending with a closed event " +
+			"when the session ends or is made private.",
+		params:    []*openapi3.Parameter{pathParam("id", "Live session ID.")},
+		responses: with(with(errorResponses(http.StatusNotFound, http.StatusServiceUnavailable), http.StatusSwitchingProtocols, ""), http.StatusOK, ""),
+		mediaType: "text/event-stream",
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/admin/users", id: "adminListUsers", tag: "admin", auth: true,
+		summary: "Search users",
+		params: append([]*openapi3.Parameter{
+			queryParam("q", "Case-insensitive username substring.", openapi3.NewStringSchema()),
+			queryParam("banned", "Only return banned users when true.", openapi3.NewBoolSchema()),
+		}, paginationParams...),
+		responses: with(errorResponses(http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError), http.StatusOK, "UserList"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/admin/users/{id}/ban", id: "adminBanUser", tag: "admin", auth: true,
+		summary:   "Ban a user",
+		params:    []*openapi3.Parameter{pathParam("id", "User ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/admin/users/{id}/unban", id: "adminUnbanUser", tag: "admin", auth: true,
+		summary:   "Lift a ban",
+		params:    []*openapi3.Parameter{pathParam("id", "User ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodPut, path: "/api/v1/admin/users/{id}/username", id: "adminRenameUser", tag: "admin", auth: true,
+		summary:     "Rename a user",
+		params:      []*openapi3.Parameter{pathParam("id", "User ID.")},
+		requestBody: "RenameUserRequest",
+		responses:   with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodDelete, path: "/api/v1/admin/users/{id}/records", id: "adminResetUserRecords", tag: "admin", auth: true,
+		summary:   "Delete a user's game records, stats, achievements and leaderboard entries",
+		params:    []*openapi3.Parameter{pathParam("id", "User ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodDelete, path: "/api/v1/admin/leaderboard/{id}", id: "adminDeleteLeaderboardEntry", tag: "admin", auth: true,
+		summary:   "Delete a leaderboard entry",
+		params:    []*openapi3.Parameter{pathParam("id", "Leaderboard entry ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/admin/leaderboard/{id}/hide", id: "adminHideLeaderboardEntry", tag: "admin", auth: true,
+		summary:   "Hide a leaderboard entry from public listings",
+		params:    []*openapi3.Parameter{pathParam("id", "Leaderboard entry ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/admin/leaderboard/{id}/unhide", id: "adminUnhideLeaderboardEntry", tag: "admin", auth: true,
+		summary:   "Show a hidden leaderboard entry again",
+		params:    []*openapi3.Parameter{pathParam("id", "Leaderboard entry ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/admin/tournaments", id: "adminCreateTournament", tag: "admin", auth: true,
+		summary:     "Schedule a tournament",
+		requestBody: "CreateTournamentRequest",
+		responses:   with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError), http.StatusCreated, "Tournament"),
+	},
+	{
+		method: http.MethodPost, path: "/api/v1/admin/tournaments/{id}/cancel", id: "adminCancelTournament", tag: "admin", auth: true,
+		summary:   "Cancel a tournament that has not finished",
+		params:    []*openapi3.Parameter{pathParam("id", "Tournament ID.")},
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError), http.StatusOK, "Message"),
+	},
+	{
+		method: http.MethodGet, path: "/api/v1/admin/audit", id: "adminListAuditEvents", tag: "admin", auth: true,
+		summary: "Query the audit log",
+		params: append([]*openapi3.Parameter{
+			queryParam("type", "Event type, e.g. auth.login_failed.", openapi3.NewStringSchema()),
+			queryParam("actor", "Actor user ID.", openapi3.NewStringSchema()),
+			queryParam("target", "Target ID.", openapi3.NewStringSchema()),
+			queryParam("ip", "Client IP address.", openapi3.NewStringSchema()),
+			queryParam("since", "Only events at or after this RFC3339 time.", openapi3.NewDateTimeSchema()),
+			queryParam("until", "Only events before this RFC3339 time.", openapi3.NewDateTimeSchema()),
+		}, paginationParams...),
+		responses: with(errorResponses(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError), http.StatusOK, "AuditEventList"),
+	},
+}
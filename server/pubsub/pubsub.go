@@ -0,0 +1,128 @@
+package pubsub
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/markbakos/infinite-minesweeper/server/metrics"
+)
+
+// Broker fans messages out to the subscribers of a topic. Implementations
+// must never block Publish on a slow subscriber, so that publishing from a
+// request handler does not slow the request down. The in-process broker can
+// be replaced with one backed by a shared message bus when the server runs as
+// several instances.
+type Broker interface {
+	// Publish delivers data to every current subscriber of topic.
+	Publish(topic string, data []byte)
+	// Subscribe returns a subscription receiving messages published on topic
+	// from now on. buffer is the number of messages held for the subscriber
+	// before it is considered too slow.
+	Subscribe(topic string, buffer int) Subscription
+}
+
+// Subscription receives the messages published on one topic. Its channel is
+// closed when the subscription is closed or when the subscriber fell too far
+// behind, in which case Lagged reports true.
+type Subscription interface {
+	C() <-chan []byte
+	Lagged() bool
+	Close()
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultBroker Broker = NewMemoryBroker()
+)
+
+// Default returns the broker shared by the whole process.
+func Default() Broker {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultBroker
+}
+
+// SetDefault replaces the process-wide broker. It must be called before the
+// server starts handling requests.
+func SetDefault(b Broker) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultBroker = b
+}
+
+// MemoryBroker is a Broker for a single server process.
+type MemoryBroker struct {
+	mu     sync.RWMutex
+	topics map[string]map[*memorySubscription]struct{}
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{topics: make(map[string]map[*memorySubscription]struct{})}
+}
+
+func (b *MemoryBroker) Publish(topic string, data []byte) {
+	b.mu.RLock()
+	var lagging []*memorySubscription
+	for sub := range b.topics[topic] {
+		select {
+		case sub.ch <- data:
+		default:
+			lagging = append(lagging, sub)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range lagging {
+		sub.lagged.Store(true)
+		b.remove(sub)
+		metrics.PubSubDropped.Inc()
+	}
+}
+
+func (b *MemoryBroker) Subscribe(topic string, buffer int) Subscription {
+	sub := &memorySubscription{broker: b, topic: topic, ch: make(chan []byte, buffer)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.topics[topic] == nil {
+		b.topics[topic] = make(map[*memorySubscription]struct{})
+	}
+	b.topics[topic][sub] = struct{}{}
+	return sub
+}
+
+// remove unsubscribes sub and closes its channel if it is still subscribed.
+func (b *MemoryBroker) remove(sub *memorySubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs, ok := b.topics[sub.topic]
+	if _, subscribed := subs[sub]; !ok || !subscribed {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.topics, sub.topic)
+	}
+	close(sub.ch)
+}
+
+type memorySubscription struct {
+	broker *MemoryBroker
+	topic  string
+	ch     chan []byte
+	lagged atomic.Bool
+}
+
+func (s *memorySubscription) C() <-chan []byte {
+	return s.ch
+}
+
+func (s *memorySubscription) Lagged() bool {
+	return s.lagged.Load()
+}
+
+func (s *memorySubscription) Close() {
+	s.broker.remove(s)
+}
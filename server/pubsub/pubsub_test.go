@@ -0,0 +1,83 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, sub Subscription) ([]byte, bool) {
+	t.Helper()
+	select {
+	case data, ok := <-sub.C():
+		return data, ok
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return nil, false
+	}
+}
+
+func TestPublishReachesTopicSubscribers(t *testing.T) {
+	broker := NewMemoryBroker()
+
+	first := broker.Subscribe("leaderboard:normal", 4)
+	second := broker.Subscribe("leaderboard:normal", 4)
+	other := broker.Subscribe("leaderboard:infinite", 4)
+
+	broker.Publish("leaderboard:normal", []byte("hello"))
+
+	for _, sub := range []Subscription{first, second} {
+		data, ok := receive(t, sub)
+		require.True(t, ok)
+		assert.Equal(t, "hello", string(data))
+	}
+	assert.Empty(t, other.C())
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	broker := NewMemoryBroker()
+
+	slow := broker.Subscribe("topic", 1)
+	fast := broker.Subscribe("topic", 8)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			broker.Publish("topic", []byte{byte(i)})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+
+	data, ok := receive(t, slow)
+	require.True(t, ok)
+	assert.Equal(t, []byte{0}, data)
+	_, ok = receive(t, slow)
+	assert.False(t, ok, "slow subscription should be closed")
+	assert.True(t, slow.Lagged())
+
+	assert.Len(t, fast.C(), 3)
+	assert.False(t, fast.Lagged())
+}
+
+func TestCloseUnsubscribes(t *testing.T) {
+	broker := NewMemoryBroker()
+
+	sub := broker.Subscribe("topic", 1)
+	sub.Close()
+	sub.Close()
+
+	_, ok := receive(t, sub)
+	assert.False(t, ok)
+	assert.False(t, sub.Lagged())
+
+	broker.Publish("topic", []byte("ignored"))
+	assert.Empty(t, broker.topics)
+}
@@ -0,0 +1,150 @@
+// Package rating implements the Glicko-2 rating system used for ranked
+// multiplayer modes. Ratings are kept on the familiar Glicko scale, where a
+// new player starts at 1500 with a deviation of 350, and converted to the
+// Glicko-2 scale only while updating.
+package rating
+
+import "math"
+
+const (
+	DefaultRating     = 1500.0
+	DefaultDeviation  = 350.0
+	DefaultVolatility = 0.06
+
+	// Tau constrains how quickly volatility changes. Glickman suggests
+	// values between 0.3 and 1.2; lower values suit games with few upsets.
+	Tau = 0.5
+
+	// scale converts between the Glicko and Glicko-2 scales.
+	scale = 173.7178
+	// epsilon is the convergence tolerance of the volatility iteration.
+	epsilon = 0.000001
+)
+
+// Rating is a player's skill estimate. Deviation is the uncertainty in
+// Rating and Volatility how erratic the player's results are.
+type Rating struct {
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+}
+
+// Default is the rating of a player who has not played a ranked match.
+func Default() Rating {
+	return Rating{Rating: DefaultRating, Deviation: DefaultDeviation, Volatility: DefaultVolatility}
+}
+
+// Result is the outcome of one game against an opponent: 1 for a win, 0.5
+// for a draw and 0 for a loss.
+type Result struct {
+	Opponent Rating
+	Score    float64
+}
+
+// Update returns r after a rating period with the given results. A player
+// without results keeps their rating but grows less certain of it.
+func Update(r Rating, results []Result) Rating {
+	mu := (r.Rating - DefaultRating) / scale
+	phi := r.Deviation / scale
+	sigma := r.Volatility
+
+	if len(results) == 0 {
+		return Rating{
+			Rating:     r.Rating,
+			Deviation:  math.Min(math.Sqrt(phi*phi+sigma*sigma)*scale, DefaultDeviation),
+			Volatility: sigma,
+		}
+	}
+
+	var variance, improvement float64
+	for _, result := range results {
+		muJ := (result.Opponent.Rating - DefaultRating) / scale
+		gJ := g(result.Opponent.Deviation / scale)
+		e := expected(mu, muJ, gJ)
+		variance += gJ * gJ * e * (1 - e)
+		improvement += gJ * (result.Score - e)
+	}
+	v := 1 / variance
+	delta := v * improvement
+
+	sigma = volatility(phi, sigma, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * improvement
+
+	return Rating{
+		Rating:     mu*scale + DefaultRating,
+		Deviation:  math.Min(phi*scale, DefaultDeviation),
+		Volatility: sigma,
+	}
+}
+
+// UpdateMatch rates a match between several players as if each had played
+// every other: finishing in a better place is a win and sharing a place is a
+// draw. Every player is rated against the others' ratings from before the
+// match. places[i] is the place of the player rated ratings[i].
+func UpdateMatch(ratings []Rating, places []int) []Rating {
+	updated := make([]Rating, len(ratings))
+	for i, r := range ratings {
+		results := make([]Result, 0, len(ratings)-1)
+		for j, opponent := range ratings {
+			if i == j {
+				continue
+			}
+			score := 0.5
+			switch {
+			case places[i] < places[j]:
+				score = 1
+			case places[i] > places[j]:
+				score = 0
+			}
+			results = append(results, Result{Opponent: opponent, Score: score})
+		}
+		updated[i] = Update(r, results)
+	}
+	return updated
+}
+
+func g(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func expected(mu, muJ, gJ float64) float64 {
+	return 1 / (1 + math.Exp(-gJ*(mu-muJ)))
+}
+
+// volatility finds the new volatility with the Illinois algorithm, step 5 of
+// Glickman's description of Glicko-2.
+func volatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(Tau*Tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*Tau) < 0 {
+			k++
+		}
+		B = a - k*Tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
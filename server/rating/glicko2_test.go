@@ -0,0 +1,62 @@
+package rating
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestUpdateGlickmanExample checks the worked example from Glickman's
+// "Example of the Glicko-2 system".
+func TestUpdateGlickmanExample(t *testing.T) {
+	player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	results := []Result{
+		{Opponent: Rating{Rating: 1400, Deviation: 30}, Score: 1},
+		{Opponent: Rating{Rating: 1550, Deviation: 100}, Score: 0},
+		{Opponent: Rating{Rating: 1700, Deviation: 300}, Score: 0},
+	}
+
+	updated := Update(player, results)
+	assert.InDelta(t, 1464.06, updated.Rating, 0.01)
+	assert.InDelta(t, 151.52, updated.Deviation, 0.01)
+	assert.InDelta(t, 0.05999, updated.Volatility, 0.00001)
+}
+
+func TestUpdateWithoutResults(t *testing.T) {
+	tests := []struct {
+		name      string
+		player    Rating
+		deviation float64
+	}{
+		{name: "Grows", player: Rating{Rating: 1600, Deviation: 50, Volatility: 0.06}, deviation: 51.075},
+		{name: "Capped", player: Default(), deviation: DefaultDeviation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := Update(tt.player, nil)
+			assert.Equal(t, tt.player.Rating, updated.Rating)
+			assert.Equal(t, tt.player.Volatility, updated.Volatility)
+			assert.InDelta(t, tt.deviation, updated.Deviation, 0.001)
+		})
+	}
+}
+
+func TestUpdateMatch(t *testing.T) {
+	players := []Rating{Default(), Default(), Default(), Default()}
+	updated := UpdateMatch(players, []int{2, 1, 3, 3})
+
+	assert.Greater(t, updated[1].Rating, updated[0].Rating, "the winner gains the most")
+	assert.Greater(t, updated[0].Rating, DefaultRating)
+	assert.Less(t, updated[2].Rating, DefaultRating)
+	assert.InDelta(t, updated[2].Rating, updated[3].Rating, 1e-9, "a shared place rates both players alike")
+	for _, r := range updated {
+		assert.Less(t, r.Deviation, DefaultDeviation, "playing makes every rating more certain")
+	}
+
+	var total float64
+	for _, r := range updated {
+		total += r.Rating - DefaultRating
+	}
+	assert.InDelta(t, 0, total, 1e-3, "equal ratings exchange points without creating any")
+}
@@ -1,34 +1,147 @@
 package routes
 
 import (
+	"log/slog"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/markbakos/infinite-minesweeper/server/config"
 	"github.com/markbakos/infinite-minesweeper/server/controllers"
 	"github.com/markbakos/infinite-minesweeper/server/middleware"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func SetupRoutes(router *gin.Engine) {
-	api := router.Group("/api")
+// legacyAPIDeprecation applies to the unversioned /api routes, which are kept
+// as aliases of v1 for clients released before the API was versioned.
+var legacyAPIDeprecation = middleware.DeprecationPolicy{
+	Since: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+	Successor: func(path string) string {
+		return "/api/v1" + strings.TrimPrefix(path, "/api")
+	},
+}
+
+// SetupRoutes registers every route on router. accounts loads the current
+// role and ban state of signed in users on each authenticated request.
+func SetupRoutes(router *gin.Engine, cfg *config.Config, logger *slog.Logger, accounts middleware.AccountLookup) {
+	h := controllers.NewHandler(cfg, logger)
+
+	router.Use(middleware.ErrorHandler(logger))
+
+	router.GET("/healthz", h.Healthz)
+	router.GET("/readyz", h.Readyz)
+	router.GET("/version", h.Version)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	v1 := newAPIVersion("v1")
+
+	api := v1.group("")
 	{
-		auth := api.Group("/auth")
+		api.GET("/openapi.json", h.GetOpenAPISpec)
+
+		auth := api.group("/auth")
 		{
-			auth.POST("/login", controllers.LoginUser)
-			auth.POST("/register", controllers.RegisterUser)
+			auth.POST("/login", h.LoginUser)
+			auth.POST("/register", h.RegisterUser)
 
-			auth.GET("/guest", controllers.CreateGuestSession)
+			auth.GET("/guest", h.CreateGuestSession)
 		}
 
-		api.GET("/leaderboard", controllers.GetLeaderboard)
+		api.GET("/leaderboard/stream", h.StreamLeaderboard)
+
+		api.GET("/ratings", h.GetRatings)
+		api.GET("/ratings/:id/history", h.GetRatingHistory)
+
+		api.GET("/daily", h.GetDailyLeaderboard)
+		api.GET("/daily/archive", h.GetDailyArchive)
+
+		api.GET("/tournaments", h.ListTournaments)
+		api.GET("/tournaments/:id", h.GetTournament)
+
+		api.GET("/game/live/:id/spectate", h.SpectateGame)
 	}
 
-	protected := router.Group("/api")
-	protected.Use(middleware.AuthMiddleware())
+	// Signed in viewers may narrow the leaderboard to their friends, see
+	// which achievements they have unlocked and see profile sections shared
+	// with friends.
+	viewer := v1.group("", middleware.OptionalAuthMiddleware(cfg.JWTSecret), middleware.AccountMiddleware(accounts))
 	{
-		protected.GET("/user", controllers.GetCurrentUser)
+		viewer.GET("/leaderboard", h.GetLeaderboard)
+		viewer.GET("/achievements", h.ListAchievements)
+		viewer.GET("/users/:username", h.GetUserProfile)
+	}
 
-		game := protected.Group("/game")
+	protected := v1.group("", middleware.AuthMiddleware(cfg.JWTSecret), middleware.AccountMiddleware(accounts))
+	{
+		protected.GET("/user", h.GetCurrentUser)
+		protected.GET("/user/privacy", h.GetPrivacySettings)
+		protected.PUT("/user/privacy", h.UpdatePrivacySettings)
+
+		protected.POST("/tournaments/:id/register", h.RegisterForTournament)
+		protected.DELETE("/tournaments/:id/register", h.WithdrawFromTournament)
+
+		friends := protected.group("/friends")
 		{
-			game.POST("/record", controllers.SaveGameRecord)
-			game.GET("/records", controllers.GetUserGameRecords)
+			friends.GET("", h.GetFriends)
+			friends.POST("/requests", h.SendFriendRequest)
+			friends.POST("/requests/:id/accept", h.AcceptFriendRequest)
+			friends.DELETE("/requests/:id", h.DeclineFriendRequest)
+			friends.DELETE("/:id", h.RemoveFriend)
+			friends.POST("/:id/block", h.BlockUser)
+			friends.DELETE("/:id/block", h.UnblockUser)
+		}
+
+		challenges := protected.group("/challenges")
+		{
+			challenges.POST("", h.CreateChallenge)
+			challenges.GET("", h.ListChallenges)
+			challenges.GET("/:id", h.GetChallenge)
+			challenges.POST("/:id/decline", h.DeclineChallenge)
+		}
+
+		notifications := protected.group("/notifications")
+		{
+			notifications.GET("", h.ListNotifications)
+			notifications.GET("/unread", h.GetUnreadNotificationCount)
+			notifications.POST("/read", h.MarkAllNotificationsRead)
+			notifications.POST("/:id/read", h.MarkNotificationRead)
+		}
+
+		game := protected.group("/game")
+		{
+			game.POST("/record", h.SaveGameRecord)
+			game.GET("/records", h.GetUserGameRecords)
+			game.GET("/races", h.GetRaceResults)
+			game.GET("/daily", h.GetDailyAttempts)
 		}
 	}
+
+	liveGame := v1.group("/game", middleware.WebSocketAuthMiddleware(cfg.JWTSecret), middleware.AccountMiddleware(accounts))
+	{
+		liveGame.GET("/live", h.LiveGame)
+	}
+
+	admin := v1.group("/admin", middleware.AuthMiddleware(cfg.JWTSecret), middleware.AccountMiddleware(accounts), middleware.RequireRole(models.RoleAdmin))
+	{
+		admin.GET("/users", h.ListUsers)
+		admin.POST("/users/:id/ban", h.BanUser)
+		admin.POST("/users/:id/unban", h.UnbanUser)
+		admin.PUT("/users/:id/username", h.RenameUser)
+		admin.DELETE("/users/:id/records", h.ResetUserRecords)
+
+		admin.DELETE("/leaderboard/:id", h.DeleteLeaderboardEntry)
+		admin.POST("/leaderboard/:id/hide", h.HideLeaderboardEntry)
+		admin.POST("/leaderboard/:id/unhide", h.UnhideLeaderboardEntry)
+
+		admin.POST("/tournaments", h.CreateTournament)
+		admin.POST("/tournaments/:id/cancel", h.CancelTournament)
+
+		admin.GET("/audit", h.ListAuditEvents)
+	}
+
+	// A later version starts from v1.next and registers only the routes it
+	// changes; everything else falls through to v1.
+	v1.mount(router.Group("/api/v1"))
+	v1.mount(router.Group("/api", middleware.Deprecated(legacyAPIDeprecation)))
 }
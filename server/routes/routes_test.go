@@ -1,29 +1,135 @@
 package routes
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/markbakos/infinite-minesweeper/server/config"
+	"github.com/markbakos/infinite-minesweeper/server/controllers"
+	"github.com/markbakos/infinite-minesweeper/server/game"
+	"github.com/markbakos/infinite-minesweeper/server/live"
+	"github.com/markbakos/infinite-minesweeper/server/middleware"
+	"github.com/markbakos/infinite-minesweeper/server/models"
+	"github.com/markbakos/infinite-minesweeper/server/notification"
+	"github.com/markbakos/infinite-minesweeper/server/openapi"
+	"github.com/markbakos/infinite-minesweeper/server/pubsub"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func TestSetupRoutes(t *testing.T) {
+const testJWTSecret = "test-secret-key"
+
+// testAdminID is the only admin known to testAccounts.
+var testAdminID = primitive.NewObjectID().Hex()
+
+// testAccounts stands in for the users collection in tests without a
+// database: every account is an active regular user except testAdminID.
+func testAccounts(_ context.Context, userID string) (middleware.Account, error) {
+	if userID == testAdminID {
+		return middleware.Account{Role: models.RoleAdmin}, nil
+	}
+	return middleware.Account{Role: models.RoleUser}, nil
+}
+
+func newTestRouter(accounts middleware.AccountLookup) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
+	SetupRoutes(router, &config.Config{JWTSecret: testJWTSecret, ChallengeTTL: time.Hour}, slog.New(slog.NewTextHandler(io.Discard, nil)), accounts)
+	return router
+}
 
-	SetupRoutes(router)
+func TestSetupRoutes(t *testing.T) {
+	router := newTestRouter(testAccounts)
 
 	routes := router.Routes()
 
 	expectedRoutes := map[string]string{
-		"/api/auth/login":    "POST",
-		"/api/auth/register": "POST",
-		"/api/auth/guest":    "GET",
-		"/api/leaderboard":   "GET",
-		"/api/user":          "GET",
-		"/api/game/record":   "POST",
-		"/api/game/records":  "GET",
+		"/healthz": "GET",
+		"/readyz":  "GET",
+		"/version": "GET",
+		"/metrics": "GET",
+
+		"/api/openapi.json": "GET",
+
+		"/api/auth/login":             "POST",
+		"/api/auth/register":          "POST",
+		"/api/auth/guest":             "GET",
+		"/api/leaderboard":            "GET",
+		"/api/leaderboard/stream":     "GET",
+		"/api/achievements":           "GET",
+		"/api/ratings":                "GET",
+		"/api/ratings/:id/history":    "GET",
+		"/api/daily":                  "GET",
+		"/api/daily/archive":          "GET",
+		"/api/user":                   "GET",
+		"/api/user/privacy":           "GET,PUT",
+		"/api/users/:username":        "GET",
+		"/api/game/record":            "POST",
+		"/api/game/records":           "GET",
+		"/api/game/daily":             "GET",
+		"/api/game/live":              "GET",
+		"/api/game/live/:id/spectate": "GET",
+
+		"/api/tournaments":              "GET",
+		"/api/tournaments/:id":          "GET",
+		"/api/tournaments/:id/register": "POST,DELETE",
+
+		"/api/friends":                     "GET",
+		"/api/friends/requests":            "POST",
+		"/api/friends/requests/:id/accept": "POST",
+		"/api/friends/requests/:id":        "DELETE",
+		"/api/friends/:id":                 "DELETE",
+		"/api/friends/:id/block":           "POST,DELETE",
+
+		"/api/challenges":             "GET,POST",
+		"/api/challenges/:id":         "GET",
+		"/api/challenges/:id/decline": "POST",
+
+		"/api/notifications":          "GET",
+		"/api/notifications/unread":   "GET",
+		"/api/notifications/read":     "POST",
+		"/api/notifications/:id/read": "POST",
+
+		"/api/admin/users":                  "GET",
+		"/api/admin/users/:id/ban":          "POST",
+		"/api/admin/users/:id/unban":        "POST",
+		"/api/admin/users/:id/username":     "PUT",
+		"/api/admin/users/:id/records":      "DELETE",
+		"/api/admin/leaderboard/:id":        "DELETE",
+		"/api/admin/leaderboard/:id/hide":   "POST",
+		"/api/admin/leaderboard/:id/unhide": "POST",
+		"/api/admin/tournaments":            "POST",
+		"/api/admin/tournaments/:id/cancel": "POST",
+		"/api/admin/audit":                  "GET",
+	}
+
+	versionedRoutes := make(map[string]string)
+	for path, method := range expectedRoutes {
+		if rest, ok := strings.CutPrefix(path, "/api/"); ok {
+			versionedRoutes["/api/v1/"+rest] = method
+		}
 	}
+	maps.Copy(expectedRoutes, versionedRoutes)
 
 	foundRoutes := make(map[string]bool)
 	for _, route := range routes {
@@ -31,7 +137,7 @@ func TestSetupRoutes(t *testing.T) {
 		method := route.Method
 
 		if expectedMethod, exists := expectedRoutes[path]; exists {
-			assert.Equal(t, expectedMethod, method, "Method for route %s should be %s", path, expectedMethod)
+			assert.Contains(t, strings.Split(expectedMethod, ","), method, "Method for route %s should be %s", path, expectedMethod)
 			foundRoutes[path] = true
 		}
 	}
@@ -40,3 +146,673 @@ func TestSetupRoutes(t *testing.T) {
 		assert.True(t, foundRoutes[path], "Expected route %s was not registered", path)
 	}
 }
+
+func TestAPIVersionFallthrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	respond := func(body string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.String(http.StatusOK, body)
+		}
+	}
+
+	v1 := newAPIVersion("v1")
+	v1.group("").GET("/leaderboard", respond("v1 leaderboard"))
+	v1.group("/game").GET("/records", respond("v1 records"))
+
+	v2 := v1.next("v2")
+	v2.group("").GET("/leaderboard", respond("v2 leaderboard"))
+
+	v1.mount(router.Group("/api/v1"))
+	v2.mount(router.Group("/api/v2"))
+
+	tests := []struct {
+		path         string
+		expectedBody string
+	}{
+		{path: "/api/v1/leaderboard", expectedBody: "v1 leaderboard"},
+		{path: "/api/v1/game/records", expectedBody: "v1 records"},
+		{path: "/api/v2/leaderboard", expectedBody: "v2 leaderboard"},
+		{path: "/api/v2/game/records", expectedBody: "v1 records"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tt.expectedBody, resp.Body.String())
+		})
+	}
+}
+
+// specPath converts a gin route pattern such as /users/:id into the OpenAPI
+// form /users/{id}.
+func specPath(ginPath string) string {
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	router := newTestRouter(testAccounts)
+
+	doc, err := openapi.Spec()
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.Background()))
+
+	registered := make(map[string]bool)
+	for _, route := range router.Routes() {
+		key := route.Method + " " + specPath(route.Path)
+		registered[key] = true
+
+		pathItem := doc.Paths.Find(specPath(route.Path))
+		if assert.NotNil(t, pathItem, "route %s is missing from the OpenAPI spec", key) {
+			assert.NotNil(t, pathItem.GetOperation(route.Method), "route %s is missing from the OpenAPI spec", key)
+		}
+	}
+
+	for path, pathItem := range doc.Paths.Map() {
+		for method := range pathItem.Operations() {
+			assert.True(t, registered[method+" "+path], "OpenAPI spec documents %s %s which is not registered", method, path)
+		}
+	}
+}
+
+func TestOpenAPIEndpoint(t *testing.T) {
+	router := newTestRouter(testAccounts)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, "3.0.3", body["openapi"])
+	assert.Contains(t, body["paths"], "/api/v1/auth/login")
+	assert.Contains(t, body["paths"], "/api/auth/login")
+}
+
+func testToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	require.NoError(t, err)
+	return token
+}
+
+type contractCase struct {
+	name           string
+	method         string
+	path           string
+	token          string
+	body           any
+	expectedStatus int
+	// timeout ends the request after the given time, for streaming
+	// responses that only finish when the client disconnects.
+	timeout time.Duration
+}
+
+// contractChecker sends requests through the gin router and validates every
+// response against the OpenAPI document, recording which operations were
+// exercised.
+type contractChecker struct {
+	router    *gin.Engine
+	specRoute routers.Router
+	covered   map[string]bool
+}
+
+func newContractChecker(t *testing.T, router *gin.Engine) *contractChecker {
+	t.Helper()
+
+	doc, err := openapi.Spec()
+	require.NoError(t, err)
+
+	specRouter, err := gorillamux.NewRouter(doc)
+	require.NoError(t, err)
+
+	return &contractChecker{router: router, specRoute: specRouter, covered: make(map[string]bool)}
+}
+
+func (cc *contractChecker) run(t *testing.T, tc contractCase) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body io.Reader
+	if tc.body != nil {
+		raw, err := json.Marshal(tc.body)
+		require.NoError(t, err)
+		body = bytes.NewReader(raw)
+	}
+
+	req := httptest.NewRequest(tc.method, tc.path, body)
+	if tc.timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), tc.timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	if tc.body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if tc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+	}
+
+	resp := httptest.NewRecorder()
+	cc.router.ServeHTTP(resp, req)
+	require.Equal(t, tc.expectedStatus, resp.Code, "unexpected status, body: %s", resp.Body.String())
+
+	route, pathParams, err := cc.specRoute.FindRoute(req)
+	require.NoError(t, err, "no OpenAPI operation for %s %s", tc.method, tc.path)
+	cc.covered[route.Method+" "+route.Path] = true
+
+	err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+		},
+		Status: resp.Code,
+		Header: resp.Header(),
+		Body:   io.NopCloser(bytes.NewReader(resp.Body.Bytes())),
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+		},
+	})
+	assert.NoError(t, err, "response does not match the OpenAPI spec, body: %s", resp.Body.String())
+
+	return resp
+}
+
+func TestAPIContract(t *testing.T) {
+	router := newTestRouter(testAccounts)
+	cc := newContractChecker(t, router)
+
+	invalidUserToken := testToken(t, jwt.MapClaims{"user_id": "not-an-object-id", "role": models.RoleUser})
+	guestToken := testToken(t, jwt.MapClaims{"user_id": primitive.NewObjectID().Hex(), "guest": true})
+	adminToken := testToken(t, jwt.MapClaims{"user_id": testAdminID, "role": models.RoleAdmin})
+
+	tests := []contractCase{
+		{name: "Liveness", method: http.MethodGet, path: "/healthz", expectedStatus: http.StatusOK},
+		{name: "Readiness", method: http.MethodGet, path: "/readyz", expectedStatus: http.StatusOK},
+		{name: "Version", method: http.MethodGet, path: "/version", expectedStatus: http.StatusOK},
+		{name: "Metrics", method: http.MethodGet, path: "/metrics", expectedStatus: http.StatusOK},
+		{name: "OpenAPI Document", method: http.MethodGet, path: "/api/v1/openapi.json", expectedStatus: http.StatusOK},
+
+		{name: "Guest Session", method: http.MethodGet, path: "/api/v1/auth/guest", expectedStatus: http.StatusOK},
+		{name: "Login Missing Fields", method: http.MethodPost, path: "/api/v1/auth/login", body: map[string]any{}, expectedStatus: http.StatusBadRequest},
+		{name: "Login Missing Body", method: http.MethodPost, path: "/api/v1/auth/login", expectedStatus: http.StatusBadRequest},
+		{name: "Register Missing Password", method: http.MethodPost, path: "/api/v1/auth/register", body: map[string]any{"username": "player"}, expectedStatus: http.StatusBadRequest},
+
+		{name: "Leaderboard Invalid Scope", method: http.MethodGet, path: "/api/v1/leaderboard?scope=world", expectedStatus: http.StatusBadRequest},
+		{name: "Friends Leaderboard Without Token", method: http.MethodGet, path: "/api/v1/leaderboard?scope=friends", expectedStatus: http.StatusUnauthorized},
+		{name: "Friends Leaderboard Guest", method: http.MethodGet, path: "/api/v1/leaderboard?scope=friends", token: guestToken, expectedStatus: http.StatusForbidden},
+		{name: "Leaderboard Invalid Token", method: http.MethodGet, path: "/api/v1/leaderboard", token: "garbage", expectedStatus: http.StatusUnauthorized},
+		{name: "Profile Invalid Token", method: http.MethodGet, path: "/api/v1/users/contract_player", token: "garbage", expectedStatus: http.StatusUnauthorized},
+		{name: "Privacy Without Token", method: http.MethodGet, path: "/api/v1/user/privacy", expectedStatus: http.StatusUnauthorized},
+		{name: "Privacy Guest", method: http.MethodGet, path: "/api/v1/user/privacy", token: guestToken, expectedStatus: http.StatusForbidden},
+		{name: "Update Privacy Guest", method: http.MethodPut, path: "/api/v1/user/privacy", token: guestToken, body: map[string]any{"rank": "private"}, expectedStatus: http.StatusForbidden},
+		{name: "Update Privacy Invalid Visibility", method: http.MethodPut, path: "/api/v1/user/privacy", token: adminToken, body: map[string]any{"rank": "everyone"}, expectedStatus: http.StatusBadRequest},
+		{name: "Achievements Invalid Token", method: http.MethodGet, path: "/api/v1/achievements", token: "garbage", expectedStatus: http.StatusUnauthorized},
+		{name: "Leaderboard Stream Invalid Game Type", method: http.MethodGet, path: "/api/v1/leaderboard/stream?gameType=hard", expectedStatus: http.StatusBadRequest},
+		{name: "Leaderboard Stream Invalid Limit", method: http.MethodGet, path: "/api/v1/leaderboard/stream?limit=0", expectedStatus: http.StatusBadRequest},
+
+		{name: "Ratings Invalid Mode", method: http.MethodGet, path: "/api/v1/ratings?mode=normal", expectedStatus: http.StatusBadRequest},
+		{name: "Rating History Invalid ID", method: http.MethodGet, path: "/api/v1/ratings/nope/history", expectedStatus: http.StatusBadRequest},
+
+		{name: "Daily Invalid Game Type", method: http.MethodGet, path: "/api/v1/daily?gameType=hard", expectedStatus: http.StatusBadRequest},
+		{name: "Daily Future Date", method: http.MethodGet, path: "/api/v1/daily?date=2999-01-01", expectedStatus: http.StatusBadRequest},
+		{name: "Daily Malformed Date", method: http.MethodGet, path: "/api/v1/daily?date=yesterday", expectedStatus: http.StatusBadRequest},
+		{name: "Daily Archive Invalid Game Type", method: http.MethodGet, path: "/api/v1/daily/archive?gameType=hard", expectedStatus: http.StatusBadRequest},
+
+		{name: "Tournaments Invalid State", method: http.MethodGet, path: "/api/v1/tournaments?state=paused", expectedStatus: http.StatusBadRequest},
+		{name: "Tournament Invalid ID", method: http.MethodGet, path: "/api/v1/tournaments/nope", expectedStatus: http.StatusBadRequest},
+		{name: "Tournament Register Without Token", method: http.MethodPost, path: "/api/v1/tournaments/nope/register", expectedStatus: http.StatusUnauthorized},
+		{name: "Tournament Register Guest", method: http.MethodPost, path: "/api/v1/tournaments/" + primitive.NewObjectID().Hex() + "/register", token: guestToken, expectedStatus: http.StatusForbidden},
+		{name: "Tournament Withdraw Invalid ID", method: http.MethodDelete, path: "/api/v1/tournaments/nope/register", token: guestToken, expectedStatus: http.StatusBadRequest},
+
+		{name: "Friends Without Token", method: http.MethodGet, path: "/api/v1/friends", expectedStatus: http.StatusUnauthorized},
+		{name: "Friends Guest", method: http.MethodGet, path: "/api/v1/friends", token: guestToken, expectedStatus: http.StatusForbidden},
+		{name: "Friend Request Guest", method: http.MethodPost, path: "/api/v1/friends/requests", token: guestToken, body: models.FriendRequestRequest{Username: "player"}, expectedStatus: http.StatusForbidden},
+		{name: "Accept Friend Request Invalid ID", method: http.MethodPost, path: "/api/v1/friends/requests/nope/accept", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Decline Friend Request Invalid ID", method: http.MethodDelete, path: "/api/v1/friends/requests/nope", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Remove Friend Invalid ID", method: http.MethodDelete, path: "/api/v1/friends/nope", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Block Invalid ID", method: http.MethodPost, path: "/api/v1/friends/nope/block", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Unblock Invalid ID", method: http.MethodDelete, path: "/api/v1/friends/nope/block", token: adminToken, expectedStatus: http.StatusBadRequest},
+
+		{name: "Challenges Without Token", method: http.MethodGet, path: "/api/v1/challenges", expectedStatus: http.StatusUnauthorized},
+		{name: "Challenges Invalid State", method: http.MethodGet, path: "/api/v1/challenges?state=lost", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Create Challenge Guest", method: http.MethodPost, path: "/api/v1/challenges", token: guestToken, body: models.CreateChallengeRequest{GameType: "normal"}, expectedStatus: http.StatusForbidden},
+		{name: "Create Challenge Invalid Game Type", method: http.MethodPost, path: "/api/v1/challenges", token: adminToken, body: map[string]any{"game_type": "hard"}, expectedStatus: http.StatusBadRequest},
+		{name: "Challenge Invalid ID", method: http.MethodGet, path: "/api/v1/challenges/nope", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Decline Challenge Invalid ID", method: http.MethodPost, path: "/api/v1/challenges/nope/decline", token: adminToken, expectedStatus: http.StatusBadRequest},
+
+		{name: "Notifications Without Token", method: http.MethodGet, path: "/api/v1/notifications", expectedStatus: http.StatusUnauthorized},
+		{name: "Notifications Invalid Unread", method: http.MethodGet, path: "/api/v1/notifications?unread=maybe", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Unread Notifications Without Token", method: http.MethodGet, path: "/api/v1/notifications/unread", expectedStatus: http.StatusUnauthorized},
+		{name: "Read All Notifications Without Token", method: http.MethodPost, path: "/api/v1/notifications/read", expectedStatus: http.StatusUnauthorized},
+		{name: "Read Notification Invalid ID", method: http.MethodPost, path: "/api/v1/notifications/nope/read", token: adminToken, expectedStatus: http.StatusBadRequest},
+
+		{name: "Current User Without Token", method: http.MethodGet, path: "/api/v1/user", expectedStatus: http.StatusUnauthorized},
+		{name: "Current User Invalid ID", method: http.MethodGet, path: "/api/v1/user", token: invalidUserToken, expectedStatus: http.StatusBadRequest},
+		{name: "Save Record Without Token", method: http.MethodPost, path: "/api/v1/game/record", body: map[string]any{}, expectedStatus: http.StatusUnauthorized},
+		{name: "Save Record Invalid Game Type", method: http.MethodPost, path: "/api/v1/game/record", token: guestToken, body: map[string]any{"game_type": "hard", "score": 10, "time_in_seconds": 5}, expectedStatus: http.StatusBadRequest},
+		{name: "Records Invalid Token", method: http.MethodGet, path: "/api/v1/game/records", token: "garbage", expectedStatus: http.StatusUnauthorized},
+		{name: "Races Without Token", method: http.MethodGet, path: "/api/v1/game/races", expectedStatus: http.StatusUnauthorized},
+		{name: "Daily Attempts Without Token", method: http.MethodGet, path: "/api/v1/game/daily", expectedStatus: http.StatusUnauthorized},
+		{name: "Records Invalid ID", method: http.MethodGet, path: "/api/v1/game/records", token: invalidUserToken, expectedStatus: http.StatusBadRequest},
+
+		{name: "Live Game Without Token", method: http.MethodGet, path: "/api/v1/game/live", expectedStatus: http.StatusUnauthorized},
+		{name: "Live Game Unavailable", method: http.MethodGet, path: "/api/v1/game/live?access_token=" + guestToken, expectedStatus: http.StatusServiceUnavailable},
+		{name: "Spectate Unavailable", method: http.MethodGet, path: "/api/v1/game/live/abc123/spectate", expectedStatus: http.StatusServiceUnavailable},
+
+		{name: "Admin Users Without Token", method: http.MethodGet, path: "/api/v1/admin/users", expectedStatus: http.StatusUnauthorized},
+		{name: "Admin Users As Guest", method: http.MethodGet, path: "/api/v1/admin/users", token: guestToken, expectedStatus: http.StatusForbidden},
+		{name: "Ban Invalid ID", method: http.MethodPost, path: "/api/v1/admin/users/nope/ban", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Unban Invalid ID", method: http.MethodPost, path: "/api/v1/admin/users/nope/unban", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Rename Invalid ID", method: http.MethodPut, path: "/api/v1/admin/users/nope/username", token: adminToken, body: map[string]any{"username": "renamed"}, expectedStatus: http.StatusBadRequest},
+		{name: "Reset Records Invalid ID", method: http.MethodDelete, path: "/api/v1/admin/users/nope/records", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Delete Entry Invalid ID", method: http.MethodDelete, path: "/api/v1/admin/leaderboard/nope", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Hide Entry Invalid ID", method: http.MethodPost, path: "/api/v1/admin/leaderboard/nope/hide", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Unhide Entry Invalid ID", method: http.MethodPost, path: "/api/v1/admin/leaderboard/nope/unhide", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Create Tournament Missing Fields", method: http.MethodPost, path: "/api/v1/admin/tournaments", token: adminToken, body: map[string]any{"name": "Cup"}, expectedStatus: http.StatusBadRequest},
+		{name: "Create Tournament Without Rounds", method: http.MethodPost, path: "/api/v1/admin/tournaments", token: adminToken, body: map[string]any{"name": "Cup", "format": "swiss", "game_type": "normal", "round_minutes": 30, "starts_at": "2999-01-01T00:00:00Z"}, expectedStatus: http.StatusBadRequest},
+		{name: "Create Tournament In The Past", method: http.MethodPost, path: "/api/v1/admin/tournaments", token: adminToken, body: map[string]any{"name": "Cup", "format": "single_elimination", "game_type": "normal", "round_minutes": 30, "starts_at": "2000-01-01T00:00:00Z"}, expectedStatus: http.StatusBadRequest},
+		{name: "Cancel Tournament Invalid ID", method: http.MethodPost, path: "/api/v1/admin/tournaments/nope/cancel", token: adminToken, expectedStatus: http.StatusBadRequest},
+		{name: "Audit Invalid Since", method: http.MethodGet, path: "/api/v1/admin/audit?since=yesterday", token: adminToken, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := cc.run(t, tt)
+			assert.Empty(t, resp.Header().Get("Deprecation"))
+		})
+
+		rest, versioned := strings.CutPrefix(tt.path, "/api/v1/")
+		if !versioned {
+			continue
+		}
+		legacy := tt
+		legacy.path = "/api/" + rest
+		t.Run(tt.name+" Legacy Alias", func(t *testing.T) {
+			resp := cc.run(t, legacy)
+			assert.NotEmpty(t, resp.Header().Get("Deprecation"))
+			assert.Contains(t, resp.Header().Get("Link"), "</api/v1/"+strings.Split(rest, "?")[0]+">")
+		})
+	}
+
+	doc, err := openapi.Spec()
+	require.NoError(t, err)
+	for path, pathItem := range doc.Paths.Map() {
+		for method := range pathItem.Operations() {
+			assert.True(t, cc.covered[method+" "+path], "no contract test exercises %s %s", method, path)
+		}
+	}
+}
+
+// TestAPIContractWithDatabase exercises the success paths against a real
+// MongoDB deployment. It is skipped unless TEST_MONGODB_URI is set and uses a
+// throwaway database that is dropped afterwards.
+func TestAPIContractWithDatabase(t *testing.T) {
+	uri := os.Getenv("TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URI not set")
+	}
+
+	ctx := context.Background()
+	cfg := &config.Config{MongoURI: uri, DBName: fmt.Sprintf("minesweeper_contract_%d", time.Now().UnixNano())}
+	require.NoError(t, config.ConnectDB(ctx, cfg))
+	t.Cleanup(func() {
+		_ = config.DB.Drop(ctx)
+		_ = config.DisconnectDB(ctx)
+	})
+	require.NoError(t, controllers.EnsureDailyIndexes(ctx))
+	require.NoError(t, controllers.EnsureRatingIndexes(ctx))
+	require.NoError(t, notification.EnsureIndexes(ctx, 2*time.Hour))
+	require.NoError(t, notification.EnsureIndexes(ctx, time.Hour), "a changed retention updates the expiry index")
+	notification.Start(notification.Options{Limit: 50, Retention: time.Hour}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { _ = notification.Stop(ctx) })
+
+	router := newTestRouter(controllers.LookupAccount)
+	cc := newContractChecker(t, router)
+
+	decode := func(resp *httptest.ResponseRecorder, v any) {
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), v))
+	}
+
+	var admin, player models.AuthResponse
+	decode(cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/auth/register", body: models.RegisterRequest{Username: "contract_admin", Password: "password123"}, expectedStatus: http.StatusCreated}), &admin)
+	decode(cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/auth/register", body: models.RegisterRequest{Username: "contract_player", Password: "password123"}, expectedStatus: http.StatusCreated}), &player)
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/auth/register", body: models.RegisterRequest{Username: "contract_player", Password: "password123"}, expectedStatus: http.StatusConflict})
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/auth/login", body: models.LoginRequest{Username: "contract_player", Password: "wrong-password"}, expectedStatus: http.StatusUnauthorized})
+
+	_, err := config.GetCollection("users").UpdateOne(ctx, bson.M{"username": "contract_admin"}, bson.M{"$set": bson.M{"role": models.RoleAdmin}})
+	require.NoError(t, err)
+	decode(cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/auth/login", body: models.LoginRequest{Username: "contract_admin", Password: "password123"}, expectedStatus: http.StatusOK}), &admin)
+
+	var me models.CurrentUserResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/user", token: player.Token, expectedStatus: http.StatusOK}), &me)
+
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/game/record", token: player.Token, body: models.SaveGameRecordRequest{GameType: "normal", Score: 42, TimeInSeconds: 30}, expectedStatus: http.StatusOK})
+	cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/game/records", token: player.Token, expectedStatus: http.StatusOK})
+	cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/game/races", token: player.Token, expectedStatus: http.StatusOK})
+
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/game/record", token: player.Token, body: models.SaveGameRecordRequest{GameType: "normal", Score: 50, TimeInSeconds: 80}, expectedStatus: http.StatusOK})
+	win := models.FinishedGame{PlayerID: me.ID, GameType: "normal", Won: true, Score: 50, TimeInSeconds: 80, FinishedAt: time.Now()}
+	require.NoError(t, controllers.RecordFinishedGame(ctx, win))
+	win.FlagsPlaced = 3
+	require.NoError(t, controllers.RecordFinishedGame(ctx, win), "achievements are awarded once")
+	var achievements models.AchievementListResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/achievements", token: player.Token, expectedStatus: http.StatusOK}), &achievements)
+	assert.EqualValues(t, 2, achievements.Players)
+	unlocked := map[string]models.Achievement{}
+	for _, a := range achievements.Achievements {
+		if a.UnlockedAt != nil {
+			unlocked[a.ID] = a
+		}
+	}
+	assert.Len(t, unlocked, 3)
+	assert.Contains(t, unlocked, "first_win")
+	assert.Contains(t, unlocked, "normal_under_100s")
+	assert.EqualValues(t, 1, unlocked["no_flags"].Unlocked)
+	assert.EqualValues(t, 50, unlocked["no_flags"].Percentage)
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/achievements", expectedStatus: http.StatusOK}), &achievements)
+	for _, a := range achievements.Achievements {
+		assert.Nil(t, a.UnlockedAt)
+	}
+
+	var privacy models.PrivacySettings
+	decode(cc.run(t, contractCase{method: http.MethodPut, path: "/api/v1/user/privacy", token: player.Token, body: models.PrivacySettings{RecentGames: models.VisibilityPrivate, Achievements: models.VisibilityFriends}, expectedStatus: http.StatusOK}), &privacy)
+	assert.Equal(t, models.VisibilityPublic, privacy.Rank)
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/user/privacy", token: player.Token, expectedStatus: http.StatusOK}), &privacy)
+	assert.Equal(t, models.VisibilityPrivate, privacy.RecentGames)
+	var profile models.PublicProfile
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/users/contract_player", expectedStatus: http.StatusOK}), &profile)
+	assert.ElementsMatch(t, []string{models.ProfileSectionAchievements, models.ProfileSectionRecentGames}, profile.Hidden)
+	assert.Empty(t, profile.RecentGames)
+	require.Len(t, profile.PersonalBests, 1)
+	assert.Equal(t, 50, profile.PersonalBests[0].Score)
+	require.Len(t, profile.Ranks, 1)
+	assert.EqualValues(t, 1, profile.Ranks[0].Rank)
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/users/contract_player", token: player.Token, expectedStatus: http.StatusOK}), &profile)
+	assert.Empty(t, profile.Hidden)
+	assert.Len(t, profile.RecentGames, 2)
+	assert.Equal(t, "First Sweep", profile.Achievements[0].Name)
+	cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/users/nobody", expectedStatus: http.StatusNotFound})
+
+	var adminMe models.CurrentUserResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/user", token: admin.Token, expectedStatus: http.StatusOK}), &adminMe)
+	race := models.RaceResult{ID: primitive.NewObjectID(), GameType: game.TypeRace, Ranked: true, FinishedAt: time.Now(), Players: []models.RacePlacement{
+		{PlayerID: me.ID, Place: 1},
+		{PlayerID: primitive.NewObjectID().Hex(), IsGuest: true, Place: 2},
+		{PlayerID: adminMe.ID, Place: 3},
+	}}
+	require.NoError(t, controllers.SaveRaceResult(ctx, race))
+	// A retry after the admin's rating failed to save rates only them.
+	_, err = config.GetCollection("ratings").DeleteOne(ctx, bson.M{"user_id": adminMe.ID})
+	require.NoError(t, err)
+	require.NoError(t, controllers.SaveRaceResult(ctx, race))
+	var ratings models.RatingListResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/ratings?mode=race", expectedStatus: http.StatusOK}), &ratings)
+	require.Len(t, ratings.Ratings, 2, "guests are not rated")
+	assert.Equal(t, "contract_player", ratings.Ratings[0].Username)
+	for _, r := range ratings.Ratings {
+		assert.Equal(t, 1, r.Matches, "a retried race is rated once")
+	}
+	races, err := config.GetCollection("race_results").CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, races)
+	var history models.RatingHistoryResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/ratings/" + me.ID + "/history", expectedStatus: http.StatusOK}), &history)
+	require.Len(t, history.History, 1)
+	assert.Positive(t, history.History[0].Change)
+
+	today := game.DailyDate(time.Now())
+	yesterday := game.DailyDate(time.Now().AddDate(0, 0, -1))
+	for _, date := range []string{yesterday, today} {
+		attempt := models.DailyAttempt{Date: date, GameType: "normal", Seed: 7, UserID: me.ID, State: models.AttemptPlaying, StartedAt: time.Now()}
+		require.NoError(t, controllers.StartDailyAttempt(ctx, attempt))
+		require.ErrorIs(t, controllers.StartDailyAttempt(ctx, attempt), live.ErrDailyAttempted, "one attempt per day")
+		finishedAt := time.Now()
+		attempt.State, attempt.Score, attempt.FinishedAt = models.AttemptWon, 90, &finishedAt
+		require.NoError(t, controllers.RecordDailyAttempt(ctx, attempt))
+	}
+	guestFinishedAt := time.Now()
+	guestAttempt := models.DailyAttempt{Date: today, GameType: "normal", Seed: 7, GuestID: "guest-scout", IsGuest: true, State: models.AttemptPlaying, StartedAt: time.Now()}
+	require.NoError(t, controllers.StartDailyAttempt(ctx, guestAttempt))
+	guestAttempt.State, guestAttempt.Score, guestAttempt.FinishedAt = models.AttemptWon, 999, &guestFinishedAt
+	require.NoError(t, controllers.RecordDailyAttempt(ctx, guestAttempt))
+	_, err = config.GetCollection("daily_attempts").InsertOne(ctx, models.DailyAttempt{Date: today, GameType: "normal", UserID: me.ID})
+	assert.True(t, mongo.IsDuplicateKeyError(err), "the index allows one attempt per player")
+	var daily models.DailyLeaderboardResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/daily?gameType=normal", expectedStatus: http.StatusOK}), &daily)
+	require.Len(t, daily.Attempts, 1, "guest attempts are not ranked")
+	assert.Equal(t, "contract_player", daily.Attempts[0].Username)
+	assert.Zero(t, daily.Attempts[0].Seed, "today's board stays secret")
+	assert.Zero(t, daily.Seed)
+	var archive models.DailyArchiveResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/daily/archive", expectedStatus: http.StatusOK}), &archive)
+	require.Len(t, archive.Days, 1)
+	assert.Equal(t, models.DailySummary{Date: yesterday, GameType: "normal", Seed: 7, Players: 1, TopScore: 90, TopUsername: "contract_player"}, archive.Days[0])
+	var attempts models.DailyAttemptListResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/game/daily", token: player.Token, expectedStatus: http.StatusOK}), &attempts)
+	assert.EqualValues(t, 2, attempts.Total)
+
+	var cup models.Tournament
+	decode(cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/admin/tournaments", token: admin.Token, body: models.CreateTournamentRequest{
+		Name: "Contract Cup", Format: "single_elimination", GameType: "normal", RoundMinutes: 30, StartsAt: time.Now().Add(time.Hour), Seeds: []int64{11},
+	}, expectedStatus: http.StatusCreated}), &cup)
+	for _, token := range []string{player.Token, admin.Token} {
+		cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/tournaments/" + cup.ID.Hex() + "/register", token: token, expectedStatus: http.StatusOK})
+	}
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/tournaments/" + cup.ID.Hex() + "/register", token: player.Token, expectedStatus: http.StatusConflict})
+	_, err = config.GetCollection("tournaments").UpdateOne(ctx, bson.M{"_id": cup.ID}, bson.M{"$set": bson.M{"starts_at": time.Now().Add(-time.Minute)}})
+	require.NoError(t, err)
+	require.NoError(t, controllers.AdvanceTournaments(ctx, time.Now()))
+	cc.run(t, contractCase{method: http.MethodDelete, path: "/api/v1/tournaments/" + cup.ID.Hex() + "/register", token: player.Token, expectedStatus: http.StatusConflict})
+
+	for i, id := range []string{me.ID, adminMe.ID} {
+		g, err := controllers.StartTournamentGame(ctx, cup.ID.Hex(), id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(11), g.Seed)
+		_, err = controllers.StartTournamentGame(ctx, cup.ID.Hex(), id)
+		require.ErrorIs(t, err, live.ErrTournamentGamePlayed)
+		if i == 1 {
+			// The admin's live session is lost, as after a restart, so
+			// their game is never recorded.
+			continue
+		}
+		finishedAt := time.Now()
+		g.State, g.Score, g.FinishedAt = models.AttemptLost, 20, &finishedAt
+		require.NoError(t, controllers.RecordTournamentGame(ctx, g))
+	}
+	require.NoError(t, controllers.AdvanceTournaments(ctx, time.Now()))
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/tournaments/" + cup.ID.Hex(), expectedStatus: http.StatusOK}), &cup)
+	assert.Equal(t, models.TournamentRunning, cup.State, "the round waits for the unfinished game")
+	require.NoError(t, controllers.AdvanceTournaments(ctx, time.Now().Add(time.Hour)))
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/tournaments/" + cup.ID.Hex(), expectedStatus: http.StatusOK}), &cup)
+	assert.Equal(t, models.TournamentFinished, cup.State)
+	require.Len(t, cup.Players, 2)
+	assert.Equal(t, "contract_player", cup.Players[0].Username)
+	assert.Equal(t, 1, cup.Players[0].Rank)
+	assert.Equal(t, int64(11), cup.Rounds[0].Seed, "a closed round's seed is published")
+	assert.Equal(t, []string{adminMe.ID}, cup.Rounds[0].Abandoned)
+	var lost models.TournamentGame
+	require.NoError(t, config.GetCollection("tournament_games").FindOne(ctx, bson.M{"tournament_id": cup.ID.Hex(), "user_id": adminMe.ID}).Decode(&lost))
+	assert.Equal(t, models.AttemptAbandoned, lost.State)
+	var tournaments models.TournamentListResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/tournaments?state=finished", expectedStatus: http.StatusOK}), &tournaments)
+	assert.EqualValues(t, 1, tournaments.Total)
+
+	toAdmin := models.FriendRequestRequest{Username: "contract_admin"}
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/friends/requests", token: player.Token, body: toAdmin, expectedStatus: http.StatusCreated})
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/friends/requests", token: player.Token, body: toAdmin, expectedStatus: http.StatusConflict})
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/friends/requests/" + me.ID + "/accept", token: admin.Token, expectedStatus: http.StatusOK})
+	var friends models.FriendListResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/friends", token: player.Token, expectedStatus: http.StatusOK}), &friends)
+	require.Len(t, friends.Friends, 1)
+	assert.Equal(t, "contract_admin", friends.Friends[0].Username)
+	var friendsPage models.LeaderboardPageResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/leaderboard?scope=friends", token: player.Token, expectedStatus: http.StatusOK}), &friendsPage)
+	require.Len(t, friendsPage.Leaderboard, 1)
+	assert.Equal(t, me.ID, friendsPage.Leaderboard[0].UserID)
+	cc.run(t, contractCase{method: http.MethodDelete, path: "/api/v1/friends/" + adminMe.ID, token: player.Token, expectedStatus: http.StatusOK})
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/friends/requests", token: player.Token, body: toAdmin, expectedStatus: http.StatusCreated})
+	cc.run(t, contractCase{method: http.MethodDelete, path: "/api/v1/friends/requests/" + me.ID, token: admin.Token, expectedStatus: http.StatusOK})
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/friends/" + me.ID + "/block", token: admin.Token, expectedStatus: http.StatusOK})
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/friends/requests", token: player.Token, body: toAdmin, expectedStatus: http.StatusNotFound})
+	cc.run(t, contractCase{method: http.MethodDelete, path: "/api/v1/friends/" + me.ID + "/block", token: admin.Token, expectedStatus: http.StatusOK})
+	cc.run(t, contractCase{method: http.MethodDelete, path: "/api/v1/friends/" + me.ID + "/block", token: admin.Token, expectedStatus: http.StatusNotFound})
+
+	seed := int64(21)
+	var duel models.Challenge
+	decode(cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/challenges", token: player.Token, body: models.CreateChallengeRequest{Username: "contract_admin", GameType: "normal", Seed: &seed}, expectedStatus: http.StatusCreated}), &duel)
+	assert.Equal(t, models.ChallengePending, duel.State)
+	assert.Equal(t, "contract_admin", duel.OpponentName)
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/challenges", token: player.Token, body: models.CreateChallengeRequest{Username: "contract_player", GameType: "normal"}, expectedStatus: http.StatusBadRequest})
+	_, err = controllers.StartChallengeGame(ctx, duel.ID.Hex(), adminMe.ID)
+	require.ErrorIs(t, err, live.ErrNoChallenge, "the challenger plays first")
+	for i, id := range []string{me.ID, adminMe.ID} {
+		g, err := controllers.StartChallengeGame(ctx, duel.ID.Hex(), id)
+		require.NoError(t, err)
+		assert.Equal(t, seed, g.Seed)
+		_, err = controllers.StartChallengeGame(ctx, duel.ID.Hex(), id)
+		require.ErrorIs(t, err, live.ErrChallengePlayed)
+		if i == 1 {
+			decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/challenges/" + duel.ID.Hex(), token: admin.Token, expectedStatus: http.StatusOK}), &duel)
+			assert.Zero(t, duel.Seed, "the board stays secret until the challenge is over")
+			require.NotNil(t, duel.Challenger)
+			assert.Empty(t, duel.Challenger.Replay)
+		}
+		finishedAt := time.Now()
+		g.State, g.Score, g.FinishedAt = models.AttemptLost, 10*(i+1), &finishedAt
+		g.Replay = []models.ReplayMove{{Type: live.CommandReveal, X: 1, Y: 2}}
+		decided, err := controllers.RecordChallengeGame(ctx, g)
+		require.NoError(t, err)
+		assert.Equal(t, i == 1, decided != nil)
+	}
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/challenges/" + duel.ID.Hex(), token: admin.Token, expectedStatus: http.StatusOK}), &duel)
+	assert.Equal(t, models.ChallengeCompleted, duel.State)
+	assert.Equal(t, adminMe.ID, duel.WinnerID)
+	require.NotNil(t, duel.Challenger)
+	assert.Len(t, duel.Challenger.Replay, 1)
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/challenges/" + duel.ID.Hex() + "/decline", token: admin.Token, expectedStatus: http.StatusConflict})
+	var stuck models.Challenge
+	decode(cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/challenges", token: player.Token, body: models.CreateChallengeRequest{Username: "contract_admin", GameType: "normal"}, expectedStatus: http.StatusCreated}), &stuck)
+	g, err := controllers.StartChallengeGame(ctx, stuck.ID.Hex(), me.ID)
+	require.NoError(t, err)
+	finishedAt := time.Now()
+	g.State, g.Score, g.FinishedAt = models.AttemptLost, 10, &finishedAt
+	_, err = controllers.RecordChallengeGame(ctx, g)
+	require.NoError(t, err)
+	_, err = controllers.StartChallengeGame(ctx, stuck.ID.Hex(), adminMe.ID)
+	require.NoError(t, err)
+	require.NoError(t, controllers.CloseExpiredChallenges(ctx, time.Now()), "the opponent still has time")
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/challenges/" + stuck.ID.Hex(), token: player.Token, expectedStatus: http.StatusOK}), &stuck)
+	assert.Equal(t, models.ChallengePlaying, stuck.State)
+	require.NoError(t, controllers.CloseExpiredChallenges(ctx, time.Now().Add(2*time.Hour)))
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/challenges/" + stuck.ID.Hex(), token: player.Token, expectedStatus: http.StatusOK}), &stuck)
+	assert.Equal(t, models.ChallengeCompleted, stuck.State)
+	assert.Equal(t, me.ID, stuck.WinnerID, "a game lost past the deadline is abandoned")
+	require.NotNil(t, stuck.Opponent)
+	assert.Equal(t, models.AttemptAbandoned, stuck.Opponent.State)
+	var link models.Challenge
+	decode(cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/challenges", token: admin.Token, body: models.CreateChallengeRequest{GameType: "infinite"}, expectedStatus: http.StatusCreated}), &link)
+	cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/challenges/" + link.ID.Hex(), token: player.Token, expectedStatus: http.StatusOK})
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/challenges/" + link.ID.Hex() + "/decline", token: player.Token, expectedStatus: http.StatusNotFound})
+	var inbox models.ChallengeListResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/challenges?state=completed", token: player.Token, expectedStatus: http.StatusOK}), &inbox)
+	assert.EqualValues(t, 2, inbox.Total)
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/challenges", token: admin.Token, expectedStatus: http.StatusOK}), &inbox)
+	assert.EqualValues(t, 3, inbox.Total)
+
+	// Stopping the writer stores every queued notification.
+	require.NoError(t, notification.Stop(ctx))
+	var inboxPage models.NotificationListResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/notifications?unread=true", token: admin.Token, expectedStatus: http.StatusOK}), &inboxPage)
+	require.NotEmpty(t, inboxPage.Notifications)
+	assert.Equal(t, inboxPage.Total, inboxPage.Unread)
+	assert.Equal(t, "challenge_completed", inboxPage.Notifications[0].Type)
+	assert.True(t, slices.ContainsFunc(inboxPage.Notifications, func(n models.Notification) bool { return n.Type == "challenge_received" }),
+		"the opponent is told once the challenger has played")
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/notifications/" + inboxPage.Notifications[0].ID.Hex() + "/read", token: admin.Token, expectedStatus: http.StatusOK})
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/notifications/" + inboxPage.Notifications[0].ID.Hex() + "/read", token: player.Token, expectedStatus: http.StatusNotFound})
+	var unread models.UnreadCountResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/notifications/unread", token: admin.Token, expectedStatus: http.StatusOK}), &unread)
+	assert.Equal(t, inboxPage.Unread-1, unread.Unread)
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/notifications/read", token: admin.Token, expectedStatus: http.StatusOK})
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/notifications/unread", token: admin.Token, expectedStatus: http.StatusOK}), &unread)
+	assert.Zero(t, unread.Unread)
+
+	var page models.LeaderboardPageResponse
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/leaderboard?gameType=normal", expectedStatus: http.StatusOK}), &page)
+	require.NotEmpty(t, page.Leaderboard)
+	entryID := page.Leaderboard[0].ID.Hex()
+	require.NotEmpty(t, page.Leaderboard[0].Profile)
+	cc.run(t, contractCase{method: http.MethodGet, path: page.Leaderboard[0].Profile, expectedStatus: http.StatusOK})
+
+	stream := cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/leaderboard/stream?gameType=normal&limit=5", expectedStatus: http.StatusOK, timeout: 200 * time.Millisecond})
+	assert.Equal(t, "text/event-stream", stream.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(stream.Body.String(), "event: snapshot\ndata: {"), stream.Body.String())
+
+	// Improving a hidden entry keeps it off the live stream.
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/admin/leaderboard/" + entryID + "/hide", token: admin.Token, expectedStatus: http.StatusOK})
+	hiddenSub := pubsub.Default().Subscribe("leaderboard:normal", 4)
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/game/record", token: player.Token, body: models.SaveGameRecordRequest{GameType: "normal", Score: 60, TimeInSeconds: 90}, expectedStatus: http.StatusOK})
+	select {
+	case data := <-hiddenSub.C():
+		t.Errorf("hidden entry was published: %s", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+	hiddenSub.Close()
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/users/contract_player", token: player.Token, expectedStatus: http.StatusOK}), &profile)
+	assert.Empty(t, profile.PersonalBests, "a hidden score is not a personal best")
+	assert.Empty(t, profile.RecentGames, "nor are games of its type recent games")
+	assert.Empty(t, profile.Ranks)
+	cc.run(t, contractCase{method: http.MethodPost, path: "/api/v1/admin/leaderboard/" + entryID + "/unhide", token: admin.Token, expectedStatus: http.StatusOK})
+
+	missingID := primitive.NewObjectID().Hex()
+	tests := []contractCase{
+		{method: http.MethodGet, path: "/api/v1/admin/users?q=contract", token: admin.Token, expectedStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/admin/audit", token: admin.Token, expectedStatus: http.StatusOK},
+		{method: http.MethodPost, path: "/api/v1/admin/tournaments/" + cup.ID.Hex() + "/cancel", token: admin.Token, expectedStatus: http.StatusConflict},
+		{method: http.MethodPost, path: "/api/v1/admin/tournaments/" + missingID + "/cancel", token: admin.Token, expectedStatus: http.StatusNotFound},
+		{method: http.MethodPost, path: "/api/v1/admin/leaderboard/" + entryID + "/hide", token: admin.Token, expectedStatus: http.StatusOK},
+		{method: http.MethodPost, path: "/api/v1/admin/leaderboard/" + entryID + "/unhide", token: admin.Token, expectedStatus: http.StatusOK},
+		{method: http.MethodDelete, path: "/api/v1/admin/leaderboard/" + entryID, token: admin.Token, expectedStatus: http.StatusOK},
+		{method: http.MethodDelete, path: "/api/v1/admin/leaderboard/" + missingID, token: admin.Token, expectedStatus: http.StatusNotFound},
+		{method: http.MethodPut, path: "/api/v1/admin/users/" + me.ID + "/username", token: admin.Token, body: models.RenameUserRequest{Username: "contract_renamed"}, expectedStatus: http.StatusOK},
+		{method: http.MethodDelete, path: "/api/v1/admin/users/" + me.ID + "/records", token: admin.Token, expectedStatus: http.StatusOK},
+		{method: http.MethodPost, path: "/api/v1/admin/users/" + me.ID + "/ban", token: admin.Token, expectedStatus: http.StatusOK},
+		{method: http.MethodPost, path: "/api/v1/admin/users/" + missingID + "/ban", token: admin.Token, expectedStatus: http.StatusNotFound},
+		{method: http.MethodPost, path: "/api/v1/auth/login", body: models.LoginRequest{Username: "contract_renamed", Password: "password123"}, expectedStatus: http.StatusForbidden},
+		{method: http.MethodGet, path: "/api/v1/game/records", token: player.Token, expectedStatus: http.StatusForbidden},
+		{method: http.MethodPost, path: "/api/v1/admin/users/" + me.ID + "/unban", token: admin.Token, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		cc.run(t, tt)
+	}
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/users/contract_renamed", token: player.Token, expectedStatus: http.StatusOK}), &profile)
+	assert.Empty(t, profile.PersonalBests)
+	assert.Empty(t, profile.RecentGames)
+	assert.Empty(t, profile.Achievements, "a reset revokes achievements")
+	decode(cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/achievements", expectedStatus: http.StatusOK}), &achievements)
+	for _, a := range achievements.Achievements {
+		assert.Zero(t, a.Unlocked, a.ID)
+	}
+
+	// Tokens keep the role they were issued with, but admin routes check the
+	// current one.
+	_, err = config.GetCollection("users").UpdateOne(ctx, bson.M{"username": "contract_admin"}, bson.M{"$set": bson.M{"role": models.RoleUser}})
+	require.NoError(t, err)
+	cc.run(t, contractCase{method: http.MethodGet, path: "/api/v1/admin/users", token: admin.Token, expectedStatus: http.StatusForbidden})
+}
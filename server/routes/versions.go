@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiVersion is the route table of one version of the REST API. A version
+// created with next inherits every route of the version before it, so a new
+// version only registers the handlers whose behaviour changed and the rest
+// fall through to the older implementation.
+type apiVersion struct {
+	name   string
+	parent *apiVersion
+	routes []apiRoute
+}
+
+type apiRoute struct {
+	method   string
+	path     string
+	handlers []gin.HandlerFunc
+}
+
+func newAPIVersion(name string) *apiVersion {
+	return &apiVersion{name: name}
+}
+
+// next starts a new version that inherits all routes of v.
+func (v *apiVersion) next(name string) *apiVersion {
+	return &apiVersion{name: name, parent: v}
+}
+
+// group returns a registrar for routes under prefix that run the given
+// middleware before their handler.
+func (v *apiVersion) group(prefix string, middleware ...gin.HandlerFunc) *versionGroup {
+	return &versionGroup{version: v, prefix: prefix, middleware: middleware}
+}
+
+// resolved returns the routes served by v: its own routes plus every
+// inherited route it does not override.
+func (v *apiVersion) resolved() []apiRoute {
+	var routes []apiRoute
+	if v.parent != nil {
+		for _, inherited := range v.parent.resolved() {
+			if !v.overrides(inherited) {
+				routes = append(routes, inherited)
+			}
+		}
+	}
+	return append(routes, v.routes...)
+}
+
+func (v *apiVersion) overrides(route apiRoute) bool {
+	for _, own := range v.routes {
+		if own.method == route.method && own.path == route.path {
+			return true
+		}
+	}
+	return false
+}
+
+// mount registers every route of v on the given router group.
+func (v *apiVersion) mount(group *gin.RouterGroup) {
+	for _, route := range v.resolved() {
+		group.Handle(route.method, route.path, route.handlers...)
+	}
+}
+
+type versionGroup struct {
+	version    *apiVersion
+	prefix     string
+	middleware []gin.HandlerFunc
+}
+
+func (g *versionGroup) group(prefix string, middleware ...gin.HandlerFunc) *versionGroup {
+	return &versionGroup{
+		version:    g.version,
+		prefix:     g.prefix + prefix,
+		middleware: append(append([]gin.HandlerFunc{}, g.middleware...), middleware...),
+	}
+}
+
+func (g *versionGroup) handle(method, path string, handler gin.HandlerFunc) {
+	handlers := append(append([]gin.HandlerFunc{}, g.middleware...), handler)
+	g.version.routes = append(g.version.routes, apiRoute{method: method, path: g.prefix + path, handlers: handlers})
+}
+
+func (g *versionGroup) GET(path string, handler gin.HandlerFunc) {
+	g.handle(http.MethodGet, path, handler)
+}
+
+func (g *versionGroup) POST(path string, handler gin.HandlerFunc) {
+	g.handle(http.MethodPost, path, handler)
+}
+
+func (g *versionGroup) PUT(path string, handler gin.HandlerFunc) {
+	g.handle(http.MethodPut, path, handler)
+}
+
+func (g *versionGroup) DELETE(path string, handler gin.HandlerFunc) {
+	g.handle(http.MethodDelete, path, handler)
+}
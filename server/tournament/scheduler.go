@@ -0,0 +1,74 @@
+package tournament
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// AdvanceFunc starts, advances and finishes the stored tournaments that are
+// due at now. Because the tournaments are persisted, a tick that fails or is
+// missed is simply caught up on the next one.
+type AdvanceFunc func(ctx context.Context, now time.Time) error
+
+const advanceTimeout = 30 * time.Second
+
+var (
+	schedulerMu   sync.Mutex
+	schedulerStop chan struct{}
+	schedulerWG   sync.WaitGroup
+)
+
+// StartScheduler calls advance every interval until StopScheduler.
+func StartScheduler(interval time.Duration, advance AdvanceFunc, logger *slog.Logger) {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+
+	stop := make(chan struct{})
+	schedulerStop = stop
+	schedulerWG.Add(1)
+	go func() {
+		defer schedulerWG.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), advanceTimeout)
+				if err := advance(ctx, now); err != nil {
+					logger.Error("failed to advance tournaments", slog.Any("error", err))
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// StopScheduler waits for a tick in progress to finish, giving up when ctx
+// is done.
+func StopScheduler(ctx context.Context) error {
+	schedulerMu.Lock()
+	if schedulerStop != nil {
+		close(schedulerStop)
+		schedulerStop = nil
+	}
+	schedulerMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		schedulerWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
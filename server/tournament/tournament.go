@@ -0,0 +1,336 @@
+// Package tournament pairs and ranks the players of a tournament. It keeps
+// no state of its own: the caller stores the players and rounds and passes
+// them back for every round, so a tournament can be picked up again by a
+// restarted process.
+//
+// In every round the players still in the tournament play the same board.
+// Single elimination and Swiss tournaments compare the two players of each
+// match on that board, while cumulative tournaments add up every player's
+// scores across all rounds.
+package tournament
+
+import (
+	"cmp"
+	"slices"
+)
+
+const (
+	FormatSingleElimination = "single_elimination"
+	FormatSwiss             = "swiss"
+	FormatCumulative        = "cumulative"
+)
+
+// Player is a player's standing in a tournament.
+type Player struct {
+	ID string
+	// Seed orders players in the bracket and breaks ties; 1 is the top
+	// seed.
+	Seed int
+	// Points counts match wins, with a bye worth a win and a Swiss draw
+	// worth half.
+	Points        float64
+	Score         int
+	TimeInSeconds int
+	Opponents     []string
+	Byes          int
+	// EliminatedIn is the round in which a player was knocked out of a
+	// single elimination tournament, or zero while they are still in it.
+	EliminatedIn int
+}
+
+// Match pairs players in a round. A match with a single player is a bye.
+// WinnerID is empty until the round is scored and stays empty for a draw.
+type Match struct {
+	Players  []string
+	WinnerID string
+}
+
+// Result is a player's game in a round. Played is false when the player did
+// not finish a game before the round closed.
+type Result struct {
+	Score         int
+	TimeInSeconds int
+	Played        bool
+}
+
+// Rounds returns how many rounds a tournament with the given number of
+// players lasts. Single elimination plays until one player is left; the
+// other formats play the configured number of rounds.
+func Rounds(format string, players, configured int) int {
+	if format != FormatSingleElimination {
+		return configured
+	}
+	rounds := 0
+	for size := 1; size < players; size *= 2 {
+		rounds++
+	}
+	return rounds
+}
+
+// Pair returns the matches of round, counting from 1. previous holds the
+// matches of the round before, whose winners meet in a bracket. Cumulative
+// tournaments have no matches.
+func Pair(format string, round int, players []Player, previous []Match) []Match {
+	switch format {
+	case FormatSingleElimination:
+		if round == 1 {
+			return bracket(players)
+		}
+		return advance(previous)
+	case FormatSwiss:
+		return swiss(players)
+	default:
+		return nil
+	}
+}
+
+// Plays reports whether a player takes part in a round with matches: they
+// are not eliminated and are not sitting out a bye.
+func Plays(format string, matches []Match, p Player) bool {
+	if p.EliminatedIn > 0 {
+		return false
+	}
+	if format == FormatCumulative {
+		return true
+	}
+	for _, m := range matches {
+		if len(m.Players) == 2 && slices.Contains(m.Players, p.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// bracket seeds the first round of a single elimination tournament so that
+// the top seeds meet as late as possible. When the field is not a power of
+// two the top seeds get byes.
+func bracket(players []Player) []Match {
+	seeded := slices.Clone(players)
+	slices.SortFunc(seeded, func(a, b Player) int { return cmp.Compare(a.Seed, b.Seed) })
+
+	order := []int{1}
+	for len(order) < len(seeded) {
+		next := make([]int, 0, 2*len(order))
+		for _, seed := range order {
+			next = append(next, seed, 2*len(order)+1-seed)
+		}
+		order = next
+	}
+
+	var matches []Match
+	for i := 0; i+1 < len(order); i += 2 {
+		var m Match
+		for _, seed := range order[i : i+2] {
+			if seed <= len(seeded) {
+				m.Players = append(m.Players, seeded[seed-1].ID)
+			}
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// advance pairs the winners of neighbouring matches of the previous round.
+func advance(previous []Match) []Match {
+	var matches []Match
+	for i := 0; i+1 < len(previous); i += 2 {
+		matches = append(matches, Match{Players: []string{previous[i].WinnerID, previous[i+1].WinnerID}})
+	}
+	return matches
+}
+
+// swiss pairs players with similar standings, avoiding rematches where it
+// can. With an odd number of players the lowest ranked player among those
+// with the fewest byes sits the round out, unless that would force a
+// rematch that another bye avoids.
+func swiss(players []Player) []Match {
+	ranked := Rank(FormatSwiss, players)
+	if len(ranked)%2 == 0 {
+		return pairSwiss(ranked)
+	}
+
+	candidates := make([]int, len(ranked))
+	for i := range candidates {
+		candidates[i] = len(ranked) - 1 - i
+	}
+	slices.SortStableFunc(candidates, func(a, b int) int { return cmp.Compare(ranked[a].Byes, ranked[b].Byes) })
+
+	var fallback []Match
+	for _, i := range candidates {
+		rest := slices.Delete(slices.Clone(ranked), i, i+1)
+		budget := swissSearchBudget
+		if matches, ok := pairWithoutRematches(rest, make([]bool, len(rest)), &budget); ok {
+			return append(matches, Match{Players: []string{ranked[i].ID}})
+		}
+		if fallback == nil {
+			fallback = append(pairSwiss(rest), Match{Players: []string{ranked[i].ID}})
+		}
+	}
+	return fallback
+}
+
+// swissSearchBudget bounds the search for pairings without rematches, which
+// can take exponential time when none exist.
+const swissSearchBudget = 10000
+
+// pairSwiss pairs an even number of ranked players, without rematches if
+// possible and otherwise greedily from the top.
+func pairSwiss(ranked []Player) []Match {
+	budget := swissSearchBudget
+	if matches, ok := pairWithoutRematches(ranked, make([]bool, len(ranked)), &budget); ok {
+		return matches
+	}
+
+	paired := make([]bool, len(ranked))
+	var matches []Match
+	for i, p := range ranked {
+		if paired[i] {
+			continue
+		}
+		opponent := -1
+		for j := i + 1; j < len(ranked); j++ {
+			if paired[j] {
+				continue
+			}
+			if opponent < 0 {
+				opponent = j
+			}
+			if !slices.Contains(p.Opponents, ranked[j].ID) {
+				opponent = j
+				break
+			}
+		}
+		paired[i], paired[opponent] = true, true
+		matches = append(matches, Match{Players: []string{p.ID, ranked[opponent].ID}})
+	}
+	return matches
+}
+
+// pairWithoutRematches pairs the highest ranked unpaired player with the
+// closest ranked player they have not met, backtracking when that leaves
+// the rest impossible to pair.
+func pairWithoutRematches(ranked []Player, paired []bool, budget *int) ([]Match, bool) {
+	i := slices.Index(paired, false)
+	if i < 0 {
+		return nil, true
+	}
+	paired[i] = true
+	defer func() { paired[i] = false }()
+
+	for j := i + 1; j < len(ranked); j++ {
+		if paired[j] || slices.Contains(ranked[i].Opponents, ranked[j].ID) {
+			continue
+		}
+		if *budget--; *budget < 0 {
+			return nil, false
+		}
+		paired[j] = true
+		rest, ok := pairWithoutRematches(ranked, paired, budget)
+		paired[j] = false
+		if ok {
+			return append([]Match{{Players: []string{ranked[i].ID, ranked[j].ID}}}, rest...), true
+		}
+	}
+	return nil, false
+}
+
+// Score applies the results of round to players and decides its matches.
+// A player who finished a game beats one who did not; otherwise the higher
+// score wins and then the faster time. Single elimination matches that are
+// still tied go to the better seed, while Swiss matches are drawn.
+func Score(format string, round int, players []Player, matches []Match, results map[string]Result) {
+	index := make(map[string]int, len(players))
+	for i, p := range players {
+		index[p.ID] = i
+		if r := results[p.ID]; r.Played && p.EliminatedIn == 0 {
+			players[i].Score += r.Score
+			players[i].TimeInSeconds += r.TimeInSeconds
+		}
+	}
+
+	for i, m := range matches {
+		if len(m.Players) == 1 {
+			p := &players[index[m.Players[0]]]
+			p.Byes++
+			p.Points++
+			matches[i].WinnerID = p.ID
+			continue
+		}
+
+		a, b := &players[index[m.Players[0]]], &players[index[m.Players[1]]]
+		a.Opponents = append(a.Opponents, b.ID)
+		b.Opponents = append(b.Opponents, a.ID)
+
+		ra, rb := results[a.ID], results[b.ID]
+		outcome := compareResults(ra, rb)
+		if outcome == 0 && format == FormatSingleElimination {
+			outcome = cmp.Compare(b.Seed, a.Seed)
+		}
+		switch {
+		case outcome > 0:
+			a.Points++
+			matches[i].WinnerID = a.ID
+			if format == FormatSingleElimination {
+				b.EliminatedIn = round
+			}
+		case outcome < 0:
+			b.Points++
+			matches[i].WinnerID = b.ID
+			if format == FormatSingleElimination {
+				a.EliminatedIn = round
+			}
+		case ra.Played:
+			a.Points += 0.5
+			b.Points += 0.5
+		}
+	}
+}
+
+// compareResults returns a positive number when a beats b, a negative one
+// when b beats a and zero for a tie.
+func compareResults(a, b Result) int {
+	switch {
+	case a.Played != b.Played:
+		if a.Played {
+			return 1
+		}
+		return -1
+	case a.Score != b.Score:
+		return cmp.Compare(a.Score, b.Score)
+	default:
+		return cmp.Compare(b.TimeInSeconds, a.TimeInSeconds)
+	}
+}
+
+// Rank returns the players in standings order. Single elimination ranks
+// players by how far they got, Swiss by points and cumulative tournaments by
+// total score. Remaining ties go to the faster total time and then the
+// better seed.
+func Rank(format string, players []Player) []Player {
+	ranked := slices.Clone(players)
+	slices.SortStableFunc(ranked, func(a, b Player) int {
+		var c int
+		switch format {
+		case FormatSingleElimination:
+			c = cmp.Or(
+				cmp.Compare(stillIn(b), stillIn(a)),
+				cmp.Compare(b.EliminatedIn, a.EliminatedIn),
+				cmp.Compare(b.Points, a.Points),
+				cmp.Compare(b.Score, a.Score),
+			)
+		case FormatSwiss:
+			c = cmp.Or(cmp.Compare(b.Points, a.Points), cmp.Compare(b.Score, a.Score))
+		default:
+			c = cmp.Compare(b.Score, a.Score)
+		}
+		return cmp.Or(c, cmp.Compare(a.TimeInSeconds, b.TimeInSeconds), cmp.Compare(a.Seed, b.Seed))
+	})
+	return ranked
+}
+
+func stillIn(p Player) int {
+	if p.EliminatedIn == 0 {
+		return 1
+	}
+	return 0
+}
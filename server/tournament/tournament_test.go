@@ -0,0 +1,137 @@
+package tournament
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPlayers(n int) []Player {
+	players := make([]Player, n)
+	for i := range players {
+		players[i] = Player{ID: fmt.Sprintf("p%d", i+1), Seed: i + 1}
+	}
+	return players
+}
+
+func matchPlayers(matches []Match) [][]string {
+	var ids [][]string
+	for _, m := range matches {
+		ids = append(ids, m.Players)
+	}
+	return ids
+}
+
+func rankedIDs(players []Player) []string {
+	var ids []string
+	for _, p := range players {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func TestRounds(t *testing.T) {
+	tests := []struct {
+		format  string
+		players int
+		rounds  int
+	}{
+		{format: FormatSingleElimination, players: 2, rounds: 1},
+		{format: FormatSingleElimination, players: 5, rounds: 3},
+		{format: FormatSingleElimination, players: 8, rounds: 3},
+		{format: FormatSwiss, players: 8, rounds: 4},
+		{format: FormatCumulative, players: 3, rounds: 4},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.rounds, Rounds(tt.format, tt.players, 4), "%s with %d players", tt.format, tt.players)
+	}
+}
+
+func TestSingleElimination(t *testing.T) {
+	players := newPlayers(5)
+
+	round1 := Pair(FormatSingleElimination, 1, players, nil)
+	require.Equal(t, [][]string{{"p1"}, {"p4", "p5"}, {"p2"}, {"p3"}}, matchPlayers(round1), "the top seeds get byes")
+
+	// p5 beats p4; the rest have byes.
+	Score(FormatSingleElimination, 1, players, round1, map[string]Result{
+		"p4": {Score: 10, Played: true},
+		"p5": {Score: 20, Played: true},
+	})
+	assert.Equal(t, 1, players[3].EliminatedIn, "p4 is out in round 1")
+	assert.Equal(t, []string{"p1", "p5", "p2", "p3"}, []string{round1[0].WinnerID, round1[1].WinnerID, round1[2].WinnerID, round1[3].WinnerID})
+
+	round2 := Pair(FormatSingleElimination, 2, players, round1)
+	require.Equal(t, [][]string{{"p1", "p5"}, {"p2", "p3"}}, matchPlayers(round2))
+
+	// p1 and p5 tie on score and time, so the better seed goes through. p3
+	// did not finish a game and loses to p2's lower score.
+	Score(FormatSingleElimination, 2, players, round2, map[string]Result{
+		"p1": {Score: 30, TimeInSeconds: 40, Played: true},
+		"p5": {Score: 30, TimeInSeconds: 40, Played: true},
+		"p2": {Score: 5, Played: true},
+	})
+	assert.Equal(t, "p1", round2[0].WinnerID)
+	assert.Equal(t, "p2", round2[1].WinnerID)
+
+	final := Pair(FormatSingleElimination, 3, players, round2)
+	require.Equal(t, [][]string{{"p1", "p2"}}, matchPlayers(final))
+	Score(FormatSingleElimination, 3, players, final, map[string]Result{
+		"p1": {Score: 50, TimeInSeconds: 90, Played: true},
+		"p2": {Score: 50, TimeInSeconds: 60, Played: true},
+	})
+	assert.Equal(t, "p2", final[0].WinnerID, "the faster time wins a tied score")
+
+	ranked := Rank(FormatSingleElimination, players)
+	assert.Equal(t, []string{"p2", "p1", "p5", "p3", "p4"}, rankedIDs(ranked))
+	assert.False(t, Plays(FormatSingleElimination, final, players[3]))
+}
+
+func TestSwiss(t *testing.T) {
+	players := newPlayers(5)
+
+	round1 := Pair(FormatSwiss, 1, players, nil)
+	require.Equal(t, [][]string{{"p1", "p2"}, {"p3", "p4"}, {"p5"}}, matchPlayers(round1))
+	assert.False(t, Plays(FormatSwiss, round1, players[4]), "p5 has a bye")
+
+	Score(FormatSwiss, 1, players, round1, map[string]Result{
+		"p1": {Score: 10, Played: true},
+		"p2": {Score: 20, Played: true},
+		"p3": {Score: 15, TimeInSeconds: 30, Played: true},
+		"p4": {Score: 15, TimeInSeconds: 30, Played: true},
+	})
+	assert.Equal(t, "p2", round1[0].WinnerID)
+	assert.Empty(t, round1[1].WinnerID, "a tie is a draw")
+	assert.Equal(t, []float64{0, 1, 0.5, 0.5, 1}, []float64{players[0].Points, players[1].Points, players[2].Points, players[3].Points, players[4].Points})
+
+	// p1 is last without a bye. Pairing p2 with p5 would leave p3 and p4 to
+	// meet again, so the pairings shift down.
+	round2 := Pair(FormatSwiss, 2, players, round1)
+	assert.Equal(t, [][]string{{"p2", "p3"}, {"p5", "p4"}, {"p1"}}, matchPlayers(round2))
+
+	// Players who have nobody new left to meet play a rematch.
+	players = newPlayers(2)
+	players[0].Opponents, players[1].Opponents = []string{"p2"}, []string{"p1"}
+	assert.Equal(t, [][]string{{"p1", "p2"}}, matchPlayers(Pair(FormatSwiss, 2, players, nil)))
+}
+
+func TestCumulative(t *testing.T) {
+	players := newPlayers(3)
+	assert.Empty(t, Pair(FormatCumulative, 1, players, nil))
+	assert.True(t, Plays(FormatCumulative, nil, players[0]))
+
+	Score(FormatCumulative, 1, players, nil, map[string]Result{
+		"p1": {Score: 10, TimeInSeconds: 50, Played: true},
+		"p2": {Score: 40, TimeInSeconds: 50, Played: true},
+		"p3": {Score: 30, TimeInSeconds: 20, Played: true},
+	})
+	Score(FormatCumulative, 2, players, nil, map[string]Result{
+		"p1": {Score: 30, TimeInSeconds: 10, Played: true},
+		"p3": {Score: 10, TimeInSeconds: 20, Played: true},
+	})
+
+	assert.Equal(t, []string{"p3", "p2", "p1"}, rankedIDs(Rank(FormatCumulative, players)), "equal totals go to the faster player")
+}